@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// tokenCookie keeps the token of the token mode once the printed URL has
+// been opened
+const tokenCookie = "file_viewer_token"
+
+// authenticator checks the credentials of every request
+type authenticator struct {
+	mode    string
+	token   string
+	users   map[string]string
+	header  string
+	proxies []*net.IPNet
+
+	// Accepted Basic credentials by hash: bcrypt is too slow to run on
+	// every image and script of a page
+	verified sync.Map
+}
+
+// newAuthenticator checks an auth setting; it returns nil when auth is off
+func newAuthenticator(cfg *AuthConfig) (*authenticator, error) {
+	if cfg == nil || cfg.Mode == "" || cfg.Mode == "none" {
+		return nil, nil
+	}
+	a := &authenticator{mode: cfg.Mode}
+	switch cfg.Mode {
+	case "token":
+		a.token = cfg.Token
+		if a.token == "" {
+			a.token = newToken()
+		}
+	case "basic":
+		if len(cfg.Users) == 0 {
+			return nil, fmt.Errorf("auth: the basic mode needs users")
+		}
+		for user, hash := range cfg.Users {
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				return nil, fmt.Errorf("auth: user %s: not a bcrypt hash, see file-viewer hash-password", user)
+			}
+		}
+		a.users = cfg.Users
+	case "proxy":
+		a.header = cfg.ProxyHeader
+		if a.header == "" {
+			a.header = "X-Forwarded-User"
+		}
+		proxies := cfg.TrustedProxies
+		if len(proxies) == 0 {
+			proxies = []string{"127.0.0.0/8", "::1/128"}
+		}
+		for _, p := range proxies {
+			if !strings.Contains(p, "/") {
+				if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+					p += "/32"
+				} else {
+					p += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(p)
+			if err != nil {
+				return nil, fmt.Errorf("auth: trusted proxy %q: %w", p, err)
+			}
+			a.proxies = append(a.proxies, network)
+		}
+	default:
+		return nil, fmt.Errorf("auth: unknown mode %q, want token, basic or proxy", cfg.Mode)
+	}
+	return a, nil
+}
+
+// newToken returns 256 random bits in URL-safe base64
+func newToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// middleware refuses the requests without valid credentials
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Health checks come from service managers without credentials
+		if r.URL.Path == "/healthz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var ok bool
+		switch a.mode {
+		case "token":
+			if t := r.URL.Query().Get("token"); t != "" && a.validToken(t) {
+				a.acceptToken(w, r)
+				return
+			}
+			ok = a.tokenRequest(r)
+		case "basic":
+			ok = a.basicRequest(r)
+			if !ok {
+				w.Header().Set("WWW-Authenticate", `Basic realm="File Viewer", charset="UTF-8"`)
+			}
+		case "proxy":
+			ok = a.proxyRequest(r)
+		}
+		if !ok {
+			msg := "Authentication required"
+			if a.mode == "token" {
+				msg += ": open the URL with ?token= printed by file-viewer at startup"
+			}
+			writeError(w, r, http.StatusUnauthorized, msg)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *authenticator) validToken(t string) bool {
+	return subtle.ConstantTimeCompare([]byte(t), []byte(a.token)) == 1
+}
+
+// acceptToken stores the token of the URL in a cookie, then redirects to
+// the URL without it so that it stays out of the history and the logs
+func (a *authenticator) acceptToken(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     tokenCookie,
+		Value:    a.token,
+		Path:     "/",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	u := *r.URL
+	q := u.Query()
+	q.Del("token")
+	u.RawQuery = q.Encode()
+	http.Redirect(w, r, u.RequestURI(), http.StatusSeeOther)
+}
+
+// tokenRequest accepts the cookie, or a Bearer token for scripts
+func (a *authenticator) tokenRequest(r *http.Request) bool {
+	if c, err := r.Cookie(tokenCookie); err == nil && a.validToken(c.Value) {
+		return true
+	}
+	t, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && a.validToken(t)
+}
+
+func (a *authenticator) basicRequest(r *http.Request) bool {
+	user, password, found := r.BasicAuth()
+	if !found {
+		return false
+	}
+	key := sha256.Sum256([]byte(user + "\x00" + password))
+	if _, ok := a.verified.Load(key); ok {
+		return true
+	}
+	hash, known := a.users[user]
+	if !known || bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		return false
+	}
+	a.verified.Store(key, true)
+	return true
+}
+
+// proxyRequest accepts requests from a trusted proxy naming a user
+func (a *authenticator) proxyRequest(r *http.Request) bool {
+	if r.Header.Get(a.header) == "" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	for _, network := range a.proxies {
+		if ip != nil && network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// runHashPassword implements "file-viewer hash-password": it reads a
+// password on stdin and prints its bcrypt hash for auth.users
+func runHashPassword(args []string) int {
+	if len(args) > 0 {
+		fmt.Fprintln(os.Stderr, "Usage: file-viewer hash-password < password.txt")
+		return 2
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	password := strings.TrimRight(line, "\r\n")
+	if password == "" {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
+		} else {
+			fmt.Fprintln(os.Stderr, "Error: empty password")
+		}
+		return 1
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	fmt.Println(string(hash))
+	return 0
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ===== Authentication Tests =====
+
+// authServer wraps a handler answering 200 with the auth middleware
+func authServer(t *testing.T, cfg *AuthConfig) (*authenticator, http.Handler) {
+	t.Helper()
+	a, err := newAuthenticator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, a.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	for _, cfg := range []*AuthConfig{nil, {}, {Mode: "none"}} {
+		if a, err := newAuthenticator(cfg); a != nil || err != nil {
+			t.Errorf("%+v: auth should be off", cfg)
+		}
+	}
+	for _, cfg := range []*AuthConfig{
+		{Mode: "password"},
+		{Mode: "basic"},
+		{Mode: "basic", Users: map[string]string{"ann": "secret"}},
+		{Mode: "proxy", TrustedProxies: []string{"10.0.0.0/33"}},
+	} {
+		if _, err := newAuthenticator(cfg); err == nil {
+			t.Errorf("%+v should be refused", cfg)
+		}
+	}
+	a, err := newAuthenticator(&AuthConfig{Mode: "token"})
+	if err != nil || len(a.token) < 40 {
+		t.Errorf("a token should be generated, got %+v, %v", a, err)
+	}
+}
+
+func TestTokenAuth(t *testing.T) {
+	_, server := authServer(t, &AuthConfig{Mode: "token", Token: "s3cret"})
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{"/tmp/a.md", "/asset?path=/a.png", "/cdn/cdn.jsdelivr.net/x.js", "/tmp/a.md?token=wrong"} {
+		if rec := serve(httptest.NewRequest("GET", target, nil)); rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: status = %d, want 401", target, rec.Code)
+		}
+	}
+
+	rec := serve(httptest.NewRequest("GET", "/tmp/a.md?line=3&token=s3cret", nil))
+	if rec.Code != http.StatusSeeOther || rec.Header().Get("Location") != "/tmp/a.md?line=3" {
+		t.Fatalf("token URL: status = %d, Location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != tokenCookie || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteStrictMode {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+
+	req := httptest.NewRequest("GET", "/files?dir=/tmp", nil)
+	req.AddCookie(cookies[0])
+	if rec := serve(req); rec.Code != http.StatusOK {
+		t.Errorf("cookie: status = %d", rec.Code)
+	}
+	req = httptest.NewRequest("GET", "/files?dir=/tmp", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	if rec := serve(req); rec.Code != http.StatusOK {
+		t.Errorf("bearer: status = %d", rec.Code)
+	}
+	req = httptest.NewRequest("GET", "/files?dir=/tmp", nil)
+	req.AddCookie(&http.Cookie{Name: tokenCookie, Value: "guess"})
+	if rec := serve(req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("wrong cookie: status = %d", rec.Code)
+	}
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("hunter2"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, server := authServer(t, &AuthConfig{Mode: "basic", Users: map[string]string{"ann": string(hash)}})
+
+	for _, tt := range []struct {
+		user, password string
+		status         int
+	}{
+		{"ann", "hunter2", http.StatusOK},
+		{"ann", "hunter2", http.StatusOK},
+		{"ann", "hunter3", http.StatusUnauthorized},
+		{"bob", "hunter2", http.StatusUnauthorized},
+		{"", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/asset?path=/a.png", nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s:%s: status = %d, want %d", tt.user, tt.password, rec.Code, tt.status)
+		}
+		if rec.Code == http.StatusUnauthorized && !strings.HasPrefix(rec.Header().Get("WWW-Authenticate"), "Basic ") {
+			t.Error("a failed request should ask for Basic credentials")
+		}
+	}
+	count := 0
+	a.verified.Range(func(k, v any) bool { count++; return true })
+	if count != 1 {
+		t.Errorf("%d verified credentials cached, want 1", count)
+	}
+}
+
+func TestProxyAuth(t *testing.T) {
+	_, server := authServer(t, &AuthConfig{Mode: "proxy", ProxyHeader: "X-Auth-User", TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5"}})
+	for _, tt := range []struct {
+		remote, user string
+		status       int
+	}{
+		{"10.1.2.3:5000", "ann", http.StatusOK},
+		{"192.168.1.5:5000", "ann", http.StatusOK},
+		{"192.168.1.6:5000", "ann", http.StatusUnauthorized},
+		{"10.1.2.3:5000", "", http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest("GET", "/tmp/a.md", nil)
+		req.RemoteAddr = tt.remote
+		if tt.user != "" {
+			req.Header.Set("X-Auth-User", tt.user)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s as %q: status = %d, want %d", tt.remote, tt.user, rec.Code, tt.status)
+		}
+	}
+
+	_, server = authServer(t, &AuthConfig{Mode: "proxy"})
+	req := httptest.NewRequest("GET", "/tmp/a.md", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-User", "ann")
+	rec := httptest.NewRecorder()
+	server.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("loopback proxy with X-Forwarded-User: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,487 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const searchTextMax = 5000 // Characters of each page kept in the search index
+
+var (
+	siteAttrRe   = regexp.MustCompile(`(href|src)="([^"]*)"`)
+	siteCSSURLRe = regexp.MustCompile(`url\(['"]?([^'")]+)['"]?\)`)
+	siteH1Re     = regexp.MustCompile(`(?s)<h1[^>]*>(.*?)</h1>`)
+	siteTagRe    = regexp.MustCompile(`(?s)<script.*?</script>|<style.*?</style>|<select.*?</select>|<button.*?</button>|<a[^>]*class="anchor-link"[^>]*>#</a>|<[^>]+>`)
+	siteSpaceRe  = regexp.MustCompile(`\s+`)
+)
+
+// Search and navigation added to every page of a static site
+const siteScript = `<script src="%ssearch-index.js"></script>
+<script>
+const SITE_ROOT = '%s';
+function siteSearch(query) {
+    const results = document.getElementById('site-search-results');
+    results.textContent = '';
+    const terms = query.toLowerCase().split(/\s+/).filter(Boolean);
+    if (!terms.length || typeof SEARCH_INDEX === 'undefined') return;
+    SEARCH_INDEX.filter(e => terms.every(t => (e.title + ' ' + e.path + ' ' + (e.tags || []).map(t => '#' + t).join(' ') + ' ' + e.text).toLowerCase().includes(t)))
+        .slice(0, 30).forEach(e => {
+            const a = document.createElement('a');
+            a.href = SITE_ROOT + e.url;
+            a.textContent = e.title;
+            const small = document.createElement('small');
+            small.textContent = e.path + (e.date ? ' · ' + e.date : '');
+            a.appendChild(small);
+            results.appendChild(a);
+        });
+}
+</script>
+`
+
+// searchEntry is a page of the static site search index
+type searchEntry struct {
+	Title string   `json:"title"`
+	Path  string   `json:"path"` // Source file, relative to the root
+	URL   string   `json:"url"`  // Page, relative to the site root
+	Text  string   `json:"text"`
+	Tags  []string `json:"tags,omitempty"` // Markdown front matter
+	Date  string   `json:"date,omitempty"`
+}
+
+// siteBuilder writes the static site of a directory tree
+type siteBuilder struct {
+	root, out string
+	copyCDN   bool
+
+	pages    map[string]string // Source path -> page, relative to out
+	raw      map[string]bool   // Source files copied as they are
+	dirs     []string
+	cdn      map[string]string // /cdn/ path -> URL relative to out, or https URL
+	index    []searchEntry
+	warnings []string
+}
+
+func newSiteBuilder(root, out string) *siteBuilder {
+	return &siteBuilder{
+		root:    root,
+		out:     out,
+		copyCDN: true,
+		pages:   make(map[string]string),
+		raw:     make(map[string]bool),
+		cdn:     make(map[string]string),
+	}
+}
+
+// rel returns a source path relative to the root, with forward slashes
+func (b *siteBuilder) rel(p string) string {
+	r, _ := filepath.Rel(b.root, p)
+	return filepath.ToSlash(r)
+}
+
+// pageName returns the page of a text file: guide.md becomes guide.html
+// unless the tree has its own guide.html, other files get .html appended
+func (b *siteBuilder) pageName(p string) string {
+	rel := b.rel(p)
+	if isMarkdownFile(p) {
+		stem := strings.TrimSuffix(p, filepath.Ext(p))
+		if _, err := os.Stat(stem + ".html"); os.IsNotExist(err) {
+			return strings.TrimSuffix(rel, path.Ext(rel)) + ".html"
+		}
+	}
+	return rel + ".html"
+}
+
+// scan sorts the files of the tree into pages and raw copies; hidden files
+// and the output directory are skipped
+func (b *siteBuilder) scan() error {
+	return filepath.WalkDir(b.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != b.root && (strings.HasPrefix(d.Name(), ".") || p == b.out) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			b.dirs = append(b.dirs, p)
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		kind, err := sniffFile(p)
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		// Pages need a server past the size limit, HTML is served as is
+		if !kind.Text || info.Size() > MaxViewableSize || ext == ".html" || ext == ".htm" {
+			b.raw[p] = true
+		} else {
+			b.pages[p] = b.pageName(p)
+		}
+		return nil
+	})
+}
+
+// relativeURL returns the URL of target (relative to out) from the page at from
+func relativeURL(from, target string) string {
+	r, err := filepath.Rel(path.Dir("/"+from), "/"+target)
+	if err != nil {
+		return target
+	}
+	return (&url.URL{Path: filepath.ToSlash(r)}).EscapedPath()
+}
+
+// siteURL returns the URL, relative to out, of a source file or directory;
+// links go to pages, sources of images and scripts to raw copies
+func (b *siteBuilder) siteURL(target, attr string) (string, bool) {
+	if target != b.root && !strings.HasPrefix(target, b.root+string(filepath.Separator)) {
+		return "", false
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return "", false
+	}
+	if info.IsDir() {
+		return path.Join(b.rel(target), "index.html"), true
+	}
+	if page, ok := b.pages[target]; ok && attr == "href" {
+		return page, true
+	}
+	if _, ok := b.pages[target]; !ok && !b.raw[target] {
+		// Hidden files are not published
+		return "", false
+	}
+	b.raw[target] = true
+	return b.rel(target), true
+}
+
+// cdnURL copies a /cdn/ resource into _cdn/, with the files its stylesheet
+// refers to; when that fails the page loads it from the CDN
+func (b *siteBuilder) cdnURL(cdnPath string) string {
+	if u, ok := b.cdn[cdnPath]; ok {
+		return u
+	}
+	u := "https://" + cdnPath
+	if b.copyCDN {
+		if data, err := fetchCDN(cdnPath); err == nil && b.writeFile(path.Join("_cdn", cdnPath), data) == nil {
+			u = path.Join("_cdn", cdnPath)
+			if strings.HasSuffix(cdnPath, ".css") {
+				for _, m := range siteCSSURLRe.FindAllStringSubmatch(string(data), -1) {
+					ref := strings.SplitN(strings.SplitN(m[1], "?", 2)[0], "#", 2)[0]
+					if strings.Contains(ref, ":") || strings.HasPrefix(ref, "/") {
+						continue
+					}
+					dep := path.Join(path.Dir(cdnPath), ref)
+					if depData, err := fetchCDN(dep); err == nil {
+						b.writeFile(path.Join("_cdn", dep), depData)
+					}
+				}
+			}
+		} else {
+			b.warnings = append(b.warnings, "CDN resource left remote: "+cdnPath)
+		}
+	}
+	b.cdn[cdnPath] = u
+	return u
+}
+
+// rewriteLinks turns the server URLs of a page into relative site URLs:
+// /asset?path=, /cdn/, absolute file paths and links relative to srcDir
+func (b *siteBuilder) rewriteLinks(page, srcDir, pageRel string) string {
+	return siteAttrRe.ReplaceAllStringFunc(page, func(m string) string {
+		parts := siteAttrRe.FindStringSubmatch(m)
+		attr, value := parts[1], html.UnescapeString(parts[2])
+
+		var target, fragment string
+		switch {
+		case value == "" || strings.HasPrefix(value, "#") || strings.Contains(value, ":"):
+			return m
+		case strings.HasPrefix(value, "/cdn/"):
+			u := b.cdnURL(strings.TrimPrefix(value, "/cdn/"))
+			if !strings.HasPrefix(u, "https://") {
+				u = relativeURL(pageRel, u)
+			}
+			return attr + `="` + html.EscapeString(u) + `"`
+		case strings.HasPrefix(value, "/asset?path="):
+			target = strings.TrimPrefix(value, "/asset?path=")
+			if unescaped, err := url.QueryUnescape(target); err == nil && !strings.Contains(target, "/") {
+				target = unescaped
+			}
+			attr = "src"
+		default:
+			if i := strings.IndexAny(value, "?#"); i >= 0 {
+				value, fragment = value[:i], value[i:]
+				if strings.HasPrefix(fragment, "?") {
+					fragment = ""
+				}
+			}
+			if decoded, err := url.PathUnescape(value); err == nil {
+				value = decoded
+			}
+			target = value
+			if !strings.HasPrefix(value, "/") {
+				target = filepath.Join(srcDir, value)
+			}
+		}
+
+		u, ok := b.siteURL(filepath.Clean(target), attr)
+		if !ok {
+			if strings.HasPrefix(value, "/") {
+				b.warnings = append(b.warnings, fmt.Sprintf("%s: link outside the site: %s", pageRel, value))
+			}
+			return m
+		}
+		return parts[1] + `="` + html.EscapeString(relativeURL(pageRel, u)+fragment) + `"`
+	})
+}
+
+// finish turns a buildHTML page into a static one: body class, sidebar
+// navigation and search, relative links
+func (b *siteBuilder) finish(page, srcDir, pageRel string) string {
+	prefix := strings.Repeat("../", strings.Count(pageRel, "/"))
+	up := relativeURL(pageRel, path.Join(path.Dir(pageRel), "index.html"))
+	if path.Base(pageRel) == "index.html" && path.Dir(pageRel) != "." {
+		up = "../index.html"
+	}
+	nav := fmt.Sprintf(`<nav class="site-nav">
+                    <a href="%sindex.html">🏠 Home</a>
+                    <a href="%s">📁 Up</a>
+                    <input type="search" class="site-search" placeholder="Search the site..." oninput="siteSearch(this.value)">
+                    <div class="site-search-results" id="site-search-results"></div>
+                </nav>`, prefix, up)
+
+	page = stripNonce(page)
+	page = strings.Replace(page, "<body>", `<body class="static-site">`, 1)
+	page = strings.Replace(page, "<!-- Populated by JavaScript -->", nav, 1)
+	page = b.rewriteLinks(page, srcDir, pageRel)
+	if i := strings.LastIndex(page, "</body>"); i >= 0 {
+		page = page[:i] + fmt.Sprintf(siteScript, prefix, prefix) + page[i:]
+	}
+	return page
+}
+
+// writeFile writes a file of the site, creating its directory
+func (b *siteBuilder) writeFile(rel string, data []byte) error {
+	dst := filepath.Join(b.out, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(dst, data, 0644)
+}
+
+// copyFile copies a source file to the site
+func (b *siteBuilder) copyFile(src string) error {
+	dst := filepath.Join(b.out, filepath.FromSlash(b.rel(src)))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// pageText returns the title and the plain text of rendered content
+func pageText(content, fallback string) (string, string) {
+	title := fallback
+	if m := siteH1Re.FindStringSubmatch(content); m != nil {
+		if t := strings.TrimSpace(html.UnescapeString(siteTagRe.ReplaceAllString(m[1], ""))); t != "" {
+			title = t
+		}
+	}
+	text := html.UnescapeString(siteTagRe.ReplaceAllString(content, " "))
+	text = strings.TrimSpace(siteSpaceRe.ReplaceAllString(text, " "))
+	if r := []rune(text); len(r) > searchTextMax {
+		text = string(r[:searchTextMax])
+	}
+	return title, text
+}
+
+// buildPage renders a text file to its page and indexes it
+func (b *siteBuilder) buildPage(src string) error {
+	rel, pageRel := b.rel(src), b.pages[src]
+	content, contentClass := renderFile(src)
+	title, text := pageText(content, filepath.Base(src))
+	fm := readFrontMatter(src)
+	if fm.Title() != "" {
+		title = fm.Title()
+	}
+	b.index = append(b.index, searchEntry{Title: title, Path: rel, URL: pageRel, Text: text, Tags: fm.Tags(), Date: fm.Date()})
+
+	page := buildHTML(title, "/"+rel, content, contentClass)
+	return b.writeFile(pageRel, []byte(b.finish(page, filepath.Dir(src), pageRel)))
+}
+
+// buildIndex writes the index.html of a directory that has none: its
+// entries, followed by its README when there is one
+func (b *siteBuilder) buildIndex(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	pageRel := path.Join(b.rel(dir), "index.html")
+
+	var sb strings.Builder
+	sb.WriteString(`<ul class="directory-listing">` + "\n")
+	readme := ""
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if !strings.HasPrefix(e.Name(), ".") && p != b.out {
+				sb.WriteString(fmt.Sprintf(`<li>📁 <a href="%s">%s/</a></li>`+"\n", html.EscapeString(relativeURL(pageRel, path.Join(b.rel(p), "index.html"))), html.EscapeString(e.Name())))
+			}
+			continue
+		}
+		target := b.pages[p]
+		if target == "" && b.raw[p] {
+			target = b.rel(p)
+		}
+		if target == "" {
+			continue
+		}
+		if strings.EqualFold(e.Name(), "readme.md") {
+			readme = p
+		}
+		sb.WriteString(fmt.Sprintf(`<li>📄 <a href="%s">%s</a>%s</li>`+"\n", html.EscapeString(relativeURL(pageRel, target)), html.EscapeString(e.Name()), readFrontMatter(p).summary()))
+	}
+	sb.WriteString("</ul>\n")
+
+	contentClass := "markdown directory"
+	if readme != "" {
+		content, _ := renderFile(readme)
+		sb.WriteString("<hr>\n" + content)
+	}
+
+	name := filepath.Base(dir)
+	title, text := pageText(sb.String(), name+"/")
+	b.index = append(b.index, searchEntry{Title: title, Path: b.rel(dir) + "/", URL: pageRel, Text: text})
+
+	page := buildHTML(name, "/"+b.rel(dir), sb.String(), contentClass)
+	return b.writeFile(pageRel, []byte(b.finish(page, dir, pageRel)))
+}
+
+// build writes the whole site
+func (b *siteBuilder) build() error {
+	if err := b.scan(); err != nil {
+		return err
+	}
+
+	sources := make([]string, 0, len(b.pages))
+	for p := range b.pages {
+		sources = append(sources, p)
+	}
+	sort.Strings(sources)
+	taken := make(map[string]bool)
+	for _, p := range sources {
+		if err := b.buildPage(p); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		taken[b.pages[p]] = true
+	}
+	for p := range b.raw {
+		taken[b.rel(p)] = true
+	}
+
+	for _, dir := range b.dirs {
+		if taken[path.Join(b.rel(dir), "index.html")] {
+			continue
+		}
+		if err := b.buildIndex(dir); err != nil {
+			return fmt.Errorf("%s: %w", dir, err)
+		}
+	}
+
+	raw := make([]string, 0, len(b.raw))
+	for p := range b.raw {
+		raw = append(raw, p)
+	}
+	sort.Strings(raw)
+	for _, p := range raw {
+		if err := b.copyFile(p); err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+	}
+
+	sort.Slice(b.index, func(i, j int) bool { return b.index[i].URL < b.index[j].URL })
+	data, err := json.Marshal(b.index)
+	if err != nil {
+		return err
+	}
+	if err := b.writeFile("search-index.json", data); err != nil {
+		return err
+	}
+	// Browsers refuse fetch() on file:// URLs, a script loads everywhere
+	return b.writeFile("search-index.js", []byte("const SEARCH_INDEX = "+string(data)+";\n"))
+}
+
+// runBuild implements "file-viewer build --root dir --out dir"
+func runBuild(args []string) int {
+	flags := flag.NewFlagSet("build", flag.ContinueOnError)
+	root := flags.String("root", ".", "directory to publish")
+	out := flags.String("out", "site", "output directory")
+	copyCDN := flags.Bool("copy-cdn", true, "copy CDN scripts and styles into the site instead of linking them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	absRoot, err := filepath.Abs(*root)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	absOut, err := filepath.Abs(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if absOut == absRoot {
+		fmt.Fprintln(os.Stderr, "Error: --out must differ from --root")
+		return 2
+	}
+	if info, err := os.Stat(absRoot); err != nil || !info.IsDir() {
+		fmt.Fprintf(os.Stderr, "Error: %s is not a directory\n", absRoot)
+		return 1
+	}
+
+	b := newSiteBuilder(absRoot, absOut)
+	b.copyCDN = *copyCDN
+	if err := b.build(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	for _, w := range b.warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+	fmt.Printf("Built %d pages and %d files into %s\n", len(b.index), len(b.raw), absOut)
+	return 0
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Static Site Tests =====
+
+func TestBuildSite(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "docs")
+	writeFiles(t, root, map[string]string{
+		"README.md":    "# Project Docs\n\nRead the [guide](sub/guide.md#setup).\n\n![Logo](img/logo.png)\n",
+		"sub/guide.md": "# Guide\n\n## Setup\n\nBack to the [readme](../README.md), see " + "[outside](/etc/hosts).\n",
+		"img/logo.png": string(testPNG),
+		"page.html":    "<p>raw</p>",
+		".git/config":  "[core]",
+	})
+	out := filepath.Join(root, "_site")
+
+	b := newSiteBuilder(root, out)
+	b.copyCDN = false
+	if err := b.build(); err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string) string {
+		data, err := os.ReadFile(filepath.Join(out, name))
+		if err != nil {
+			t.Fatalf("missing %s: %v", name, err)
+		}
+		return string(data)
+	}
+
+	readme := read("README.html")
+	for _, want := range []string{
+		`<body class="static-site">`,
+		`href="sub/guide.html#setup"`,
+		`src="img/logo.png"`,
+		`src="search-index.js"`,
+		`href="https://cdnjs.cloudflare.com/ajax/libs/prism/`,
+	} {
+		if !strings.Contains(readme, want) {
+			t.Errorf("README.html missing %q", want)
+		}
+	}
+	if strings.Contains(readme, "/asset?path=") || strings.Contains(readme, `"/cdn/`) {
+		t.Error("README.html still refers to server URLs")
+	}
+
+	guide := read("sub/guide.html")
+	for _, want := range []string{`href="../README.html"`, `href="../index.html">🏠 Home`, `href="/etc/hosts"`} {
+		if !strings.Contains(guide, want) {
+			t.Errorf("sub/guide.html missing %q", want)
+		}
+	}
+	if len(b.warnings) != 1 || !strings.Contains(b.warnings[0], "/etc/hosts") {
+		t.Errorf("warnings = %v, want the link outside the site", b.warnings)
+	}
+
+	index := read("index.html")
+	for _, want := range []string{`<a href="README.html">README.md</a>`, `<a href="sub/index.html">sub/</a>`, `<a href="page.html">page.html</a>`, "Project Docs"} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html missing %q", want)
+		}
+	}
+	if strings.Contains(index, ".git") || strings.Contains(index, "_site") {
+		t.Error("Hidden files and the output directory should not be listed")
+	}
+	if read("page.html") != "<p>raw</p>" || read("img/logo.png") != string(testPNG) {
+		t.Error("HTML files and images should be copied as they are")
+	}
+
+	var entries []searchEntry
+	if err := json.Unmarshal([]byte(read("search-index.json")), &entries); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, e := range entries {
+		if e.URL == "sub/guide.html" {
+			found = e.Title == "Guide" && strings.Contains(e.Text, "Setup")
+		}
+	}
+	if !found {
+		t.Errorf("search index has no entry for the guide: %+v", entries)
+	}
+	if !strings.HasPrefix(read("search-index.js"), "const SEARCH_INDEX = [") {
+		t.Error("search-index.js should define SEARCH_INDEX")
+	}
+}
+
+func TestPageName(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.md": "", "b.md": "", "b.html": "", "c.yaml": ""})
+	b := newSiteBuilder(root, filepath.Join(root, "site"))
+	for name, want := range map[string]string{"a.md": "a.html", "b.md": "b.md.html", "c.yaml": "c.yaml.html"} {
+		if got := b.pageName(filepath.Join(root, name)); got != want {
+			t.Errorf("pageName(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
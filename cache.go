@@ -0,0 +1,150 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// renderVersion changes with every start of the server: a new binary or
+// config file may render the same file differently
+var renderVersion = strconv.FormatInt(time.Now().UnixNano(), 36)
+
+// renderCacheSize bounds the rendered pages kept in memory, in bytes
+const renderCacheSize = 64 << 20
+
+// renderedFiles holds the latest renderings of files, by path
+var renderedFiles = newRenderCache(renderCacheSize)
+
+// etagOf returns a weak ETag hashing values
+func etagOf(values ...interface{}) string {
+	h := fnv.New64a()
+	for _, v := range values {
+		fmt.Fprint(h, v, "\x00")
+	}
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// fileETag returns the ETag of a file served as it is
+func fileETag(filePath string, info os.FileInfo) string {
+	return etagOf(filePath, info.ModTime().UnixNano(), info.Size())
+}
+
+// renderETag returns the ETag of the rendering of a file. Markdown pages
+// resolve wiki-links and list backlinks from other notes, so they change with
+// the generation of their links in the vault index too. The last index is
+// used as it is: a 304 never waits for the vault to be walked.
+func renderETag(filePath string, info os.FileInfo) string {
+	var linksGen uint64
+	if isMarkdownFile(filePath) {
+		if v := lastVault(findVaultRoot(filepath.Dir(filePath))); v != nil {
+			linksGen = v.gens[filepath.Clean(filePath)]
+		}
+	}
+	return etagOf(filePath, info.ModTime().UnixNano(), info.Size(), renderVersion, linksGen)
+}
+
+// notModified sets the ETag of a response, to be revalidated on every use,
+// and answers 304 when the request's If-None-Match holds it
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, tag := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// renderCached returns the rendering of a file with the given ETag from
+// renderedFiles, rendering it on a miss, and whether it was cached
+func renderCached(r *http.Request, filePath, etag string) (string, string, bool) {
+	if content, class, ok := renderedFiles.get(filePath, etag); ok {
+		renderCacheRequests.inc("hit")
+		return content, class, true
+	}
+	renderCacheRequests.inc("miss")
+	start := time.Now()
+	content, class := renderFile(filePath)
+	requestInfoFrom(r).setRender(class, time.Since(start))
+	if class != "" {
+		renderedFiles.add(filePath, etag, content, class)
+	}
+	return content, class, false
+}
+
+// renderCache is an LRU of rendered files bounded by size. An entry only
+// serves the ETag it was rendered for: a changed file replaces it.
+type renderCache struct {
+	mu    sync.Mutex
+	max   int
+	size  int
+	order *list.List // Most recently used first
+	items map[string]*list.Element
+}
+
+type renderEntry struct {
+	path, etag, content, class string
+}
+
+func newRenderCache(max int) *renderCache {
+	return &renderCache{max: max, order: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *renderCache) get(path, etag string) (string, string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[path]
+	if !ok {
+		return "", "", false
+	}
+	e := el.Value.(*renderEntry)
+	if e.etag != etag {
+		c.remove(el)
+		return "", "", false
+	}
+	c.order.MoveToFront(el)
+	return e.content, e.class, true
+}
+
+func (c *renderCache) add(path, etag, content, class string) {
+	// One page may not evict most of the others
+	if len(content) > c.max/4 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[path]; ok {
+		c.remove(el)
+	}
+	c.items[path] = c.order.PushFront(&renderEntry{path, etag, content, class})
+	c.size += len(content)
+	for c.size > c.max {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *renderCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*renderEntry)
+	delete(c.items, e.path)
+	c.size -= len(e.content)
+}
+
+func (c *renderCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
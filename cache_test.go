@@ -0,0 +1,197 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ===== Caching Tests =====
+
+func TestRenderCache(t *testing.T) {
+	c := newRenderCache(40)
+	c.add("/a", "1", strings.Repeat("a", 10), "text")
+	c.add("/b", "1", strings.Repeat("b", 10), "text")
+	if _, _, ok := c.get("/a", "1"); !ok {
+		t.Fatal("/a should be cached")
+	}
+	// /b is the least recently used
+	c.add("/c", "1", strings.Repeat("c", 10), "text")
+	c.add("/d", "1", strings.Repeat("d", 10), "text")
+	c.add("/e", "1", strings.Repeat("e", 10), "text")
+	if _, _, ok := c.get("/b", "1"); ok {
+		t.Error("/b should be evicted")
+	}
+	if content, class, ok := c.get("/a", "1"); !ok || content != strings.Repeat("a", 10) || class != "text" {
+		t.Errorf("/a = %q %q %v", content, class, ok)
+	}
+
+	if _, _, ok := c.get("/a", "2"); ok {
+		t.Error("a changed file should miss")
+	}
+	if _, _, ok := c.get("/a", "1"); ok {
+		t.Error("the stale entry should be dropped")
+	}
+	c.add("/big", "1", strings.Repeat("x", 11), "text")
+	if _, _, ok := c.get("/big", "1"); ok {
+		t.Error("an entry over a quarter of the cache should not be kept")
+	}
+	if c.len() != 3 || c.size != 30 {
+		t.Errorf("len = %d, size = %d", c.len(), c.size)
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	dir := writeTree(t, map[string]string{"doc.md": "# Doc\n", "logo.svg": "<svg/>"})
+	doc := filepath.Join(dir, "doc.md")
+	server := securityHeaders(newRouter())
+	get := func(target, etag string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if etag != "" {
+			req.Header.Set("If-None-Match", etag)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		return rec
+	}
+
+	for _, target := range []string{doc, "/preview" + doc, "/asset?path=" + url.QueryEscape(filepath.Join(dir, "logo.svg"))} {
+		rec := get(target, "")
+		etag := rec.Header().Get("ETag")
+		if rec.Code != http.StatusOK || !strings.HasPrefix(etag, `W/"`) || rec.Header().Get("Cache-Control") != "no-cache" {
+			t.Fatalf("%s: %d, ETag %q, Cache-Control %q", target, rec.Code, etag, rec.Header().Get("Cache-Control"))
+		}
+		rec = get(target, etag)
+		if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+			t.Errorf("%s with If-None-Match: %d, %d bytes", target, rec.Code, rec.Body.Len())
+		}
+		if rec.Header().Get("Content-Security-Policy") != "" {
+			t.Errorf("%s: a 304 should not replace the policy of the cached page", target)
+		}
+		if rec = get(target, `W/"other"`); rec.Code != http.StatusOK {
+			t.Errorf("%s with another ETag: %d", target, rec.Code)
+		}
+	}
+
+	first := get(doc, "")
+	if cache := get(doc, "").Header().Get("X-Cache"); cache != "HIT" {
+		t.Errorf("second view: X-Cache = %q, want HIT", cache)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(doc, []byte("# Changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(doc, later, later)
+	rec := get(doc, first.Header().Get("ETag"))
+	if rec.Code != http.StatusOK || rec.Header().Get("X-Cache") != "MISS" || !strings.Contains(rec.Body.String(), "Changed") {
+		t.Errorf("changed file: %d, X-Cache %q", rec.Code, rec.Header().Get("X-Cache"))
+	}
+}
+
+func TestCDNConditionalRequests(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cached := filepath.Join(getCacheDir(), "cdn.jsdelivr.net", "lib@1.0", "lib.js")
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(cached, []byte("console.log(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/cdn/cdn.jsdelivr.net/lib@1.0/lib.js", nil))
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag == "" || rec.Header().Get("Last-Modified") == "" || rec.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("%d, ETag %q, Last-Modified %q", rec.Code, etag, rec.Header().Get("Last-Modified"))
+	}
+	req := httptest.NewRequest("GET", "/cdn/cdn.jsdelivr.net/lib@1.0/lib.js", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match: status = %d, want 304", rec.Code)
+	}
+
+}
+
+func TestVaultGenerations(t *testing.T) {
+	root := writeVault(t, map[string]string{"a.md": "[[b]]", "b.md": "text", "c.md": "alone"})
+	a, b := filepath.Join(root, "a.md"), filepath.Join(root, "b.md")
+	etags := func() (string, string) {
+		t.Helper()
+		// Rebuild the index as once vaultTTL has passed
+		vaultsMu.Lock()
+		if v := vaults[root]; v != nil {
+			v.built = time.Time{}
+		}
+		vaultsMu.Unlock()
+		getVault(root)
+		infoA, err := os.Stat(a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		infoB, err := os.Stat(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return renderETag(a, infoA), renderETag(b, infoB)
+	}
+
+	a1, b1 := etags()
+	if a2, b2 := etags(); a2 != a1 || b2 != b1 {
+		t.Errorf("ETags changed with the index alone: %s %s, then %s %s", a1, b1, a2, b2)
+	}
+	if err := os.WriteFile(filepath.Join(root, "c.md"), []byte("see [[b]]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a3, b3 := etags()
+	if b3 == b1 {
+		t.Error("a new backlink should change the ETag of its target")
+	}
+	if a3 != a1 {
+		t.Error("notes whose links did not change should keep their ETag")
+	}
+}
+
+func TestRenderETagLastIndex(t *testing.T) {
+	root := writeVault(t, map[string]string{"a.md": "# A\n", "b.md": "[[a]]"})
+	a := filepath.Join(root, "a.md")
+	info, err := os.Stat(a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := getVault(root)
+	before := renderETag(a, info)
+	if err := os.WriteFile(filepath.Join(root, "c.md"), []byte("[[a]]"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vaultsMu.Lock()
+	first.built = time.Time{}
+	vaultsMu.Unlock()
+
+	// The stale index answers at once and is rebuilt in the background
+	if etag := renderETag(a, info); etag != before {
+		t.Errorf("ETag = %s with the last index, want %s", etag, before)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		vaultsMu.Lock()
+		rebuilt := vaults[root] != first
+		vaultsMu.Unlock()
+		if rebuilt {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the stale index was not rebuilt")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if etag := renderETag(a, info); etag == before {
+		t.Error("the new backlink should change the ETag once indexed")
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+)
+
+// Responses smaller than this are sent as they are
+const minCompressSize = 1024
+
+// compressor is a gzip or brotli writer
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+	Reset(w io.Writer)
+}
+
+// Writers by Content-Encoding, reused across responses. Brotli level 5
+// compresses pages better than gzip at a similar speed.
+var compressors = map[string]*sync.Pool{
+	"br":   {New: func() interface{} { return brotli.NewWriterLevel(nil, 5) }},
+	"gzip": {New: func() interface{} { return gzip.NewWriter(nil) }},
+}
+
+// preferredEncoding returns the encoding an Accept-Encoding header prefers,
+// brotli on a tie, "" for none
+func preferredEncoding(acceptEncoding string) string {
+	br, gz := acceptQuality(acceptEncoding, "br"), acceptQuality(acceptEncoding, "gzip")
+	switch {
+	case br > 0 && br >= gz:
+		return "br"
+	case gz > 0:
+		return "gzip"
+	}
+	return ""
+}
+
+// compressible reports whether a content type gains from compression.
+// Event streams are left alone so that every event is sent at once.
+func compressible(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case mt == "text/event-stream":
+		return false
+	case strings.HasPrefix(mt, "text/"), strings.HasSuffix(mt, "+json"), strings.HasSuffix(mt, "+xml"):
+		return true
+	}
+	switch mt {
+	case "application/json", "application/javascript", "application/xml", "application/toml", "application/yaml", "application/x-ndjson":
+		return true
+	}
+	return false
+}
+
+// compressResponses compresses responses with brotli or gzip, as the client
+// accepts
+func compressResponses(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := preferredEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter compresses the body once the headers show it is worth it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	decided  bool
+	c        compressor
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if !w.decided {
+		w.decide(status)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// decide starts compressing, unless the response has no body, is a range,
+// is already encoded, small or of an incompressible type
+func (w *compressWriter) decide(status int) {
+	w.decided = true
+	h := w.Header()
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified ||
+		h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" || !compressible(h.Get("Content-Type")) {
+		return
+	}
+	if n, err := strconv.Atoi(h.Get("Content-Length")); err == nil && n < minCompressSize {
+		return
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", w.encoding)
+	w.c = compressors[w.encoding].Get().(compressor)
+	w.c.Reset(w.ResponseWriter)
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		// Sniffed here: the server would sniff the compressed bytes
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(p))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.c != nil {
+		return w.c.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) Flush() {
+	if w.c != nil {
+		w.c.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// close ends the compressed stream and returns the writer to its pool
+func (w *compressWriter) close() {
+	if w.c == nil {
+		return
+	}
+	w.c.Close()
+	w.c.Reset(io.Discard)
+	compressors[w.encoding].Put(w.c)
+	w.c = nil
+}
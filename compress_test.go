@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ===== Compression Tests =====
+
+func TestPreferredEncoding(t *testing.T) {
+	for header, want := range map[string]string{
+		"gzip, deflate, br, zstd": "br",
+		"gzip":                    "gzip",
+		"br;q=0.5, gzip":          "gzip",
+		"*":                       "br",
+		"identity":                "",
+		"":                        "",
+		"gzip;q=0, br;q=0":        "",
+	} {
+		if got := preferredEncoding(header); got != want {
+			t.Errorf("preferredEncoding(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestCompressResponses(t *testing.T) {
+	page := strings.Repeat("<p>Hello, compression</p>\n", 200)
+	server := compressResponses(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(page))
+		case "/sniffed":
+			w.Write([]byte(page))
+		case "/small":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Content-Length", "5")
+			w.Write([]byte("small"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(testPNG)
+		case "/events":
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Write([]byte("event: line\ndata: {}\n\n"))
+		}
+	}))
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"br":   func(r io.Reader) (io.Reader, error) { return brotli.NewReader(r), nil },
+	}
+	for _, tt := range []struct {
+		path, accept, encoding string
+	}{
+		{"/page", "gzip, br", "br"},
+		{"/page", "gzip", "gzip"},
+		{"/sniffed", "gzip", "gzip"},
+		{"/page", "", ""},
+		{"/small", "br", ""},
+		{"/image", "br", ""},
+		{"/events", "br", ""},
+	} {
+		req := httptest.NewRequest("GET", tt.path, nil)
+		req.Header.Set("Accept-Encoding", tt.accept)
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Encoding"); got != tt.encoding {
+			t.Errorf("%s with %q: Content-Encoding = %q, want %q", tt.path, tt.accept, got, tt.encoding)
+			continue
+		}
+		if rec.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("%s: Vary = %q", tt.path, rec.Header().Get("Vary"))
+		}
+		if tt.encoding == "" {
+			continue
+		}
+		r, err := decoders[tt.encoding](bytes.NewReader(rec.Body.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(r)
+		if err != nil || string(body) != page {
+			t.Errorf("%s: decoded %d bytes, %v", tt.path, len(body), err)
+		}
+		if rec.Body.Len() >= len(page)/4 {
+			t.Errorf("%s: %d compressed bytes for %d", tt.path, rec.Body.Len(), len(page))
+		}
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+			t.Errorf("%s: Content-Type = %q", tt.path, ct)
+		}
+	}
+}
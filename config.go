@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Config holds the user settings read from config.json in the config directory
+type Config struct {
+	// Schemas maps file globs to JSON Schema paths or URLs, e.g.
+	// {"**/.github/workflows/*.yml": "https://json.schemastore.org/github-workflow.json"}.
+	// Globs without a slash match the file name only; relative schema paths
+	// are resolved against the config directory.
+	Schemas map[string]string `json:"schemas,omitempty"`
+
+	// PDFRenderer is the program used by /export?format=pdf; empty picks the
+	// first of Chromium, WeasyPrint and wkhtmltopdf found in $PATH.
+	PDFRenderer string `json:"pdfRenderer,omitempty"`
+
+	// Vaults are the roots wiki-links are resolved against, e.g. ["~/notes"];
+	// outside them the nearest parent holding .obsidian or .git is the root.
+	Vaults []string `json:"vaults,omitempty"`
+
+	// TrustedRoots are directories whose HTML is rendered as it is: raw HTML
+	// of Markdown files unsanitised, .html files outside the sandbox.
+	TrustedRoots []string `json:"trustedRoots,omitempty"`
+
+	// LinkCheck configures the requests made to external URLs by
+	// check-links --external and /links/check?external=1.
+	LinkCheck *LinkCheckConfig `json:"linkCheck,omitempty"`
+
+	// Listen is the address the server binds, "127.0.0.1:4120" by default;
+	// "0.0.0.0:4120" opens it to the network. --listen overrides it.
+	Listen string `json:"listen,omitempty"`
+
+	// AllowedHosts are the host names accepted in the Host header besides
+	// localhost and IP addresses, e.g. the name of this machine.
+	AllowedHosts []string `json:"allowedHosts,omitempty"`
+
+	// CORS lets pages of other origins call the API.
+	CORS *CORSConfig `json:"cors,omitempty"`
+
+	// Auth requires credentials on every route; none by default. --auth
+	// overrides its mode.
+	Auth *AuthConfig `json:"auth,omitempty"`
+
+	// TLS serves HTTPS when set, like --tls.
+	TLS *TLSConfig `json:"tls,omitempty"`
+
+	// Log sets the request logs written to stderr, like --log-level and
+	// --log-format.
+	Log *LogConfig `json:"log,omitempty"`
+}
+
+// LogConfig is the level and format of the logs
+type LogConfig struct {
+	Level  string `json:"level,omitempty"`  // debug, info, warn or error; info by default
+	Format string `json:"format,omitempty"` // text or json; text by default
+}
+
+// TLSConfig is the certificate of HTTPS and the plain HTTP listener
+type TLSConfig struct {
+	// Cert and Key are PEM files; when both are empty a certificate signed
+	// by a local CA is generated in the tls folder of the config directory.
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+
+	// RedirectHTTP is an address answering plain HTTP with a redirect to
+	// HTTPS, e.g. ":80".
+	RedirectHTTP string `json:"redirectHTTP,omitempty"`
+}
+
+// AuthConfig selects how requests are authenticated
+type AuthConfig struct {
+	// Mode is "token", "basic" or "proxy"; empty or "none" turns auth off.
+	Mode string `json:"mode,omitempty"`
+
+	// Token is the secret of the token mode; a new one is generated at
+	// each start when empty.
+	Token string `json:"token,omitempty"`
+
+	// Users maps user names to bcrypt hashes for the basic mode, see
+	// "file-viewer hash-password".
+	Users map[string]string `json:"users,omitempty"`
+
+	// ProxyHeader holds the user name set by the reverse proxy in the proxy
+	// mode, "X-Forwarded-User" by default. It is only read from
+	// TrustedProxies, IP addresses or CIDR ranges, loopback by default.
+	ProxyHeader    string   `json:"proxyHeader,omitempty"`
+	TrustedProxies []string `json:"trustedProxies,omitempty"`
+}
+
+// CORSConfig lists the origins allowed to read the API from their pages
+type CORSConfig struct {
+	Origins []string `json:"origins,omitempty"` // e.g. "http://localhost:3000"; "*" allows any
+}
+
+// LinkCheckConfig is the HTTP client of the external link checks
+type LinkCheckConfig struct {
+	Timeout   string   `json:"timeout,omitempty"`   // Per URL, e.g. "5s"; 10s by default
+	UserAgent string   `json:"userAgent,omitempty"` // Some sites refuse unknown clients
+	Ignore    []string `json:"ignore,omitempty"`    // URL prefixes never requested
+}
+
+// appConfig is the configuration loaded at startup
+var appConfig = &Config{}
+
+// getConfigDir returns the directory holding config.json, $FILE_VIEWER_CONFIG_DIR
+// or ~/.config/file-viewer
+func getConfigDir() string {
+	if dir := os.Getenv("FILE_VIEWER_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "/tmp/file-viewer-config"
+	}
+	return filepath.Join(homeDir, ".config", "file-viewer")
+}
+
+// loadConfig reads config.json from dir; a missing file gives the defaults
+func loadConfig(dir string) (*Config, error) {
+	cfg := &Config{}
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", filepath.Join(dir, "config.json"), err)
+	}
+	return cfg, nil
+}
+
+// matchGlob matches a path against a glob where * and ? stay within a path
+// segment and ** matches any number of segments
+func matchGlob(pattern, path string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := filepath.Match(pattern, filepath.Base(path))
+		return ok
+	}
+
+	var re strings.Builder
+	re.WriteString("^")
+	if !strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "**") {
+		// Relative globs match anywhere below a directory
+		re.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			re.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			re.WriteString(".*")
+			i++
+		case c == '*':
+			re.WriteString("[^/]*")
+		case c == '?':
+			re.WriteString("[^/]")
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	re.WriteString("$")
+	ok, _ := regexp.MatchString(re.String(), filepath.ToSlash(path))
+	return ok
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Conversion targets and their content types
+var convertContentTypes = map[string]string{
+	"json": "application/json; charset=utf-8",
+	"yaml": "application/yaml; charset=utf-8",
+	"toml": "application/toml; charset=utf-8",
+	"csv":  "text/csv; charset=utf-8",
+}
+
+// convertibleFormat returns the source format of a file for /convert
+func convertibleFormat(filePath string) string {
+	if format := structuredFormat(filePath); format != "" {
+		return format
+	}
+	if strings.ToLower(filepath.Ext(filePath)) == ".csv" {
+		return "csv"
+	}
+	return ""
+}
+
+// csvToRecords turns CSV rows into objects keyed by the header
+func csvToRecords(content string) []interface{} {
+	records := []interface{}{}
+	if strings.TrimSpace(content) == "" {
+		return records
+	}
+	headers, rows := parseCSV(content)
+	for _, cells := range rows {
+		record := make(map[string]interface{}, len(headers))
+		for i, h := range headers {
+			value := ""
+			if i < len(cells) {
+				value = cells[i]
+			}
+			record[h] = value
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// loadConvertible reads a JSON, YAML, TOML or CSV file as a JSON-compatible
+// value, along with the order of the keys of its records, see recordKeyOrder
+func loadConvertible(filePath string) (interface{}, []string, error) {
+	format := convertibleFormat(filePath)
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "csv" {
+		var headers []string
+		if strings.TrimSpace(string(content)) != "" {
+			headers, _ = parseCSV(string(content))
+		}
+		return csvToRecords(string(content)), headers, nil
+	}
+	doc, err := parseStructured(string(content), format)
+	if err != nil {
+		return nil, nil, err
+	}
+	if format == "toml" {
+		return doc, nil, nil
+	}
+	return doc, recordKeyOrder(string(content)), nil
+}
+
+// recordKeyOrder returns the keys of the objects of a JSON or YAML array in
+// the order they first appear, nil when the document is no array. Decoded
+// maps lose this order, which the columns of a CSV keep.
+func recordKeyOrder(content string) []string {
+	// JSON is YAML too
+	var root yaml.Node
+	if yaml.Unmarshal([]byte(content), &root) != nil || len(root.Content) == 0 || root.Content[0].Kind != yaml.SequenceNode {
+		return nil
+	}
+	keys := []string{}
+	seen := make(map[string]bool)
+	for _, item := range root.Content[0].Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 0; i+1 < len(item.Content); i += 2 {
+			if k := item.Content[i].Value; !seen[k] {
+				seen[k] = true
+				keys = append(keys, k)
+			}
+		}
+	}
+	return keys
+}
+
+// orderKeys returns the keys of obj in the given order, followed by those
+// not in it, sorted
+func orderKeys(obj map[string]interface{}, order []string) []string {
+	keys := make([]string, 0, len(obj))
+	listed := make(map[string]bool, len(order))
+	for _, k := range order {
+		listed[k] = true
+		if _, ok := obj[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range sortedKeys(obj) {
+		if !listed[k] {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// orderedRecord is a record encoded to JSON with its keys in order
+type orderedRecord struct {
+	obj  map[string]interface{}
+	keys []string
+}
+
+func (o orderedRecord) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	buf.WriteByte('{')
+	for i, k := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(k); err != nil {
+			return nil, err
+		}
+		buf.WriteByte(':')
+		if err := enc.Encode(o.obj[k]); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// convertValue serializes a value to json, yaml, toml or csv; minify produces
+// compact JSON and flow-style YAML and has no effect on TOML and CSV. The
+// objects of an array get their keys in the order of keys, when not nil.
+func convertValue(v interface{}, to string, minify bool, keys []string) ([]byte, error) {
+	arr, records := v.([]interface{})
+	records = records && keys != nil
+	switch to {
+	case "json":
+		if records {
+			ordered := make([]interface{}, len(arr))
+			for i, item := range arr {
+				ordered[i] = item
+				if obj, ok := item.(map[string]interface{}); ok {
+					ordered[i] = orderedRecord{obj, orderKeys(obj, keys)}
+				}
+			}
+			v = ordered
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if !minify {
+			enc.SetIndent("", "  ")
+		}
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case "yaml":
+		var node yaml.Node
+		if err := node.Encode(v); err != nil {
+			return nil, err
+		}
+		if records {
+			for i, item := range node.Content {
+				if obj, ok := arr[i].(map[string]interface{}); ok && item.Kind == yaml.MappingNode {
+					orderMapping(item, orderKeys(obj, keys))
+				}
+			}
+		}
+		if minify {
+			setFlowStyle(&node)
+		}
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(&node); err != nil {
+			return nil, err
+		}
+		enc.Close()
+		return buf.Bytes(), nil
+
+	case "toml":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("TOML needs a table at the top level, got %s", jqType(v))
+		}
+		if ptr, ok := findNull(obj, ""); ok {
+			return nil, fmt.Errorf("TOML has no null value (at %s)", ptr)
+		}
+		var buf bytes.Buffer
+		enc := toml.NewEncoder(&buf)
+		enc.Indent = ""
+		if err := enc.Encode(tomlIntegers(obj)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+
+	case "csv":
+		return recordsToCSV(v, keys)
+	}
+	return nil, fmt.Errorf("unsupported target format: %s", to)
+}
+
+// orderMapping reorders the pairs of a YAML mapping node as keys
+func orderMapping(n *yaml.Node, keys []string) {
+	pairs := make(map[string][]*yaml.Node, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		pairs[n.Content[i].Value] = n.Content[i : i+2]
+	}
+	content := make([]*yaml.Node, 0, len(n.Content))
+	for _, k := range keys {
+		content = append(content, pairs[k]...)
+	}
+	n.Content = content
+}
+
+// setFlowStyle writes every collection of a YAML node on one line
+func setFlowStyle(n *yaml.Node) {
+	if n.Kind == yaml.MappingNode || n.Kind == yaml.SequenceNode {
+		n.Style = yaml.FlowStyle
+	}
+	for _, c := range n.Content {
+		setFlowStyle(c)
+	}
+}
+
+// findNull returns the JSON pointer of the first null value
+func findNull(v interface{}, ptr string) (string, bool) {
+	switch val := v.(type) {
+	case nil:
+		return ptr, true
+	case map[string]interface{}:
+		for _, k := range sortedKeys(val) {
+			if p, ok := findNull(val[k], ptr+"/"+pointerToken(k)); ok {
+				return p, true
+			}
+		}
+	case []interface{}:
+		for i, item := range val {
+			if p, ok := findNull(item, ptr+"/"+strconv.Itoa(i)); ok {
+				return p, true
+			}
+		}
+	}
+	return "", false
+}
+
+// tomlIntegers converts whole float64 values back to integers so TOML writes 8080, not 8080.0
+func tomlIntegers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case float64:
+		if val == float64(int64(val)) {
+			return int64(val)
+		}
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = tomlIntegers(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = tomlIntegers(item)
+		}
+		return out
+	}
+	return v
+}
+
+// recordsToCSV writes an array of flat objects as CSV, with the union of
+// their keys as header: those in keys first, in this order, then the others
+// sorted
+func recordsToCSV(v interface{}, keys []string) ([]byte, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("CSV needs an array of flat objects, got %s", jqType(v))
+	}
+
+	union := make(map[string]interface{})
+	for i, item := range arr {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("CSV needs an array of flat objects, /%d is %s", i, jqType(item))
+		}
+		for _, k := range sortedKeys(obj) {
+			switch obj[k].(type) {
+			case map[string]interface{}, []interface{}:
+				return nil, fmt.Errorf("CSV needs flat objects, /%d/%s is %s", i, pointerToken(k), jqType(obj[k]))
+			}
+			union[k] = nil
+		}
+	}
+	columns := orderKeys(union, keys)
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(columns)
+	for _, item := range arr {
+		obj := item.(map[string]interface{})
+		row := make([]string, len(columns))
+		for i, col := range columns {
+			switch cell := obj[col].(type) {
+			case nil:
+			case string:
+				row[i] = cell
+			default:
+				b, _ := json.Marshal(cell)
+				row[i] = string(b)
+			}
+		}
+		w.Write(row)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// handleConvert serves /convert?path=&to=json|yaml|toml|csv[&minify=1][&download=1]
+func handleConvert(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path, to := q.Get("path"), strings.ToLower(q.Get("to"))
+	if path == "" || to == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path or to parameter")
+		return
+	}
+	if _, ok := convertContentTypes[to]; !ok {
+		writeError(w, r, http.StatusBadRequest, "Unsupported target format: "+to)
+		return
+	}
+	if convertibleFormat(path) == "" {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Not a JSON, YAML, TOML or CSV file")
+		return
+	}
+	if checkFile(w, r, path, MaxViewableSize) == nil {
+		return
+	}
+
+	doc, keys, err := loadConvertible(path)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Cannot parse "+convertibleFormat(path)+": "+err.Error())
+		return
+	}
+	out, err := convertValue(doc, to, q.Get("minify") == "1", keys)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", convertContentTypes[to])
+	if q.Get("download") == "1" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "." + to
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	w.Write(out)
+}
+
+// renderConvertButtons renders the download buttons of a structured data toolbar
+func renderConvertButtons(from string) string {
+	var sb strings.Builder
+	sb.WriteString(`<span class="convert-buttons">`)
+	for _, to := range []string{"json", "yaml", "toml", "csv"} {
+		if to == from {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf(`<button data-to="%s" onclick="downloadAs(this.dataset.to, false)" title="Download as %s">⬇ %s</button>`, to, strings.ToUpper(to), strings.ToUpper(to)))
+	}
+	if from == "json" {
+		sb.WriteString(`<button onclick="downloadAs('json', true)" title="Download minified JSON">⬇ Minified</button>`)
+	} else if from != "csv" {
+		sb.WriteString(`<button onclick="downloadAs('json', true)" title="Download as minified JSON">⬇ JSON (min)</button>`)
+	}
+	sb.WriteString(withNonce(`</span>
+<script>
+async function downloadAs(to, minify) {
+    const params = new URLSearchParams({ path: decodeURIComponent(location.pathname), to: to });
+    if (minify) params.set('minify', '1');
+    const res = await fetch('/convert?' + params);
+    if (!res.ok) {
+        const data = await res.json();
+        alert('Conversion failed: ' + data.error);
+        return;
+    }
+    params.set('download', '1');
+    location.href = '/convert?' + params;
+}
+</script>`))
+	return sb.String()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Conversion Tests =====
+
+func TestConvertValue(t *testing.T) {
+	doc := mustParseJSON(t, `{"name": "app", "port": 8080, "ratio": 0.5, "tags": ["a", "b"], "db": {"host": "localhost"}}`)
+
+	tests := []struct {
+		to     string
+		minify bool
+		expect string
+	}{
+		{"json", true, `{"db":{"host":"localhost"},"name":"app","port":8080,"ratio":0.5,"tags":["a","b"]}` + "\n"},
+		{"json", false, "{\n  \"db\": {\n    \"host\": \"localhost\"\n  },\n  \"name\": \"app\",\n  \"port\": 8080,\n  \"ratio\": 0.5,\n  \"tags\": [\n    \"a\",\n    \"b\"\n  ]\n}\n"},
+		{"yaml", false, "db:\n  host: localhost\nname: app\nport: 8080\nratio: 0.5\ntags:\n  - a\n  - b\n"},
+		{"yaml", true, "{db: {host: localhost}, name: app, port: 8080, ratio: 0.5, tags: [a, b]}\n"},
+		{"toml", false, "name = \"app\"\nport = 8080\nratio = 0.5\ntags = [\"a\", \"b\"]\n\n[db]\nhost = \"localhost\"\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.to, func(t *testing.T) {
+			out, err := convertValue(doc, tt.to, tt.minify, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(out) != tt.expect {
+				t.Errorf("got:\n%s\nwant:\n%s", out, tt.expect)
+			}
+		})
+	}
+}
+
+func TestConvertCSV(t *testing.T) {
+	records := csvToRecords("port,name\n80,web\n5432,\"db, primary\"\n")
+	out, err := convertValue(records, "json", true, []string{"port", "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `[{"port":"80","name":"web"},{"port":"5432","name":"db, primary"}]` + "\n"; string(out) != want {
+		t.Errorf("CSV to JSON = %s, want %s", out, want)
+	}
+
+	back, err := convertValue(mustParseJSON(t, `[{"b": 1, "a": "x,y"}, {"a": "z", "c": true}]`), "csv", false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "a,b,c\n\"x,y\",1,\nz,,true\n"; string(back) != want {
+		t.Errorf("JSON to CSV = %q, want %q", back, want)
+	}
+}
+
+func TestConvertKeepsColumnOrder(t *testing.T) {
+	dir := t.TempDir()
+	csvPath := filepath.Join(dir, "hosts.csv")
+	original := "zone,name,id\neu,web,2\nus,db,1\n"
+	if err := os.WriteFile(csvPath, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		t.Run(format, func(t *testing.T) {
+			doc, keys, err := loadConvertible(csvPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := convertValue(doc, format, false, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "hosts."+format)
+			if err := os.WriteFile(path, out, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			doc, keys, err = loadConvertible(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			back, err := convertValue(doc, "csv", false, keys)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(back) != original {
+				t.Errorf("CSV to %s and back = %q, want %q\n%s", format, back, original, out)
+			}
+		})
+	}
+}
+
+func TestConvertErrors(t *testing.T) {
+	tests := []struct {
+		doc     string
+		to      string
+		message string
+	}{
+		{`[1, 2]`, "toml", "TOML needs a table"},
+		{`{"a": {"b": null}}`, "toml", "no null value (at /a/b)"},
+		{`{"a": 1}`, "csv", "array of flat objects"},
+		{`[{"a": {"b": 1}}]`, "csv", "/0/a is object"},
+		{`{}`, "xml", "unsupported target format"},
+	}
+	for _, tt := range tests {
+		_, err := convertValue(mustParseJSON(t, tt.doc), tt.to, false, nil)
+		if err == nil || !strings.Contains(err.Error(), tt.message) {
+			t.Errorf("%s to %s: error = %v, want %q", tt.doc, tt.to, err, tt.message)
+		}
+	}
+}
+
+func TestHandleConvert(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.toml")
+	if err := os.WriteFile(path, []byte("title = \"demo\"\n[server]\nport = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleConvert(rec, httptest.NewRequest("GET", "/convert?path="+url.QueryEscape(path)+"&to=yaml&download=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := rec.Body.String(); got != "server:\n  port: 80\ntitle: demo\n" {
+		t.Errorf("body = %q", got)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "application/yaml") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="app.yaml"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	rec = httptest.NewRecorder()
+	handleConvert(rec, httptest.NewRequest("GET", "/convert?path="+url.QueryEscape(path)+"&to=csv", nil))
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("table to CSV status = %d, want 422", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleConvert(rec, httptest.NewRequest("GET", "/convert?path="+url.QueryEscape(path)+"&to=pdf", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("unknown target status = %d, want 400", rec.Code)
+	}
+}
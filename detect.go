@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Number of bytes read from the head of a file to decide how to display it
+const sniffLen = 8192
+
+// FileKind describes what the viewer knows about a file's content
+type FileKind struct {
+	Text     bool   // content can be displayed as text
+	MimeType string // detected MIME type
+	Encoding string // utf-8, utf-16le, utf-16be, utf-32le, utf-32be or latin-1
+	Language string // Prism language for well-known filenames (Makefile, Dockerfile...)
+}
+
+// Byte order marks, longest first so UTF-32LE is not mistaken for UTF-16LE
+var byteOrderMarks = []struct {
+	bom      []byte
+	encoding string
+}{
+	{[]byte{0xFF, 0xFE, 0x00, 0x00}, "utf-32le"},
+	{[]byte{0x00, 0x00, 0xFE, 0xFF}, "utf-32be"},
+	{[]byte{0xEF, 0xBB, 0xBF}, "utf-8"},
+	{[]byte{0xFF, 0xFE}, "utf-16le"},
+	{[]byte{0xFE, 0xFF}, "utf-16be"},
+}
+
+// Magic numbers of common binary formats. Those made of printable ASCII,
+// such as "MZ" or "RIFF", may also start a text file: they only count when
+// the head holds control characters too.
+var magicNumbers = []struct {
+	offset   int
+	magic    string
+	mimeType string
+}{
+	{0, "\x89PNG\r\n\x1a\n", "image/png"},
+	{0, "\xFF\xD8\xFF", "image/jpeg"},
+	{0, "GIF87a", "image/gif"},
+	{0, "GIF89a", "image/gif"},
+	{0, "%PDF-", "application/pdf"},
+	{0, "PK\x03\x04", "application/zip"},
+	{0, "PK\x05\x06", "application/zip"},
+	{0, "\x1F\x8B", "application/gzip"},
+	{0, "BZh", "application/x-bzip2"},
+	{0, "\xFD7zXZ\x00", "application/x-xz"},
+	{0, "7z\xBC\xAF\x27\x1C", "application/x-7z-compressed"},
+	{0, "Rar!\x1A\x07", "application/vnd.rar"},
+	{257, "ustar", "application/x-tar"},
+	{0, "\x7FELF", "application/x-executable"},
+	{0, "\xFE\xED\xFA\xCE", "application/x-mach-binary"},
+	{0, "\xFE\xED\xFA\xCF", "application/x-mach-binary"},
+	{0, "\xCE\xFA\xED\xFE", "application/x-mach-binary"},
+	{0, "\xCF\xFA\xED\xFE", "application/x-mach-binary"},
+	{0, "\xCA\xFE\xBA\xBE", "application/java-vm"},
+	{0, "MZ", "application/vnd.microsoft.portable-executable"},
+	{0, "\x00asm", "application/wasm"},
+	{0, "SQLite format 3\x00", "application/vnd.sqlite3"},
+	{0, "OggS", "audio/ogg"},
+	{0, "fLaC", "audio/flac"},
+	{0, "ID3", "audio/mpeg"},
+	{0, "RIFF", "application/octet-stream"},
+	{4, "ftyp", "video/mp4"},
+	{0, "\x1A\x45\xDF\xA3", "video/webm"},
+	{0, "wOFF", "font/woff"},
+	{0, "wOF2", "font/woff2"},
+	{0, "OTTO", "font/otf"},
+	{0, "\x00\x01\x00\x00\x00", "font/ttf"},
+}
+
+// Well-known extensionless or special filenames and their Prism language
+// ("" means plain text)
+var wellKnownFiles = map[string]string{
+	"makefile":       "makefile",
+	"gnumakefile":    "makefile",
+	"dockerfile":     "docker",
+	"containerfile":  "docker",
+	"jenkinsfile":    "groovy",
+	"vagrantfile":    "ruby",
+	"gemfile":        "ruby",
+	"rakefile":       "ruby",
+	"podfile":        "ruby",
+	"brewfile":       "ruby",
+	".bashrc":        "bash",
+	".zshrc":         "bash",
+	".profile":       "bash",
+	".editorconfig":  "ini",
+	".gitconfig":     "ini",
+	".gitignore":     "",
+	".dockerignore":  "",
+	"go.mod":         "go-module",
+	"go.sum":         "",
+	"cmakelists.txt": "cmake",
+	"procfile":       "",
+	"license":        "",
+	"licence":        "",
+	"copying":        "",
+	"authors":        "",
+	"contributors":   "",
+	"notice":         "",
+	"readme":         "",
+	"changelog":      "",
+	"codeowners":     "",
+}
+
+// Suffixed variants of well-known files, such as Dockerfile.dev or
+// Makefile.linux, named after the file they vary
+var wellKnownVariants = map[string]bool{
+	"makefile":      true,
+	"dockerfile":    true,
+	"containerfile": true,
+	"jenkinsfile":   true,
+}
+
+// wellKnownLanguage returns the language of a well-known filename. Only the
+// files in wellKnownVariants match with a suffix: Gemfile.lock is no Ruby.
+func wellKnownLanguage(name string) (string, bool) {
+	lower := strings.ToLower(name)
+	if lang, ok := wellKnownFiles[lower]; ok {
+		return lang, true
+	}
+	if base, _, ok := strings.Cut(lower, "."); ok && wellKnownVariants[base] {
+		return wellKnownFiles[base], true
+	}
+	return "", false
+}
+
+// sniffFile reads the head of a file and decides whether it is text; the
+// sidebar, renderFile and /asset all rely on it so they never disagree
+func sniffFile(path string) (FileKind, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileKind{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return FileKind{}, err
+	}
+	return sniffContent(filepath.Base(path), head[:n], n == sniffLen), nil
+}
+
+// sniffContent classifies the head of a file; truncated is true when more
+// content follows, so a multi-byte character may be cut at the end
+func sniffContent(name string, head []byte, truncated bool) FileKind {
+	ext := strings.ToLower(filepath.Ext(name))
+	kind := FileKind{}
+	kind.Language, _ = wellKnownLanguage(name)
+
+	textKind := func(encoding string) FileKind {
+		kind.Text = true
+		kind.Encoding = encoding
+		kind.MimeType = "text/plain; charset=utf-8"
+		// The sniffer only knows a handful of text types, the extension is more precise
+		if byExt := mime.TypeByExtension(ext); isTextMimeType(byExt) {
+			kind.MimeType = byExt
+		} else if sniffed := http.DetectContentType(head); strings.HasPrefix(sniffed, "text/") {
+			kind.MimeType = sniffed
+		}
+		return kind
+	}
+
+	if len(head) == 0 {
+		return textKind("utf-8")
+	}
+
+	for _, b := range byteOrderMarks {
+		if bytes.HasPrefix(head, b.bom) {
+			return textKind(b.encoding)
+		}
+	}
+
+	for _, m := range magicNumbers {
+		if len(head) >= m.offset+len(m.magic) && string(head[m.offset:m.offset+len(m.magic)]) == m.magic &&
+			(!isPrintableASCII(m.magic) || controlBytes(head) > 0) {
+			kind.MimeType = m.mimeType
+			if m.magic == "RIFF" {
+				kind.MimeType = http.DetectContentType(head)
+			}
+			return kind
+		}
+	}
+
+	if bytes.IndexByte(head, 0) != -1 {
+		kind.MimeType = "application/octet-stream"
+		return kind
+	}
+
+	// Ignore a multi-byte character cut by the sniff window
+	valid := head
+	if truncated {
+		for i := 0; i < utf8.UTFMax-1 && len(valid) > 0 && !utf8.Valid(valid); i++ {
+			valid = valid[:len(valid)-1]
+		}
+	}
+	if utf8.Valid(valid) {
+		return textKind("utf-8")
+	}
+
+	// Not UTF-8: accept legacy 8-bit text if control characters are rare
+	if controlBytes(head)*100 < len(head) {
+		return textKind("latin-1")
+	}
+
+	kind.MimeType = "application/octet-stream"
+	return kind
+}
+
+// controlBytes counts the bytes of head that do not occur in text
+func controlBytes(head []byte) int {
+	n := 0
+	for _, c := range head {
+		if c < 0x20 && c != '\t' && c != '\n' && c != '\r' && c != '\f' && c != '\b' && c != 0x1B {
+			n++
+		}
+	}
+	return n
+}
+
+// isPrintableASCII reports whether s is made of printable ASCII characters
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] > 0x7E {
+			return false
+		}
+	}
+	return true
+}
+
+// isTextMimeType reports whether a MIME type describes textual content
+func isTextMimeType(mimeType string) bool {
+	base, _, _ := strings.Cut(mimeType, ";")
+	switch {
+	case base == "":
+		return false
+	case strings.HasPrefix(base, "text/"),
+		strings.HasSuffix(base, "+xml"),
+		strings.HasSuffix(base, "+json"),
+		strings.Contains(base, "json"),
+		strings.Contains(base, "xml"),
+		strings.Contains(base, "javascript"),
+		strings.Contains(base, "yaml"),
+		strings.Contains(base, "toml"):
+		return true
+	}
+	return false
+}
+
+// decodeText converts file content to a UTF-8 string according to the sniffed encoding
+func decodeText(content []byte, encoding string) string {
+	switch encoding {
+	case "utf-8":
+		return string(bytes.TrimPrefix(content, []byte{0xEF, 0xBB, 0xBF}))
+	case "utf-16le", "utf-16be":
+		var order binary.ByteOrder = binary.LittleEndian
+		if encoding == "utf-16be" {
+			order = binary.BigEndian
+		}
+		units := make([]uint16, 0, len(content)/2)
+		for i := 2; i+1 < len(content); i += 2 {
+			units = append(units, order.Uint16(content[i:]))
+		}
+		return string(utf16.Decode(units))
+	case "utf-32le", "utf-32be":
+		var order binary.ByteOrder = binary.LittleEndian
+		if encoding == "utf-32be" {
+			order = binary.BigEndian
+		}
+		var sb strings.Builder
+		for i := 4; i+3 < len(content); i += 4 {
+			sb.WriteRune(rune(order.Uint32(content[i:])))
+		}
+		return sb.String()
+	case "latin-1":
+		runes := make([]rune, len(content))
+		for i, c := range content {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	}
+	return string(content)
+}
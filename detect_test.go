@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Content Detection Tests =====
+
+func TestSniffContent(t *testing.T) {
+	// "é" is two bytes in UTF-8; cut it in half at the end of the window
+	truncated := []byte(strings.Repeat("a", 10) + "é")
+	truncated = truncated[:len(truncated)-1]
+
+	tests := []struct {
+		name      string
+		filename  string
+		head      []byte
+		truncated bool
+		text      bool
+		encoding  string
+		language  string
+		mimeType  string
+	}{
+		{"Makefile", "Makefile", []byte("all:\n\tgo build\n"), false, true, "utf-8", "makefile", ""},
+		{"Dockerfile variant", "Dockerfile.dev", []byte("FROM golang\n"), false, true, "utf-8", "docker", ""},
+		{"Lock file of a well-known file", "Gemfile.lock", []byte("GEM\n  remote: https://rubygems.org/\n"), false, true, "utf-8", "", ""},
+		{"LICENSE", "LICENSE", []byte("MIT License\n"), false, true, "utf-8", "", "text/plain; charset=utf-8"},
+		{"Empty file", "empty", nil, false, true, "utf-8", "", ""},
+		{"PNG magic", "logo.png", []byte("\x89PNG\r\n\x1a\n\x00\x00"), false, false, "", "", "image/png"},
+		{"Text with binary extension", "notes.bin", []byte("just text"), false, true, "utf-8", "", ""},
+		{"ELF executable", "tool", []byte("\x7FELF\x02\x01\x01"), false, false, "", "", "application/x-executable"},
+		{"Text starting like a signature", "notes", []byte("MZ notes\nRIFF and OTTO too\n"), false, true, "utf-8", "", ""},
+		{"Windows executable", "tool.exe", []byte("MZ\x90\x00\x03\x00"), false, false, "", "", "application/vnd.microsoft.portable-executable"},
+		{"NUL bytes", "data", []byte("abc\x00def"), false, false, "", "", "application/octet-stream"},
+		{"UTF-16LE BOM", "win.txt", []byte{0xFF, 0xFE, 'h', 0, 'i', 0}, false, true, "utf-16le", "", ""},
+		{"UTF-8 BOM", "bom.txt", []byte{0xEF, 0xBB, 0xBF, 'h', 'i'}, false, true, "utf-8", "", ""},
+		{"Latin-1 text", "old.txt", []byte("caf\xe9 cr\xe8me"), false, true, "latin-1", "", ""},
+		{"Cut multi-byte character", "long.txt", truncated, true, true, "utf-8", "", ""},
+		{"Control characters", "noise", []byte("\x01\x02\x03\x04\xff\xfe\x05"), false, false, "", "", "application/octet-stream"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind := sniffContent(tt.filename, tt.head, tt.truncated)
+			if kind.Text != tt.text {
+				t.Errorf("Text = %v, want %v", kind.Text, tt.text)
+			}
+			if kind.Encoding != tt.encoding {
+				t.Errorf("Encoding = %q, want %q", kind.Encoding, tt.encoding)
+			}
+			if kind.Language != tt.language {
+				t.Errorf("Language = %q, want %q", kind.Language, tt.language)
+			}
+			if tt.mimeType != "" && kind.MimeType != tt.mimeType {
+				t.Errorf("MimeType = %q, want %q", kind.MimeType, tt.mimeType)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  []byte
+		encoding string
+		expect   string
+	}{
+		{"UTF-8 BOM stripped", []byte{0xEF, 0xBB, 0xBF, 'o', 'k'}, "utf-8", "ok"},
+		{"UTF-16LE", []byte{0xFF, 0xFE, 'h', 0, 0xE9, 0}, "utf-16le", "hé"},
+		{"UTF-16BE", []byte{0xFE, 0xFF, 0, 'h', 0, 'i'}, "utf-16be", "hi"},
+		{"UTF-32LE", []byte{0xFF, 0xFE, 0, 0, 'a', 0, 0, 0}, "utf-32le", "a"},
+		{"Latin-1", []byte("caf\xe9"), "latin-1", "café"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeText(tt.content, tt.encoding); got != tt.expect {
+				t.Errorf("decodeText() = %q, want %q", got, tt.expect)
+			}
+		})
+	}
+}
+
+func TestRenderFileDetection(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"Makefile":  "build:\n\tgo build ./...\n",
+		"LICENSE":   "MIT License <c>",
+		"image.dat": "\x89PNG\r\n\x1a\n\x00\x00\x00",
+	})
+
+	tests := []struct {
+		file     string
+		class    string
+		contains string
+	}{
+		{"Makefile", "code", `class="language-makefile"`},
+		{"LICENSE", "text", "MIT License &lt;c&gt;"},
+		{"image.dat", "binary", "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			content, class := renderFile(filepath.Join(dir, tt.file))
+			if class != tt.class {
+				t.Errorf("class = %q, want %q", class, tt.class)
+			}
+			if !strings.Contains(content, tt.contains) {
+				t.Errorf("renderFile() missing %q in %q", tt.contains, content)
+			}
+		})
+	}
+
+	// The sidebar agrees with renderFile
+	listed, _, err := listDirectory(dir, ListOptions{Sort: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range listed {
+		wantViewable := f.Name != "image.dat"
+		if f.Viewable != wantViewable {
+			t.Errorf("%s: Viewable = %v, want %v", f.Name, f.Viewable, wantViewable)
+		}
+	}
+}
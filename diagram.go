@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diagramTimeout  = 20 * time.Second
+	diagramErrorMax = 2000 // Characters of renderer output shown with a failing diagram
+)
+
+// diagramTool is a local program rendering a diagram language to SVG
+type diagramTool struct {
+	Binary string
+	// Args returns the command line rendering input to output; id is unique
+	// to the diagram and theme, for tools that prefix their CSS with it
+	Args func(input, output, theme, id string) []string
+	// Themes are rendered side by side, the page shows the one matching its theme;
+	// without themes the SVG follows the page colours through currentColor
+	Themes []string
+}
+
+// Diagram languages rendered on the server, by fence language
+var diagramTools = map[string]*diagramTool{
+	"dot": {
+		Binary: "dot",
+		Args: func(input, output, theme, id string) []string {
+			return []string{"-Tsvg", "-o", output, input}
+		},
+	},
+	"mermaid": {
+		Binary: "mmdc",
+		Args: func(input, output, theme, id string) []string {
+			return []string{"--quiet", "-i", input, "-o", output, "-t", theme, "-b", "transparent", "--svgId", id}
+		},
+		Themes: []string{"default", "dark"},
+	},
+}
+
+var diagramAliases = map[string]string{"graphviz": "dot", "gv": "dot"}
+
+// Graphviz defaults turned into the page colours
+var dotColors = strings.NewReplacer(
+	`fill="white"`, `fill="none"`,
+	`stroke="black"`, `stroke="currentColor"`,
+	`fill="black"`, `fill="currentColor"`,
+)
+
+// isDiagramLang reports whether a fence language is rendered as a diagram
+func isDiagramLang(lang string) bool {
+	if _, ok := diagramTools[lang]; ok {
+		return true
+	}
+	_, ok := diagramAliases[lang]
+	return ok || lang == "plantuml" || lang == "puml"
+}
+
+// getDiagramCacheDir returns the directory of rendered diagrams, next to the CDN cache
+func getDiagramCacheDir() string {
+	return filepath.Join(filepath.Dir(getCacheDir()), "diagrams")
+}
+
+// renderDiagram renders a fenced diagram: PlantUML through its public server,
+// the others with a local tool, falling back to the browser for Mermaid
+func renderDiagram(lang, source string) string {
+	if lang == "plantuml" || lang == "puml" {
+		return fmt.Sprintf("<div class=\"plantuml\"><img src=\"https://www.plantuml.com/plantuml/svg/%s\" alt=\"PlantUML diagram\" loading=\"lazy\"></div>\n", encodePlantUML(source))
+	}
+	if alias, ok := diagramAliases[lang]; ok {
+		lang = alias
+	}
+	tool := diagramTools[lang]
+
+	path, err := exec.LookPath(tool.Binary)
+	if err != nil {
+		if lang == "mermaid" {
+			// Rendered by mermaid.js in the browser
+			return fmt.Sprintf("<div class=\"mermaid\">%s</div>\n", html.EscapeString(source))
+		}
+		return diagramError(lang, tool.Binary+" is not installed", source)
+	}
+
+	if len(tool.Themes) == 0 {
+		svg, err := renderDiagramSVG(lang, tool, path, source, "")
+		if err != nil {
+			return diagramError(lang, err.Error(), source)
+		}
+		return fmt.Sprintf("<div class=\"diagram diagram-%s\">%s</div>\n", lang, dotColors.Replace(sanitizeSVG(svg)))
+	}
+
+	// The themes render at the same time, the tools being slow to start
+	svgs := make([]string, len(tool.Themes))
+	errs := make([]error, len(tool.Themes))
+	var wg sync.WaitGroup
+	for i, theme := range tool.Themes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			svgs[i], errs[i] = renderDiagramSVG(lang, tool, path, source, theme)
+		}()
+	}
+	wg.Wait()
+
+	var sb strings.Builder
+	for i, svg := range svgs {
+		if errs[i] != nil {
+			return diagramError(lang, errs[i].Error(), source)
+		}
+		variant := "light"
+		if i > 0 {
+			variant = "dark"
+		}
+		sb.WriteString(fmt.Sprintf("<div class=\"diagram diagram-%s diagram-%s\">%s</div>\n", lang, variant, sanitizeSVG(svg)))
+	}
+	return sb.String()
+}
+
+// renderDiagramSVG runs a tool, or returns its output cached by content hash
+func renderDiagramSVG(lang string, tool *diagramTool, path, source, theme string) (string, error) {
+	sum := sha256.Sum256([]byte(lang + "\x00" + theme + "\x00" + source))
+	key := hex.EncodeToString(sum[:])
+	cachePath := filepath.Join(getDiagramCacheDir(), key+".svg")
+	if data, err := os.ReadFile(cachePath); err == nil {
+		return string(data), nil
+	}
+
+	dir, err := os.MkdirTemp("", "file-viewer-diagram-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	input, output := filepath.Join(dir, "diagram."+lang), filepath.Join(dir, "diagram.svg")
+	if err := os.WriteFile(input, []byte(source), 0600); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), diagramTimeout)
+	defer cancel()
+	id := lang + "-" + key[:12]
+	if theme != "" {
+		id += "-" + theme
+	}
+	cmd := exec.CommandContext(ctx, path, tool.Args(input, output, theme, id)...)
+	var stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stderr, &stderr
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if ctx.Err() != nil {
+			msg = fmt.Sprintf("timed out after %s", diagramTimeout)
+		} else if msg == "" {
+			msg = err.Error()
+		}
+		if r := []rune(msg); len(r) > diagramErrorMax {
+			msg = string(r[:diagramErrorMax]) + "…"
+		}
+		return "", fmt.Errorf("%s", msg)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		return "", err
+	}
+	// Inline SVG starts at the root element, without XML prolog or doctype
+	svg := string(data)
+	start := strings.Index(svg, "<svg")
+	if start < 0 {
+		return "", fmt.Errorf("%s produced no SVG", tool.Binary)
+	}
+	svg = strings.TrimSpace(svg[start:])
+
+	// Written aside then renamed, so concurrent renders never read half a file
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		tmp := cachePath + ".tmp" + filepath.Base(dir)
+		if os.WriteFile(tmp, []byte(svg), 0644) == nil {
+			os.Rename(tmp, cachePath)
+		}
+	}
+	return svg, nil
+}
+
+// diagramError shows why a diagram failed, with its source
+func diagramError(lang, message, source string) string {
+	return fmt.Sprintf("<div class=\"diagram-error\"><strong>⚠ %s diagram failed: %s</strong><pre><code>%s</code></pre></div>\n",
+		html.EscapeString(lang), html.EscapeString(message), html.EscapeString(source))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Diagram Tests =====
+
+// fakeTool installs a shell script as a diagram tool in an empty $PATH
+func fakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "bin")
+	if err := os.MkdirAll(bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(bin, name), []byte("#!/bin/sh\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin)
+	t.Setenv("HOME", t.TempDir())
+}
+
+func TestRenderDiagramDot(t *testing.T) {
+	// Counts its runs to check the cache
+	fakeTool(t, "dot", `echo run >> "$HOME/runs"
+printf '<?xml version="1.0"?>\n<!DOCTYPE svg>\n<svg><polygon fill="white" stroke="none"/><path stroke="black"/><text>a</text></svg>\n' > "$3"
+`)
+	result := renderMarkdown("```dot\ndigraph { a -> b }\n```\n", "")
+	for _, want := range []string{`<div class="diagram diagram-dot"><svg>`, `fill="none"`, `stroke="currentColor"`} {
+		if !strings.Contains(result, want) {
+			t.Errorf("missing %q in %s", want, result)
+		}
+	}
+	if strings.Contains(result, "<?xml") || strings.Contains(result, "code-block") {
+		t.Errorf("diagram should be inlined without prolog: %s", result)
+	}
+
+	renderDiagram("graphviz", "digraph { a -> b }")
+	runs, _ := os.ReadFile(filepath.Join(os.Getenv("HOME"), "runs"))
+	if strings.Count(string(runs), "run") != 1 {
+		t.Errorf("dot ran %d times, want 1 (cached)", strings.Count(string(runs), "run"))
+	}
+	matches, _ := filepath.Glob(filepath.Join(getDiagramCacheDir(), "*.svg"))
+	if len(matches) != 1 {
+		t.Errorf("cache holds %d diagrams, want 1", len(matches))
+	}
+}
+
+func TestRenderDiagramSanitized(t *testing.T) {
+	fakeTool(t, "dot", `printf '<svg><g id="a"><a xlink:href="javascript:alert(1)" xlink:title="a"><text>a</text></a></g></svg>\n' > "$3"`+"\n")
+	result := renderDiagram("dot", `digraph { a [URL="javascript:alert(1)"] }`)
+	if strings.Contains(result, "javascript:") || !strings.Contains(result, `<a xlink:title="a">`) {
+		t.Errorf("link target should be removed: %s", result)
+	}
+}
+
+func TestRenderDiagramError(t *testing.T) {
+	fakeTool(t, "dot", "echo 'Error: syntax error in line 1 near }' >&2\nexit 1\n")
+	result := renderDiagram("dot", "digraph { a -> }")
+	for _, want := range []string{`class="diagram-error"`, "syntax error in line 1 near }", "<code>digraph { a -&gt; }</code>"} {
+		if !strings.Contains(result, want) {
+			t.Errorf("missing %q in %s", want, result)
+		}
+	}
+	matches, _ := filepath.Glob(filepath.Join(getDiagramCacheDir(), "*"))
+	if len(matches) != 0 {
+		t.Error("failures should not be cached")
+	}
+}
+
+func TestRenderDiagramMermaid(t *testing.T) {
+	fakeTool(t, "mmdc", `printf '<svg id="%s" class="%s"></svg>' "${11}" "$7" > "$5"`+"\n")
+	result := renderDiagram("mermaid", "graph TD; A-->B")
+	for _, want := range []string{`diagram-mermaid diagram-light"><svg id="mermaid-`, `-default" class="default">`, `diagram-mermaid diagram-dark"><svg`, `class="dark"`} {
+		if !strings.Contains(result, want) {
+			t.Errorf("missing %q in %s", want, result)
+		}
+	}
+}
+
+func TestRenderDiagramWithoutTools(t *testing.T) {
+	t.Setenv("PATH", "")
+	if got := renderDiagram("mermaid", "graph TD; A-->B"); !strings.Contains(got, `<div class="mermaid">graph TD; A--&gt;B</div>`) {
+		t.Errorf("Mermaid should fall back to the browser: %s", got)
+	}
+	if got := renderDiagram("dot", "digraph {}"); !strings.Contains(got, "dot is not installed") {
+		t.Errorf("dot without Graphviz should explain why: %s", got)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// errNotFile is the error of paths naming a directory where a file is expected
+var errNotFile = errors.New("not a file")
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers an error as {"error": msg} to API clients and as plain
+// text to the others, see wantsJSON
+func writeError(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	if wantsJSON(r) {
+		writeJSON(w, status, map[string]string{"error": msg})
+		return
+	}
+	http.Error(w, msg, status)
+}
+
+// writeFileError answers the error of reading a file
+func writeFileError(w http.ResponseWriter, r *http.Request, err error) {
+	status, msg := fileErrorStatus(err)
+	writeError(w, r, status, msg)
+}
+
+// fileErrorStatus returns the status code and message of a file error: 404
+// when it does not exist, 403 when it cannot be read, 400 for directories
+func fileErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return http.StatusNotFound, "File not found"
+	case errors.Is(err, fs.ErrPermission):
+		return http.StatusForbidden, "Permission denied"
+	case errors.Is(err, errNotFile):
+		return http.StatusBadRequest, "Not a file"
+	}
+	return http.StatusInternalServerError, err.Error()
+}
+
+// probeFile returns the info of a readable file
+func probeFile(p string) (os.FileInfo, error) {
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: p, Err: errNotFile}
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	return info, nil
+}
+
+// checkFile returns the info of a file to serve, or answers the error and
+// returns nil when p is not a readable file or is larger than maxSize (413)
+// when maxSize > 0
+func checkFile(w http.ResponseWriter, r *http.Request, p string, maxSize int64) os.FileInfo {
+	info, err := probeFile(p)
+	if err != nil {
+		writeFileError(w, r, err)
+		return nil
+	}
+	if maxSize > 0 && info.Size() > maxSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, fmt.Sprintf("File too large: %s, the limit is %s", formatSize(info.Size()), formatSize(maxSize)))
+		return nil
+	}
+	return info
+}
+
+// wantsJSON reports whether a client should get errors in JSON: on API
+// routes unless it prefers HTML, elsewhere when it prefers JSON
+func wantsJSON(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	json, html := acceptQuality(accept, "application/json"), acceptQuality(accept, "text/html")
+	if isAPIPath(path.Clean(r.URL.Path)) {
+		return accept == "" || json >= html
+	}
+	return json > html
+}
+
+// acceptQuality returns the q value an Accept header gives a media type, or
+// an Accept-Encoding header a content coding, from its most specific
+// matching range
+func acceptQuality(accept, mediaType string) float64 {
+	major, _, _ := strings.Cut(mediaType, "/")
+	best, quality := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		specificity := -1
+		switch rng {
+		case mediaType:
+			specificity = 2
+		case major + "/*":
+			specificity = 1
+		case "*/*", "*":
+			specificity = 0
+		}
+		if specificity <= best {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		best, quality = specificity, q
+	}
+	return quality
+}
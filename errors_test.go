@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+// ===== Error Response Tests =====
+
+func TestAcceptQuality(t *testing.T) {
+	const browser = "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+	for _, tt := range []struct {
+		accept, mediaType string
+		want              float64
+	}{
+		{browser, "text/html", 1},
+		{browser, "application/json", 0.8},
+		{"application/json", "application/json", 1},
+		{"application/*;q=0.5, application/json;q=0.2", "application/json", 0.2},
+		{"text/*;q=0.3", "text/html", 0.3},
+		{"text/event-stream", "application/json", 0},
+		{"", "text/html", 0},
+		{"text/html;q=oops, */*", "text/html", 1},
+	} {
+		if got := acceptQuality(tt.accept, tt.mediaType); got != tt.want {
+			t.Errorf("acceptQuality(%q, %s) = %v, want %v", tt.accept, tt.mediaType, got, tt.want)
+		}
+	}
+}
+
+func TestWantsJSON(t *testing.T) {
+	for _, tt := range []struct {
+		target, accept string
+		want           bool
+	}{
+		{"/files", "", true},
+		{"/files", "*/*", true},
+		{"/asset?path=/tmp/a.png", "image/avif,image/webp,*/*;q=0.8", true},
+		{"/files", "text/html,*/*;q=0.8", false},
+		{"/tmp/a.md", "", false},
+		{"/tmp/a.md", "*/*", false},
+		{"/tmp/a.md", "application/json", true},
+		{"/cdn/cdn.jsdelivr.net/a.js", "*/*", false},
+	} {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		if got := wantsJSON(req); got != tt.want {
+			t.Errorf("%s with Accept %q: wantsJSON = %v", tt.target, tt.accept, got)
+		}
+	}
+}
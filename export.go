@@ -0,0 +1,363 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+const (
+	maxInlineAsset   = 10 * 1024 * 1024 // Larger images stay links in exports
+	pdfRenderTimeout = 60 * time.Second
+	katexCDN         = "cdn.jsdelivr.net/npm/katex@0.16.9/dist/"
+)
+
+var (
+	exportCodeRe   = regexp.MustCompile(`(?s)<code id="code-\d+"(?: class="language-([^"]+)")?>(.*?)</code>`)
+	exportAssetRe  = regexp.MustCompile(`src="/asset\?path=([^"]+)"`)
+	exportCopyRe   = regexp.MustCompile(`<button class="copy-btn"[^>]*>.*?</button>`)
+	exportFontRe   = regexp.MustCompile(`url\((fonts/[^)]+\.woff2)\)`)
+	exportMathRe   = regexp.MustCompile(`class="math-(inline|block)">\$`) // Formulas left to KaTeX
+	exportLightbox = ` onclick="openLightbox(this.src, this.alt)"`
+)
+
+// Styles of the exported page on top of the viewer styles; the @page margin
+// boxes give PDF renderers a running header and page numbers
+const exportCSS = `
+        body { background: white; }
+        .content { max-width: 900px; margin: 0 auto; border: none; }
+        .anchor-link, .copy-btn { display: none; }
+        .code-block pre { padding: 16px; overflow-x: auto; }
+        @media print {
+            .toc { display: block !important; }
+            .toc-nav a { color: black; }
+            h1, h2, h3 { break-after: avoid; }
+            pre, table, img { break-inside: avoid; }
+        }
+        @page {
+            size: A4;
+            margin: 2cm 1.8cm;
+            @top-center { content: %s; font-size: 9pt; color: #6b7280; }
+            @bottom-right { content: counter(page) " / " counter(pages); font-size: 9pt; color: #6b7280; }
+        }
+`
+
+// isMarkdownFile reports whether a path is rendered by renderMarkdown
+func isMarkdownFile(filePath string) bool {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// highlightCode replaces the code blocks of rendered Markdown by spans coloured
+// with the classes of chromaCSS; blocks of unknown languages stay plain
+func highlightCode(body string) string {
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(true))
+	style := styles.Get("github")
+	return exportCodeRe.ReplaceAllStringFunc(body, func(m string) string {
+		parts := exportCodeRe.FindStringSubmatch(m)
+		lexer := lexers.Get(parts[1])
+		if parts[1] == "" || lexer == nil {
+			return m
+		}
+		it, err := chroma.Coalesce(lexer).Tokenise(nil, html.UnescapeString(parts[2]))
+		if err != nil {
+			return m
+		}
+		var buf strings.Builder
+		if err := formatter.Format(&buf, style, it); err != nil {
+			return m
+		}
+		return fmt.Sprintf(`<code class="chroma language-%s">%s</code>`, html.EscapeString(parts[1]), buf.String())
+	})
+}
+
+// chromaCSS returns the stylesheet of the classes written by highlightCode
+func chromaCSS() string {
+	var buf strings.Builder
+	chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, styles.Get("github"))
+	return buf.String()
+}
+
+// dataURI encodes a local file as a data: URI
+func dataURI(filePath string) (string, error) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxInlineAsset {
+		return "", fmt.Errorf("%s is larger than %s", filePath, formatSize(maxInlineAsset))
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	mime, ok := assetContentTypes[strings.ToLower(filepath.Ext(filePath))]
+	if !ok {
+		mime = http.DetectContentType(data)
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+// inlineAssets turns the /asset URLs of rendered Markdown into data: URIs;
+// files that cannot be read keep their URL
+func inlineAssets(body string) string {
+	return exportAssetRe.ReplaceAllStringFunc(body, func(m string) string {
+		path := exportAssetRe.FindStringSubmatch(m)[1]
+		uri, err := dataURI(html.UnescapeString(path))
+		if err != nil {
+			return m
+		}
+		return `src="` + uri + `"`
+	})
+}
+
+// katexBundle returns KaTeX with its fonts as data: URIs, so math renders in
+// the exported file without network
+func katexBundle() (string, error) {
+	css, err := fetchCDN(katexCDN + "katex.min.css")
+	if err != nil {
+		return "", err
+	}
+	var fontErr error
+	inlined := exportFontRe.ReplaceAllStringFunc(string(css), func(m string) string {
+		font := exportFontRe.FindStringSubmatch(m)[1]
+		data, err := fetchCDN(katexCDN + font)
+		if err != nil {
+			fontErr = err
+			return m
+		}
+		return "url(data:font/woff2;base64," + base64.StdEncoding.EncodeToString(data) + ")"
+	})
+	if fontErr != nil {
+		return "", fontErr
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<style>" + inlined + "</style>\n")
+	for _, script := range []string{"katex.min.js", "contrib/auto-render.min.js"} {
+		js, err := fetchCDN(katexCDN + script)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString("<script>" + string(js) + "</script>\n")
+	}
+	sb.WriteString(`<script>
+renderMathInElement(document.body, {
+    delimiters: [{left: '$$', right: '$$', display: true}, {left: '$', right: '$', display: false}],
+    throwOnError: false
+});
+</script>
+`)
+	return sb.String(), nil
+}
+
+// exportHTML renders a Markdown file as a self-contained page: viewer and
+// highlighting styles inline, images as data: URIs, code highlighted and
+// math rendered without network access
+func exportHTML(filePath string) (string, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	body := renderMarkdown(string(content), filepath.Dir(filePath))
+	body = highlightCode(body)
+	body = inlineAssets(body)
+	body = exportCopyRe.ReplaceAllString(body, "")
+	body = strings.ReplaceAll(body, exportLightbox, "")
+	body = strings.Replace(body, `<details class="toc">`, `<details class="toc" open>`, 1)
+
+	title := pageTitle(filePath, filepath.Base(filePath))
+	math := ""
+	if exportMathRe.MatchString(body) {
+		if math, err = katexBundle(); err != nil {
+			// The TeX source stays readable between its delimiters
+			fmt.Fprintf(os.Stderr, "export: math left unrendered: %v\n", err)
+		}
+	}
+
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <style>%s
+%s
+%s
+    </style>
+</head>
+<body>
+    <div class="content markdown">%s</div>
+%s</body>
+</html>
+`, html.EscapeString(title), viewerCSS, chromaCSS(), fmt.Sprintf(exportCSS, cssString(title)), body, math), nil
+}
+
+// cssString quotes a value for the CSS content property
+func cssString(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", " ", "<", `\3c `).Replace(s)
+	return `"` + s + `"`
+}
+
+// pdfRenderer is a headless program turning an HTML file into a PDF
+type pdfRenderer struct {
+	Name string // chromium, weasyprint or wkhtmltopdf
+	Path string
+}
+
+// Programs tried by findPDFRenderer, in order
+var pdfRendererCandidates = []struct {
+	name     string
+	binaries []string
+}{
+	{"chromium", []string{"chromium", "chromium-browser", "google-chrome", "google-chrome-stable", "microsoft-edge"}},
+	{"weasyprint", []string{"weasyprint"}},
+	{"wkhtmltopdf", []string{"wkhtmltopdf"}},
+}
+
+// findPDFRenderer returns the configured PDF renderer or the first one found in $PATH
+func findPDFRenderer() (*pdfRenderer, error) {
+	if configured := appConfig.PDFRenderer; configured != "" {
+		path, err := exec.LookPath(configured)
+		if err != nil {
+			return nil, fmt.Errorf("PDF renderer %s: %w", configured, err)
+		}
+		base := strings.ToLower(filepath.Base(path))
+		for _, c := range pdfRendererCandidates {
+			for _, bin := range c.binaries {
+				if strings.HasPrefix(base, bin) {
+					return &pdfRenderer{Name: c.name, Path: path}, nil
+				}
+			}
+		}
+		// Unknown names are assumed to accept Chromium flags (Brave, Vivaldi...)
+		return &pdfRenderer{Name: "chromium", Path: path}, nil
+	}
+
+	for _, c := range pdfRendererCandidates {
+		for _, bin := range c.binaries {
+			if path, err := exec.LookPath(bin); err == nil {
+				return &pdfRenderer{Name: c.name, Path: path}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no PDF renderer found, install Chromium, WeasyPrint or wkhtmltopdf")
+}
+
+// args returns the command line converting input to output
+func (p *pdfRenderer) args(input, output, title string) []string {
+	switch p.Name {
+	case "weasyprint":
+		return []string{"--quiet", input, output}
+	case "wkhtmltopdf":
+		// Qt WebKit ignores @page margin boxes
+		return []string{"--quiet", "--enable-local-file-access", "--javascript-delay", "1000",
+			"--page-size", "A4", "--margin-top", "20mm", "--margin-bottom", "20mm",
+			"--header-center", title, "--header-font-size", "8", "--header-spacing", "5",
+			"--footer-right", "[page] / [topage]", "--footer-font-size", "8", "--footer-spacing", "5",
+			input, output}
+	}
+	args := []string{"--headless", "--disable-gpu", "--no-pdf-header-footer",
+		"--virtual-time-budget=10000", "--print-to-pdf=" + output}
+	if os.Geteuid() == 0 {
+		// Chromium refuses to start its sandbox as root
+		args = append(args, "--no-sandbox")
+	}
+	return append(args, "file://"+input)
+}
+
+// render converts a page to PDF in a temporary directory
+func (p *pdfRenderer) render(ctx context.Context, page, title string) ([]byte, error) {
+	dir, err := os.MkdirTemp("", "file-viewer-pdf-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	input, output := filepath.Join(dir, "page.html"), filepath.Join(dir, "page.pdf")
+	if err := os.WriteFile(input, []byte(page), 0600); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, pdfRenderTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, p.Path, p.args(input, output, title)...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v: %s", p.Name, err, strings.TrimSpace(stderr.String()))
+	}
+	return os.ReadFile(output)
+}
+
+// handleExport serves /export?path=&format=html|pdf[&download=1]
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path, format := q.Get("path"), strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = "html"
+	}
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	if format != "html" && format != "pdf" {
+		writeError(w, r, http.StatusBadRequest, "Unsupported export format: "+format)
+		return
+	}
+	if !isMarkdownFile(path) {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Only Markdown files can be exported")
+		return
+	}
+	if checkFile(w, r, path, MaxViewableSize) == nil {
+		return
+	}
+
+	var renderer *pdfRenderer
+	if format == "pdf" {
+		var err error
+		if renderer, err = findPDFRenderer(); err != nil {
+			writeError(w, r, http.StatusNotImplemented, err.Error())
+			return
+		}
+	}
+
+	page, err := exportHTML(path)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	out, contentType := []byte(page), "text/html; charset=utf-8"
+	if renderer != nil {
+		if out, err = renderer.render(r.Context(), page, filepath.Base(path)); err != nil {
+			writeError(w, r, http.StatusInternalServerError, "PDF rendering failed: "+err.Error())
+			return
+		}
+		contentType = "application/pdf"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if renderer == nil {
+		w.Header().Set("Content-Security-Policy", exportCSP)
+	}
+	if q.Get("download") == "1" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + "." + format
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	}
+	w.Write(out)
+}
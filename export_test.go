@@ -0,0 +1,107 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Export Tests =====
+
+// 1x1 transparent PNG
+var testPNG = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x01\x00\x00\x00\x01\x08\x06\x00\x00\x00\x1f\x15\xc4\x89\x00\x00\x00\rIDATx\x9cc\x00\x01\x00\x00\x05\x00\x01\r\n-\xb4\x00\x00\x00\x00IEND\xaeB`\x82")
+
+func TestExportHTML(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "logo.png"), testPNG, 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "guide.md")
+	md := "# Guide\n\n![Logo](logo.png)\n\n![Remote](https://example.com/a.png)\n\n```go\nfunc main() {}\n```\n\n```unknownlang\n<raw>\n```\n"
+	if err := os.WriteFile(path, []byte(md), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := exportHTML(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<title>guide.md</title>",
+		`src="data:image/png;base64,`,
+		`src="https://example.com/a.png"`,
+		`<code class="chroma language-go">`,
+		`<span class="kd">func</span>`,
+		".chroma .kd {",
+		"&lt;raw&gt;",
+		`@top-center { content: "guide.md";`,
+		"counter(pages)",
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("export missing %q", want)
+		}
+	}
+	for _, unwanted := range []string{"/asset?path=", "openLightbox(", `class="copy-btn"`, "<script"} {
+		if strings.Contains(page, unwanted) {
+			t.Errorf("export should not contain %q", unwanted)
+		}
+	}
+}
+
+func TestPDFRendererArgs(t *testing.T) {
+	chromium := &pdfRenderer{Name: "chromium", Path: "/usr/bin/chromium"}
+	args := strings.Join(chromium.args("/tmp/in.html", "/tmp/out.pdf", "doc.md"), " ")
+	for _, want := range []string{"--headless", "--no-pdf-header-footer", "--print-to-pdf=/tmp/out.pdf", "file:///tmp/in.html"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("chromium args %q missing %q", args, want)
+		}
+	}
+
+	wk := &pdfRenderer{Name: "wkhtmltopdf", Path: "/usr/bin/wkhtmltopdf"}
+	args = strings.Join(wk.args("/tmp/in.html", "/tmp/out.pdf", "doc.md"), " ")
+	if !strings.Contains(args, "--header-center doc.md") || !strings.Contains(args, "[page] / [topage]") {
+		t.Errorf("wkhtmltopdf args %q should set header and page numbers", args)
+	}
+}
+
+func TestHandleExport(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.md")
+	if err := os.WriteFile(path, []byte("# Notes\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	handleExport(rec, httptest.NewRequest("GET", "/export?path="+url.QueryEscape(path)+"&download=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if cd := rec.Header().Get("Content-Disposition"); cd != `attachment; filename="notes.html"` {
+		t.Errorf("Content-Disposition = %q", cd)
+	}
+
+	// No renderer can be found with an empty $PATH
+	t.Setenv("PATH", "")
+	rec = httptest.NewRecorder()
+	handleExport(rec, httptest.NewRequest("GET", "/export?path="+url.QueryEscape(path)+"&format=pdf", nil))
+	if rec.Code != http.StatusNotImplemented {
+		t.Errorf("PDF without renderer status = %d, want 501", rec.Code)
+	}
+
+	for query, status := range map[string]int{
+		"format=html":                http.StatusBadRequest,
+		"path=/tmp/a.json":           http.StatusUnsupportedMediaType,
+		"path=/nonexistent/a.md":     http.StatusNotFound,
+		"path=/tmp/a.md&format=docx": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handleExport(rec, httptest.NewRequest("GET", "/export?"+query, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, status)
+		}
+	}
+}
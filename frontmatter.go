@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const frontMatterMax = 64 * 1024 // Front matter must end within the first 64KB
+
+// A YAML block is only front matter when it opens with a key, so a document
+// starting with a horizontal rule still renders as before
+var frontMatterKeyRe = regexp.MustCompile(`^["']?[\w.-]+["']?\s*:`)
+
+// frontMatter is the metadata block at the top of a Markdown file, between
+// --- lines (YAML, Jekyll/Hugo/Obsidian) or +++ lines (TOML, Hugo)
+type frontMatter struct {
+	Format string // yaml or toml
+	Raw    string
+	Values map[string]interface{}
+	Error  string
+}
+
+// splitFrontMatter separates the front matter from the Markdown that follows
+// it; content without front matter is returned unchanged with nil
+func splitFrontMatter(content string) (*frontMatter, string) {
+	text := strings.TrimPrefix(content, "\ufeff")
+	first, rest, ok := strings.Cut(text, "\n")
+	if !ok {
+		return nil, content
+	}
+
+	format, closers := "", []string{}
+	switch strings.TrimRight(first, " \t\r") {
+	case "---":
+		format, closers = "yaml", []string{"---", "..."}
+	case "+++":
+		format, closers = "toml", []string{"+++"}
+	default:
+		return nil, content
+	}
+
+	lines := strings.SplitAfter(rest, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimRight(line, " \t\r\n")
+		if trimmed != closers[0] && (len(closers) < 2 || trimmed != closers[1]) {
+			continue
+		}
+		raw := strings.Join(lines[:i], "")
+		if format == "yaml" && !looksLikeYAMLMapping(raw) {
+			return nil, content
+		}
+		fm := &frontMatter{Format: format, Raw: raw, Values: map[string]interface{}{}}
+		if strings.TrimSpace(raw) != "" {
+			doc, err := parseStructured(raw, format)
+			if err != nil {
+				fm.Error = err.Error()
+			} else if values, ok := doc.(map[string]interface{}); ok {
+				fm.Values = values
+			} else {
+				fm.Error = "front matter is not a mapping"
+			}
+		}
+		return fm, strings.Join(lines[i+1:], "")
+	}
+	return nil, content
+}
+
+// looksLikeYAMLMapping reports whether the first meaningful line is a key
+func looksLikeYAMLMapping(raw string) bool {
+	for _, line := range strings.Split(raw, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		return frontMatterKeyRe.MatchString(line)
+	}
+	// An empty block is front matter
+	return true
+}
+
+// readFrontMatter reads the front matter of a Markdown file, nil if it has none
+func readFrontMatter(filePath string) *frontMatter {
+	if !isMarkdownFile(filePath) {
+		return nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	head, err := io.ReadAll(io.LimitReader(f, frontMatterMax))
+	if err != nil {
+		return nil
+	}
+	fm, _ := splitFrontMatter(string(head))
+	return fm
+}
+
+// Title returns the title field
+func (fm *frontMatter) Title() string {
+	if fm == nil {
+		return ""
+	}
+	if title, ok := fm.Values["title"].(string); ok {
+		return strings.TrimSpace(title)
+	}
+	return ""
+}
+
+// Tags returns the tags field, a list or a comma or space separated string
+func (fm *frontMatter) Tags() []string {
+	if fm == nil {
+		return nil
+	}
+	var tags []string
+	switch v := fm.Values["tags"].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" && item != nil {
+				tags = append(tags, strings.TrimPrefix(s, "#"))
+			}
+		}
+	case string:
+		sep := " "
+		if strings.Contains(v, ",") {
+			sep = ","
+		}
+		for _, s := range strings.Split(v, sep) {
+			if s = strings.TrimSpace(s); s != "" {
+				tags = append(tags, strings.TrimPrefix(s, "#"))
+			}
+		}
+	}
+	return tags
+}
+
+// Date returns the date field, without its time when it is midnight
+func (fm *frontMatter) Date() string {
+	if fm == nil {
+		return ""
+	}
+	var date string
+	switch v := fm.Values["date"].(type) {
+	case string:
+		date = v
+	case float64:
+		date = fmt.Sprint(v)
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(date, "T00:00:00Z"), "T00:00:00")
+}
+
+// pageTitle returns the front matter title of a Markdown file, or its name
+func pageTitle(filePath, fallback string) string {
+	if title := readFrontMatter(filePath).Title(); title != "" {
+		return title
+	}
+	return fallback
+}
+
+// summary renders the title, date and tags, for the card and directory listings
+func (fm *frontMatter) summary() string {
+	var sb strings.Builder
+	if title := fm.Title(); title != "" {
+		sb.WriteString(` <span class="front-matter-title">` + html.EscapeString(title) + `</span>`)
+	}
+	if date := fm.Date(); date != "" {
+		sb.WriteString(` <span class="front-matter-date">` + html.EscapeString(date) + `</span>`)
+	}
+	for _, tag := range fm.Tags() {
+		sb.WriteString(` <span class="front-matter-chip">#` + html.EscapeString(tag) + `</span>`)
+	}
+	return sb.String()
+}
+
+// frontMatterValue renders a metadata value: scalars as text, lists of
+// scalars as chips, anything else as JSON
+func frontMatterValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return `<span class="front-matter-null">null</span>`
+	case string:
+		return html.EscapeString(val)
+	case []interface{}:
+		var sb strings.Builder
+		for _, item := range val {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return "<code>" + html.EscapeString(mustJSON(val)) + "</code>"
+			}
+			sb.WriteString(`<span class="front-matter-chip">` + html.EscapeString(fmt.Sprint(item)) + "</span>")
+		}
+		return sb.String()
+	case map[string]interface{}:
+		return "<code>" + html.EscapeString(mustJSON(val)) + "</code>"
+	}
+	return html.EscapeString(fmt.Sprint(v))
+}
+
+// renderFrontMatter renders the metadata card shown above the document
+func renderFrontMatter(fm *frontMatter) string {
+	if fm.Error != "" {
+		return fmt.Sprintf(`<details class="front-matter front-matter-invalid" open><summary>⚠ Invalid %s front matter: %s</summary><pre>%s</pre></details>`+"\n",
+			strings.ToUpper(fm.Format), html.EscapeString(fm.Error), html.EscapeString(fm.Raw))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(`<details class="front-matter"><summary><span class="front-matter-label">📋 Metadata</span>`)
+	sb.WriteString(fm.summary())
+	sb.WriteString("</summary>\n<table class=\"front-matter-table\">\n")
+	for _, key := range sortedKeys(fm.Values) {
+		sb.WriteString(fmt.Sprintf("<tr><th>%s</th><td>%s</td></tr>\n", html.EscapeString(key), frontMatterValue(fm.Values[key])))
+	}
+	sb.WriteString("</table>\n</details>\n")
+	return sb.String()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// ===== Front Matter Tests =====
+
+func TestSplitFrontMatter(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		format  string // Empty when the content has no front matter
+		body    string
+	}{
+		{"yaml", "---\ntitle: Notes\n---\n# Body\n", "yaml", "# Body\n"},
+		{"yaml dots", "---\ntitle: Notes\n...\nBody\n", "yaml", "Body\n"},
+		{"yaml crlf", "---\r\ntitle: Notes\r\n---\r\nBody\r\n", "yaml", "Body\r\n"},
+		{"bom", "\ufeff---\ntitle: Notes\n---\nBody\n", "yaml", "Body\n"},
+		{"toml", "+++\ntitle = \"Notes\"\n+++\nBody\n", "toml", "Body\n"},
+		{"empty", "---\n---\nBody\n", "yaml", "Body\n"},
+		{"horizontal rule", "---\nSome text\n---\n", "", "---\nSome text\n---\n"},
+		{"unclosed", "---\ntitle: Notes\nBody\n", "", "---\ntitle: Notes\nBody\n"},
+		{"not at start", "Intro\n---\ntitle: x\n---\n", "", "Intro\n---\ntitle: x\n---\n"},
+	}
+	for _, tt := range tests {
+		fm, body := splitFrontMatter(tt.content)
+		if tt.format == "" {
+			if fm != nil {
+				t.Errorf("%s: unexpected front matter %+v", tt.name, fm)
+			}
+		} else if fm == nil || fm.Format != tt.format {
+			t.Errorf("%s: expected %s front matter, got %+v", tt.name, tt.format, fm)
+		}
+		if body != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.name, body, tt.body)
+		}
+	}
+}
+
+func TestFrontMatterFields(t *testing.T) {
+	fm, _ := splitFrontMatter("---\ntitle: ' Release notes '\ndate: 2024-03-01\ntags: [go, \"#web\"]\n---\n")
+	if fm.Title() != "Release notes" {
+		t.Errorf("title: %q", fm.Title())
+	}
+	if fm.Date() != "2024-03-01" {
+		t.Errorf("date: %q", fm.Date())
+	}
+	if !reflect.DeepEqual(fm.Tags(), []string{"go", "web"}) {
+		t.Errorf("tags: %v", fm.Tags())
+	}
+
+	for tags, want := range map[string][]string{
+		"go, web":  {"go", "web"},
+		"#go #web": {"go", "web"},
+		"single":   {"single"},
+		"":         nil,
+	} {
+		fm := &frontMatter{Values: map[string]interface{}{"tags": tags}}
+		if got := fm.Tags(); !reflect.DeepEqual(got, want) {
+			t.Errorf("tags %q: got %v, want %v", tags, got, want)
+		}
+	}
+
+	fm, _ = splitFrontMatter("+++\ndate = 2024-03-01T10:30:00Z\n+++\n")
+	if fm.Date() != "2024-03-01T10:30:00Z" {
+		t.Errorf("TOML date: %q", fm.Date())
+	}
+
+	// Without front matter every field is empty
+	var none *frontMatter
+	if none.Title() != "" || none.Tags() != nil || none.Date() != "" || none.summary() != "" {
+		t.Error("nil front matter should have no fields")
+	}
+}
+
+func TestRenderMarkdownFrontMatter(t *testing.T) {
+	result := renderMarkdown("---\ntitle: Guide\nauthor: <Ann>\ntags: [a, b]\ndraft: false\n---\n# Heading\n", "")
+	for _, want := range []string{
+		`<details class="front-matter">`,
+		`<span class="front-matter-title">Guide</span>`,
+		`<span class="front-matter-chip">#a</span>`,
+		`<tr><th>author</th><td>&lt;Ann&gt;</td></tr>`,
+		`<tr><th>draft</th><td>false</td></tr>`,
+		`<h1 id="heading"`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in:\n%s", want, result)
+		}
+	}
+	if strings.Contains(result, "<hr") || strings.Contains(result, "title: Guide") {
+		t.Error("front matter should not render as Markdown")
+	}
+
+	invalid := renderMarkdown("---\ntitle: [unclosed\n---\nBody\n", "")
+	if !strings.Contains(invalid, `front-matter-invalid`) || !strings.Contains(invalid, "Invalid YAML front matter") {
+		t.Errorf("expected an error card, got:\n%s", invalid)
+	}
+	if !strings.Contains(invalid, "<pre>title: [unclosed\n</pre>") {
+		t.Error("invalid front matter should be shown as is")
+	}
+}
+
+func TestFrontMatterFileEntry(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "post.md")
+	if err := os.WriteFile(path, []byte("---\ntitle: My Post\ntags: notes\ndate: 2024-01-02\n---\n# Post\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fe := FileEntry{Name: "post.md", Path: path}
+	enrichFileEntry(&fe)
+	if fe.Title != "My Post" || !reflect.DeepEqual(fe.Tags, []string{"notes"}) || fe.Date != "2024-01-02" {
+		t.Errorf("unexpected entry %+v", fe)
+	}
+	if got := pageTitle(path, "post.md"); got != "My Post" {
+		t.Errorf("pageTitle: %q", got)
+	}
+	if got := pageTitle(filepath.Join(dir, "missing.md"), "missing.md"); got != "missing.md" {
+		t.Errorf("pageTitle fallback: %q", got)
+	}
+}
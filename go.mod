@@ -1,3 +1,14 @@
 module file-viewer
 
 go 1.25.3
+
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/alecthomas/chroma/v2 v2.14.0
+	github.com/andybalholm/brotli v1.2.0
+	golang.org/x/crypto v0.54.0
+	golang.org/x/net v0.57.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require github.com/dlclark/regexp2 v1.11.0 // indirect
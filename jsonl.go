@@ -0,0 +1,424 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Number of JSON Lines records rendered per page
+const jsonlPageSize = 500
+
+// Longest cell text in the column table view, in characters
+const jsonlCellMax = 200
+
+// Longest record preview in a collapsed header, in characters
+const jsonlSummaryMax = 160
+
+// Longest line parsed as a record; longer lines are shown cut, as errors
+const maxJSONLLineBytes = 1 << 20
+
+// jsonlRecord is one non-empty line of a JSON Lines file
+type jsonlRecord struct {
+	Line  int
+	Raw   []byte
+	Value interface{}
+	Keys  []string // top-level keys in file order, for objects
+	Error string
+}
+
+// jsonlPage is a page of records read from a byte offset
+type jsonlPage struct {
+	Records    []jsonlRecord
+	NextOffset int64
+	NextLine   int
+	EOF        bool
+}
+
+// readJSONLines parses up to limit records starting at a byte offset which
+// must be the start of line number line (1-based)
+func readJSONLines(path string, offset int64, line, limit int) (*jsonlPage, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	page := &jsonlPage{NextOffset: offset, NextLine: line}
+	r := bufio.NewReader(f)
+	for len(page.Records) < limit {
+		// One byte more than the limit tells a long line from one at the limit
+		raw, n, err := readLine(r, maxJSONLLineBytes+1)
+		if err == io.EOF {
+			page.EOF = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		page.NextOffset += n
+		page.NextLine++
+
+		if len(raw) > maxJSONLLineBytes {
+			page.Records = append(page.Records, jsonlRecord{
+				Line:  page.NextLine - 1,
+				Raw:   []byte(truncateRunes(string(raw), jsonlSummaryMax)),
+				Error: fmt.Sprintf("line longer than %s, not parsed", formatSize(maxJSONLLineBytes)),
+			})
+			continue
+		}
+		raw = bytes.TrimSpace(raw)
+		if len(raw) > 0 {
+			page.Records = append(page.Records, parseJSONLine(page.NextLine-1, raw))
+		}
+	}
+	if !page.EOF {
+		// Report EOF now rather than on an empty next page
+		if _, err := r.Peek(1); err == io.EOF {
+			page.EOF = true
+		}
+	}
+	return page, nil
+}
+
+// parseJSONLine parses one record, keeping the error instead of failing the whole file
+func parseJSONLine(line int, raw []byte) jsonlRecord {
+	rec := jsonlRecord{Line: line, Raw: raw}
+	if err := json.Unmarshal(raw, &rec.Value); err != nil {
+		rec.Error = err.Error()
+		return rec
+	}
+	if _, ok := rec.Value.(map[string]interface{}); ok {
+		rec.Keys = topLevelKeys(raw)
+	}
+	return rec
+}
+
+// topLevelKeys returns the keys of a JSON object in the order they are written
+func topLevelKeys(raw []byte) []string {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil
+	}
+	var keys []string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return keys
+		}
+		keys = append(keys, tok.(string))
+		var skip json.RawMessage
+		if err := dec.Decode(&skip); err != nil {
+			return keys
+		}
+	}
+	return keys
+}
+
+// jsonlColumns derives table columns from the records' top-level keys, in order of first appearance
+func jsonlColumns(records []jsonlRecord) []string {
+	var columns []string
+	seen := make(map[string]bool)
+	for _, rec := range records {
+		for _, k := range rec.Keys {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	return columns
+}
+
+// jsonlCell returns the text shown in the table for a top-level value
+func jsonlCell(v interface{}) string {
+	var text string
+	switch val := v.(type) {
+	case string:
+		text = val
+	case nil:
+		text = ""
+	default:
+		b, _ := json.Marshal(val)
+		text = string(b)
+	}
+	return truncateRunes(text, jsonlCellMax)
+}
+
+// jsonlSummary returns a one-line preview of a record for its collapsed header
+func jsonlSummary(rec jsonlRecord) string {
+	return truncateRunes(string(rec.Raw), jsonlSummaryMax)
+}
+
+// truncateRunes cuts s to max characters followed by an ellipsis. Only the
+// bytes that can hold them are decoded, however long s is.
+func truncateRunes(s string, max int) string {
+	cut := len(s) > max*utf8.UTFMax
+	if cut {
+		s = s[:max*utf8.UTFMax]
+	}
+	r := []rune(s)
+	if len(r) > max {
+		r, cut = r[:max], true
+	}
+	if !cut {
+		return s
+	}
+	return string(r) + "…"
+}
+
+// renderJSONLRecord renders one record of the list view
+func renderJSONLRecord(rec jsonlRecord) string {
+	if rec.Error != "" {
+		return fmt.Sprintf(`<div class="jsonl-record jsonl-error" id="jsonl-L%d"><span class="jsonl-line">%d</span><span class="error">%s</span><pre>%s</pre></div>`,
+			rec.Line, rec.Line, html.EscapeString(rec.Error), html.EscapeString(string(rec.Raw)))
+	}
+	return fmt.Sprintf(`<details class="jsonl-record" id="jsonl-L%d"><summary><span class="jsonl-line">%d</span><code>%s</code></summary><div class="json-tree"><ul><li>%s</li></ul></div></details>`,
+		rec.Line, rec.Line, html.EscapeString(jsonlSummary(rec)), renderJSONTree(rec.Value))
+}
+
+// renderJSONLRow renders one record of the table view
+func renderJSONLRow(rec jsonlRecord, columns []string) string {
+	var sb strings.Builder
+	if rec.Error != "" {
+		sb.WriteString(fmt.Sprintf(`<tr class="jsonl-error"><td class="jsonl-line">%d</td><td colspan="%d">%s</td></tr>`, rec.Line, max(len(columns), 1), html.EscapeString(rec.Error)))
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf(`<tr><td class="jsonl-line">%d</td>`, rec.Line))
+	obj, isObject := rec.Value.(map[string]interface{})
+	if !isObject {
+		sb.WriteString(fmt.Sprintf(`<td colspan="%d">%s</td></tr>`, max(len(columns), 1), html.EscapeString(jsonlCell(rec.Value))))
+		return sb.String()
+	}
+	for _, col := range columns {
+		cell := ""
+		if v, ok := obj[col]; ok {
+			cell = jsonlCell(v)
+		}
+		sb.WriteString(fmt.Sprintf(`<td>%s</td>`, html.EscapeString(cell)))
+	}
+	sb.WriteString(`</tr>`)
+	return sb.String()
+}
+
+// renderJSONLines renders a JSON Lines / NDJSON file: the first page of records
+// as an expandable list and as a table, later pages are fetched from /jsonl
+func renderJSONLines(filePath string) string {
+	page, err := readJSONLines(filePath, 0, 1, jsonlPageSize)
+	if err != nil {
+		return fmt.Sprintf(`<p style="color: red;">Error reading file: %s</p>`, html.EscapeString(err.Error()))
+	}
+	columns := jsonlColumns(page.Records)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf(`<div class="json-toolbar jsonl-toolbar">
+    <button id="jsonl-view-list" class="active" onclick="setJSONLView('list')">Records</button>
+    <button id="jsonl-view-table" onclick="setJSONLView('table')">Table</button>
+    <input type="text" id="jsonl-filter" placeholder="Filter records..." oninput="filterJSONL()" />
+    <span id="jsonl-count" class="search-count"></span>
+    <a href="#" id="jsonl-first-error" class="jsonl-error-count" onclick="jumpToJSONLError(); return false;"></a>
+</div>
+<div id="jsonl-data" data-path="%s" data-offset="%d" data-line="%d" data-columns="%s"></div>`,
+		html.EscapeString(filePath), page.NextOffset, page.NextLine, html.EscapeString(mustJSON(columns))))
+
+	result.WriteString(`<div class="jsonl-list" id="jsonl-list">`)
+	for _, rec := range page.Records {
+		result.WriteString(renderJSONLRecord(rec))
+		result.WriteString("\n")
+	}
+	result.WriteString(`</div>`)
+
+	result.WriteString(`<div class="csv-container jsonl-table-view" id="jsonl-table-view" style="display:none"><table class="csv-table" id="jsonl-table"><thead><tr><th>#</th>`)
+	for _, col := range columns {
+		result.WriteString(fmt.Sprintf(`<th>%s</th>`, html.EscapeString(col)))
+	}
+	result.WriteString(`</tr></thead><tbody>`)
+	for _, rec := range page.Records {
+		result.WriteString(renderJSONLRow(rec, columns))
+	}
+	result.WriteString(`</tbody></table></div>`)
+
+	loadMore := ""
+	if page.EOF {
+		loadMore = ` style="display:none"`
+	}
+	result.WriteString(fmt.Sprintf(`<div class="jsonl-more"><button id="jsonl-more-btn" onclick="loadMoreJSONL()"%s>Load %d more records</button></div>`, loadMore, jsonlPageSize))
+	result.WriteString(withNonce(`
+<script>
+function setJSONLView(view) {
+    document.getElementById('jsonl-list').style.display = view === 'list' ? '' : 'none';
+    document.getElementById('jsonl-table-view').style.display = view === 'table' ? '' : 'none';
+    document.getElementById('jsonl-view-list').classList.toggle('active', view === 'list');
+    document.getElementById('jsonl-view-table').classList.toggle('active', view === 'table');
+}
+function filterJSONL() {
+    const q = document.getElementById('jsonl-filter').value.toLowerCase();
+    const records = document.querySelectorAll('#jsonl-list .jsonl-record');
+    const rows = document.querySelectorAll('#jsonl-table tbody tr');
+    let shown = 0;
+    records.forEach((el, i) => {
+        const match = !q || el.textContent.toLowerCase().includes(q);
+        el.style.display = match ? '' : 'none';
+        if (rows[i]) rows[i].style.display = match ? '' : 'none';
+        if (match) shown++;
+    });
+    document.getElementById('jsonl-count').textContent = (q ? shown + ' / ' : '') + records.length + ' records';
+    const errors = document.querySelectorAll('#jsonl-list .jsonl-error').length;
+    document.getElementById('jsonl-first-error').textContent = errors ? '⚠️ ' + errors + ' invalid line' + (errors > 1 ? 's' : '') : '';
+}
+function jumpToJSONLError() {
+    setJSONLView('list');
+    const el = document.querySelector('#jsonl-list .jsonl-error');
+    if (el) el.scrollIntoView({ block: 'center' });
+}
+async function loadMoreJSONL() {
+    const data = document.getElementById('jsonl-data');
+    const btn = document.getElementById('jsonl-more-btn');
+    btn.disabled = true;
+    const res = await fetch('/jsonl?path=' + encodeURIComponent(data.dataset.path) + '&offset=' + data.dataset.offset + '&line=' + data.dataset.line);
+    const page = await res.json();
+    btn.disabled = false;
+    if (!res.ok) { btn.textContent = page.error; return; }
+
+    // New keys become new columns, earlier rows get empty cells
+    const columns = JSON.parse(data.dataset.columns);
+    const headRow = document.querySelector('#jsonl-table thead tr');
+    const body = document.querySelector('#jsonl-table tbody');
+    page.columns.forEach(col => {
+        if (columns.includes(col)) return;
+        columns.push(col);
+        const th = document.createElement('th');
+        th.textContent = col;
+        headRow.appendChild(th);
+        body.querySelectorAll('tr:not(.jsonl-error)').forEach(tr => {
+            if (tr.querySelector('td[colspan]')) return;
+            tr.appendChild(document.createElement('td'));
+        });
+    });
+    const list = document.getElementById('jsonl-list');
+    page.records.forEach(rec => {
+        list.insertAdjacentHTML('beforeend', rec.html);
+        const tr = document.createElement('tr');
+        const num = document.createElement('td');
+        num.className = 'jsonl-line';
+        num.textContent = rec.line;
+        tr.appendChild(num);
+        if (rec.error || !rec.cells) {
+            if (rec.error) tr.className = 'jsonl-error';
+            const td = document.createElement('td');
+            td.colSpan = Math.max(columns.length, 1);
+            td.textContent = rec.error || rec.text;
+            tr.appendChild(td);
+        } else {
+            columns.forEach(col => {
+                const td = document.createElement('td');
+                td.textContent = rec.cells[col] !== undefined ? rec.cells[col] : '';
+                tr.appendChild(td);
+            });
+        }
+        body.appendChild(tr);
+    });
+    data.dataset.columns = JSON.stringify(columns);
+    data.dataset.offset = page.nextOffset;
+    data.dataset.line = page.nextLine;
+    if (page.eof) btn.style.display = 'none';
+    filterJSONL();
+}
+document.addEventListener('DOMContentLoaded', function() { filterJSONL(); });
+</script>`))
+	return result.String()
+}
+
+// mustJSON marshals values that cannot fail (strings, slices of strings...)
+func mustJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+// handleJSONLines serves /jsonl?path=&offset=&line=&limit= : the next page of records
+func handleJSONLines(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+
+	var offset int64
+	line, limit := 1, jsonlPageSize
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid offset: "+v)
+			return
+		}
+		offset = n
+	}
+	if v := q.Get("line"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			writeError(w, r, http.StatusBadRequest, "Invalid line: "+v)
+			return
+		}
+		line = n
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid limit: "+v)
+			return
+		}
+		limit = min(n, maxChunkLines)
+	}
+
+	page, err := readJSONLines(path, offset, line, limit)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+
+	type recordJSON struct {
+		Line  int               `json:"line"`
+		HTML  string            `json:"html"`
+		Cells map[string]string `json:"cells,omitempty"`
+		Text  string            `json:"text,omitempty"`
+		Error string            `json:"error,omitempty"`
+	}
+	records := make([]recordJSON, 0, len(page.Records))
+	for _, rec := range page.Records {
+		out := recordJSON{Line: rec.Line, HTML: renderJSONLRecord(rec), Error: rec.Error}
+		if obj, ok := rec.Value.(map[string]interface{}); ok {
+			out.Cells = make(map[string]string, len(obj))
+			for k, v := range obj {
+				out.Cells[k] = jsonlCell(v)
+			}
+		} else if rec.Error == "" {
+			out.Text = jsonlCell(rec.Value)
+		}
+		records = append(records, out)
+	}
+	columns := jsonlColumns(page.Records)
+	if columns == nil {
+		columns = []string{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":       path,
+		"records":    records,
+		"columns":    columns,
+		"nextOffset": page.NextOffset,
+		"nextLine":   page.NextLine,
+		"eof":        page.EOF,
+	})
+}
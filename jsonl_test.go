@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// ===== JSON Lines Tests =====
+
+func writeJSONLFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadJSONLines(t *testing.T) {
+	path := writeJSONLFile(t, "events.jsonl", `{"id":1,"type":"a"}
+
+{"id":2, broken
+[1,2]
+{"type":"b","id":3,"extra":true}`)
+
+	page, err := readJSONLines(path, 0, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !page.EOF || len(page.Records) != 4 {
+		t.Fatalf("got %d records (eof=%v), want 4 with EOF", len(page.Records), page.EOF)
+	}
+
+	lines := []int{}
+	for _, rec := range page.Records {
+		lines = append(lines, rec.Line)
+	}
+	if fmt.Sprint(lines) != "[1 3 4 5]" {
+		t.Errorf("record lines = %v, want blank line skipped", lines)
+	}
+	if page.Records[1].Error == "" {
+		t.Error("Line 3 should report a parse error")
+	}
+	if got := strings.Join(jsonlColumns(page.Records), ","); got != "id,type,extra" {
+		t.Errorf("columns = %s, want id,type,extra", got)
+	}
+
+	// Paging continues from the returned offset and line number
+	first, _ := readJSONLines(path, 0, 1, 2)
+	if first.EOF {
+		t.Error("First page should not be EOF")
+	}
+	rest, err := readJSONLines(path, first.NextOffset, first.NextLine, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest.Records) != 2 || rest.Records[0].Line != 4 {
+		t.Errorf("second page = %+v", rest.Records)
+	}
+}
+
+func TestJSONLTruncation(t *testing.T) {
+	long := strings.Repeat("é", jsonlCellMax+10)
+	if cell := jsonlCell(long); !utf8.ValidString(cell) || cell != strings.Repeat("é", jsonlCellMax)+"…" {
+		t.Errorf("jsonlCell() cut %q", cell)
+	}
+	raw := []byte(`{"msg":"` + long + `"}`)
+	if summary := jsonlSummary(jsonlRecord{Raw: raw}); !utf8.ValidString(summary) || utf8.RuneCountInString(summary) != jsonlSummaryMax+1 {
+		t.Errorf("jsonlSummary() cut %q", summary)
+	}
+
+	// Cut by bytes first: four-byte characters filling the decoded prefix
+	wide := strings.Repeat("😀", 5) + strings.Repeat("x", 100)
+	if got := truncateRunes(wide, 5); got != strings.Repeat("😀", 5)+"…" {
+		t.Errorf("truncateRunes() = %q", got)
+	}
+	if got := truncateRunes("short", 5); got != "short" {
+		t.Errorf("truncateRunes() = %q", got)
+	}
+}
+
+func TestReadJSONLinesLongLine(t *testing.T) {
+	long := `{"data":"` + strings.Repeat("x", maxJSONLLineBytes) + `"}`
+	path := writeJSONLFile(t, "big.jsonl", long+"\n{\"ok\":true}\n")
+	page, err := readJSONLines(path, 0, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 2 || !page.EOF {
+		t.Fatalf("records = %d, eof = %v", len(page.Records), page.EOF)
+	}
+	if rec := page.Records[0]; !strings.Contains(rec.Error, "longer than") || len(rec.Raw) > jsonlSummaryMax*utf8.UTFMax+len("…") {
+		t.Errorf("long line: error %q, %d bytes kept", rec.Error, len(rec.Raw))
+	}
+	if rec := page.Records[1]; rec.Line != 2 || rec.Error != "" {
+		t.Errorf("next line = %+v", rec)
+	}
+	if page.NextOffset != int64(len(long)+len("\n{\"ok\":true}\n")) {
+		t.Errorf("nextOffset = %d", page.NextOffset)
+	}
+}
+
+func TestRenderFileJSONLines(t *testing.T) {
+	path := writeJSONLFile(t, "log.ndjson", "{\"msg\":\"<hello>\"}\nnot json\n")
+
+	content, class := renderFile(path)
+	if class != "jsonl" {
+		t.Errorf("class = %q, want jsonl", class)
+	}
+	for _, want := range []string{`id="jsonl-L1"`, `jsonl-record jsonl-error" id="jsonl-L2"`, `<th>msg</th>`, "&lt;hello&gt;"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("renderFile() missing %q", want)
+		}
+	}
+}
+
+func TestHandleJSONLines(t *testing.T) {
+	var sb strings.Builder
+	for i := 1; i <= 30; i++ {
+		sb.WriteString(fmt.Sprintf("{\"n\":%d}\n", i))
+	}
+	path := writeJSONLFile(t, "many.jsonl", sb.String())
+
+	rec := httptest.NewRecorder()
+	handleJSONLines(rec, httptest.NewRequest("GET", "/jsonl?path="+url.QueryEscape(path)+"&limit=25", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var page struct {
+		Records []struct {
+			Line  int               `json:"line"`
+			Cells map[string]string `json:"cells"`
+		} `json:"records"`
+		NextLine int  `json:"nextLine"`
+		EOF      bool `json:"eof"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Records) != 25 || page.NextLine != 26 || page.EOF {
+		t.Errorf("page = %d records, nextLine %d, eof %v", len(page.Records), page.NextLine, page.EOF)
+	}
+	if page.Records[24].Cells["n"] != "25" {
+		t.Errorf("last cell = %v", page.Records[24].Cells)
+	}
+
+	rec = httptest.NewRecorder()
+	handleJSONLines(rec, httptest.NewRequest("GET", "/jsonl?path="+url.QueryEscape(path)+"&line=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("line=0 status = %d, want 400", rec.Code)
+	}
+}
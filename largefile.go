@@ -0,0 +1,640 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Every lineIndexStride-th line start is recorded in the sparse line index
+const lineIndexStride = 1000
+
+// Lines longer than this are cut when served by /chunk and /search
+const maxLineBytes = 16 * 1024
+
+// Maximum number of lines returned by one /chunk request
+const maxChunkLines = 5000
+
+// lineIndex is a sparse index of line start offsets for a large file
+type lineIndex struct {
+	size       int64
+	modTime    time.Time
+	totalLines int
+	stride     int
+	offsets    []int64 // offsets[i] is the byte offset of line i*stride
+}
+
+// maxLineIndexes bounds the number of files whose line index is kept
+const maxLineIndexes = 64
+
+// lineIndexes holds the line indexes of the latest large files viewed
+var lineIndexes = newLineIndexCache(maxLineIndexes)
+
+// statRegular returns the info of a regular file. Devices, FIFOs and
+// sockets are refused before being opened: /dev/zero never ends and opening
+// a FIFO blocks until a writer comes.
+func statRegular(path string) (os.FileInfo, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errNotFile}
+	}
+	return info, nil
+}
+
+// getLineIndex returns the cached index for a file, rebuilding it when the
+// file changed. The build stops when ctx is done.
+func getLineIndex(ctx context.Context, path string) (*lineIndex, error) {
+	info, err := statRegular(path)
+	if err != nil {
+		return nil, err
+	}
+	return lineIndexes.get(ctx, path, info, func() (*lineIndex, error) {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return buildLineIndex(ctx, f, lineIndexStride)
+	})
+}
+
+// lineIndexCache is an LRU of line indexes by path. Each index is built
+// once: concurrent requests for a file wait for the first one's build.
+type lineIndexCache struct {
+	mu    sync.Mutex
+	max   int
+	order *list.List // Most recently used first
+	items map[string]*list.Element
+}
+
+type lineIndexEntry struct {
+	path    string
+	size    int64
+	modTime time.Time
+	ready   chan struct{} // Closed once idx or err is set
+	idx     *lineIndex
+	err     error
+}
+
+func newLineIndexCache(max int) *lineIndexCache {
+	return &lineIndexCache{max: max, order: list.New(), items: map[string]*list.Element{}}
+}
+
+// get returns the index of a file in the state info describes, calling
+// build on a miss. A request whose build was canceled hands it over to the
+// requests waiting for it.
+func (c *lineIndexCache) get(ctx context.Context, path string, info os.FileInfo, build func() (*lineIndex, error)) (*lineIndex, error) {
+	c.mu.Lock()
+	if el, ok := c.items[path]; ok {
+		e := el.Value.(*lineIndexEntry)
+		if e.size == info.Size() && e.modTime.Equal(info.ModTime()) {
+			c.order.MoveToFront(el)
+			c.mu.Unlock()
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if isCanceled(e.err) && ctx.Err() == nil {
+				return c.get(ctx, path, info, build)
+			}
+			return e.idx, e.err
+		}
+		c.remove(el)
+	}
+	e := &lineIndexEntry{path: path, size: info.Size(), modTime: info.ModTime(), ready: make(chan struct{})}
+	el := c.order.PushFront(e)
+	c.items[path] = el
+	for c.order.Len() > c.max {
+		c.remove(c.order.Back())
+	}
+	c.mu.Unlock()
+
+	e.idx, e.err = build()
+	if e.idx != nil {
+		e.idx.size, e.idx.modTime = e.size, e.modTime
+	}
+	if e.err != nil {
+		// Retried by the next request, or the waiting ones when canceled
+		c.mu.Lock()
+		if c.items[path] == el {
+			c.remove(el)
+		}
+		c.mu.Unlock()
+	}
+	close(e.ready)
+	return e.idx, e.err
+}
+
+// isCanceled reports whether an error comes from a done context
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (c *lineIndexCache) remove(el *list.Element) {
+	e := c.order.Remove(el).(*lineIndexEntry)
+	delete(c.items, e.path)
+}
+
+func (c *lineIndexCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// buildLineIndex scans a reader once, recording the offset of every
+// stride-th line, until ctx is done
+func buildLineIndex(ctx context.Context, r io.Reader, stride int) (*lineIndex, error) {
+	idx := &lineIndex{stride: stride, offsets: []int64{0}}
+	buf := make([]byte, 256*1024)
+	var offset int64
+	lines := 0
+	lastByte := byte('\n')
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		for len(chunk) > 0 {
+			i := bytes.IndexByte(chunk, '\n')
+			if i < 0 {
+				break
+			}
+			lines++
+			offset += int64(i + 1)
+			chunk = chunk[i+1:]
+			if lines%stride == 0 {
+				idx.offsets = append(idx.offsets, offset)
+			}
+		}
+		offset += int64(len(chunk))
+		if n > 0 {
+			lastByte = buf[n-1]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// A last line without trailing newline still counts
+	if lastByte != '\n' {
+		lines++
+	}
+	// Drop a trailing entry pointing at EOF
+	if len(idx.offsets) > 1 && idx.offsets[len(idx.offsets)-1] == offset {
+		idx.offsets = idx.offsets[:len(idx.offsets)-1]
+	}
+	idx.totalLines = lines
+	return idx, nil
+}
+
+// readLine reads one line, keeping at most max bytes, and returns the number of bytes consumed
+func readLine(r *bufio.Reader, max int) ([]byte, int64, error) {
+	var line []byte
+	var consumed int64
+	for {
+		part, err := r.ReadSlice('\n')
+		consumed += int64(len(part))
+		if room := max - len(line); room > 0 {
+			if len(part) > room {
+				line = append(line, part[:room]...)
+			} else {
+				line = append(line, part...)
+			}
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err != nil && consumed == 0 {
+			return nil, 0, err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		return line, consumed, nil
+	}
+}
+
+// lineChunk is the JSON payload of /chunk
+type lineChunk struct {
+	Path       string   `json:"path"`
+	Size       int64    `json:"size"`
+	TotalLines int      `json:"totalLines"`
+	StartLine  int      `json:"startLine"` // 1-based number of the first returned line
+	Offset     int64    `json:"offset"`
+	NextOffset int64    `json:"nextOffset"`
+	Lines      []string `json:"lines"`
+	EOF        bool     `json:"eof"`
+}
+
+// readChunkAtLine returns count lines starting at the given 0-based line number
+func readChunkAtLine(path string, idx *lineIndex, line, count int) (*lineChunk, error) {
+	if line < 0 {
+		line = 0
+	}
+	block := line / idx.stride
+	if block >= len(idx.offsets) {
+		block = len(idx.offsets) - 1
+	}
+	start := idx.offsets[block]
+	skip := line - block*idx.stride
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReaderSize(f, 64*1024)
+	offset := start
+	for i := 0; i < skip; i++ {
+		_, n, err := readLine(r, 0)
+		if err != nil {
+			break
+		}
+		offset += n
+	}
+
+	chunk, err := readChunk(r, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	chunk.StartLine = line + 1
+	return chunk, nil
+}
+
+// readChunkAtOffset returns count lines starting at a byte offset; an offset in
+// the middle of a line is moved to the start of the next line
+func readChunkAtOffset(path string, idx *lineIndex, offset int64, count int) (*lineChunk, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > 0 {
+		// Align on a line start by looking at the previous byte
+		if _, err := f.Seek(offset-1, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	r := bufio.NewReaderSize(f, 64*1024)
+	if offset > 0 {
+		prev, err := r.ReadByte()
+		if err == nil && prev != '\n' {
+			_, n, _ := readLine(r, 0)
+			offset += n
+		}
+	}
+
+	chunk, err := readChunk(r, offset, count)
+	if err != nil {
+		return nil, err
+	}
+	chunk.StartLine = lineForOffset(path, idx, offset) + 1
+	return chunk, nil
+}
+
+func readChunk(r *bufio.Reader, offset int64, count int) (*lineChunk, error) {
+	chunk := &lineChunk{Offset: offset, Lines: []string{}}
+	for i := 0; i < count; i++ {
+		line, n, err := readLine(r, maxLineBytes)
+		if err == io.EOF {
+			chunk.EOF = true
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		offset += n
+		chunk.Lines = append(chunk.Lines, string(line))
+	}
+	if !chunk.EOF {
+		if _, err := r.Peek(1); err == io.EOF {
+			chunk.EOF = true
+		}
+	}
+	chunk.NextOffset = offset
+	return chunk, nil
+}
+
+// lineForOffset returns the 0-based line number starting at a line-aligned offset
+func lineForOffset(path string, idx *lineIndex, offset int64) int {
+	block := sort.Search(len(idx.offsets), func(i int) bool { return idx.offsets[i] > offset }) - 1
+	if block < 0 {
+		block = 0
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return block * idx.stride
+	}
+	defer f.Close()
+
+	start := idx.offsets[block]
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return block * idx.stride
+	}
+	n, _ := countNewlines(io.LimitReader(f, offset-start))
+	return block*idx.stride + n
+}
+
+func countNewlines(r io.Reader) (int, error) {
+	buf := make([]byte, 64*1024)
+	count := 0
+	for {
+		n, err := r.Read(buf)
+		count += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return count, nil
+		}
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+// searchMatch is one result of a whole-file search
+type searchMatch struct {
+	Line   int    `json:"line"` // 1-based
+	Offset int64  `json:"offset"`
+	Column int    `json:"column"` // 0-based byte column of the match
+	Text   string `json:"text"`
+}
+
+// searchFile scans a file line by line and returns up to limit matches; it
+// gives up when ctx is done
+func searchFile(ctx context.Context, path string, re *regexp.Regexp, limit int) ([]searchMatch, bool, error) {
+	if _, err := statRegular(path); err != nil {
+		return nil, false, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 256*1024)
+	matches := []searchMatch{}
+	var offset int64
+	for lineNo := 1; ; lineNo++ {
+		if err := ctx.Err(); err != nil {
+			return nil, false, err
+		}
+		line, n, err := readLine(r, maxLineBytes)
+		if err == io.EOF {
+			return matches, false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		if loc := re.FindIndex(line); loc != nil {
+			if len(matches) >= limit {
+				return matches, true, nil
+			}
+			matches = append(matches, searchMatch{Line: lineNo, Offset: offset, Column: loc[0], Text: string(line)})
+		}
+		offset += n
+	}
+}
+
+// compileSearch builds the search expression from the /search query parameters
+func compileSearch(q url.Values) (*regexp.Regexp, error) {
+	query := q.Get("q")
+	if query == "" {
+		return nil, errors.New("missing q parameter")
+	}
+	if q.Get("regex") != "1" {
+		query = regexp.QuoteMeta(query)
+	}
+	if q.Get("case") != "1" {
+		query = "(?i)" + query
+	}
+	return regexp.Compile(query)
+}
+
+// handleChunk serves /chunk?path=&line= or /chunk?path=&offset=
+func handleChunk(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	count := 200
+	if v := q.Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid count: "+v)
+			return
+		}
+		count = min(n, maxChunkLines)
+	}
+
+	idx, err := getLineIndex(r.Context(), path)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+
+	var chunk *lineChunk
+	if v := q.Get("offset"); v != "" {
+		offset, perr := strconv.ParseInt(v, 10, 64)
+		if perr != nil {
+			writeError(w, r, http.StatusBadRequest, "Invalid offset: "+v)
+			return
+		}
+		chunk, err = readChunkAtOffset(path, idx, offset, count)
+	} else {
+		line := 1
+		if v := q.Get("line"); v != "" {
+			n, perr := strconv.Atoi(v)
+			if perr != nil || n < 1 {
+				writeError(w, r, http.StatusBadRequest, "Invalid line: "+v)
+				return
+			}
+			line = n
+		}
+		chunk, err = readChunkAtLine(path, idx, line-1, count)
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	chunk.Path = path
+	chunk.Size = idx.size
+	chunk.TotalLines = idx.totalLines
+	writeJSON(w, http.StatusOK, chunk)
+}
+
+// handleSearch serves /search?path=&q=&regex=1&case=1&limit=
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path := q.Get("path")
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	re, err := compileSearch(q)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := 1000
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, r, http.StatusBadRequest, "Invalid limit: "+v)
+			return
+		}
+		limit = n
+	}
+
+	matches, truncated, err := searchFile(r.Context(), path, re, limit)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":      path,
+		"matches":   matches,
+		"truncated": truncated,
+	})
+}
+
+// renderLargeFile renders a virtual-scrolling viewer that loads lines through /chunk
+func renderLargeFile(filePath string, size int64) string {
+	return fmt.Sprintf(withNonce(`<p class="large-file-notice">File larger than %s, shown as plain text. <a href="%s">Download</a></p>
+<div class="large-file-toolbar">
+    <span class="large-file-info">%s · <span id="lf-total">…</span> lines</span>
+    <input type="number" id="lf-goto" min="1" placeholder="Go to line" onkeydown="if(event.key==='Enter')largeFileGoto(this.value)" />
+    <button onclick="largeFileGoto(document.getElementById('lf-goto').value)">Go</button>
+    <input type="text" id="lf-search" placeholder="Search whole file..." onkeydown="if(event.key==='Enter')largeFileSearch()" />
+    <label><input type="checkbox" id="lf-regex" /> Regex</label>
+    <button onclick="largeFileSearch()">Search</button>
+    <span id="lf-search-status" class="search-count"></span>
+</div>
+<div class="large-file-results" id="lf-results"></div>
+<div class="large-file-viewport" id="lf-viewport" data-path="%s">
+    <div class="large-file-spacer" id="lf-spacer"><div class="large-file-lines" id="lf-lines"></div></div>
+</div>
+<script>
+(function() {
+    const LINE_HEIGHT = 20;
+    const BLOCK = 200;
+    const MAX_SPACER = 10000000; // browsers cap element heights
+    const viewport = document.getElementById('lf-viewport');
+    const spacer = document.getElementById('lf-spacer');
+    const linesEl = document.getElementById('lf-lines');
+    const path = viewport.dataset.path;
+    const blocks = new Map();
+    let totalLines = 0;
+    let pxPerLine = LINE_HEIGHT;
+    let highlighted = 0;
+
+    function chunkURL(line) {
+        return '/chunk?path=' + encodeURIComponent(path) + '&line=' + line + '&count=' + BLOCK;
+    }
+
+    function loadBlock(b) {
+        if (!blocks.has(b)) {
+            blocks.set(b, fetch(chunkURL(b * BLOCK + 1)).then(res => res.json()));
+        }
+        return blocks.get(b);
+    }
+
+    async function render() {
+        const visible = Math.ceil(viewport.clientHeight / LINE_HEIGHT) + 1;
+        const first = Math.min(Math.floor(viewport.scrollTop / pxPerLine), Math.max(0, totalLines - visible));
+        const last = Math.min(totalLines, first + visible);
+        const needed = [];
+        for (let b = Math.floor(first / BLOCK); b <= Math.floor(Math.max(first, last - 1) / BLOCK); b++) needed.push(loadBlock(b));
+        const loaded = await Promise.all(needed);
+        const lines = [];
+        loaded.forEach(chunk => lines.push(...chunk.lines));
+        const offset = first - Math.floor(first / BLOCK) * BLOCK;
+
+        while (linesEl.firstChild) linesEl.removeChild(linesEl.firstChild);
+        for (let i = 0; i < last - first; i++) {
+            const row = document.createElement('div');
+            row.className = 'large-file-line' + (first + i + 1 === highlighted ? ' highlighted' : '');
+            const num = document.createElement('span');
+            num.className = 'large-file-lineno';
+            num.textContent = first + i + 1;
+            const text = document.createElement('span');
+            text.textContent = lines[offset + i] !== undefined ? lines[offset + i] : '';
+            row.appendChild(num);
+            row.appendChild(text);
+            linesEl.appendChild(row);
+        }
+        // Keep the rendered lines in view even when the spacer is compressed
+        linesEl.style.transform = 'translateY(' + (pxPerLine === LINE_HEIGHT ? first * LINE_HEIGHT : viewport.scrollTop) + 'px)';
+    }
+
+    window.largeFileGoto = function(line) {
+        line = parseInt(line, 10);
+        if (!line || line < 1) return;
+        highlighted = Math.min(line, totalLines);
+        viewport.scrollTop = (highlighted - 1) * pxPerLine;
+        render();
+    };
+
+    window.largeFileSearch = async function() {
+        const q = document.getElementById('lf-search').value;
+        const status = document.getElementById('lf-search-status');
+        const results = document.getElementById('lf-results');
+        while (results.firstChild) results.removeChild(results.firstChild);
+        if (!q) { status.textContent = ''; return; }
+        status.textContent = 'Searching...';
+        const regex = document.getElementById('lf-regex').checked ? '&regex=1' : '';
+        const res = await fetch('/search?path=' + encodeURIComponent(path) + '&q=' + encodeURIComponent(q) + regex);
+        const data = await res.json();
+        if (data.error) { status.textContent = data.error; return; }
+        status.textContent = data.matches.length + (data.truncated ? '+' : '') + ' résultat(s)';
+        data.matches.forEach(m => {
+            const a = document.createElement('a');
+            a.href = 'javascript:void(0)';
+            a.className = 'large-file-result';
+            a.textContent = m.line + ': ' + m.text.substring(Math.max(0, m.column - 40), m.column + 120);
+            a.onclick = () => largeFileGoto(m.line);
+            results.appendChild(a);
+        });
+    };
+
+    loadBlock(0).then(chunk => {
+        totalLines = chunk.totalLines;
+        document.getElementById('lf-total').textContent = totalLines.toLocaleString();
+        pxPerLine = Math.min(LINE_HEIGHT, MAX_SPACER / Math.max(totalLines, 1));
+        spacer.style.height = Math.ceil(totalLines * pxPerLine + LINE_HEIGHT) + 'px';
+        const hash = location.hash.match(/^#L(\d+)$/);
+        if (hash) largeFileGoto(hash[1]); else render();
+    });
+    viewport.addEventListener('scroll', () => requestAnimationFrame(render));
+})();
+</script>`), formatSize(MaxViewableSize), "/asset?path="+url.QueryEscape(filePath), formatSize(size), html.EscapeString(filePath))
+}
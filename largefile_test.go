@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ===== Large File Tests =====
+
+// writeNumberedLines creates a file whose line i (1-based) is "line i"
+func writeNumberedLines(t *testing.T, n int, trailingNewline bool) string {
+	t.Helper()
+	var sb strings.Builder
+	for i := 1; i <= n; i++ {
+		sb.WriteString(fmt.Sprintf("line %d", i))
+		if i < n || trailingNewline {
+			sb.WriteString("\n")
+		}
+	}
+	path := filepath.Join(t.TempDir(), "big.log")
+	if err := os.WriteFile(path, []byte(sb.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuildLineIndex(t *testing.T) {
+	tests := []struct {
+		input   string
+		lines   int
+		offsets []int64
+	}{
+		{"", 0, []int64{0}},
+		{"a\nb\nc\nd\ne", 5, []int64{0, 4, 8}},
+		{"a\nb\nc\nd\n", 4, []int64{0, 4}},
+		{"no newline", 1, []int64{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.input), func(t *testing.T) {
+			idx, err := buildLineIndex(context.Background(), strings.NewReader(tt.input), 2)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if idx.totalLines != tt.lines {
+				t.Errorf("totalLines = %d, want %d", idx.totalLines, tt.lines)
+			}
+			if fmt.Sprint(idx.offsets) != fmt.Sprint(tt.offsets) {
+				t.Errorf("offsets = %v, want %v", idx.offsets, tt.offsets)
+			}
+		})
+	}
+}
+
+func TestLineIndexCache(t *testing.T) {
+	path := writeNumberedLines(t, 10, true)
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newLineIndexCache(2)
+	var builds atomic.Int32
+	build := func() (*lineIndex, error) {
+		builds.Add(1)
+		time.Sleep(10 * time.Millisecond)
+		return &lineIndex{totalLines: 10}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if idx, err := c.get(context.Background(), path, info, build); err != nil || idx.totalLines != 10 {
+				t.Errorf("get() = %v, %v", idx, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := builds.Load(); n != 1 {
+		t.Errorf("index built %d times, want 1", n)
+	}
+
+	// A failed build is not kept
+	if _, err := c.get(context.Background(), "other", info, func() (*lineIndex, error) { return nil, os.ErrNotExist }); err == nil {
+		t.Error("get() should return the build error")
+	}
+	if n := c.len(); n != 1 {
+		t.Errorf("len() = %d after a failed build, want 1", n)
+	}
+
+	// A canceled build is handed over to the requests waiting for it
+	started, release := make(chan struct{}), make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error)
+	go func() {
+		_, err := c.get(ctx, "slow", info, func() (*lineIndex, error) {
+			close(started)
+			<-release
+			return nil, ctx.Err()
+		})
+		canceled <- err
+	}()
+	<-started
+	waiter := make(chan *lineIndex)
+	go func() {
+		idx, _ := c.get(context.Background(), "slow", info, build)
+		waiter <- idx
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	close(release)
+	if err := <-canceled; err != context.Canceled {
+		t.Errorf("canceled build: %v", err)
+	}
+	if idx := <-waiter; idx == nil || idx.totalLines != 10 {
+		t.Errorf("waiter got %v", idx)
+	}
+
+	for _, p := range []string{"a", "b", "c"} {
+		c.get(context.Background(), p, info, build)
+	}
+	if n := c.len(); n != 2 {
+		t.Errorf("len() = %d, want the bound 2", n)
+	}
+}
+
+func TestReadChunk(t *testing.T) {
+	path := writeNumberedLines(t, 2500, false)
+	idx, err := getLineIndex(context.Background(), path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.totalLines != 2500 {
+		t.Fatalf("totalLines = %d, want 2500", idx.totalLines)
+	}
+
+	chunk, err := readChunkAtLine(path, idx, 1499, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chunk.Lines, ","); got != "line 1500,line 1501,line 1502" {
+		t.Errorf("readChunkAtLine() = %s", got)
+	}
+
+	// Continue from nextOffset, as the client does when paging by offset
+	next, err := readChunkAtOffset(path, idx, chunk.NextOffset, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.StartLine != 1503 || strings.Join(next.Lines, ",") != "line 1503,line 1504" {
+		t.Errorf("readChunkAtOffset() = %d %v", next.StartLine, next.Lines)
+	}
+
+	// An offset in the middle of a line moves to the next line
+	mid, err := readChunkAtOffset(path, idx, chunk.Offset+2, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mid.StartLine != 1501 || mid.Lines[0] != "line 1501" {
+		t.Errorf("mid-line offset = %d %v", mid.StartLine, mid.Lines)
+	}
+
+	last, err := readChunkAtLine(path, idx, 2498, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.EOF || strings.Join(last.Lines, ",") != "line 2499,line 2500" {
+		t.Errorf("last chunk = %v eof=%v", last.Lines, last.EOF)
+	}
+}
+
+func TestSearchFile(t *testing.T) {
+	path := writeNumberedLines(t, 300, true)
+
+	matches, truncated, err := searchFile(context.Background(), path, regexp.MustCompile(`^line 2\d9$`), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if truncated || len(matches) != 10 {
+		t.Fatalf("got %d matches (truncated=%v), want 10", len(matches), truncated)
+	}
+	if matches[0].Line != 209 || matches[0].Text != "line 209" {
+		t.Errorf("first match = %+v", matches[0])
+	}
+
+	matches, truncated, _ = searchFile(context.Background(), path, regexp.MustCompile(`line`), 5)
+	if !truncated || len(matches) != 5 {
+		t.Errorf("limit not applied: %d matches, truncated=%v", len(matches), truncated)
+	}
+}
+
+func TestLargeFileCanceled(t *testing.T) {
+	path := writeNumberedLines(t, 300, true)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := buildLineIndex(ctx, strings.NewReader("a\nb\n"), 2); err != context.Canceled {
+		t.Errorf("buildLineIndex() = %v, want context.Canceled", err)
+	}
+	if _, _, err := searchFile(ctx, path, regexp.MustCompile(`line`), 10); err != context.Canceled {
+		t.Errorf("searchFile() = %v, want context.Canceled", err)
+	}
+}
+
+func TestLargeFileNotRegular(t *testing.T) {
+	if _, err := os.Stat(os.DevNull); err != nil {
+		t.Skip(err)
+	}
+	for _, target := range []string{"/chunk?path=", "/search?q=x&path="} {
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest("GET", target+url.QueryEscape(os.DevNull), nil))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s%s: status = %d, want 400", target, os.DevNull, rec.Code)
+		}
+	}
+}
+
+func TestHandleChunk(t *testing.T) {
+	path := writeNumberedLines(t, 50, true)
+
+	rec := httptest.NewRecorder()
+	handleChunk(rec, httptest.NewRequest("GET", "/chunk?path="+url.QueryEscape(path)+"&line=10&count=2", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", rec.Code, rec.Body)
+	}
+	var chunk lineChunk
+	if err := json.Unmarshal(rec.Body.Bytes(), &chunk); err != nil {
+		t.Fatal(err)
+	}
+	if chunk.TotalLines != 50 || chunk.StartLine != 10 || strings.Join(chunk.Lines, ",") != "line 10,line 11" {
+		t.Errorf("chunk = %+v", chunk)
+	}
+
+	rec = httptest.NewRecorder()
+	handleChunk(rec, httptest.NewRequest("GET", "/chunk?path="+url.QueryEscape(path)+"&line=0", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("line=0 status = %d, want 400", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	handleSearch(rec, httptest.NewRequest("GET", "/search?path="+url.QueryEscape(path)+"&q=(&regex=1", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid regex status = %d, want 400", rec.Code)
+	}
+}
+
+func TestRenderFileLarge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "huge.md")
+	line := strings.Repeat("x", 99) + "\n"
+	if err := os.WriteFile(path, []byte(strings.Repeat(line, MaxViewableSize/len(line)+1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, class := renderFile(path)
+	if class != "large" {
+		t.Errorf("class = %q, want large", class)
+	}
+	if !strings.Contains(content, `id="lf-viewport"`) {
+		t.Error("Should render the chunked viewer")
+	}
+}
@@ -0,0 +1,638 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	linkCheckTimeout     = 10 * time.Second // Per external URL, unless configured
+	linkCheckConcurrency = 8                // External URLs checked at once
+	maxLinkCheckEntries  = 20000            // Files and directories walked per check
+)
+
+var (
+	// Same patterns as the image and link rules of renderMarkdown
+	checkImageRe   = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
+	checkLinkRe    = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
+	checkHeaderRe  = regexp.MustCompile(`^(#{1,6})\s+(.+)$`)
+	checkFootRe    = regexp.MustCompile(`^\[\^([^\]]+)\]:`)
+	checkHTMLIDRe  = regexp.MustCompile(`\sid="([^"]+)"`)
+	checkCodeRe    = regexp.MustCompile("`[^`]+`")
+	checkSchemeRe  = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*:`)
+	checkSkipNames = map[string]bool{"node_modules": true}
+)
+
+// linkIssue is a link of a Markdown file that leads nowhere
+type linkIssue struct {
+	File  string `json:"file"`
+	Line  int    `json:"line"`
+	Link  string `json:"link"`
+	Kind  string `json:"kind"` // link, image, anchor, wiki, url or file
+	Error string `json:"error"`
+}
+
+// linkReport is the result of checking the links of a tree
+type linkReport struct {
+	Root     string      `json:"root"`
+	Files    int         `json:"files"`
+	Links    int         `json:"links"`
+	External int         `json:"external"` // URLs requested
+	Skipped  int         `json:"skipped"`  // URLs not requested, other schemes
+	Issues   []linkIssue `json:"issues"`
+	// The walk stopped after maxLinkCheckEntries files and directories
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// externalRef is an external URL and where it is written
+type externalRef struct {
+	url   string
+	where []linkIssue
+}
+
+// linkChecker checks the links of Markdown files, caching the anchors of
+// the files it reads
+type linkChecker struct {
+	external  bool
+	client    *http.Client
+	userAgent string
+	ignore    []string
+
+	anchors map[string]map[string]bool
+	vaults  map[string]*vault
+	urls    map[string]*externalRef
+}
+
+// newLinkChecker returns a checker; external enables requests to http(s)
+// URLs with the client described by the linkCheck settings of the config
+func newLinkChecker(external bool) (*linkChecker, error) {
+	c := &linkChecker{
+		external:  external,
+		client:    &http.Client{Timeout: linkCheckTimeout},
+		userAgent: "file-viewer-link-checker",
+		anchors:   map[string]map[string]bool{},
+		vaults:    map[string]*vault{},
+		urls:      map[string]*externalRef{},
+	}
+	if cfg := appConfig.LinkCheck; cfg != nil {
+		if cfg.Timeout != "" {
+			d, err := time.ParseDuration(cfg.Timeout)
+			if err != nil {
+				return nil, fmt.Errorf("linkCheck.timeout: %w", err)
+			}
+			c.client.Timeout = d
+		}
+		if cfg.UserAgent != "" {
+			c.userAgent = cfg.UserAgent
+		}
+		c.ignore = cfg.Ignore
+	}
+	return c, nil
+}
+
+// publicOnly keeps the checker from connecting to loopback, private and
+// link-local addresses, as /links/check must not let a page probe the
+// network of the server.
+func (c *linkChecker) publicOnly() {
+	c.client.Transport = publicTransport(c.client.Timeout)
+}
+
+// publicTransport returns a transport that only connects to public
+// addresses. Addresses are checked once resolved, redirects included, and
+// proxies are not used since they would connect in our place.
+func publicTransport(dialTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: dialTimeout, Control: func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+			return fmt.Errorf("%s is not a public address", host)
+		}
+		return nil
+	}}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// isPublicIP reports whether an address is reachable on the internet
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsUnspecified() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() && !ip.IsMulticast()
+}
+
+// check scans a Markdown file, or the Markdown files of a directory tree
+// without hidden directories and node_modules
+func (c *linkChecker) check(root string) (*linkReport, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	report := &linkReport{Root: root, Issues: []linkIssue{}}
+
+	var files []string
+	if !info.IsDir() {
+		if !isMarkdownFile(root) {
+			return nil, fmt.Errorf("%s is not a Markdown file", root)
+		}
+		files = []string{root}
+	} else {
+		entries := 0
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if p == root {
+					return err
+				}
+				// Listed like a broken link, the rest of the tree is still checked
+				report.Issues = append(report.Issues, linkIssue{File: p, Kind: "file", Error: err.Error()})
+				return nil
+			}
+			if entries++; entries > maxLinkCheckEntries {
+				report.Truncated = true
+				return filepath.SkipAll
+			}
+			if p != root && (strings.HasPrefix(d.Name(), ".") || checkSkipNames[d.Name()]) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if d.Type().IsRegular() && isMarkdownFile(p) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range files {
+		issues, err := c.checkFile(f, report)
+		if err != nil && !info.IsDir() {
+			return nil, err
+		} else if err != nil {
+			issues = append(issues, linkIssue{File: f, Kind: "file", Error: err.Error()})
+		}
+		report.Issues = append(report.Issues, issues...)
+	}
+	report.Files = len(files)
+	report.Issues = append(report.Issues, c.checkURLs(report)...)
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		a, b := report.Issues[i], report.Issues[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return report, nil
+}
+
+// markdownLines calls fn with the lines of a Markdown file outside code and
+// math blocks, inline code removed
+func markdownLines(filePath string, fn func(n int, line string)) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	_, body := splitFrontMatter(string(data))
+	skipped := strings.Count(string(data), "\n") - strings.Count(body, "\n")
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), MaxViewableSize)
+	inCode, inMath := false, false
+	for n := skipped + 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fenceRe.MatchString(line):
+			inCode = !inCode
+			continue
+		case !inCode && trimmed == "$$":
+			inMath = !inMath
+			continue
+		case inCode || inMath:
+			continue
+		}
+		fn(n, checkCodeRe.ReplaceAllString(line, ""))
+	}
+	return scanner.Err()
+}
+
+// fileAnchors returns the ids a Markdown file defines: headings, as slugify
+// makes them, footnotes and id attributes of inline HTML
+func (c *linkChecker) fileAnchors(filePath string) map[string]bool {
+	if anchors, ok := c.anchors[filePath]; ok {
+		return anchors
+	}
+	anchors := map[string]bool{}
+	markdownLines(filePath, func(n int, line string) {
+		if m := checkHeaderRe.FindStringSubmatch(line); m != nil {
+			anchors[slugify(m[2])] = true
+		}
+		if m := checkFootRe.FindStringSubmatch(line); m != nil {
+			anchors["fn-"+m[1]] = true
+		}
+		for _, m := range checkHTMLIDRe.FindAllStringSubmatch(line, -1) {
+			anchors[m[1]] = true
+		}
+	})
+	c.anchors[filePath] = anchors
+	return anchors
+}
+
+// checkFile checks the links and images of a file; external URLs are
+// collected for checkURLs
+func (c *linkChecker) checkFile(filePath string, report *linkReport) ([]linkIssue, error) {
+	var issues []linkIssue
+	dir := filepath.Dir(filePath)
+	err := markdownLines(filePath, func(n int, line string) {
+		issue := func(link, kind, msg string) {
+			issues = append(issues, linkIssue{File: filePath, Line: n, Link: link, Kind: kind, Error: msg})
+		}
+
+		for _, m := range wikiLinkRe.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(m[0], "`") {
+				continue
+			}
+			report.Links++
+			target, heading := strings.TrimSpace(m[2]), strings.TrimSpace(strings.TrimPrefix(m[3], "#"))
+			resolved := filePath
+			if target != "" {
+				root := findVaultRoot(dir)
+				v, ok := c.vaults[root]
+				if !ok {
+					v = indexVault(root)
+					c.vaults[root] = v
+				}
+				if resolved, ok = v.resolve(target, dir); !ok {
+					issue(m[0], "wiki", "no file named “"+target+"” in the vault")
+					continue
+				}
+			}
+			if heading != "" && !strings.HasPrefix(heading, "^") && isMarkdownFile(resolved) && !c.fileAnchors(resolved)[slugify(heading)] {
+				issue(m[0], "anchor", "no heading “"+heading+"”")
+			}
+		}
+		line = wikiLinkRe.ReplaceAllString(line, "")
+
+		for _, m := range checkImageRe.FindAllStringSubmatch(line, -1) {
+			report.Links++
+			if msg, kind := c.checkTarget(m[2], "image", filePath, n, report); msg != "" {
+				issue(m[2], kind, msg)
+			}
+		}
+		line = checkImageRe.ReplaceAllString(line, "")
+
+		for _, m := range checkLinkRe.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(m[1], "^") {
+				// Footnote reference followed by parentheses
+				continue
+			}
+			report.Links++
+			if msg, kind := c.checkTarget(m[2], "link", filePath, n, report); msg != "" {
+				issue(m[2], kind, msg)
+			}
+		}
+	})
+	return issues, err
+}
+
+// checkTarget checks a link target written in filePath and returns why it is
+// broken with the kind of problem, or "" when it is fine
+func (c *linkChecker) checkTarget(target, kind, filePath string, line int, report *linkReport) (string, string) {
+	// A title may follow the target: [text](target "title")
+	fields := strings.Fields(target)
+	if len(fields) == 0 {
+		return "empty link", kind
+	}
+	target = strings.Trim(fields[0], "<>")
+
+	if strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") {
+		for _, prefix := range c.ignore {
+			if strings.HasPrefix(target, prefix) {
+				report.Skipped++
+				return "", ""
+			}
+		}
+		if !c.external {
+			report.Skipped++
+			return "", ""
+		}
+		ref, ok := c.urls[target]
+		if !ok {
+			ref = &externalRef{url: target}
+			c.urls[target] = ref
+		}
+		ref.where = append(ref.where, linkIssue{File: filePath, Line: line, Kind: "url", Link: target})
+		return "", ""
+	}
+	if checkSchemeRe.MatchString(target) || strings.HasPrefix(target, "//") {
+		// mailto:, tel:, data:...
+		report.Skipped++
+		return "", ""
+	}
+
+	p, fragment, _ := strings.Cut(target, "#")
+	p, _, _ = strings.Cut(p, "?")
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	resolved := filePath
+	if p != "" {
+		resolved = p
+		if !filepath.IsAbs(resolved) {
+			resolved = filepath.Join(filepath.Dir(filePath), resolved)
+		}
+		info, err := os.Stat(resolved)
+		if err != nil {
+			return "file not found", kind
+		}
+		if info.IsDir() {
+			if fragment != "" {
+				return "anchor on a directory", "anchor"
+			}
+			return "", ""
+		}
+	}
+
+	if fragment != "" && isMarkdownFile(resolved) {
+		if unescaped, err := url.PathUnescape(fragment); err == nil {
+			fragment = unescaped
+		}
+		// Slugified as markdownLinkTag does, block references excepted
+		if !strings.HasPrefix(fragment, "^") {
+			fragment = slugify(fragment)
+		}
+		if !c.fileAnchors(resolved)[fragment] {
+			if p == "" {
+				return "no heading with anchor #" + fragment, "anchor"
+			}
+			return "no heading with anchor #" + fragment + " in " + filepath.Base(resolved), "anchor"
+		}
+	}
+	return "", ""
+}
+
+// checkURLs requests the external URLs found, a few at a time: HEAD first,
+// then GET for servers that refuse HEAD
+func (c *linkChecker) checkURLs(report *linkReport) []linkIssue {
+	if len(c.urls) == 0 {
+		return nil
+	}
+	refs := make([]*externalRef, 0, len(c.urls))
+	for _, ref := range c.urls {
+		refs = append(refs, ref)
+	}
+	report.External = len(refs)
+
+	errs := make([]string, len(refs))
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, linkCheckConcurrency)
+	for i, ref := range refs {
+		wg.Add(1)
+		go func(i int, ref *externalRef) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			errs[i] = c.checkURL(ref.url)
+		}(i, ref)
+	}
+	wg.Wait()
+
+	var issues []linkIssue
+	for i, ref := range refs {
+		if errs[i] == "" {
+			continue
+		}
+		for _, w := range ref.where {
+			w.Error = errs[i]
+			issues = append(issues, w)
+		}
+	}
+	return issues
+}
+
+// checkURL returns why an external URL fails, or ""
+func (c *linkChecker) checkURL(u string) string {
+	status := 0
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		ctx, cancel := context.WithTimeout(context.Background(), c.client.Timeout)
+		req, err := http.NewRequestWithContext(ctx, method, u, nil)
+		if err != nil {
+			cancel()
+			return err.Error()
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		resp, err := c.client.Do(req)
+		if err != nil {
+			cancel()
+			return err.Error()
+		}
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		cancel()
+		status = resp.StatusCode
+		if status != http.StatusMethodNotAllowed && status != http.StatusForbidden && status != http.StatusNotImplemented {
+			break
+		}
+	}
+	if status >= 400 {
+		return fmt.Sprintf("HTTP %d %s", status, http.StatusText(status))
+	}
+	return ""
+}
+
+// renderLinkReport renders a report as a page section, issues grouped by file
+func renderLinkReport(r *linkReport) string {
+	var sb strings.Builder
+	sb.WriteString(`<div class="link-report">`)
+	sb.WriteString(fmt.Sprintf("<h1>Link check</h1>\n<p><code>%s</code></p>\n", html.EscapeString(r.Root)))
+	status := "link-report-ok"
+	if len(r.Issues) > 0 {
+		status = "link-report-failed"
+	}
+	sb.WriteString(fmt.Sprintf(`<p class="link-report-summary %s">%d broken of %d links in %d files`, status, len(r.Issues), r.Links, r.Files))
+	if r.External > 0 {
+		sb.WriteString(fmt.Sprintf(", %d external URLs checked", r.External))
+	}
+	if r.Skipped > 0 {
+		sb.WriteString(fmt.Sprintf(", %d not checked", r.Skipped))
+	}
+	if r.Truncated {
+		sb.WriteString(fmt.Sprintf(", stopped after %d files and directories", maxLinkCheckEntries))
+	}
+	sb.WriteString("</p>\n")
+
+	file := ""
+	for _, issue := range r.Issues {
+		if issue.File != file {
+			if file != "" {
+				sb.WriteString("</table>\n")
+			}
+			file = issue.File
+			href := (&url.URL{Path: filepath.ToSlash(file)}).EscapedPath()
+			sb.WriteString(fmt.Sprintf("<h3><a href=\"%s\">%s</a></h3>\n<table>\n<tr><th>Line</th><th>Link</th><th>Kind</th><th>Problem</th></tr>\n",
+				html.EscapeString(href), html.EscapeString(relOrAbs(r.Root, file))))
+		}
+		sb.WriteString(fmt.Sprintf("<tr><td>%d</td><td><code>%s</code></td><td>%s</td><td>%s</td></tr>\n",
+			issue.Line, html.EscapeString(issue.Link), issue.Kind, html.EscapeString(issue.Error)))
+	}
+	if file != "" {
+		sb.WriteString("</table>\n")
+	}
+	sb.WriteString("</div>\n")
+	return sb.String()
+}
+
+// relOrAbs returns p relative to root when it is inside it
+func relOrAbs(root, p string) string {
+	if rel, err := filepath.Rel(root, p); err == nil && !strings.HasPrefix(rel, "..") && rel != "." {
+		return rel
+	}
+	return p
+}
+
+// handleLinkCheck checks the links of a Markdown file or tree and returns the
+// report as JSON, or with format=html as a page
+func handleLinkCheck(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	p = filepath.Clean(p)
+	if _, err := os.Stat(p); err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "html" {
+		writeError(w, r, http.StatusBadRequest, "Unsupported format: "+format)
+		return
+	}
+
+	c, err := newLinkChecker(r.URL.Query().Get("external") == "1")
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.publicOnly()
+	report, err := c.check(p)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if format == "html" {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(buildHTML("Link check · "+filepath.Base(p), p, renderLinkReport(report), "markdown")))
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// runCheckLinks is the check-links command: it exits with 0 when every link
+// resolves, 1 when some are broken and 2 when the check cannot run
+func runCheckLinks(args []string) int {
+	flags := flag.NewFlagSet("check-links", flag.ContinueOnError)
+	external := flags.Bool("external", false, "also request http(s) URLs")
+	format := flags.String("format", "text", "report format: text, json or html")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: file-viewer check-links [flags] [path...]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "text" && *format != "json" && *format != "html" {
+		fmt.Fprintf(os.Stderr, "Error: unsupported format %q\n", *format)
+		return 2
+	}
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	c, err := newLinkChecker(*external)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 2
+	}
+	broken := false
+	var reports []*linkReport
+	for _, p := range paths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		report, err := c.check(abs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 2
+		}
+		reports = append(reports, report)
+		broken = broken || len(report.Issues) > 0
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if len(reports) == 1 {
+			enc.Encode(reports[0])
+		} else {
+			enc.Encode(reports)
+		}
+	case "html":
+		var sb strings.Builder
+		for _, report := range reports {
+			sb.WriteString(renderLinkReport(report))
+		}
+		fmt.Print(stripNonce(buildHTML("Link check", strings.Join(paths, " "), sb.String(), "markdown")))
+	default:
+		for _, report := range reports {
+			for _, issue := range report.Issues {
+				if issue.Kind == "file" {
+					fmt.Printf("%s: %s (%s)\n", relOrAbs(report.Root, issue.File), issue.Error, issue.Kind)
+					continue
+				}
+				fmt.Printf("%s:%d: %s: %s (%s)\n", relOrAbs(report.Root, issue.File), issue.Line, issue.Link, issue.Error, issue.Kind)
+			}
+			fmt.Printf("%s: %d broken of %d links in %d files\n", report.Root, len(report.Issues), report.Links, report.Files)
+			if report.Truncated {
+				fmt.Printf("%s: stopped after %d files and directories\n", report.Root, maxLinkCheckEntries)
+			}
+		}
+	}
+	if broken {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Link Checker Tests =====
+
+func TestCheckLinks(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"README.md": "---\ntitle: Docs\n---\n# Docs\n\n## Getting Started\n\n" +
+			"See [setup](guide/setup.md#install-it), [bad anchor](guide/setup.md#nope) and [start](#getting-started).\n" +
+			"[missing](guide/missing.md) ![logo](img/logo.png) ![gone](img/gone.png) [dir](guide/)\n" +
+			"[local](#nowhere) [mail](mailto:a@b.c) [web](https://example.com) `[code](nothing.md)`\n" +
+			"[[setup#Install it]] [[setup#Uninstall]] [[ghost]] [note][^1]\n\n" +
+			"```\n[fenced](nothing.md)\n```\n\n[^1]: Footnote, see [back](#fn-1).\n",
+		"guide/setup.md":    "# Setup\n\n## Install it\n\n<a id=\"custom\"></a>\n[up](../README.md#docs) [custom](#custom) [with title](../README.md \"Home\")\n",
+		"img/logo.png":      "png",
+		".hidden/bad.md":    "[broken](nowhere.md)",
+		"node_modules/x.md": "[broken](nowhere.md)",
+	})
+
+	c, err := newLinkChecker(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Files != 2 {
+		t.Errorf("files = %d, want 2", report.Files)
+	}
+
+	readme := filepath.Join(root, "README.md")
+	want := []linkIssue{
+		{File: readme, Line: 8, Link: "guide/setup.md#nope", Kind: "anchor"},
+		{File: readme, Line: 9, Link: "img/gone.png", Kind: "image"},
+		{File: readme, Line: 9, Link: "guide/missing.md", Kind: "link"},
+		{File: readme, Line: 10, Link: "#nowhere", Kind: "anchor"},
+		{File: readme, Line: 11, Link: "[[setup#Uninstall]]", Kind: "anchor"},
+		{File: readme, Line: 11, Link: "[[ghost]]", Kind: "wiki"},
+	}
+	if len(report.Issues) != len(want) {
+		t.Fatalf("issues = %+v, want %d", report.Issues, len(want))
+	}
+	for i, w := range want {
+		got := report.Issues[i]
+		if got.File != w.File || got.Line != w.Line || got.Link != w.Link || got.Kind != w.Kind || got.Error == "" {
+			t.Errorf("issue %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if report.Skipped != 2 {
+		t.Errorf("skipped = %d, want mailto and the unchecked URL", report.Skipped)
+	}
+
+	html := renderLinkReport(report)
+	for _, want := range []string{`6 broken of`, `<h3><a href="` + filepath.ToSlash(readme) + `">README.md</a></h3>`, `<code>img/gone.png</code>`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report page missing %q", want)
+		}
+	}
+}
+
+func TestCheckLinksBlankTarget(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.md": "[x](   ) ![y]( \t)\n"})
+	c, err := newLinkChecker(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 2 || report.Issues[0].Error != "empty link" || report.Issues[1].Error != "empty link" {
+		t.Errorf("issues = %+v, want both blank targets reported", report.Issues)
+	}
+}
+
+func TestCheckLinksFileErrors(t *testing.T) {
+	root := writeTree(t, map[string]string{
+		"a.md":    "# My Heading\n\n[x](#My_Heading) [y](#My%20Heading) [z](b.md#Other_Part)\n",
+		"b.md":    "## Other part\n",
+		"huge.md": strings.Repeat("x", MaxViewableSize+1),
+	})
+	c, err := newLinkChecker(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fragments are slugified as the viewer does; an unreadable file is listed
+	if len(report.Issues) != 1 || report.Issues[0].File != filepath.Join(root, "huge.md") || report.Issues[0].Kind != "file" {
+		t.Errorf("issues = %+v, want only huge.md", report.Issues)
+	}
+	if report.Files != 3 || report.Links != 3 {
+		t.Errorf("files = %d, links = %d", report.Files, report.Links)
+	}
+}
+
+func TestCheckLinksExternal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/no-head":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		case "/agent":
+			if r.UserAgent() != "docs-bot" {
+				w.WriteHeader(http.StatusForbidden)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	root := writeTree(t, map[string]string{
+		"a.md": "[ok](" + server.URL + "/ok) [head](" + server.URL + "/no-head) [agent](" + server.URL + "/agent)\n" +
+			"[gone](" + server.URL + "/gone) [again](" + server.URL + "/gone) [skip](" + server.URL + "/skip/gone)\n",
+	})
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{LinkCheck: &LinkCheckConfig{Timeout: "5s", UserAgent: "docs-bot", Ignore: []string{server.URL + "/skip/"}}}
+
+	c, err := newLinkChecker(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := c.check(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.External != 4 || report.Skipped != 1 {
+		t.Errorf("external = %d, skipped = %d", report.External, report.Skipped)
+	}
+	if len(report.Issues) != 2 {
+		t.Fatalf("issues = %+v, want the /gone link twice", report.Issues)
+	}
+	for _, issue := range report.Issues {
+		if issue.Kind != "url" || issue.Line != 2 || issue.Error != "HTTP 404 Not Found" {
+			t.Errorf("issue = %+v", issue)
+		}
+	}
+
+	appConfig = &Config{LinkCheck: &LinkCheckConfig{Timeout: "soon"}}
+	if _, err := newLinkChecker(true); err == nil {
+		t.Error("an invalid timeout should be reported")
+	}
+}
+
+func TestLinkCheckPublicOnly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	root := writeTree(t, map[string]string{"a.md": "[admin](" + server.URL + "/admin)\n"})
+
+	rec := httptest.NewRecorder()
+	handleLinkCheck(rec, httptest.NewRequest("GET", "/links/check?external=1&path="+url.QueryEscape(root), nil))
+	var report linkReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || !strings.Contains(report.Issues[0].Error, "127.0.0.1 is not a public address") {
+		t.Errorf("issues = %+v, want the loopback URL refused", report.Issues)
+	}
+
+	for ip, public := range map[string]bool{"93.184.216.34": true, "2606:4700::1111": true, "127.0.0.1": false, "10.1.2.3": false,
+		"192.168.0.1": false, "169.254.169.254": false, "::1": false, "fd00::1": false, "0.0.0.0": false} {
+		if got := isPublicIP(net.ParseIP(ip)); got != public {
+			t.Errorf("isPublicIP(%s) = %v, want %v", ip, got, public)
+		}
+	}
+}
+
+func TestRunCheckLinks(t *testing.T) {
+	clean := writeTree(t, map[string]string{"a.md": "# A\n\n[self](#a)\n"})
+	broken := writeTree(t, map[string]string{"a.md": "[x](missing.md)\n"})
+	for _, tt := range []struct {
+		args []string
+		code int
+	}{
+		{[]string{clean}, 0},
+		{[]string{"--format", "json", broken}, 1},
+		{[]string{clean, broken}, 1},
+		{[]string{"--format", "xml", clean}, 2},
+		{[]string{filepath.Join(clean, "nonexistent")}, 2},
+	} {
+		if code := runCheckLinks(tt.args); code != tt.code {
+			t.Errorf("%v: exit code %d, want %d", tt.args, code, tt.code)
+		}
+	}
+}
+
+func TestHandleLinkCheck(t *testing.T) {
+	root := writeTree(t, map[string]string{"a.md": "[x](missing.md)\n"})
+
+	rec := httptest.NewRecorder()
+	handleLinkCheck(rec, httptest.NewRequest("GET", "/links/check?path="+url.QueryEscape(root), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var report linkReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Issues) != 1 || report.Issues[0].Link != "missing.md" {
+		t.Errorf("issues = %+v", report.Issues)
+	}
+
+	rec = httptest.NewRecorder()
+	handleLinkCheck(rec, httptest.NewRequest("GET", "/links/check?format=html&path="+url.QueryEscape(root), nil))
+	if !strings.Contains(rec.Body.String(), `<div class="link-report">`) {
+		t.Error("format=html should render the report page")
+	}
+
+	for query, status := range map[string]int{
+		"":                      http.StatusBadRequest,
+		"path=/nonexistent":     http.StatusNotFound,
+		"path=/etc/hostname":    http.StatusBadRequest,
+		"path=/tmp&format=yaml": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handleLinkCheck(rec, httptest.NewRequest("GET", "/links/check?"+query, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, status)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// newLogger returns the logger of a level (debug, info, warn or error) and
+// a format (text or json)
+func newLogger(w io.Writer, level, format string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if level != "" {
+		if err := lvl.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("log level %q: want debug, info, warn or error", level)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("log format %q: want text or json", format)
+}
+
+// requestInfo collects what handlers know about a request for its log line
+type requestInfo struct {
+	renderType string
+	render     time.Duration
+}
+
+type requestInfoKey struct{}
+
+// requestInfoFrom returns the requestInfo of a request; nil outside
+// logRequests, which the setters accept
+func requestInfoFrom(r *http.Request) *requestInfo {
+	info, _ := r.Context().Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// setRender records the rendering of a file, in the request log and the
+// metrics
+func (info *requestInfo) setRender(contentType string, d time.Duration) {
+	if contentType == "" {
+		renderErrors.inc()
+		contentType = "error"
+	} else {
+		rendersTotal.inc(contentType)
+		renderDuration.observe(d.Seconds(), contentType)
+	}
+	if info != nil {
+		info.renderType, info.render = contentType, d
+	}
+}
+
+// statusWriter records the status and size of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// redactedURL returns the URL of a request without the token of the token
+// auth mode
+func redactedURL(u *url.URL) string {
+	q := u.Query()
+	if !q.Has("token") {
+		return u.RequestURI()
+	}
+	q.Set("token", "REDACTED")
+	redacted := *u
+	redacted.RawQuery = q.Encode()
+	return redacted.RequestURI()
+}
+
+// logRequests logs each request once served and counts it in the metrics.
+// Live reload polls, scrapes and health checks are logged at debug level
+// only.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{}
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), requestInfoKey{}, info)))
+		elapsed := time.Since(start)
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		route := routeLabel(path.Clean(r.URL.Path))
+		requestsTotal.inc(route, methodLabel(r.Method), fmt.Sprint(sw.status))
+		requestDuration.observe(elapsed.Seconds(), route)
+		responseBytes.add(float64(sw.bytes), route)
+
+		level := slog.LevelInfo
+		switch {
+		case sw.status >= 500:
+			level = slog.LevelError
+		case route == "/mtime/" || route == "/metrics" || route == "/healthz":
+			level = slog.LevelDebug
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("url", redactedURL(r.URL)),
+			slog.Int("status", sw.status),
+			slog.Int64("bytes", sw.bytes),
+			slog.Duration("duration", elapsed),
+			slog.String("remote", r.RemoteAddr),
+		}
+		if cache := sw.Header().Get("X-Cache"); cache != "" {
+			attrs = append(attrs, slog.String("cache", strings.ToLower(cache)))
+		}
+		if info.renderType != "" {
+			attrs = append(attrs, slog.String("render_type", info.renderType), slog.Duration("render", info.render))
+		}
+		slog.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
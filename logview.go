@@ -0,0 +1,626 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Interval between two checks of a followed log file
+const tailPollInterval = 500 * time.Millisecond
+
+// A followed file is read tailReadSize bytes at a time; lines longer than
+// maxLineBytes are sent cut
+const tailReadSize = 64 * 1024
+
+// Log levels from least to most severe
+var logLevels = []string{"trace", "debug", "info", "warn", "error", "fatal"}
+
+// Level names found in the wild, normalized to logLevels
+var logLevelAliases = map[string]string{
+	"trace": "trace", "trc": "trace", "verbose": "trace",
+	"debug": "debug", "dbg": "debug",
+	"info": "info", "inf": "info", "information": "info", "notice": "info",
+	"warn": "warn", "wrn": "warn", "warning": "warn",
+	"error": "error", "err": "error", "eror": "error",
+	"fatal": "fatal", "ftl": "fatal", "critical": "fatal", "crit": "fatal", "panic": "fatal",
+	"emerg": "fatal", "emergency": "fatal", "alert": "fatal",
+}
+
+// Field names used by structured loggers (JSON lines and logfmt)
+var (
+	logTimeKeys    = []string{"time", "ts", "timestamp", "@timestamp", "datetime", "date", "t"}
+	logLevelKeys   = []string{"level", "lvl", "severity", "loglevel", "levelname", "log.level"}
+	logMessageKeys = []string{"msg", "message", "@message", "text"}
+)
+
+// Timestamp formats recognized at the start of plain text lines
+var logTimestampFormats = []struct {
+	re      *regexp.Regexp
+	layouts []string
+}{
+	{
+		regexp.MustCompile(`\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(?:[.,]\d+)?(?:Z|[+-]\d{2}:?\d{2})?`),
+		[]string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999Z0700", "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999Z0700", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05.999999999"},
+	},
+	{
+		regexp.MustCompile(`\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?`),
+		[]string{"2006/01/02 15:04:05.999999999"},
+	},
+	{
+		regexp.MustCompile(`\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`),
+		[]string{"[02/Jan/2006:15:04:05 -0700]"},
+	},
+	{
+		regexp.MustCompile(`[A-Z][a-z]{2} +\d{1,2} \d{2}:\d{2}:\d{2}`),
+		[]string{"Jan _2 15:04:05"},
+	},
+}
+
+var (
+	// Upper-case level words anywhere, or lower-case ones in brackets or followed by a colon
+	logLevelUpperRe   = regexp.MustCompile(`\b(TRACE|DEBUG|INFO|NOTICE|WARN|WARNING|ERROR|ERR|FATAL|CRITICAL|CRIT|PANIC|EMERG|ALERT)\b`)
+	logLevelBracketRe = regexp.MustCompile(`(?i)[\[<(](trace|debug|info|notice|warn|warning|error|err|fatal|critical|crit|panic)[\]>)]|(?i)\b(trace|debug|info|notice|warn|warning|error|err|fatal|critical|panic):`)
+	logfmtPairRe      = regexp.MustCompile(`([A-Za-z_@][A-Za-z0-9_.@-]*)=("(?:[^"\\]|\\.)*"|[^\s"]*)`)
+)
+
+// logEntry is one parsed line of a log file
+type logEntry struct {
+	Time         time.Time
+	Level        string // one of logLevels, or "" when unknown
+	Format       string // json, logfmt or text
+	Message      string
+	Fields       [][2]string // remaining structured fields, in order
+	TimeText     string      // timestamp as written in a text line
+	Continuation bool        // stack trace or wrapped line inheriting the previous level
+}
+
+// normalizeLogLevel maps a level name or bunyan/pino numeric level to logLevels
+func normalizeLogLevel(v interface{}) string {
+	switch l := v.(type) {
+	case string:
+		if level, ok := logLevelAliases[strings.ToLower(strings.TrimSpace(l))]; ok {
+			return level
+		}
+		if n, err := strconv.Atoi(l); err == nil {
+			return normalizeLogLevel(float64(n))
+		}
+	case float64:
+		switch {
+		case l >= 60:
+			return "fatal"
+		case l >= 50:
+			return "error"
+		case l >= 40:
+			return "warn"
+		case l >= 30:
+			return "info"
+		case l >= 20:
+			return "debug"
+		case l > 0:
+			return "trace"
+		}
+	}
+	return ""
+}
+
+// parseLogTime reads a structured timestamp: RFC 3339 text or Unix seconds/milliseconds
+func parseLogTime(v interface{}) time.Time {
+	switch t := v.(type) {
+	case string:
+		for _, f := range logTimestampFormats {
+			if m := f.re.FindString(t); m != "" {
+				if ts := parseTimestamp(m, f.layouts); !ts.IsZero() {
+					return ts
+				}
+			}
+		}
+		if n, err := strconv.ParseFloat(t, 64); err == nil {
+			return parseLogTime(n)
+		}
+	case float64:
+		if t > 1e12 {
+			return time.UnixMilli(int64(t))
+		}
+		sec := int64(t)
+		return time.Unix(sec, int64((t-float64(sec))*1e9))
+	}
+	return time.Time{}
+}
+
+func parseTimestamp(s string, layouts []string) time.Time {
+	s = strings.Replace(s, ",", ".", 1)
+	for _, layout := range layouts {
+		if ts, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			// Syslog timestamps have no year
+			if ts.Year() == 0 {
+				now := time.Now()
+				ts = ts.AddDate(now.Year(), 0, 0)
+				if ts.After(now.Add(24 * time.Hour)) {
+					ts = ts.AddDate(-1, 0, 0)
+				}
+			}
+			return ts
+		}
+	}
+	return time.Time{}
+}
+
+// parseLogLine detects JSON lines, logfmt and plain text log formats
+func parseLogLine(line string) logEntry {
+	trimmed := strings.TrimSpace(line)
+
+	if strings.HasPrefix(trimmed, "{") {
+		var obj map[string]interface{}
+		if err := json.Unmarshal([]byte(trimmed), &obj); err == nil {
+			return structuredLogEntry("json", objectFields(obj), func(key string) (interface{}, bool) {
+				v, ok := obj[key]
+				return v, ok
+			})
+		}
+	}
+
+	if pairs := logfmtPairRe.FindAllStringSubmatch(trimmed, -1); len(pairs) >= 2 && isLogfmt(trimmed, pairs) {
+		values := make(map[string]interface{})
+		var keys []string
+		for _, p := range pairs {
+			v := p[2]
+			if unquoted, err := strconv.Unquote(v); err == nil {
+				v = unquoted
+			}
+			if _, dup := values[p[1]]; !dup {
+				keys = append(keys, p[1])
+			}
+			values[p[1]] = v
+		}
+		return structuredLogEntry("logfmt", keyValues(keys, values), func(key string) (interface{}, bool) {
+			v, ok := values[key]
+			return v, ok
+		})
+	}
+
+	entry := logEntry{Format: "text", Message: line}
+	for _, f := range logTimestampFormats {
+		if loc := f.re.FindStringIndex(line); loc != nil && loc[0] < 32 {
+			entry.TimeText = line[loc[0]:loc[1]]
+			entry.Time = parseTimestamp(strings.Trim(entry.TimeText, "[]"), trimBracketLayouts(f.layouts))
+			break
+		}
+	}
+	if m := logLevelUpperRe.FindStringSubmatch(line); m != nil {
+		entry.Level = normalizeLogLevel(m[1])
+	} else if m := logLevelBracketRe.FindStringSubmatch(line); m != nil {
+		entry.Level = normalizeLogLevel(m[1] + m[2])
+	}
+	return entry
+}
+
+func trimBracketLayouts(layouts []string) []string {
+	trimmed := make([]string, len(layouts))
+	for i, l := range layouts {
+		trimmed[i] = strings.Trim(l, "[]")
+	}
+	return trimmed
+}
+
+// isLogfmt requires the pairs to cover most of the line and a well-known key
+func isLogfmt(line string, pairs [][]string) bool {
+	covered := 0
+	known := false
+	for _, p := range pairs {
+		covered += len(p[0])
+		for _, keys := range [][]string{logTimeKeys, logLevelKeys, logMessageKeys} {
+			for _, k := range keys {
+				if p[1] == k {
+					known = true
+				}
+			}
+		}
+	}
+	return known && covered*2 >= len(strings.ReplaceAll(line, " ", ""))
+}
+
+func objectFields(obj map[string]interface{}) [][2]string {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keyValues(keys, obj)
+}
+
+func keyValues(keys []string, values map[string]interface{}) [][2]string {
+	fields := make([][2]string, 0, len(keys))
+	for _, k := range keys {
+		v := values[k]
+		text, ok := v.(string)
+		if !ok {
+			b, _ := json.Marshal(v)
+			text = string(b)
+		}
+		fields = append(fields, [2]string{k, text})
+	}
+	return fields
+}
+
+// structuredLogEntry picks time, level and message out of key/value fields
+func structuredLogEntry(format string, fields [][2]string, get func(string) (interface{}, bool)) logEntry {
+	entry := logEntry{Format: format}
+	used := make(map[string]bool)
+	pick := func(keys []string) (interface{}, bool) {
+		for _, k := range keys {
+			if v, ok := get(k); ok {
+				used[k] = true
+				return v, true
+			}
+		}
+		return nil, false
+	}
+
+	if v, ok := pick(logTimeKeys); ok {
+		entry.Time = parseLogTime(v)
+	}
+	if v, ok := pick(logLevelKeys); ok {
+		entry.Level = normalizeLogLevel(v)
+	}
+	if v, ok := pick(logMessageKeys); ok {
+		entry.Message = fmt.Sprint(v)
+	}
+	for _, f := range fields {
+		if !used[f[0]] {
+			entry.Fields = append(entry.Fields, f)
+		}
+	}
+	return entry
+}
+
+// parseLogLines parses every line, attaching continuation lines to the previous entry's level
+func parseLogLines(lines []string) []logEntry {
+	entries := make([]logEntry, 0, len(lines))
+	var prev *logEntry
+	for _, line := range lines {
+		entry := parseLogLine(line)
+		if !continueLogEntry(prev, &entry, line) {
+			prev = &entry
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// continueLogEntry attaches a line without its own timestamp or level to the
+// previous entry: the rest of a multi-line message or a stack trace
+func continueLogEntry(prev, entry *logEntry, line string) bool {
+	if prev == nil || entry.Format != "text" || !entry.Time.IsZero() || entry.Level != "" {
+		return false
+	}
+	if !isContinuationLine(line) && prev.Time.IsZero() {
+		return false
+	}
+	entry.Continuation = true
+	entry.Level = prev.Level
+	entry.Time = prev.Time
+	return true
+}
+
+// isContinuationLine matches indented lines and Java/Python stack trace lines
+func isContinuationLine(line string) bool {
+	if line == "" {
+		return false
+	}
+	if unicode.IsSpace(rune(line[0])) {
+		return true
+	}
+	for _, prefix := range []string{"at ", "Caused by:", "Traceback", "...", "goroutine "} {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderLogLine renders one entry as a filterable row
+func renderLogLine(entry logEntry) string {
+	var sb strings.Builder
+	level := entry.Level
+	if level == "" {
+		level = "other"
+	}
+	ts := ""
+	if !entry.Time.IsZero() {
+		ts = strconv.FormatInt(entry.Time.UnixMilli(), 10)
+	}
+	class := "log-line log-level-" + level
+	if entry.Continuation {
+		class += " log-continuation"
+	}
+	sb.WriteString(fmt.Sprintf(`<div class="%s" data-level="%s" data-ts="%s">`, class, level, ts))
+
+	if entry.Format == "text" {
+		msg := html.EscapeString(entry.Message)
+		if entry.TimeText != "" {
+			escapedTS := html.EscapeString(entry.TimeText)
+			msg = strings.Replace(msg, escapedTS, `<span class="log-ts">`+escapedTS+`</span>`, 1)
+		}
+		sb.WriteString(msg)
+	} else {
+		if !entry.Time.IsZero() {
+			sb.WriteString(fmt.Sprintf(`<span class="log-ts">%s</span> `, entry.Time.Format("2006-01-02 15:04:05.000")))
+		}
+		if entry.Level != "" {
+			sb.WriteString(fmt.Sprintf(`<span class="log-level">%s</span> `, strings.ToUpper(entry.Level)))
+		}
+		sb.WriteString(html.EscapeString(entry.Message))
+		for _, f := range entry.Fields {
+			sb.WriteString(fmt.Sprintf(` <span class="log-field"><span class="log-key">%s</span>=%s</span>`, html.EscapeString(f[0]), html.EscapeString(f[1])))
+		}
+	}
+	sb.WriteString("</div>")
+	return sb.String()
+}
+
+// readLogTail reads at most max bytes from the end of a file, starting on a line boundary
+func readLogTail(path string, size, max int64) ([]byte, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+
+	if size <= max {
+		data, err := io.ReadAll(f)
+		return data, false, err
+	}
+	if _, err := f.Seek(size-max, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	data, err := io.ReadAll(io.LimitReader(f, max))
+	if err != nil {
+		return nil, false, err
+	}
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		data = data[i+1:]
+	}
+	return data, true, nil
+}
+
+// renderLogFile renders a log file (its last MaxViewableSize bytes for large files)
+// with level colouring, filters and live follow
+func renderLogFile(filePath string, size int64, kind FileKind) string {
+	data, partial, err := readLogTail(filePath, size, MaxViewableSize)
+	if err != nil {
+		return fmt.Sprintf(`<p style="color: red;">Error reading file: %s</p>`, html.EscapeString(err.Error()))
+	}
+	content := strings.TrimSuffix(decodeText(data, kind.Encoding), "\n")
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(content, "\n")
+	}
+
+	var result strings.Builder
+	result.WriteString(`<div class="log-toolbar">`)
+	for _, level := range append(logLevels, "other") {
+		result.WriteString(fmt.Sprintf(`<label class="log-filter log-level-%s"><input type="checkbox" value="%s" checked onchange="filterLog()"> %s</label>`, level, level, level))
+	}
+	result.WriteString(`
+    <input type="datetime-local" id="log-from" step="1" onchange="filterLog()" title="From" />
+    <input type="datetime-local" id="log-to" step="1" onchange="filterLog()" title="To" />
+    <input type="text" id="log-regex" placeholder="Filter (regex)..." oninput="filterLog()" />
+    <button id="log-follow-btn" onclick="toggleFollow()">▶ Follow</button>
+    <span id="log-count" class="search-count"></span>
+</div>`)
+	if partial {
+		result.WriteString(fmt.Sprintf(`<p class="large-file-notice">Showing the last %s of %s.</p>`, formatSize(MaxViewableSize), formatSize(size)))
+	}
+	result.WriteString(fmt.Sprintf(`<div class="log-view" id="log-view" data-path="%s" data-offset="%d">`, html.EscapeString(filePath), size))
+	for _, entry := range parseLogLines(lines) {
+		result.WriteString(renderLogLine(entry))
+		result.WriteString("\n")
+	}
+	result.WriteString(withNonce(`</div>
+<script>
+function filterLog() {
+    const levels = new Set(Array.from(document.querySelectorAll('.log-filter input:checked')).map(cb => cb.value));
+    const from = document.getElementById('log-from').value;
+    const to = document.getElementById('log-to').value;
+    const fromTs = from ? new Date(from).getTime() : null;
+    const toTs = to ? new Date(to).getTime() : null;
+    const input = document.getElementById('log-regex');
+    let re = null;
+    try {
+        re = input.value ? new RegExp(input.value, 'i') : null;
+        input.classList.remove('invalid');
+    } catch (e) {
+        input.classList.add('invalid');
+    }
+    const rows = document.querySelectorAll('#log-view .log-line');
+    let shown = 0;
+    rows.forEach(row => {
+        const ts = row.dataset.ts ? parseInt(row.dataset.ts, 10) : null;
+        let match = levels.has(row.dataset.level);
+        if (match && ts !== null && fromTs !== null && ts < fromTs) match = false;
+        if (match && ts !== null && toTs !== null && ts > toTs) match = false;
+        if (match && re && !re.test(row.textContent)) match = false;
+        row.style.display = match ? '' : 'none';
+        if (match) shown++;
+    });
+    document.getElementById('log-count').textContent = shown + ' / ' + rows.length + ' lines';
+}
+
+let logSource = null;
+function toggleFollow() {
+    const btn = document.getElementById('log-follow-btn');
+    const view = document.getElementById('log-view');
+    if (logSource) {
+        logSource.close();
+        logSource = null;
+        btn.textContent = '▶ Follow';
+        btn.classList.remove('following');
+        return;
+    }
+    logSource = new EventSource('/tail?path=' + encodeURIComponent(view.dataset.path) + '&offset=' + view.dataset.offset);
+    btn.textContent = '⏸ Following';
+    btn.classList.add('following');
+    const append = (html) => {
+        const atBottom = window.innerHeight + window.scrollY >= document.body.scrollHeight - 40;
+        view.insertAdjacentHTML('beforeend', html);
+        filterLog();
+        if (atBottom) window.scrollTo(0, document.body.scrollHeight);
+    };
+    logSource.addEventListener('line', e => {
+        const data = JSON.parse(e.data);
+        view.dataset.offset = data.offset;
+        append(data.html);
+    });
+    ['truncated', 'rotated'].forEach(type => logSource.addEventListener(type, e => {
+        view.dataset.offset = 0;
+        append('<div class="log-marker">— file ' + type + ' —</div>');
+    }));
+}
+document.addEventListener('DOMContentLoaded', function() { filterLog(); });
+</script>`))
+	return result.String()
+}
+
+// handleTail streams lines appended to a log file as server-sent events, like tail -f
+func handleTail(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+	defer func() { f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	offset := info.Size()
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n >= 0 && n <= info.Size() {
+			offset = n
+		}
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, http.StatusInternalServerError, "Streaming not supported")
+		return
+	}
+	// The stream outlives the write timeout of the server
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(event string, data interface{}) {
+		watcherEvents.inc(event)
+		b, _ := json.Marshal(data)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b)
+	}
+
+	buf := make([]byte, tailReadSize)
+	var pending []byte
+	skipping := false
+	var prev *logEntry
+	ticker := time.NewTicker(tailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-draining(r):
+			// EventSource reconnects once the server is back
+			return
+		case <-ticker.C:
+		}
+
+		// Rotation: the path now points to another file
+		if current, err := os.Stat(path); err == nil && !os.SameFile(info, current) {
+			if reopened, err := os.Open(path); err == nil {
+				f.Close()
+				f = reopened
+				info = current
+				offset = 0
+				pending, prev, skipping = nil, nil, false
+				send("rotated", map[string]int64{"offset": 0})
+			}
+		}
+
+		stat, err := f.Stat()
+		if err != nil {
+			continue
+		}
+		// Truncation: the file is shorter than what we already read
+		if stat.Size() < offset {
+			offset = 0
+			pending, prev, skipping = nil, nil, false
+			send("truncated", map[string]int64{"offset": 0})
+		}
+		for offset < stat.Size() && r.Context().Err() == nil {
+			n, err := f.ReadAt(buf[:min(int64(len(buf)), stat.Size()-offset)], offset)
+			if n == 0 {
+				if err != nil {
+					break
+				}
+				continue
+			}
+			offset += int64(n)
+			pending = append(pending, buf[:n]...)
+			for {
+				i := bytes.IndexByte(pending, '\n')
+				if skipping {
+					// The rest of a line already sent cut
+					if i < 0 {
+						pending = pending[:0]
+						break
+					}
+					pending, skipping = pending[i+1:], false
+					continue
+				}
+				if i < 0 && len(pending) < maxLineBytes {
+					break
+				}
+				if i < 0 || i > maxLineBytes {
+					i, skipping = maxLineBytes, true
+				}
+				line := strings.TrimRight(string(pending[:i]), "\r")
+				if skipping {
+					pending = pending[i:]
+				} else {
+					pending = pending[i+1:]
+				}
+				entry := parseLogLine(line)
+				if !continueLogEntry(prev, &entry, line) {
+					prev = &entry
+				}
+				send("line", map[string]interface{}{
+					"html":   renderLogLine(entry),
+					"offset": offset - int64(len(pending)),
+				})
+			}
+			// Keep the unread part of pending only, not the whole buffer
+			pending = append(pending[:0:0], pending...)
+		}
+		flusher.Flush()
+	}
+}
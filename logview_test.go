@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ===== Log Viewer Tests =====
+
+func TestParseLogLine(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		format  string
+		level   string
+		message string
+		hasTime bool
+	}{
+		{"ISO timestamp", "2024-03-01T10:15:30.123Z INFO server started", "text", "info", "2024-03-01T10:15:30.123Z INFO server started", true},
+		{"Go log", "2024/03/01 10:15:30 [warn] disk almost full", "text", "warn", "2024/03/01 10:15:30 [warn] disk almost full", true},
+		{"Syslog", "Mar  1 10:15:30 host sshd[42]: error: auth failed", "text", "error", "Mar  1 10:15:30 host sshd[42]: error: auth failed", true},
+		{"Apache", `127.0.0.1 - - [01/Mar/2024:10:15:30 +0000] "GET / HTTP/1.1" 200 512`, "text", "", `127.0.0.1 - - [01/Mar/2024:10:15:30 +0000] "GET / HTTP/1.1" 200 512`, true},
+		{"Lower-case prose is not a level", "no error here", "text", "", "no error here", false},
+		{"JSON", `{"time":"2024-03-01T10:15:30Z","level":"ERROR","msg":"boom","user":"bob"}`, "json", "error", "boom", true},
+		{"JSON numeric level", `{"ts":1709288130,"level":50,"message":"pino"}`, "json", "error", "pino", true},
+		{"logfmt", `time=2024-03-01T10:15:30Z level=warning msg="slow query" ms=1200`, "logfmt", "warn", "slow query", true},
+		{"key=value prose is not logfmt", "set a=1 b=2 and then continue the work", "text", "", "set a=1 b=2 and then continue the work", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := parseLogLine(tt.line)
+			if entry.Format != tt.format {
+				t.Errorf("Format = %q, want %q", entry.Format, tt.format)
+			}
+			if entry.Level != tt.level {
+				t.Errorf("Level = %q, want %q", entry.Level, tt.level)
+			}
+			if entry.Message != tt.message {
+				t.Errorf("Message = %q, want %q", entry.Message, tt.message)
+			}
+			if entry.Time.IsZero() == tt.hasTime {
+				t.Errorf("Time = %v, want set=%v", entry.Time, tt.hasTime)
+			}
+		})
+	}
+
+	entry := parseLogLine(`{"time":"2024-03-01T10:15:30Z","level":"info","msg":"ok","user":"bob"}`)
+	if len(entry.Fields) != 1 || entry.Fields[0] != [2]string{"user", "bob"} {
+		t.Errorf("Fields = %v, want [[user bob]]", entry.Fields)
+	}
+}
+
+func TestParseLogLinesContinuation(t *testing.T) {
+	// Without timestamps only indented or stack trace lines continue an entry
+	plain := parseLogLines([]string{"ERROR first", "second", "  third"})
+	if plain[1].Continuation || !plain[2].Continuation {
+		t.Errorf("plain lines = %+v", plain)
+	}
+
+	entries := parseLogLines([]string{
+		"2024-03-01 10:15:30 ERROR unhandled exception",
+		"java.lang.NullPointerException",
+		"    at com.example.Main.run(Main.java:10)",
+		"2024-03-01 10:15:31 INFO recovered",
+	})
+	if !entries[2].Continuation || entries[2].Level != "error" {
+		t.Errorf("stack frame = %+v, want continuation of error", entries[2])
+	}
+	if !entries[1].Continuation || entries[1].Level != "error" {
+		t.Errorf("exception line = %+v, want continuation of error", entries[1])
+	}
+	if entries[3].Continuation || entries[3].Level != "info" {
+		t.Errorf("next entry = %+v", entries[3])
+	}
+}
+
+func TestRenderFileLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	content := "2024-03-01 10:15:30 WARN <low> memory\n2024-03-01 10:15:31 ERROR crash\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	html, class := renderFile(path)
+	if class != "log" {
+		t.Errorf("class = %q, want log", class)
+	}
+	for _, want := range []string{
+		`data-level="warn"`,
+		`data-level="error"`,
+		"&lt;low&gt;",
+		`<span class="log-ts">2024-03-01 10:15:30</span>`,
+		`data-offset="` + strconv.Itoa(len(content)) + `"`,
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("renderFile() missing %q", want)
+		}
+	}
+}
+
+func TestReadLogTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tail.log")
+	if err := os.WriteFile(path, []byte("first line\nsecond\nthird\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	data, partial, err := readLogTail(path, 24, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !partial || string(data) != "third\n" {
+		t.Errorf("readLogTail() = %q partial=%v, want whole last line", data, partial)
+	}
+}
+
+func TestHandleTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "live.log")
+	if err := os.WriteFile(path, []byte("old line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(handleTail))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/tail?path="+url.QueryEscape(path)+"&offset=9", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Content-Type = %q", ct)
+	}
+
+	events := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(resp.Body)
+		event := ""
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				events <- event + " " + strings.TrimPrefix(line, "data: ")
+			}
+		}
+		close(events)
+	}()
+	next := func() string {
+		select {
+		case e := <-events:
+			return e
+		case <-ctx.Done():
+			t.Fatal("timed out waiting for event")
+		}
+		return ""
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("2024-03-01 10:15:30 ERROR appended\n")
+	f.Close()
+
+	if e := next(); !strings.HasPrefix(e, "line ") || !strings.Contains(e, "appended") || !strings.Contains(e, `log-level-error`) {
+		t.Errorf("first event = %q", e)
+	}
+
+	// Truncation restarts from the beginning of the file
+	if err := os.WriteFile(path, []byte("new\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); !strings.HasPrefix(e, "truncated ") {
+		t.Errorf("expected truncated event, got %q", e)
+	}
+	if e := next(); !strings.Contains(e, "new") {
+		t.Errorf("expected line after truncation, got %q", e)
+	}
+
+	// Rotation: the path is replaced by another file
+	os.Rename(path, path+".1")
+	if err := os.WriteFile(path, []byte("rotated line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if e := next(); !strings.HasPrefix(e, "rotated ") {
+		t.Errorf("expected rotated event, got %q", e)
+	}
+	if e := next(); !strings.Contains(e, "rotated line") {
+		t.Errorf("expected line after rotation, got %q", e)
+	}
+
+	// A line longer than maxLineBytes is sent cut, the next one whole
+	f, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(strings.Repeat("x", 3*maxLineBytes) + "\nshort\n")
+	f.Close()
+	if e := next(); strings.Count(e, "x") != maxLineBytes {
+		t.Errorf("long line sent with %d x, want %d", strings.Count(e, "x"), maxLineBytes)
+	}
+	if e := next(); !strings.Contains(e, "short") || strings.Contains(e, "xx") {
+		t.Errorf("expected the line after the long one, got %.80q", e)
+	}
+}
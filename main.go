@@ -3,21 +3,44 @@ package main
 import (
 	"bytes"
 	"compress/zlib"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html"
 	"io"
+	"log/slog"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
+// Content types of the files served by /asset, by extension
+var assetContentTypes = map[string]string{
+	".svg":  "image/svg+xml",
+	".png":  "image/png",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".gif":  "image/gif",
+	".webp": "image/webp",
+	".ico":  "image/x-icon",
+	".pdf":  "application/pdf",
+}
+
 // Emoji map for common emojis
 var emojiMap = map[string]string{
 	"smile":           "😊",
@@ -196,31 +219,39 @@ type Header struct {
 
 // FileEntry represents a file or directory for the sidebar
 type FileEntry struct {
-	Name     string `json:"name"`
-	Path     string `json:"path"`
-	IsDir    bool   `json:"isDir"`
-	Size     int64  `json:"size"`
-	Ext      string `json:"ext"`
-	Viewable bool   `json:"viewable"`
+	Name       string    `json:"name"`
+	Path       string    `json:"path"`
+	IsDir      bool      `json:"isDir"`
+	Size       int64     `json:"size"`
+	Ext        string    `json:"ext"`
+	Viewable   bool      `json:"viewable"`
+	Title      string    `json:"title,omitempty"` // Markdown front matter
+	Tags       []string  `json:"tags,omitempty"`
+	Date       string    `json:"date,omitempty"`
+	ModTime    time.Time `json:"modTime"`
+	Mode       string    `json:"mode"`
+	IsSymlink  bool      `json:"isSymlink,omitempty"`
+	LinkTarget string    `json:"linkTarget,omitempty"`
+	BrokenLink bool      `json:"brokenLink,omitempty"`
+	ChildCount int       `json:"childCount,omitempty"`
+	MimeType   string    `json:"mimeType,omitempty"`
 }
 
-// Maximum file size for viewing (5MB)
-const MaxViewableSize = 5 * 1024 * 1024
-
-// Binary/non-viewable extensions
-var binaryExtensions = map[string]bool{
-	"": true, ".exe": true, ".bin": true, ".so": true, ".dylib": true, ".dll": true,
-	".o": true, ".a": true, ".lib": true, ".obj": true,
-	".zip": true, ".tar": true, ".gz": true, ".bz2": true, ".xz": true, ".7z": true, ".rar": true,
-	".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".bmp": true, ".ico": true, ".webp": true, ".tiff": true,
-	".mp3": true, ".wav": true, ".flac": true, ".aac": true, ".ogg": true, ".m4a": true,
-	".mp4": true, ".avi": true, ".mkv": true, ".mov": true, ".wmv": true, ".flv": true, ".webm": true,
-	".pdf": true, ".doc": true, ".docx": true, ".xls": true, ".xlsx": true, ".ppt": true, ".pptx": true,
-	".ttf": true, ".otf": true, ".woff": true, ".woff2": true, ".eot": true,
-	".class": true, ".pyc": true, ".pyo": true, ".wasm": true,
-	".db": true, ".sqlite": true, ".sqlite3": true,
+// ListOptions controls sorting, filtering and pagination of a directory listing
+type ListOptions struct {
+	Sort       string   // name, size, mtime or ext
+	Desc       bool     // descending order (directories still come first)
+	Offset     int      // number of entries to skip
+	Limit      int      // maximum number of entries, 0 for no limit
+	Extensions []string // only list files with these extensions (lowercase, with dot)
 }
 
+// Sort keys accepted by listDirectory
+var listSortKeys = map[string]bool{"name": true, "size": true, "mtime": true, "ext": true}
+
+// Maximum file size rendered in one piece (5MB); larger text files use the chunked viewer
+const MaxViewableSize = 5 * 1024 * 1024
+
 func fetchURL(url string) (string, error) {
 	resp, err := httpClient.Get(url)
 	if err != nil {
@@ -249,6 +280,61 @@ func getCacheDir() string {
 	return filepath.Join(homeDir, ".cache", "file-viewer", "cdn")
 }
 
+// fetchCDN returns a resource of the /cdn cache, downloading it on a miss
+func fetchCDN(cdnPath string) ([]byte, error) {
+	data, _, err := cachedCDN(cdnPath)
+	return data, err
+}
+
+// cdnCachePath returns the cache file of a CDN resource. Paths that are not
+// clean, climb with .. or land outside the cache are refused.
+func cdnCachePath(cdnPath string) (string, error) {
+	if path.Clean(cdnPath) != cdnPath || slices.Contains(strings.Split(cdnPath, "/"), "..") {
+		return "", fmt.Errorf("invalid CDN path %q", cdnPath)
+	}
+	cacheDir := getCacheDir()
+	cachePath := filepath.Join(cacheDir, filepath.FromSlash(cdnPath))
+	if !strings.HasPrefix(cachePath, cacheDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid CDN path %q", cdnPath)
+	}
+	return cachePath, nil
+}
+
+// cachedCDN returns a CDN resource and whether it came from the cache
+func cachedCDN(cdnPath string) ([]byte, bool, error) {
+	cachePath, err := cdnCachePath(cdnPath)
+	if err != nil {
+		return nil, false, err
+	}
+	if data, err := os.ReadFile(cachePath); err == nil {
+		cdnRequests.inc("hit")
+		return data, true, nil
+	}
+	data, err := downloadCDN(cdnPath)
+	if err != nil {
+		cdnRequests.inc("error")
+		return nil, false, err
+	}
+	cdnRequests.inc("miss")
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+		os.WriteFile(cachePath, data, 0644)
+	}
+	return data, false, nil
+}
+
+// downloadCDN fetches a CDN resource, cdnPath being its URL without scheme
+func downloadCDN(cdnPath string) ([]byte, error) {
+	resp, err := httpClient.Get("https://" + cdnPath)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CDN returned %d for %s", resp.StatusCode, cdnPath)
+	}
+	return io.ReadAll(resp.Body)
+}
+
 // encodePlantUML encodes PlantUML content for the PlantUML server API
 func encodePlantUML(content string) string {
 	// Compress using zlib/deflate
@@ -296,14 +382,71 @@ func encodePlantUMLBytes(data []byte) string {
 	return result.String()
 }
 
-// listDirectory returns a sorted list of files and directories
-func listDirectory(dirPath string) ([]FileEntry, error) {
+// parseListOptions reads the /files query parameters (sort, order, offset, limit, ext)
+func parseListOptions(q url.Values) (ListOptions, error) {
+	opts := ListOptions{Sort: "name"}
+
+	if s := q.Get("sort"); s != "" {
+		if !listSortKeys[s] {
+			return opts, fmt.Errorf("invalid sort key: %s", s)
+		}
+		opts.Sort = s
+	}
+
+	switch q.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		return opts, fmt.Errorf("invalid order: %s", q.Get("order"))
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"offset", &opts.Offset}, {"limit", &opts.Limit}} {
+		v := q.Get(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return opts, fmt.Errorf("invalid %s: %s", p.name, v)
+		}
+		*p.dst = n
+	}
+
+	// ext=md,.go or repeated ext parameters
+	for _, v := range q["ext"] {
+		for _, e := range strings.Split(v, ",") {
+			e = strings.ToLower(strings.TrimSpace(e))
+			if e == "" {
+				continue
+			}
+			if !strings.HasPrefix(e, ".") {
+				e = "." + e
+			}
+			opts.Extensions = append(opts.Extensions, e)
+		}
+	}
+
+	return opts, nil
+}
+
+// listDirectory returns a sorted, filtered page of files and directories
+// along with the total number of matching entries
+func listDirectory(dirPath string, opts ListOptions) ([]FileEntry, int, error) {
 	entries, err := os.ReadDir(dirPath)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	var files []FileEntry
+	extFilter := make(map[string]bool)
+	for _, e := range opts.Extensions {
+		extFilter[e] = true
+	}
+
+	files := []FileEntry{}
 	for _, entry := range entries {
 		// Skip hidden files (starting with .)
 		if strings.HasPrefix(entry.Name(), ".") {
@@ -316,226 +459,439 @@ func listDirectory(dirPath string) ([]FileEntry, error) {
 		}
 
 		fullPath := filepath.Join(dirPath, entry.Name())
-		ext := ""
-		if !entry.IsDir() {
-			ext = strings.ToLower(filepath.Ext(entry.Name()))
-		}
-
-		// Determine if file is viewable (not binary and not too large)
-		viewable := true
-		if !entry.IsDir() {
-			if binaryExtensions[ext] {
-				viewable = false
-			} else if info.Size() > MaxViewableSize {
-				viewable = false
+		fe := FileEntry{
+			Name: entry.Name(),
+			Path: fullPath,
+		}
+
+		// Follow symlinks so linked directories stay navigable
+		if info.Mode()&os.ModeSymlink != 0 {
+			fe.IsSymlink = true
+			fe.LinkTarget, _ = os.Readlink(fullPath)
+			if target, err := os.Stat(fullPath); err == nil {
+				info = target
+			} else {
+				fe.BrokenLink = true
 			}
 		}
 
-		files = append(files, FileEntry{
-			Name:     entry.Name(),
-			Path:     fullPath,
-			IsDir:    entry.IsDir(),
-			Size:     info.Size(),
-			Ext:      ext,
-			Viewable: viewable,
-		})
+		fe.IsDir = info.IsDir()
+		fe.Size = info.Size()
+		fe.ModTime = info.ModTime()
+		fe.Mode = info.Mode().String()
+		if !fe.IsDir {
+			fe.Ext = strings.ToLower(filepath.Ext(entry.Name()))
+		}
+
+		if len(extFilter) > 0 && !fe.IsDir && !extFilter[fe.Ext] {
+			continue
+		}
+
+		files = append(files, fe)
+	}
+
+	sortFileEntries(files, opts.Sort, opts.Desc)
+
+	total := len(files)
+	if opts.Offset >= len(files) {
+		files = files[:0]
+	} else {
+		files = files[opts.Offset:]
+	}
+	if opts.Limit > 0 && len(files) > opts.Limit {
+		files = files[:opts.Limit]
 	}
 
-	// Sort: directories first, then alphabetically
-	sort.Slice(files, func(i, j int) bool {
-		if files[i].IsDir != files[j].IsDir {
-			return files[i].IsDir
+	// Only the returned page pays for file reads
+	for i := range files {
+		enrichFileEntry(&files[i])
+	}
+
+	return files, total, nil
+}
+
+// sortFileEntries sorts directories first, then by the given key, with name as tie-breaker
+func sortFileEntries(files []FileEntry, key string, desc bool) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		nameA, nameB := strings.ToLower(a.Name), strings.ToLower(b.Name)
+		cmp := 0
+		switch key {
+		case "size":
+			cmp = compareInt64(a.Size, b.Size)
+		case "mtime":
+			cmp = compareInt64(a.ModTime.UnixNano(), b.ModTime.UnixNano())
+		case "ext":
+			cmp = strings.Compare(a.Ext, b.Ext)
+		}
+		if cmp == 0 {
+			cmp = strings.Compare(nameA, nameB)
+		}
+		if desc {
+			return cmp > 0
 		}
-		return strings.ToLower(files[i].Name) < strings.ToLower(files[j].Name)
+		return cmp < 0
 	})
+}
 
-	return files, nil
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
 }
 
-func main() {
-	http.HandleFunc("/", handler)
+// enrichFileEntry fills in the fields that require reading the file or directory
+func enrichFileEntry(fe *FileEntry) {
+	if fe.BrokenLink {
+		return
+	}
+
+	if fe.IsDir {
+		fe.Viewable = true
+		if d, err := os.Open(fe.Path); err == nil {
+			names, _ := d.Readdirnames(-1)
+			d.Close()
+			// Hidden entries are not listed, so not counted either
+			for _, name := range names {
+				if !strings.HasPrefix(name, ".") {
+					fe.ChildCount++
+				}
+			}
+		}
+		return
+	}
 
-	fmt.Printf("File Viewer running on http://localhost:%d\n", PORT)
-	fmt.Printf("Usage: http://localhost:%d/path/to/file\n", PORT)
+	// Determine if file is viewable (text content; large files use the chunked viewer)
+	kind, err := sniffFile(fe.Path)
+	if err != nil {
+		return
+	}
+	fe.Viewable = kind.Text
+	fe.MimeType = kind.MimeType
+	if fm := readFrontMatter(fe.Path); fm != nil {
+		fe.Title, fe.Tags, fe.Date = fm.Title(), fm.Tags(), fm.Date()
+	}
+}
 
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", PORT), nil); err != nil {
+func main() {
+	cfg, err := loadConfig(getConfigDir())
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-}
+	appConfig = cfg
 
-func handler(w http.ResponseWriter, r *http.Request) {
-	// Log request
-	fmt.Printf("[%s] %s %s\n", time.Now().Format("15:04:05"), r.Method, r.URL.String())
+	if len(os.Args) > 1 && os.Args[1] == "build" {
+		os.Exit(runBuild(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "check-links" {
+		os.Exit(runCheckLinks(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "hash-password" {
+		os.Exit(runHashPassword(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "install-service" {
+		os.Exit(runInstallService(os.Args[2:]))
+	}
 
-	urlPath := filepath.Clean(r.URL.Path)
+	flags := flag.NewFlagSet("file-viewer", flag.ExitOnError)
+	listen := flags.String("listen", appConfig.listenAddr(), "address to serve on, e.g. 0.0.0.0:4120 to open the server to the network")
+	authMode := flags.String("auth", "", "authentication: none, token, basic or proxy (default from the config file)")
+	tlsCfg := appConfig.TLS
+	if tlsCfg == nil {
+		tlsCfg = &TLSConfig{}
+	}
+	useTLS := flags.Bool("tls", appConfig.TLS != nil, "serve HTTPS")
+	tlsCert := flags.String("tls-cert", tlsCfg.Cert, "certificate file (PEM); a local CA signs one when empty")
+	tlsKey := flags.String("tls-key", tlsCfg.Key, "key file of --tls-cert (PEM)")
+	redirectHTTP := flags.String("redirect-http", tlsCfg.RedirectHTTP, "address redirecting plain HTTP to HTTPS, e.g. :80")
+	logCfg := appConfig.Log
+	if logCfg == nil {
+		logCfg = &LogConfig{}
+	}
+	logLevel := flags.String("log-level", logCfg.Level, "log level: debug, info, warn or error (default info)")
+	logFormat := flags.String("log-format", logCfg.Format, "log format: text or json (default text)")
+	flags.Parse(os.Args[1:])
 
-	// Asset endpoint - serve static files (images, etc.)
-	if urlPath == "/asset" {
-		assetPath := r.URL.Query().Get("path")
-		if assetPath == "" {
-			http.Error(w, "Missing path parameter", http.StatusBadRequest)
-			return
+	logger, err := newLogger(os.Stderr, *logLevel, *logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+	appConfig.Listen = *listen
+	if *authMode != "" {
+		if appConfig.Auth == nil {
+			appConfig.Auth = &AuthConfig{}
 		}
-		// Clean and validate path
-		assetPath = filepath.Clean(assetPath)
+		appConfig.Auth.Mode = *authMode
+	}
+	auth, err := newAuthenticator(appConfig.Auth)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		// Check file exists
-		info, err := os.Stat(assetPath)
-		if err != nil || info.IsDir() {
-			http.Error(w, "File not found", http.StatusNotFound)
-			return
-		}
+	// A socket passed by systemd replaces --listen
+	ln, err := activationListener()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if ln != nil {
+		*listen = ln.Addr().String()
+		appConfig.Listen = *listen
+	} else if ln, err = net.Listen("tcp", *listen); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		// Determine content type
-		ext := strings.ToLower(filepath.Ext(assetPath))
-		contentTypes := map[string]string{
-			".svg":  "image/svg+xml",
-			".png":  "image/png",
-			".jpg":  "image/jpeg",
-			".jpeg": "image/jpeg",
-			".gif":  "image/gif",
-			".webp": "image/webp",
-			".ico":  "image/x-icon",
-			".pdf":  "application/pdf",
+	var h http.Handler = newRouter()
+	if auth != nil {
+		h = auth.middleware(h)
+	}
+	srv := newServer(*listen, logRequests(compressResponses(securityHeaders(guardRequests(h)))))
+	var others []*http.Server
+
+	if *useTLS {
+		certFile, keyFile := *tlsCert, *tlsKey
+		if (certFile == "") != (keyFile == "") {
+			fmt.Fprintln(os.Stderr, "Error: --tls-cert and --tls-key go together")
+			os.Exit(2)
+		}
+		if certFile == "" {
+			var caFile string
+			certFile, keyFile, caFile, err = ensureLocalCert(filepath.Join(getConfigDir(), "tls"), certHosts(*listen))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Certificate signed by the local CA %s; add it to the trusted roots of your browsers\n", caFile)
+		}
+		if err := configureTLS(srv, certFile, keyFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
 		}
-		if ct, ok := contentTypes[ext]; ok {
-			w.Header().Set("Content-Type", ct)
+		if *redirectHTTP != "" {
+			others = append(others, newServer(*redirectHTTP, redirectToHTTPS(*listen)))
 		}
+	}
 
-		http.ServeFile(w, r, assetPath)
-		return
+	base := serverURL(*listen, *useTLS)
+	fmt.Printf("File Viewer running on %s\n", base)
+	if auth != nil && auth.mode == "token" {
+		fmt.Printf("Open %s/?token=%s to sign in\n", base, auth.token)
+	} else if auth != nil {
+		fmt.Printf("Authentication: %s\n", auth.mode)
+	}
+	fmt.Printf("Usage: %s/path/to/file\n", base)
+	if !isLoopbackAddr(*listen) && auth == nil {
+		fmt.Fprintf(os.Stderr, "Warning: listening on %s without auth, other machines can read the files of this user\n", *listen)
 	}
 
-	// CDN Cache endpoint - proxy and cache CDN resources locally
-	if strings.HasPrefix(urlPath, "/cdn/") {
-		cdnPath := urlPath[5:] // Remove "/cdn/" prefix
-		// Reconstruct CDN URL from path
-		// Format: /cdn/cdnjs.cloudflare.com/... or /cdn/cdn.jsdelivr.net/...
-		parts := strings.SplitN(cdnPath, "/", 2)
-		if len(parts) < 2 {
-			http.Error(w, "Invalid CDN path", http.StatusBadRequest)
-			return
-		}
-		cdnHost := parts[0]
-		cdnResource := parts[1]
-		cdnURL := "https://" + cdnHost + "/" + cdnResource
-
-		// Get cache directory
-		cacheDir := getCacheDir()
-		cachePath := filepath.Join(cacheDir, cdnPath)
-
-		// Check if cached
-		if data, err := os.ReadFile(cachePath); err == nil {
-			// Serve from cache
-			ext := strings.ToLower(filepath.Ext(cachePath))
-			contentTypes := map[string]string{
-				".css": "text/css; charset=utf-8",
-				".js":  "application/javascript; charset=utf-8",
-			}
-			if ct, ok := contentTypes[ext]; ok {
-				w.Header().Set("Content-Type", ct)
-			}
-			w.Header().Set("X-Cache", "HIT")
-			w.Write(data)
-			return
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := serve(ctx, srv, ln, *useTLS, others...); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+}
 
-		// Fetch from CDN
-		resp, err := http.Get(cdnURL)
-		if err != nil {
-			http.Error(w, "Failed to fetch from CDN", http.StatusBadGateway)
-			return
-		}
-		defer resp.Body.Close()
+// newRouter returns the routes of the server. Every route answers GET and
+// HEAD; the files themselves are served at their own path.
+func newRouter() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /asset", handleAsset)
+	mux.HandleFunc("GET /cdn/{host}/{path...}", handleCDN)
+	mux.HandleFunc("GET /files", handleFiles)
+	mux.HandleFunc("GET /chunk", handleChunk)
+	mux.HandleFunc("GET /search", handleSearch)
+	mux.HandleFunc("GET /query", handleQuery)
+	mux.HandleFunc("GET /convert", handleConvert)
+	mux.HandleFunc("GET /export", handleExport)
+	mux.HandleFunc("GET /metrics", handleMetrics)
+	mux.HandleFunc("GET /healthz", handleHealth)
+	mux.HandleFunc("GET /graph", handleGraph)
+	mux.HandleFunc("GET /links/check", handleLinkCheck)
+	mux.HandleFunc("GET /jsonl", handleJSONLines)
+	mux.HandleFunc("GET /tail", handleTail)
+	mux.HandleFunc("GET /mtime/{path...}", handleMtime)
+	mux.HandleFunc("GET /preview/{path...}", handlePreview)
+	mux.HandleFunc("GET /{path...}", handlePage)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeError(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+	})
+	return mux
+}
 
-		if resp.StatusCode != http.StatusOK {
-			http.Error(w, fmt.Sprintf("CDN returned %d", resp.StatusCode), resp.StatusCode)
-			return
-		}
+// handleAsset serves /asset?path= : the raw file, for images and downloads
+func handleAsset(w http.ResponseWriter, r *http.Request) {
+	assetPath := r.URL.Query().Get("path")
+	if assetPath == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	assetPath = filepath.Clean(assetPath)
+	info := checkFile(w, r, assetPath, 0)
+	if info == nil {
+		return
+	}
 
-		data, err := io.ReadAll(resp.Body)
-		if err != nil {
-			http.Error(w, "Failed to read CDN response", http.StatusBadGateway)
-			return
-		}
+	// Determine content type
+	ext := strings.ToLower(filepath.Ext(assetPath))
+	if ct, ok := assetContentTypes[ext]; ok {
+		w.Header().Set("Content-Type", ct)
+	} else if kind, err := sniffFile(assetPath); err == nil && kind.MimeType != "" {
+		// Same detection as the sidebar and renderFile
+		w.Header().Set("Content-Type", kind.MimeType)
+	}
+	// HTML and SVG opened directly must not run scripts on this origin
+	if ct := w.Header().Get("Content-Type"); (ct == "" || assetNeedsSandbox(ct)) && !isTrustedPath(assetPath) {
+		w.Header().Set("Content-Security-Policy", "sandbox; "+sandboxCSP)
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(assetPath)}))
+	}
 
-		// Cache the response
-		if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
-			os.WriteFile(cachePath, data, 0644)
-		}
+	// ServeFile answers 304 to a matching If-None-Match or If-Modified-Since
+	w.Header().Set("ETag", fileETag(assetPath, info))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, assetPath)
+}
 
-		// Serve response
-		ext := strings.ToLower(filepath.Ext(cachePath))
-		contentTypes := map[string]string{
-			".css": "text/css; charset=utf-8",
-			".js":  "application/javascript; charset=utf-8",
-		}
-		if ct, ok := contentTypes[ext]; ok {
-			w.Header().Set("Content-Type", ct)
-		}
-		w.Header().Set("X-Cache", "MISS")
-		w.Write(data)
+// Content types of the CDN resources served by /cdn/
+var cdnContentTypes = map[string]string{
+	".css": "text/css; charset=utf-8",
+	".js":  "application/javascript; charset=utf-8",
+}
+
+// Hosts that /cdn/ proxies: those of the page templates. Any other host would
+// let a Markdown file load scripts from anywhere under the 'self' of the CSP.
+var cdnHosts = map[string]bool{
+	"cdnjs.cloudflare.com": true,
+	"cdn.jsdelivr.net":     true,
+}
+
+// handleCDN serves /cdn/{host}/{path}: https://{host}/{path}, cached locally.
+// The resources are versioned by their path: browsers keep them for a day.
+func handleCDN(w http.ResponseWriter, r *http.Request) {
+	if !cdnHosts[r.PathValue("host")] {
+		writeError(w, r, http.StatusNotFound, "Unknown CDN host")
+		return
+	}
+	cdnPath := r.PathValue("host") + "/" + r.PathValue("path")
+	// The wildcard is unescaped and not cleaned: a%2F..%2F climbs
+	cachePath, err := cdnCachePath(cdnPath)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Invalid CDN path")
 		return
 	}
+	data, hit, err := cachedCDN(cdnPath)
+	if err != nil {
+		slog.Warn("CDN fetch failed", "url", "https://"+cdnPath, "err", err)
+		writeError(w, r, http.StatusBadGateway, "Failed to fetch from CDN: "+err.Error())
+		return
+	}
+	if ct, ok := cdnContentTypes[strings.ToLower(filepath.Ext(cdnPath))]; ok {
+		w.Header().Set("Content-Type", ct)
+	}
+	if hit {
+		w.Header().Set("X-Cache", "HIT")
+	} else {
+		w.Header().Set("X-Cache", "MISS")
+	}
+	var modTime time.Time
+	if info, err := os.Stat(cachePath); err == nil {
+		modTime = info.ModTime()
+		w.Header().Set("ETag", fileETag(cdnPath, info))
+	}
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	http.ServeContent(w, r, cdnPath, modTime, bytes.NewReader(data))
+}
 
-	// Files API endpoint - list directory contents for sidebar
-	if urlPath == "/files" {
-		dirPath := r.URL.Query().Get("dir")
-		if dirPath == "" {
-			dirPath = "/"
-		}
-		dirPath = filepath.Clean(dirPath)
+// handleFiles serves /files?dir= : the directory listing of the sidebar
+func handleFiles(w http.ResponseWriter, r *http.Request) {
+	dirPath := r.URL.Query().Get("dir")
+	if dirPath == "" {
+		dirPath = "/"
+	}
+	dirPath = filepath.Clean(dirPath)
 
-		// Validate it's a directory
-		info, err := os.Stat(dirPath)
-		if err != nil || !info.IsDir() {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusBadRequest)
-			json.NewEncoder(w).Encode(map[string]string{"error": "Invalid directory"})
-			return
-		}
+	info, err := os.Stat(dirPath)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+	if !info.IsDir() {
+		writeError(w, r, http.StatusBadRequest, "Not a directory")
+		return
+	}
 
-		files, err := listDirectory(dirPath)
-		if err != nil {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
-			return
-		}
+	opts, err := parseListOptions(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"dir":    dirPath,
-			"parent": filepath.Dir(dirPath),
-			"files":  files,
-		})
+	files, total, err := listDirectory(dirPath, opts)
+	if err != nil {
+		writeFileError(w, r, err)
 		return
 	}
 
-	// Live reload endpoint
-	if strings.HasPrefix(urlPath, "/mtime/") {
-		filePath := urlPath[7:]
-		info, err := os.Stat(filePath)
-		if err != nil {
-			w.Write([]byte("0"))
-			return
-		}
-		w.Write([]byte(fmt.Sprintf("%d", info.ModTime().UnixNano())))
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"dir":    dirPath,
+		"parent": filepath.Dir(dirPath),
+		"files":  files,
+		"total":  total,
+		"offset": opts.Offset,
+		"limit":  opts.Limit,
+	})
+}
+
+// handleMtime serves /mtime/{path}: the modification time of the file in
+// nanoseconds, polled by live reload
+func handleMtime(w http.ResponseWriter, r *http.Request) {
+	info, err := os.Stat("/" + r.PathValue("path"))
+	if err != nil {
+		writeFileError(w, r, err)
 		return
 	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(strconv.FormatInt(info.ModTime().UnixNano(), 10)))
+}
 
-	// Preview endpoint - return rendered content only (for link preview)
-	if strings.HasPrefix(urlPath, "/preview/") {
-		filePath := urlPath[9:]
-		content, _ := renderFile(filePath)
-		// Truncate to first ~500 chars of text content for preview
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Write([]byte(content))
+// handlePreview serves /preview/{path}: the rendered content only, for link
+// previews
+func handlePreview(w http.ResponseWriter, r *http.Request) {
+	filePath := "/" + r.PathValue("path")
+	info := checkFile(w, r, filePath, MaxViewableSize)
+	if info == nil {
+		return
+	}
+	etag := renderETag(filePath, info)
+	if notModified(w, r, etag) {
 		return
 	}
+	content, contentClass, _ := renderCached(r, filePath, etag)
+	if contentClass == "" {
+		writeError(w, r, http.StatusInternalServerError, "Cannot render "+filePath)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(content))
+}
 
-	// Check for path and filename query parameters
+// handlePage serves the page of a file: at its own path, or at
+// /?path=&filename= for editors opening files. / shows the Claude Code
+// CHANGELOG.
+func handlePage(w http.ResponseWriter, r *http.Request) {
 	queryPath := r.URL.Query().Get("path")
 	queryFilename := r.URL.Query().Get("filename")
 
@@ -554,17 +910,16 @@ func handler(w http.ResponseWriter, r *http.Request) {
 	} else if queryPath != "" {
 		// Just path parameter
 		filePath = queryPath
-	} else if urlPath != "/" {
+	} else if p := r.PathValue("path"); p != "" {
 		// Use URL path directly
-		filePath = urlPath
+		filePath = filepath.Clean("/" + p)
 	}
 
 	// Root path without query params - show Claude Code CHANGELOG
 	if filePath == "" {
 		content, err := fetchURL("https://raw.githubusercontent.com/anthropics/claude-code/refs/heads/main/CHANGELOG.md")
 		if err != nil {
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.Write([]byte(fmt.Sprintf(`<html><body><h1>Error</h1><p>%s</p></body></html>`, err.Error())))
+			writeError(w, r, http.StatusBadGateway, err.Error())
 			return
 		}
 		htmlPage := buildHTML("Claude Code changelog", "Claude Code", renderMarkdown(content, ""), "markdown")
@@ -573,11 +928,42 @@ func handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Render file
-	content, contentClass := renderFile(filePath)
-	htmlPage := buildHTML(filepath.Base(filePath), filePath, content, contentClass)
+	// Missing and unreadable files still get a page, with the sidebar, for
+	// browsers
+	var content, contentClass string
+	status := http.StatusOK
+	if info, err := probeFile(filePath); err != nil {
+		var msg string
+		status, msg = fileErrorStatus(err)
+		if wantsJSON(r) {
+			writeError(w, r, status, msg)
+			return
+		}
+		start := time.Now()
+		content, contentClass = renderFile(filePath)
+		requestInfoFrom(r).setRender(contentClass, time.Since(start))
+	} else {
+		etag := renderETag(filePath, info)
+		if notModified(w, r, etag) {
+			return
+		}
+		var hit bool
+		if content, contentClass, hit = renderCached(r, filePath, etag); hit {
+			w.Header().Set("X-Cache", "HIT")
+		} else {
+			w.Header().Set("X-Cache", "MISS")
+		}
+		if contentClass == "" {
+			status = http.StatusInternalServerError
+		}
+	}
+	htmlPage := buildHTML(pageTitle(filePath, filepath.Base(filePath)), filePath, content, contentClass)
 
+	if isTrustedPath(filePath) {
+		w.Header().Set("Content-Security-Policy", trustedPageCSP)
+	}
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
 	w.Write([]byte(htmlPage))
 }
 
@@ -600,31 +986,100 @@ func renderFile(filePath string) (string, string) {
 		return fmt.Sprintf(`<p style="color: red;">Not a file: %s</p>`, html.EscapeString(filePath)), ""
 	}
 
-	content, err := os.ReadFile(filePath)
+	kind, err := sniffFile(filePath)
 	if err != nil {
 		return fmt.Sprintf(`<p style="color: red;">Error reading file: %s</p>`, html.EscapeString(err.Error())), ""
 	}
+	if !kind.Text {
+		return renderBinary(filePath, info.Size(), kind), "binary"
+	}
 
 	ext := strings.ToLower(filepath.Ext(filePath))
 
+	// Log files show their tail, whatever their size
+	if ext == ".log" {
+		return renderLogFile(filePath, info.Size(), kind), "log"
+	}
+	// JSON Lines files are paged, whatever their size
+	if ext == ".jsonl" || ext == ".ndjson" {
+		return renderJSONLines(filePath), "jsonl"
+	}
+	if info.Size() > MaxViewableSize {
+		return renderLargeFile(filePath, info.Size()), "large"
+	}
+
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Sprintf(`<p style="color: red;">Error reading file: %s</p>`, html.EscapeString(err.Error())), ""
+	}
+	content := decodeText(raw, kind.Encoding)
+
+	// Makefile, Dockerfile, go.mod... are highlighted as code
+	if kind.Language != "" {
+		return renderCode(content, kind.Language), "code"
+	}
+
 	switch ext {
 	case ".md", ".markdown":
-		return renderMarkdown(string(content), filepath.Dir(filePath)), "markdown"
+		return renderMarkdown(content, filepath.Dir(filePath)) + renderBacklinks(filePath), "markdown"
 	case ".json":
-		return renderJSON(string(content)), "json"
+		return renderJSONWithSchema(content, filePath), "json"
 	case ".yaml", ".yml":
-		return renderYAML(string(content)), "yaml"
+		return renderYAMLWithSchema(content, filePath), "yaml"
 	case ".toml":
-		return renderTOML(string(content)), "toml"
+		return renderTOML(content), "toml"
 	case ".csv":
-		return renderCSV(string(content)), "csv"
+		return renderCSV(content), "csv"
 	case ".html", ".htm":
-		return string(content), "html"
+		return renderHTMLFile(filePath, content), "html"
 	case ".txt", ".text", "":
-		return renderText(string(content)), "text"
+		return renderText(content), "text"
 	default:
-		return fmt.Sprintf(`<div class="text">%s</div>`, html.EscapeString(string(content))), "text"
+		return fmt.Sprintf(`<div class="text">%s</div>`, html.EscapeString(content)), "text"
+	}
+}
+
+// renderBinary describes a file that cannot be displayed as text
+func renderBinary(filePath string, size int64, kind FileKind) string {
+	assetURL := "/asset?path=" + url.QueryEscape(filePath)
+	var result strings.Builder
+	result.WriteString(`<div class="binary-file">`)
+	result.WriteString(fmt.Sprintf(`<p>Binary file <code>%s</code> (%s)</p>`, html.EscapeString(kind.MimeType), formatSize(size)))
+	if strings.HasPrefix(kind.MimeType, "image/") {
+		result.WriteString(fmt.Sprintf(`<img src="%s" alt="%s" class="lightbox-img" onclick="openLightbox(this.src, this.alt)" style="max-width:100%%; cursor: zoom-in;">`, assetURL, html.EscapeString(filepath.Base(filePath))))
+	}
+	result.WriteString(fmt.Sprintf(`<p><a href="%s">Open raw file</a></p>`, assetURL))
+	result.WriteString(`</div>`)
+	return result.String()
+}
+
+// formatSize returns a human readable file size
+func formatSize(size int64) string {
+	switch {
+	case size < 1024:
+		return fmt.Sprintf("%d B", size)
+	case size < 1024*1024:
+		return fmt.Sprintf("%.1f KB", float64(size)/1024)
+	}
+	return fmt.Sprintf("%.1f MB", float64(size)/1024/1024)
+}
+
+// renderCode displays source code with Prism highlighting
+func renderCode(content, language string) string {
+	return fmt.Sprintf(`<pre class="line-numbers"><code class="language-%s">%s</code></pre>`, html.EscapeString(language), html.EscapeString(content))
+}
+
+// fenceLanguageRe matches the language names a class attribute can hold
+var fenceLanguageRe = regexp.MustCompile(`^[A-Za-z0-9_+-]+$`)
+
+// fenceLanguage returns the language of a code fence info string: its first
+// word, empty when it holds anything but letters, digits, _, + and -
+func fenceLanguage(info string) string {
+	fields := strings.Fields(info)
+	if len(fields) == 0 || !fenceLanguageRe.MatchString(fields[0]) {
+		return ""
 	}
+	return fields[0]
 }
 
 func renderText(content string) string {
@@ -634,11 +1089,94 @@ func renderText(content string) string {
     <button onclick="nextMatch()">▶</button>
     <span id="search-count" class="search-count"></span>
 </div>`
-	initScript := `<script>document.addEventListener("DOMContentLoaded", function() { initSearch("searchable-content"); });</script>`
+	initScript := withNonce(`<script>document.addEventListener("DOMContentLoaded", function() { initSearch("searchable-content"); });</script>`)
 	return fmt.Sprintf(`%s<div id="searchable-content" class="text">%s</div>%s`, toolbar, html.EscapeString(content), initScript)
 }
 
+// isExternalURL reports whether a link target leaves the viewer
+func isExternalURL(target string) bool {
+	target = strings.ToLower(strings.TrimSpace(target))
+	return strings.HasPrefix(target, "http://") || strings.HasPrefix(target, "https://") || strings.HasPrefix(target, "//")
+}
+
+// opensAsAsset reports whether a linked file is served raw rather than viewed.
+// Only the extension is looked at, so rendering does not touch the disk and
+// the choice stays valid while the page is cached.
+func opensAsAsset(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	if _, ok := assetContentTypes[ext]; ok {
+		return true
+	}
+	byExt := mime.TypeByExtension(ext)
+	return byExt != "" && !isTextMimeType(byExt)
+}
+
+// markdownLinkTag returns the opening <a> tag of a Markdown link target, with
+// its optional "title". Paths are resolved against baseDir: images, PDFs and
+// other files with a binary extension open through /asset, the rest in the
+// viewer; fragments are slugified like headings. External links open in a new tab.
+func markdownLinkTag(target, baseDir string) string {
+	target = strings.TrimSpace(target)
+	title := ""
+	if i := strings.IndexAny(target, " \t"); i >= 0 {
+		title = strings.Trim(strings.TrimSpace(target[i:]), `"'`)
+		target = target[:i]
+	}
+	target = strings.TrimSuffix(strings.TrimPrefix(target, "<"), ">")
+	titleAttr := ""
+	if title != "" {
+		titleAttr = fmt.Sprintf(` title="%s"`, html.EscapeString(title))
+	}
+
+	if isExternalURL(target) {
+		return fmt.Sprintf(`<a href="%s"%s class="external-link" target="_blank" rel="noopener">`, html.EscapeString(target), titleAttr)
+	}
+	href := target
+	p, fragment, hasFragment := strings.Cut(target, "#")
+	if hasFragment && fragment != "" && !strings.HasPrefix(fragment, "^") {
+		if unescaped, err := url.PathUnescape(fragment); err == nil {
+			fragment = unescaped
+		}
+		fragment = slugify(fragment)
+	}
+	switch {
+	case !safeURL("href", target):
+		// javascript: and other schemes that run code
+		return fmt.Sprintf(`<a%s>`, titleAttr)
+	case checkSchemeRe.MatchString(target), strings.Contains(p, "?"):
+		// mailto:, tel:... and server URLs are left as they are
+	case p == "":
+		href = "#" + fragment
+	case baseDir != "":
+		if unescaped, err := url.PathUnescape(p); err == nil {
+			p = unescaped
+		}
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(baseDir, p)
+		}
+		href = (&url.URL{Path: filepath.ToSlash(p)}).EscapedPath()
+		if opensAsAsset(p) {
+			href = "/asset?path=" + url.QueryEscape(p)
+		}
+		if hasFragment {
+			href += "#" + fragment
+		}
+	}
+	return fmt.Sprintf(`<a href="%s"%s>`, html.EscapeString(href), titleAttr)
+}
+
 func renderMarkdown(content string, baseDir string) string {
+	// Front matter becomes a metadata card instead of a rule and paragraphs
+	metadata := ""
+	if fm, body := splitFrontMatter(content); fm != nil {
+		metadata = renderFrontMatter(fm)
+		content = body
+	}
+
+	// Raw HTML is sanitised unless the file is under a trusted root
+	trusted := isTrustedPath(baseDir)
+	skipHTMLUntil := ""
+
 	lines := strings.Split(content, "\n")
 	var result strings.Builder
 	var headers []Header
@@ -657,9 +1195,26 @@ func renderMarkdown(content string, baseDir string) string {
 	footnoteOrder := []string{}
 
 	processInline := func(text string) string {
-		// Inline math $...$ (protect first, before other processing)
+		// Inline math $...$ (protect first, before other processing): the
+		// MathML is put back once the other rules have run
+		var maths []string
 		mathRe := regexp.MustCompile(`\$([^$\n]+)\$`)
-		text = mathRe.ReplaceAllString(text, `<span class="math-inline">$$$1$$</span>`)
+		text = mathRe.ReplaceAllStringFunc(text, func(m string) string {
+			maths = append(maths, renderMathInline(m[1:len(m)-1]))
+			return fmt.Sprintf("\x00math%d\x00", len(maths)-1)
+		})
+
+		// Wiki-links [[page#heading|alias]], kept aside like math so file
+		// names are not taken for emphasis; Markdown links use the same slots
+		var wikis []string
+		text = wikiLinkRe.ReplaceAllStringFunc(text, func(m string) string {
+			if strings.HasPrefix(m, "`") {
+				return m
+			}
+			parts := wikiLinkRe.FindStringSubmatch(m)
+			wikis = append(wikis, renderWikiLink(parts[1] == "!", parts[2], parts[3], parts[4], baseDir))
+			return fmt.Sprintf("\x00wiki%d\x00", len(wikis)-1)
+		})
 
 		// Code (protect early)
 		codeRe := regexp.MustCompile("`([^`]+)`")
@@ -668,6 +1223,11 @@ func renderMarkdown(content string, baseDir string) string {
 			return "<code>" + html.EscapeString(inner) + "</code>"
 		})
 
+		// Inline HTML written in the file, before any markup is generated
+		if !trusted {
+			text = sanitizeHTML(text)
+		}
+
 		// Images (with lightbox support) - resolve relative paths
 		imgRe := regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`)
 		text = imgRe.ReplaceAllStringFunc(text, func(m string) string {
@@ -684,12 +1244,24 @@ func renderMarkdown(content string, baseDir string) string {
 				// Absolute path on filesystem
 				src = "/asset?path=" + src
 			}
-			return fmt.Sprintf(`<img src="%s" alt="%s" class="lightbox-img" onclick="openLightbox(this.src, this.alt)" style="max-width:100%%; cursor: zoom-in;">`, src, html.EscapeString(alt))
+			if !safeURL("src", src) {
+				src = ""
+			}
+			return fmt.Sprintf(`<img src="%s" alt="%s" class="lightbox-img" onclick="openLightbox(this.src, this.alt)" style="max-width:100%%; cursor: zoom-in;">`, html.EscapeString(src), html.EscapeString(alt))
 		})
 
-		// Links
+		// Links, resolved against the file; the opening tag is kept aside so
+		// paths are not taken for emphasis, the text is formatted as usual
 		linkRe := regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`)
-		text = linkRe.ReplaceAllString(text, `<a href="$2">$1</a>`)
+		text = linkRe.ReplaceAllStringFunc(text, func(m string) string {
+			parts := linkRe.FindStringSubmatch(m)
+			wikis = append(wikis, markdownLinkTag(parts[2], baseDir))
+			suffix := "</a>"
+			if isExternalURL(parts[2]) {
+				suffix = `<span class="external-link-icon" aria-hidden="true">↗</span></a>`
+			}
+			return fmt.Sprintf("\x00wiki%d\x00", len(wikis)-1) + parts[1] + suffix
+		})
 
 		// Highlight ==text==
 		highlightRe := regexp.MustCompile(`==(.+?)==`)
@@ -715,10 +1287,16 @@ func renderMarkdown(content string, baseDir string) string {
 		// Footnote references [^id]
 		footnoteRefRe := regexp.MustCompile(`\[\^([^\]]+)\]`)
 		text = footnoteRefRe.ReplaceAllStringFunc(text, func(m string) string {
-			id := m[2 : len(m)-1] // Extract id from [^id]
+			id := html.EscapeString(m[2 : len(m)-1]) // Extract id from [^id]
 			return fmt.Sprintf(`<sup class="footnote-ref"><a href="#fn-%s" id="fnref-%s">[%s]</a></sup>`, id, id, id)
 		})
 
+		for i, m := range maths {
+			text = strings.Replace(text, fmt.Sprintf("\x00math%d\x00", i), m, 1)
+		}
+		for i, w := range wikis {
+			text = strings.Replace(text, fmt.Sprintf("\x00wiki%d\x00", i), w, 1)
+		}
 		return text
 	}
 
@@ -746,7 +1324,7 @@ func renderMarkdown(content string, baseDir string) string {
 		if strings.TrimSpace(line) == "$$" {
 			if inMathBlock {
 				mathContent := strings.Join(mathLines, "\n")
-				result.WriteString(fmt.Sprintf("<div class=\"math-block\">$$%s$$</div>\n", html.EscapeString(mathContent)))
+				result.WriteString(renderMathBlock(mathContent) + "\n")
 				inMathBlock = false
 				mathLines = nil
 			} else {
@@ -765,19 +1343,15 @@ func renderMarkdown(content string, baseDir string) string {
 		if strings.HasPrefix(line, "```") {
 			if inCodeBlock {
 				codeContent := strings.Join(codeLines, "\n")
-				if codeLang == "mermaid" {
-					// Mermaid diagram
-					result.WriteString(fmt.Sprintf("<div class=\"mermaid\">%s</div>\n", html.EscapeString(codeContent)))
-				} else if codeLang == "plantuml" || codeLang == "puml" {
-					// PlantUML diagram - render via PlantUML server
-					encoded := encodePlantUML(codeContent)
-					result.WriteString(fmt.Sprintf("<div class=\"plantuml\"><img src=\"https://www.plantuml.com/plantuml/svg/%s\" alt=\"PlantUML diagram\" loading=\"lazy\"></div>\n", encoded))
+				if isDiagramLang(codeLang) {
+					// Mermaid, Graphviz and PlantUML diagrams
+					result.WriteString(renderDiagram(codeLang, codeContent))
 				} else {
 					// Regular code block with copy button and line numbers
 					escapedCode := html.EscapeString(codeContent)
 					result.WriteString(escapedCode)
 					result.WriteString("</code></pre>")
-					result.WriteString(fmt.Sprintf(`<button class="copy-btn" onclick="copyCode('code-%d')">📋 Copy</button>`, codeBlockID))
+					result.WriteString(`<button class="copy-btn" onclick="copyCode(this)">📋 Copy</button>`)
 					result.WriteString("</div>\n")
 					codeBlockID++
 				}
@@ -786,8 +1360,8 @@ func renderMarkdown(content string, baseDir string) string {
 				codeLines = nil
 			} else {
 				closeLists()
-				codeLang = strings.TrimSpace(line[3:])
-				if codeLang != "mermaid" && codeLang != "plantuml" && codeLang != "puml" {
+				codeLang = fenceLanguage(line[3:])
+				if !isDiagramLang(codeLang) {
 					langClass := ""
 					if codeLang != "" {
 						langClass = fmt.Sprintf(` class="language-%s"`, codeLang)
@@ -955,10 +1529,27 @@ func renderMarkdown(content string, baseDir string) string {
 			continue
 		}
 
-		// HTML block
+		// HTML block; untrusted script and style blocks are dropped up to
+		// their closing tag
+		if skipHTMLUntil != "" {
+			if strings.Contains(strings.ToLower(line), skipHTMLUntil) {
+				skipHTMLUntil = ""
+			}
+			continue
+		}
 		if isHTMLBlock(line) {
 			closeLists()
-			result.WriteString(line + "\n")
+			if trusted {
+				result.WriteString(line + "\n")
+				continue
+			}
+			lower := strings.ToLower(strings.TrimSpace(line))
+			for _, tag := range []string{"script", "style"} {
+				if strings.HasPrefix(lower, "<"+tag) && !strings.Contains(lower, "</"+tag) {
+					skipHTMLUntil = "</" + tag
+				}
+			}
+			result.WriteString(sanitizeHTML(line) + "\n")
 			continue
 		}
 
@@ -971,11 +1562,8 @@ func renderMarkdown(content string, baseDir string) string {
 	closeLists()
 	if inCodeBlock {
 		codeContent := strings.Join(codeLines, "\n")
-		if codeLang == "mermaid" {
-			result.WriteString(fmt.Sprintf("<div class=\"mermaid\">%s</div>\n", html.EscapeString(codeContent)))
-		} else if codeLang == "plantuml" || codeLang == "puml" {
-			encoded := encodePlantUML(codeContent)
-			result.WriteString(fmt.Sprintf("<div class=\"plantuml\"><img src=\"https://www.plantuml.com/plantuml/svg/%s\" alt=\"PlantUML diagram\" loading=\"lazy\"></div>\n", encoded))
+		if isDiagramLang(codeLang) {
+			result.WriteString(renderDiagram(codeLang, codeContent))
 		} else {
 			result.WriteString(html.EscapeString(codeContent))
 			result.WriteString("</code></pre></div>\n")
@@ -983,7 +1571,7 @@ func renderMarkdown(content string, baseDir string) string {
 	}
 	if inMathBlock {
 		mathContent := strings.Join(mathLines, "\n")
-		result.WriteString(fmt.Sprintf("<div class=\"math-block\">$$%s$$</div>\n", html.EscapeString(mathContent)))
+		result.WriteString(renderMathBlock(mathContent) + "\n")
 	}
 	if inBlockquote {
 		result.WriteString("</blockquote>\n")
@@ -1000,7 +1588,7 @@ func renderMarkdown(content string, baseDir string) string {
 		result.WriteString("<ol class=\"footnotes-list\">\n")
 		for _, id := range footnoteOrder {
 			content := footnotes[id]
-			result.WriteString(fmt.Sprintf("<li id=\"fn-%s\" class=\"footnote-item\">%s <a href=\"#fnref-%s\" class=\"footnote-backref\">↩</a></li>\n", id, processInline(content), id))
+			result.WriteString(fmt.Sprintf("<li id=\"fn-%s\" class=\"footnote-item\">%s <a href=\"#fnref-%s\" class=\"footnote-backref\">↩</a></li>\n", html.EscapeString(id), processInline(content), html.EscapeString(id)))
 		}
 		result.WriteString("</ol>\n")
 		result.WriteString("</section>\n")
@@ -1019,29 +1607,49 @@ func renderMarkdown(content string, baseDir string) string {
 		toc.WriteString("<nav class=\"toc-nav\">\n")
 		for _, h := range headers {
 			indent := (h.Level - 1) * 16
-			toc.WriteString(fmt.Sprintf("<a href=\"#%s\" style=\"padding-left: %dpx;\">%s</a>\n", h.Anchor, indent, replaceEmojis(h.Text)))
+			text := replaceEmojis(h.Text)
+			if !trusted {
+				text = sanitizeHTML(text)
+			}
+			toc.WriteString(fmt.Sprintf("<a href=\"#%s\" style=\"padding-left: %dpx;\">%s</a>\n", h.Anchor, indent, text))
 		}
 		toc.WriteString("</nav>\n")
 		toc.WriteString("</details>\n")
 	}
 
-	return toc.String() + result.String()
+	return metadata + toc.String() + result.String()
 }
 
 func renderJSON(content string) string {
+	return renderJSONWithSchema(content, "")
+}
+
+// renderJSONWithSchema renders a JSON document, validated against its schema
+// when filePath is set and a schema is found
+func renderJSONWithSchema(content, filePath string) string {
 	var parsed interface{}
 	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
 		return fmt.Sprintf(`<span class="error">Invalid JSON</span><pre>%s</pre>`, html.EscapeString(content))
 	}
 
-	treeHTML := renderJSONTree(parsed)
+	var report *schemaReport
+	if filePath != "" {
+		report = validateDocument(filePath, parsed)
+	}
+	annotations := schemaErrorsByPointer(report)
+	root := "<li>"
+	if annotations != nil {
+		root = jsonTreeItem("", annotations)
+	}
+	treeHTML := root + renderJSONTreeAt(parsed, "", annotations)
 
-	return fmt.Sprintf(`<div class="json-toolbar">
+	return renderSchemaSummary(report) + renderQueryBar() + fmt.Sprintf(withNonce(`<div class="json-toolbar">
     <input type="text" id="json-search" placeholder="Rechercher..." oninput="searchJson(this.value)" />
     <button onclick="expandAll()">Expand All</button>
     <button onclick="collapseAll()">Collapse All</button>
+    %s
 </div>
-<div class="json-tree"><ul><li>%s</li></ul></div>
+<div class="json-tree"><ul>%s</li></ul></div>
 <script>
 function expandAll() {
     document.querySelectorAll('.json-tree li.json-collapsed').forEach(function(li) {
@@ -1091,10 +1699,29 @@ function searchJson(query) {
         }
     });
 }
-</script>`, treeHTML)
+</script>`), renderConvertButtons("json"), treeHTML)
+}
+
+func renderJSONTree(obj interface{}) string {
+	return renderJSONTreeAt(obj, "", nil)
+}
+
+// jsonTreeItem opens the <li> of the node at pointer, marking it when the
+// schema validation reported errors for it
+func jsonTreeItem(pointer string, annotations map[string][]string) string {
+	if annotations == nil {
+		return "<li>"
+	}
+	messages := annotations[pointer]
+	if len(messages) == 0 {
+		return fmt.Sprintf(`<li data-pointer="%s">`, html.EscapeString(pointer))
+	}
+	return fmt.Sprintf(`<li data-pointer="%s" class="schema-node-invalid"><span class="schema-error" title="%s">⚠ %s</span> `,
+		html.EscapeString(pointer), html.EscapeString(strings.Join(messages, "\n")), html.EscapeString(messages[0]))
 }
 
-func renderJSONTree(obj interface{}) string {
+// renderJSONTreeAt renders the value at a JSON pointer, with optional schema error annotations
+func renderJSONTreeAt(obj interface{}, pointer string, annotations map[string][]string) string {
 	var result strings.Builder
 
 	switch v := obj.(type) {
@@ -1112,7 +1739,8 @@ func renderJSONTree(obj interface{}) string {
 			if i == len(v)-1 {
 				comma = ""
 			}
-			result.WriteString(fmt.Sprintf(`<li><span class="json-key">"%s"</span>: %s%s</li>`, html.EscapeString(key), renderJSONTree(value), comma))
+			childPointer := pointer + "/" + pointerToken(key)
+			result.WriteString(fmt.Sprintf(`%s<span class="json-key">"%s"</span>: %s%s</li>`, jsonTreeItem(childPointer, annotations), html.EscapeString(key), renderJSONTreeAt(value, childPointer, annotations), comma))
 			i++
 		}
 		result.WriteString("</ul>")
@@ -1131,7 +1759,8 @@ func renderJSONTree(obj interface{}) string {
 			if i == len(v)-1 {
 				comma = ""
 			}
-			result.WriteString(fmt.Sprintf(`<li>%s%s</li>`, renderJSONTree(value), comma))
+			childPointer := pointer + "/" + strconv.Itoa(i)
+			result.WriteString(fmt.Sprintf(`%s%s%s</li>`, jsonTreeItem(childPointer, annotations), renderJSONTreeAt(value, childPointer, annotations), comma))
 		}
 		result.WriteString("</ul>")
 		result.WriteString(`<span class="json-bracket">]</span>`)
@@ -1156,63 +1785,89 @@ func renderJSONTree(obj interface{}) string {
 }
 
 func renderYAML(content string) string {
+	return renderYAMLWithSchema(content, "")
+}
+
+// renderYAMLWithSchema renders a YAML document, validated against its schema
+// when filePath is set and a schema is found
+func renderYAMLWithSchema(content, filePath string) string {
+	summary := ""
+	if filePath != "" {
+		if doc, err := parseStructured(content, "yaml"); err == nil {
+			if report := validateDocument(filePath, doc); report != nil {
+				lines := yamlPointerLines(content)
+				for i := range report.Errors {
+					report.Errors[i].Line = lines[report.Errors[i].Pointer]
+				}
+				summary = renderSchemaSummary(report)
+			}
+		}
+	}
+
 	// Display YAML with syntax highlighting using Prism
 	toolbar := `<div class="yaml-toolbar">
     <button onclick="copyYAML()" title="Copy YAML">📋 Copy</button>
+    ` + renderConvertButtons("yaml") + `
 </div>`
 	escaped := html.EscapeString(content)
-	return fmt.Sprintf(`%s<pre class="line-numbers"><code class="language-yaml" id="yaml-content">%s</code></pre>
+	return summary + renderQueryBar() + fmt.Sprintf(withNonce(`%s<pre class="line-numbers"><code class="language-yaml" id="yaml-content">%s</code></pre>
 <script>
 function copyYAML() {
     const content = document.getElementById('yaml-content').textContent;
     navigator.clipboard.writeText(content);
 }
-</script>`, toolbar, escaped)
+</script>`), toolbar, escaped)
 }
 
 func renderTOML(content string) string {
 	// Display TOML with syntax highlighting using Prism
 	toolbar := `<div class="toml-toolbar">
     <button onclick="copyTOML()" title="Copy TOML">📋 Copy</button>
+    ` + renderConvertButtons("toml") + `
 </div>`
 	escaped := html.EscapeString(content)
-	return fmt.Sprintf(`%s<pre class="line-numbers"><code class="language-toml" id="toml-content">%s</code></pre>
+	return renderQueryBar() + fmt.Sprintf(withNonce(`%s<pre class="line-numbers"><code class="language-toml" id="toml-content">%s</code></pre>
 <script>
 function copyTOML() {
     const content = document.getElementById('toml-content').textContent;
     navigator.clipboard.writeText(content);
 }
-</script>`, toolbar, escaped)
+</script>`), toolbar, escaped)
 }
 
-func renderCSV(content string) string {
+// parseCSV splits CSV content into its header and rows, skipping blank lines
+func parseCSV(content string) ([]string, [][]string) {
 	lines := strings.Split(strings.TrimSpace(content), "\n")
-	if len(lines) == 0 {
-		return `<p>Empty CSV file</p>`
+	headers := parseCSVLine(strings.TrimRight(lines[0], "\r"))
+	var rows [][]string
+	for _, line := range lines[1:] {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rows = append(rows, parseCSVLine(strings.TrimRight(line, "\r")))
 	}
+	return headers, rows
+}
+
+func renderCSV(content string) string {
+	headers, rows := parseCSV(content)
 
 	var result strings.Builder
 	result.WriteString(`<div class="csv-toolbar">
     <input type="text" id="csv-search" placeholder="Filter rows..." oninput="filterCSV(this.value)" />
     <span id="csv-count"></span>
+    ` + renderConvertButtons("csv") + `
 </div>
 <div class="csv-container">
 <table class="csv-table" id="csv-table">
 <thead><tr>`)
 
-	// Parse header
-	headers := parseCSVLine(lines[0])
 	for _, h := range headers {
 		result.WriteString(fmt.Sprintf(`<th>%s</th>`, html.EscapeString(h)))
 	}
 	result.WriteString(`</tr></thead><tbody>`)
 
-	// Parse rows
-	for i := 1; i < len(lines); i++ {
-		if strings.TrimSpace(lines[i]) == "" {
-			continue
-		}
-		cells := parseCSVLine(lines[i])
+	for _, cells := range rows {
 		result.WriteString(`<tr>`)
 		for j := 0; j < len(headers); j++ {
 			val := ""
@@ -1224,7 +1879,7 @@ func renderCSV(content string) string {
 		result.WriteString(`</tr>`)
 	}
 
-	result.WriteString(`</tbody></table></div>
+	result.WriteString(withNonce(`</tbody></table></div>
 <script>
 function filterCSV(query) {
     const table = document.getElementById('csv-table');
@@ -1240,7 +1895,7 @@ function filterCSV(query) {
     document.getElementById('csv-count').textContent = q ? count + ' / ' + rows.length + ' rows' : rows.length + ' rows';
 }
 document.addEventListener('DOMContentLoaded', function() { filterCSV(''); });
-</script>`)
+</script>`))
 	return result.String()
 }
 
@@ -1269,19 +1924,8 @@ func parseCSVLine(line string) []string {
 	return result
 }
 
-func buildHTML(title, filePath, content, contentClass string) string {
-	return fmt.Sprintf(`<!DOCTYPE html>
-<html lang="en">
-<head>
-    <meta charset="UTF-8">
-    <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>%s</title>
-    <!-- Prism CSS -->
-    <link rel="stylesheet" href="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/themes/prism-okaidia.min.css">
-    <link rel="stylesheet" href="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/plugins/line-numbers/prism-line-numbers.min.css">
-    <!-- KaTeX CSS -->
-    <link rel="stylesheet" href="/cdn/cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.css">
-    <style>
+// viewerCSS is the stylesheet of the viewer pages, also inlined in exports
+const viewerCSS = `
         :root {
             --bg-primary: #fafafa;
             --bg-secondary: white;
@@ -1460,6 +2104,10 @@ func buildHTML(title, filePath, content, contentClass string) string {
             overflow: hidden;
             text-overflow: ellipsis;
         }
+        .file-tree .tree-item.load-more {
+            color: var(--link-color);
+            font-style: italic;
+        }
         /* Star button for favorites */
         .star-btn {
             opacity: 0;
@@ -1680,9 +2328,9 @@ func buildHTML(title, filePath, content, contentClass string) string {
         .panel-resize-handle::after {
             content: '';
             position: absolute;
-            left: 50%%;
-            top: 50%%;
-            transform: translate(-50%%, -50%%);
+            left: 50%;
+            top: 50%;
+            transform: translate(-50%, -50%);
             width: 30px;
             height: 2px;
             background: var(--text-secondary);
@@ -1710,7 +2358,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
             min-width: 0;
             display: flex;
             flex-direction: column;
-            max-width: 100%%;
+            max-width: 100%;
             margin-left: 280px;
             transition: margin-left 0.3s ease;
         }
@@ -1772,6 +2420,22 @@ func buildHTML(title, filePath, content, contentClass string) string {
             font-size: 16px;
         }
         .print-btn:hover { background: rgba(255,255,255,0.1); }
+        .export-buttons { display: inline-flex; gap: 6px; }
+        .export-buttons .print-btn { font-size: 12px; }
+        .static-site .query-bar, .static-site .convert-buttons,
+        .static-site #log-follow-btn, .static-site .jsonl-more { display: none; }
+        .site-nav { padding: 8px 12px; font-size: 13px; }
+        .site-nav a { display: block; padding: 4px 0; color: var(--link-color); text-decoration: none; }
+        .site-search {
+            width: 100%; box-sizing: border-box; margin: 8px 0; padding: 6px 8px;
+            border: 1px solid var(--border-color); border-radius: 4px;
+            background: var(--bg-primary); color: var(--text-primary);
+        }
+        .site-search-results a { padding: 4px 0; }
+        .site-search-results small { display: block; color: var(--text-secondary); }
+        .directory-listing { list-style: none; padding: 0; }
+        .directory-listing li { padding: 4px 0; border-bottom: 1px solid var(--border-color); }
+        .directory-listing a { text-decoration: none; }
         .theme-selector {
             background: rgba(255,255,255,0.1);
             border: 1px solid rgba(255,255,255,0.3);
@@ -1883,7 +2547,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
             position: absolute;
             pointer-events: none;
             top: 0;
-            font-size: 100%%;
+            font-size: 100%;
             left: -3.8em;
             width: 3em;
             letter-spacing: -1px;
@@ -1923,7 +2587,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
         .markdown .checkbox { font-size: 1.2em; line-height: 1; }
         .markdown .checkbox.checked { color: #22c55e; }
         .markdown .checkbox.unchecked { color: #9ca3af; }
-        .markdown table { border-collapse: collapse; width: 100%%; }
+        .markdown table { border-collapse: collapse; width: 100%; }
         .markdown th, .markdown td {
             border: 1px solid var(--border-color);
             padding: 8px 12px;
@@ -1994,18 +2658,118 @@ func buildHTML(title, filePath, content, contentClass string) string {
             text-align: center;
         }
         .plantuml img {
-            max-width: 100%%;
+            max-width: 100%;
             height: auto;
         }
         .dark-mode .plantuml { background: #f8fafc; }
+        /* Front matter */
+        .front-matter {
+            border: 1px solid var(--border-color);
+            border-radius: 8px;
+            margin-bottom: 1.5em;
+            background: var(--bg-code);
+            font-size: 14px;
+        }
+        .front-matter summary { cursor: pointer; padding: 8px 12px; }
+        .front-matter-label { color: var(--text-secondary); }
+        .front-matter-title { font-weight: 600; }
+        .front-matter-date { color: var(--text-secondary); }
+        .front-matter-chip {
+            display: inline-block;
+            padding: 1px 8px;
+            margin: 2px 4px 2px 0;
+            border-radius: 10px;
+            background: var(--bg-secondary);
+            border: 1px solid var(--border-color);
+            font-size: 12px;
+        }
+        .markdown .front-matter-table { margin: 0; width: 100%; border: none; }
+        .markdown .front-matter-table th { width: 1%; white-space: nowrap; background: none; }
+        .front-matter-null { color: var(--text-secondary); font-style: italic; }
+        .front-matter-invalid summary { color: #ef4444; }
+        .front-matter-invalid pre { margin: 0 12px 12px; }
+        .external-link-icon {
+            font-size: 0.75em;
+            margin-left: 2px;
+            opacity: 0.6;
+        }
+        /* Wiki-links and backlinks */
+        .wiki-link-broken {
+            color: #ef4444;
+            border-bottom: 1px dashed #ef4444;
+            cursor: help;
+        }
+        .backlinks {
+            margin-top: 2em;
+            padding-top: 1em;
+            border-top: 1px solid var(--border-color);
+            font-size: 14px;
+        }
+        .backlinks h4 { color: var(--text-secondary); margin: 0.5em 0; }
+        .backlinks small { color: var(--text-secondary); }
+        .backlink-context {
+            color: var(--text-secondary);
+            font-size: 13px;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        .backlinks-broken code { color: #ef4444; }
+        .link-graph { position: relative; height: calc(100vh - 140px); }
+        .link-graph canvas { width: 100%; height: 100%; display: block; cursor: grab; }
+        .link-graph-info {
+            position: absolute;
+            top: 8px;
+            left: 8px;
+            font-size: 12px;
+            color: var(--text-secondary);
+        }
+        @media print { .backlinks { display: none; } }
+        /* Untrusted HTML files */
+        .html-sandbox-note {
+            font-size: 13px;
+            color: var(--text-secondary);
+            margin-bottom: 8px;
+        }
+        .html-sandbox {
+            width: 100%;
+            height: calc(100vh - 160px);
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: white;
+            resize: vertical;
+        }
+        /* Link check report */
+        .link-report-summary { font-weight: 600; }
+        .link-report-ok { color: #22c55e; }
+        .link-report-failed { color: #ef4444; }
+        /* Server-rendered diagrams */
+        .diagram {
+            margin: 1em 0;
+            text-align: center;
+            overflow-x: auto;
+            color: var(--text-primary);
+        }
+        .diagram svg { max-width: 100%; height: auto; }
+        .diagram-dot svg text:not([fill]) { fill: currentColor; }
+        .diagram-dark, .dark-mode .diagram-light { display: none; }
+        .dark-mode .diagram-dark { display: block; }
+        .diagram-error {
+            border: 1px solid #ef4444;
+            border-radius: 8px;
+            padding: 12px 16px;
+            margin: 1em 0;
+        }
+        .diagram-error strong { color: #ef4444; white-space: pre-wrap; }
+        .diagram-error pre { margin: 8px 0 0; }
         /* Lightbox */
         .lightbox {
             display: none;
             position: fixed;
             top: 0;
             left: 0;
-            width: 100%%;
-            height: 100%%;
+            width: 100%;
+            height: 100%;
             background: rgba(0,0,0,0.9);
             z-index: 1000;
             justify-content: center;
@@ -2014,8 +2778,8 @@ func buildHTML(title, filePath, content, contentClass string) string {
         }
         .lightbox.active { display: flex; }
         .lightbox img {
-            max-width: 90%%;
-            max-height: 80%%;
+            max-width: 90%;
+            max-height: 80%;
             object-fit: contain;
         }
         .lightbox-caption {
@@ -2092,9 +2856,21 @@ func buildHTML(title, filePath, content, contentClass string) string {
             color: var(--text-primary);
         }
         .csv-toolbar span { color: var(--text-secondary); font-size: 14px; }
+        /* Conversion downloads */
+        .convert-buttons { display: inline-flex; gap: 6px; margin-left: auto; }
+        .json-toolbar .convert-buttons button, .yaml-toolbar .convert-buttons button,
+        .toml-toolbar .convert-buttons button, .csv-toolbar .convert-buttons button {
+            padding: 6px 10px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+            color: var(--text-primary);
+            cursor: pointer;
+            font-size: 12px;
+        }
         .csv-container { overflow-x: auto; }
         .csv-table {
-            width: 100%%;
+            width: 100%;
             border-collapse: collapse;
             font-size: 14px;
             font-family: 'SF Mono', Monaco, 'Courier New', monospace;
@@ -2148,6 +2924,244 @@ func buildHTML(title, filePath, content, contentClass string) string {
         .json-highlight, .search-highlight { background: #fef08a; border-radius: 2px; }
         .dark-mode .json-highlight, .dark-mode .search-highlight { background: #854d0e; color: #fef9c3; }
         .search-current { background: #f97316; color: white; }
+        /* Large file viewer */
+        .large-file-notice { color: var(--text-secondary); font-size: 13px; margin-top: 0; }
+        .large-file-toolbar {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 10px;
+            margin-bottom: 10px;
+            align-items: center;
+            font-size: 14px;
+        }
+        .large-file-toolbar input[type="text"], .large-file-toolbar input[type="number"] {
+            padding: 6px 10px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+            color: var(--text-primary);
+        }
+        .large-file-toolbar input[type="number"] { width: 120px; }
+        .large-file-toolbar input[type="text"] { flex: 1; min-width: 160px; }
+        .large-file-toolbar button {
+            padding: 6px 14px;
+            border: none;
+            border-radius: 6px;
+            background: var(--accent-color);
+            color: white;
+            cursor: pointer;
+        }
+        .large-file-info { color: var(--text-secondary); }
+        .large-file-results {
+            max-height: 200px;
+            overflow-y: auto;
+            font-family: 'SF Mono', Monaco, 'Courier New', monospace;
+            font-size: 12px;
+        }
+        .large-file-result {
+            display: block;
+            color: var(--link-color);
+            text-decoration: none;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        .large-file-viewport {
+            height: calc(100vh - 180px);
+            overflow: auto;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-code);
+        }
+        .large-file-spacer { position: relative; }
+        .large-file-lines {
+            position: absolute;
+            top: 0;
+            left: 0;
+            right: 0;
+            font-family: 'SF Mono', Monaco, 'Courier New', monospace;
+            font-size: 13px;
+        }
+        .large-file-line {
+            height: 20px;
+            line-height: 20px;
+            white-space: pre;
+        }
+        .large-file-line.highlighted { background: #fef08a; }
+        .dark-mode .large-file-line.highlighted { background: #854d0e; }
+        .large-file-lineno {
+            display: inline-block;
+            width: 6em;
+            padding-right: 1em;
+            text-align: right;
+            color: var(--text-secondary);
+            user-select: none;
+        }
+        /* Schema validation */
+        .schema-summary {
+            margin-bottom: 12px;
+            padding: 8px 12px;
+            border-radius: 6px;
+            font-size: 14px;
+            border: 1px solid var(--border-color);
+        }
+        .schema-summary code { font-size: 12px; }
+        .schema-valid { border-color: #2da44e; background: rgba(45, 164, 78, 0.08); }
+        .schema-unavailable { border-color: #d4a72c; background: rgba(212, 167, 44, 0.1); }
+        .schema-invalid { border-color: #cf222e; background: rgba(207, 34, 46, 0.06); }
+        .schema-summary summary { cursor: pointer; }
+        .schema-summary ul { margin: 8px 0 0; padding-left: 20px; }
+        .schema-pointer { font-family: 'SF Mono', Monaco, 'Courier New', monospace; font-size: 12px; }
+        .schema-keyword { color: var(--text-secondary); font-size: 12px; }
+        .schema-error {
+            color: #cf222e;
+            font-size: 12px;
+            font-weight: 600;
+            margin-right: 4px;
+            cursor: help;
+        }
+        .dark-mode .schema-error { color: #f85149; }
+        .schema-flash { outline: 2px solid #f97316; border-radius: 3px; }
+        /* Query bar */
+        .query-bar {
+            display: flex;
+            gap: 8px;
+            margin-bottom: 10px;
+            align-items: center;
+        }
+        .query-bar input {
+            flex: 1;
+            padding: 6px 10px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+            color: var(--text-primary);
+            font-family: 'SF Mono', Monaco, 'Courier New', monospace;
+            font-size: 13px;
+        }
+        .query-bar select {
+            padding: 6px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+            color: var(--text-primary);
+        }
+        .query-bar button {
+            padding: 6px 14px;
+            border: none;
+            border-radius: 6px;
+            background: var(--accent-color);
+            color: white;
+            cursor: pointer;
+        }
+        .query-results {
+            display: none;
+            max-height: 50vh;
+            overflow-y: auto;
+            margin-bottom: 16px;
+            padding: 10px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+        }
+        .query-summary { color: var(--text-secondary); font-size: 13px; margin-bottom: 8px; }
+        .query-error { color: #cf222e; }
+        .query-result { border-top: 1px solid var(--border-color); padding: 6px 0; }
+        .query-result-path { display: flex; gap: 6px; align-items: center; }
+        .query-result-path button { border: none; background: none; cursor: pointer; opacity: 0.6; }
+        .query-result-path button:hover { opacity: 1; }
+        /* JSON Lines viewer */
+        .jsonl-toolbar button.active { background: var(--header-bg); }
+        .jsonl-error-count { color: #cf222e; font-size: 14px; text-decoration: none; }
+        .jsonl-record {
+            border-bottom: 1px solid var(--border-color);
+            padding: 4px 0;
+        }
+        .jsonl-record summary {
+            cursor: pointer;
+            white-space: nowrap;
+            overflow: hidden;
+            text-overflow: ellipsis;
+        }
+        .jsonl-record summary code { background: none; font-size: 12px; }
+        .jsonl-record .json-tree { margin: 6px 0 6px 3em; }
+        .jsonl-line {
+            display: inline-block;
+            min-width: 3em;
+            margin-right: 0.5em;
+            color: var(--text-secondary);
+            font-family: 'SF Mono', Monaco, 'Courier New', monospace;
+            font-size: 12px;
+            text-align: right;
+        }
+        .jsonl-error { background: rgba(207, 34, 46, 0.08); }
+        .jsonl-error pre { margin: 4px 0 0 3.5em; white-space: pre-wrap; word-break: break-all; }
+        .jsonl-error .error { color: #cf222e; }
+        .jsonl-table-view td { max-width: 320px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+        .jsonl-more { text-align: center; margin: 16px 0; }
+        .jsonl-more button {
+            padding: 8px 16px;
+            border: none;
+            border-radius: 6px;
+            background: var(--accent-color);
+            color: white;
+            cursor: pointer;
+        }
+        /* Log viewer */
+        .log-toolbar {
+            display: flex;
+            flex-wrap: wrap;
+            gap: 8px;
+            margin-bottom: 10px;
+            align-items: center;
+            font-size: 13px;
+        }
+        .log-toolbar input[type="text"], .log-toolbar input[type="datetime-local"] {
+            padding: 5px 8px;
+            border: 1px solid var(--border-color);
+            border-radius: 6px;
+            background: var(--bg-secondary);
+            color: var(--text-primary);
+        }
+        .log-toolbar input[type="text"] { flex: 1; min-width: 160px; }
+        .log-toolbar input.invalid { border-color: #dc2626; }
+        .log-toolbar button {
+            padding: 5px 12px;
+            border: none;
+            border-radius: 6px;
+            background: var(--accent-color);
+            color: white;
+            cursor: pointer;
+        }
+        .log-toolbar button.following { background: #16a34a; }
+        .log-filter { cursor: pointer; white-space: nowrap; }
+        .log-view {
+            font-family: 'SF Mono', Monaco, 'Courier New', monospace;
+            font-size: 12px;
+            line-height: 1.5;
+        }
+        .log-line { white-space: pre-wrap; word-break: break-all; padding: 0 6px; border-left: 3px solid transparent; }
+        .log-continuation { padding-left: 2em; }
+        .log-ts { color: var(--text-secondary); }
+        .log-level { font-weight: 600; }
+        .log-key { color: var(--text-secondary); }
+        .log-marker { color: var(--text-secondary); font-style: italic; text-align: center; margin: 4px 0; }
+        .log-level-trace { color: #8b949e; }
+        .log-level-debug { color: #6e7781; }
+        .log-level-info { border-left-color: #0969da; }
+        .log-level-warn { color: #9a6700; border-left-color: #d4a72c; }
+        .log-level-error { color: #cf222e; border-left-color: #cf222e; }
+        .log-level-fatal { color: white; background: #a40e26; border-left-color: #82071e; }
+        .dark-mode .log-level-warn { color: #d29922; }
+        .dark-mode .log-level-error { color: #f85149; }
+        .log-filter.log-level-fatal { color: #a40e26; background: none; }
+        .binary-file {
+            color: var(--text-secondary);
+        }
+        .binary-file img {
+            display: block;
+            margin: 1em 0;
+        }
         .text {
             font-family: 'SF Mono', Monaco, 'Courier New', monospace;
             white-space: pre-wrap;
@@ -2209,7 +3223,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
         @media print {
             body { background: white; }
             .sidebar, .header, .lightbox, .toc, .copy-btn, .search-toolbar,
-            .json-toolbar, .yaml-toolbar, .toml-toolbar, .csv-toolbar { display: none !important; }
+            .json-toolbar, .yaml-toolbar, .toml-toolbar, .csv-toolbar, .query-bar, .query-results { display: none !important; }
             .app-container { display: block; }
             .main-content { margin: 0; padding: 0; max-width: none; }
             .content {
@@ -2232,13 +3246,29 @@ func buildHTML(title, filePath, content, contentClass string) string {
             .markdown table { border-color: #d1d5db; }
             .markdown th { background: #f3f4f6; }
             .anchor-link { display: none; }
+            .diagram-dark { display: none !important; }
+            .diagram-light { display: block !important; }
             .footnotes { border-top: 1px solid #d1d5db; }
             @page {
                 margin: 2cm;
                 size: A4;
             }
         }
-    </style>
+`
+
+func buildHTML(title, filePath, content, contentClass string) string {
+	return fmt.Sprintf(withNonce(`<!DOCTYPE html>
+<html lang="en">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>%s</title>
+    <!-- Prism CSS -->
+    <link rel="stylesheet" href="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/themes/prism-okaidia.min.css">
+    <link rel="stylesheet" href="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/plugins/line-numbers/prism-line-numbers.min.css">
+    <!-- KaTeX CSS -->
+    <link rel="stylesheet" href="/cdn/cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.css">
+    <style>%s    </style>
 </head>
 <body>
     <div class="app-container">
@@ -2258,7 +3288,12 @@ func buildHTML(title, filePath, content, contentClass string) string {
                     <span>%s</span>
                 </div>
                 <div class="header-controls">
-                    <button class="print-btn" onclick="printDocument()" title="Print / Export PDF">🖨️</button>
+                    <span class="export-buttons" id="export-buttons">
+                        <button class="print-btn" onclick="exportDocument('html')" title="Download as standalone HTML">⬇ HTML</button>
+                        <button class="print-btn" onclick="exportDocument('pdf')" title="Download as PDF">⬇ PDF</button>
+                        <button class="print-btn" onclick="openLinkGraph()" title="Show the link graph of this vault">🕸 Graph</button>
+                    </span>
+                    <button class="print-btn" onclick="printDocument()" title="Print">🖨️</button>
                     <select class="theme-selector" id="theme-selector" onchange="setTheme(this.value)" title="Select theme">
                         <option value="light">☀️ Light</option>
                         <option value="dark">🌙 Dark</option>
@@ -2303,12 +3338,22 @@ func buildHTML(title, filePath, content, contentClass string) string {
     <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-java.min.js"></script>
     <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-c.min.js"></script>
     <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-cpp.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-makefile.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-docker.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-ruby.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-groovy.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-ini.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-cmake.min.js"></script>
+    <script src="/cdn/cdnjs.cloudflare.com/ajax/libs/prism/1.29.0/components/prism-go-module.min.js"></script>
     <!-- KaTeX JS -->
     <script src="/cdn/cdn.jsdelivr.net/npm/katex@0.16.9/dist/katex.min.js"></script>
     <script src="/cdn/cdn.jsdelivr.net/npm/katex@0.16.9/dist/contrib/auto-render.min.js"></script>
     <!-- Mermaid JS -->
     <script src="/cdn/cdn.jsdelivr.net/npm/mermaid@10/dist/mermaid.min.js"></script>
     <script>
+        // Pages written by "file-viewer build" have no server behind them
+        const staticSite = document.body.classList.contains('static-site');
+
         // Theme management
         const themes = ['light', 'dark', 'sepia', 'nord', 'solarized-light', 'solarized-dark'];
         const darkThemes = ['dark', 'nord', 'solarized-dark'];
@@ -2351,11 +3396,34 @@ func buildHTML(title, filePath, content, contentClass string) string {
             setTheme(savedTheme);
         }
 
-        // Print / Export PDF
+        // Print
         function printDocument() {
             window.print();
         }
 
+        // Export Markdown as standalone HTML or PDF
+        if (staticSite || !document.querySelector('.content.markdown') || location.pathname === '/') {
+            document.getElementById('export-buttons').style.display = 'none';
+        }
+        async function exportDocument(format) {
+            const params = new URLSearchParams({ path: decodeURIComponent(location.pathname), format: format });
+            const res = await fetch('/export?' + params);
+            if (!res.ok) {
+                const data = await res.json();
+                alert('Export failed: ' + data.error);
+                return;
+            }
+            const link = document.createElement('a');
+            link.href = URL.createObjectURL(await res.blob());
+            link.download = decodeURIComponent(location.pathname).split('/').pop().replace(/\.[^.]+$/, '') + '.' + format;
+            link.click();
+            URL.revokeObjectURL(link.href);
+        }
+
+        function openLinkGraph() {
+            location.href = '/graph?format=html&path=' + encodeURIComponent(decodeURIComponent(location.pathname));
+        }
+
         // Link Preview
         let linkPreviewTimeout = null;
         let linkPreviewCache = {};
@@ -2364,11 +3432,11 @@ func buildHTML(title, filePath, content, contentClass string) string {
         const linkPreviewContent = document.getElementById('link-preview-content');
 
         function isInternalLink(href) {
-            if (!href) return false;
+            if (!href || href.startsWith('/asset?')) return false;
             // Internal links are absolute paths starting with /
             if (href.startsWith('/') && !href.startsWith('//')) return true;
             // Relative paths without protocol
-            if (!href.includes('://') && !href.startsWith('#')) return true;
+            if (!/^[a-z][a-z0-9+.-]*:/i.test(href) && !href.startsWith('#')) return true;
             return false;
         }
 
@@ -2401,7 +3469,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
             }
 
             // Fetch preview
-            fetch('/preview' + href)
+            fetch('/preview' + href.split('#')[0])
                 .then(res => res.ok ? res.text() : Promise.reject('Not found'))
                 .then(html => {
                     // Truncate content for preview
@@ -2428,6 +3496,7 @@ func buildHTML(title, filePath, content, contentClass string) string {
 
         // Attach hover listeners to internal links
         document.addEventListener('DOMContentLoaded', function() {
+            if (staticSite) return;
             document.querySelectorAll('.markdown a, .content a').forEach(link => {
                 const href = link.getAttribute('href');
                 if (!isInternalLink(href) || href.startsWith('#')) return;
@@ -2916,11 +3985,17 @@ func buildHTML(title, filePath, content, contentClass string) string {
             return panelEl;
         }
 
+        const DIR_PAGE_SIZE = 500;
+
+        function directoryURL(dir, offset) {
+            return '/files?dir=' + encodeURIComponent(dir) + '&limit=' + DIR_PAGE_SIZE + '&offset=' + (offset || 0);
+        }
+
         async function loadDirectoryForPanel(panelId, dir) {
             const container = document.getElementById('panel-content-' + panelId);
             if (!container) return;
             try {
-                const res = await fetch('/files?dir=' + encodeURIComponent(dir));
+                const res = await fetch(directoryURL(dir, 0));
                 const data = await res.json();
                 if (data.error) {
                     container.textContent = 'Error: ' + data.error;
@@ -2992,8 +4067,37 @@ func buildHTML(title, filePath, content, contentClass string) string {
                 ul.appendChild(li);
             }
 
+            appendFileTreeItems(ul, data, panelId);
+
+            tree.appendChild(ul);
+            container.appendChild(tree);
+        }
+
+        function fileTooltip(file) {
+            const parts = [file.path];
+            if (file.title) parts.push(file.title + (file.date ? ' · ' + file.date : ''));
+            if (file.tags) parts.push(file.tags.map(t => '#' + t).join(' '));
+            if (file.isSymlink) parts.push('→ ' + (file.linkTarget || '?') + (file.brokenLink ? ' (broken link)' : ''));
+            if (file.isDir) {
+                parts.push((file.childCount || 0) + ' items');
+            } else {
+                parts.push(formatFileSize(file.size) + (file.mimeType ? ' · ' + file.mimeType : ''));
+            }
+            if (file.modTime) parts.push(new Date(file.modTime).toLocaleString());
+            if (file.mode) parts.push(file.mode);
+            return parts.join('\n');
+        }
+
+        function formatFileSize(size) {
+            if (size < 1024) return size + ' B';
+            if (size < 1024 * 1024) return (size / 1024).toFixed(1) + ' KB';
+            return (size / 1024 / 1024).toFixed(1) + ' MB';
+        }
+
+        // Append one page of entries, plus a "load more" item if the directory has more
+        function appendFileTreeItems(ul, data, panelId) {
             data.files.forEach(file => {
-                const icon = getFileIcon(file.ext, file.isDir);
+                const icon = file.brokenLink ? '⛓️' : getFileIcon(file.ext, file.isDir);
                 const li = document.createElement('li');
                 const favorited = isFavorite(file.path);
 
@@ -3040,7 +4144,11 @@ func buildHTML(title, filePath, content, contentClass string) string {
                 } else {
                     const span = document.createElement('span');
                     span.className = 'tree-item disabled';
-                    span.title = file.size > 5242880 ? 'File too large (>5MB)' : 'Binary file';
+                    if (file.brokenLink) {
+                        span.title = 'Broken link → ' + (file.linkTarget || '?');
+                    } else {
+                        span.title = 'Binary file';
+                    }
                     const iconSpan = document.createElement('span');
                     iconSpan.className = 'tree-icon';
                     iconSpan.textContent = icon;
@@ -3051,11 +4159,32 @@ func buildHTML(title, filePath, content, contentClass string) string {
                     span.appendChild(nameSpan);
                     li.appendChild(span);
                 }
+                const item = li.querySelector('.tree-item');
+                if (item && !file.brokenLink) item.title = fileTooltip(file);
                 ul.appendChild(li);
             });
 
-            tree.appendChild(ul);
-            container.appendChild(tree);
+            const loaded = data.offset + data.files.length;
+            if (loaded < data.total) {
+                const li = document.createElement('li');
+                const a = document.createElement('a');
+                a.className = 'tree-item load-more';
+                a.href = 'javascript:void(0)';
+                a.textContent = 'Load more (' + (data.total - loaded) + ' remaining)';
+                a.onclick = async () => {
+                    a.textContent = 'Loading...';
+                    try {
+                        const res = await fetch(directoryURL(data.dir, loaded));
+                        const next = await res.json();
+                        li.remove();
+                        appendFileTreeItems(ul, next, panelId);
+                    } catch (e) {
+                        a.textContent = 'Failed to load more';
+                    }
+                };
+                li.appendChild(a);
+                ul.appendChild(li);
+            }
         }
 
         function getFileIcon(ext, isDir) {
@@ -3087,6 +4216,8 @@ func buildHTML(title, filePath, content, contentClass string) string {
             if (!sidebarOpen) {
                 container.classList.add('sidebar-hidden');
             }
+            // Static sites ship their own navigation in the sidebar
+            if (staticSite) return;
             // Track current file in recent history
             const headerSpan = document.querySelector('.header-left span');
             const filepath = headerSpan ? headerSpan.textContent : '';
@@ -3098,12 +4229,11 @@ func buildHTML(title, filePath, content, contentClass string) string {
         }
 
         // Copy code functionality
-        function copyCode(id) {
-            const code = document.getElementById(id);
+        function copyCode(btn) {
+            const code = btn.closest('.code-block').querySelector('code');
             if (!code) return;
             const text = code.textContent;
             navigator.clipboard.writeText(text).then(() => {
-                const btn = code.closest('.code-block').querySelector('.copy-btn');
                 btn.textContent = '✓ Copied!';
                 btn.classList.add('copied');
                 setTimeout(() => {
@@ -3128,10 +4258,10 @@ func buildHTML(title, filePath, content, contentClass string) string {
 
         // Live reload
         let lastMtime = null;
-        setInterval(async () => {
+        if (!staticSite) setInterval(async () => {
             try {
                 const res = await fetch('/mtime' + location.pathname);
-                const mtime = await res.text();
+                const mtime = res.ok ? await res.text() : '0';
                 if (lastMtime === null) lastMtime = mtime;
                 else if (mtime !== lastMtime) location.reload();
             } catch (e) {}
@@ -3230,5 +4360,5 @@ func buildHTML(title, filePath, content, contentClass string) string {
         });
     </script>
 </body>
-</html>`, title, filePath, contentClass, content)
+</html>`), title, viewerCSS, filePath, contentClass, content)
 }
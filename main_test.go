@@ -1,10 +1,42 @@
 package main
 
 import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
+// ===== Test Helpers =====
+
+// writeFiles creates files from name -> content below dir, with their
+// parent directories
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeTree creates files from name -> content in a new directory
+func writeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	writeFiles(t, root, files)
+	return root
+}
+
 // ===== Markdown Rendering Tests =====
 
 func TestRenderMarkdownHeaders(t *testing.T) {
@@ -64,7 +96,7 @@ func TestRenderMarkdownInlineFormatting(t *testing.T) {
 		{"Strikethrough", "~~deleted~~", "<del>deleted</del>"},
 		{"Inline code", "`code`", "<code>code</code>"},
 		{"Highlight", "==highlight==", "<mark>highlight</mark>"},
-		{"Link", "[text](http://example.com)", `<a href="http://example.com">text</a>`},
+		{"Link", "[text](http://example.com)", `<a href="http://example.com" class="external-link" target="_blank" rel="noopener">text<span class="external-link-icon" aria-hidden="true">↗</span></a>`},
 	}
 
 	for _, tt := range tests {
@@ -77,6 +109,43 @@ func TestRenderMarkdownInlineFormatting(t *testing.T) {
 	}
 }
 
+func TestRenderMarkdownRelativeLinks(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"docs/other notes.md": "# Other\n",
+		"docs/report.pdf":     "%PDF-1.4\x00\x01binary",
+		"docs/data.json":      "{}",
+	})
+	base := filepath.Join(dir, "docs", "sub")
+
+	tests := []struct {
+		input    string
+		contains string
+	}{
+		{"[other](../other%20notes.md#Getting_Started)", `<a href="` + filepath.ToSlash(dir) + `/docs/other%20notes.md#getting-started">other</a>`},
+		{"[data](../data.json)", `<a href="` + filepath.ToSlash(dir) + `/docs/data.json">data</a>`},
+		{"[pdf](../report.pdf)", `<a href="/asset?path=` + url.QueryEscape(filepath.Join(dir, "docs", "report.pdf")) + `">pdf</a>`},
+		{"[later](../scan.PNG)", `<a href="/asset?path=` + url.QueryEscape(filepath.Join(dir, "docs", "scan.PNG")) + `">later</a>`},
+		{"[up](..)", `<a href="` + filepath.ToSlash(dir) + `/docs">up</a>`},
+		{"[abs](/etc/hosts)", `<a href="/etc/hosts">abs</a>`},
+		{"[top](#Table_of_Contents)", `<a href="#table-of-contents">top</a>`},
+		{`[titled](../data.json "The data")`, `/docs/data.json" title="The data">titled</a>`},
+		{"[**bold** file](../my__file.md)", `/docs/my__file.md"><strong>bold</strong> file</a>`},
+		{"[mail](mailto:a@b.c)", `<a href="mailto:a@b.c">mail</a>`},
+		{"[site](https://example.com/a?b=1&c=2)", `<a href="https://example.com/a?b=1&amp;c=2" class="external-link" target="_blank" rel="noopener">site<span class="external-link-icon" aria-hidden="true">↗</span></a>`},
+	}
+	for _, tt := range tests {
+		result := renderMarkdown(tt.input, base)
+		if !strings.Contains(result, tt.contains) {
+			t.Errorf("renderMarkdown(%q) = %q, want to contain %q", tt.input, result, tt.contains)
+		}
+	}
+
+	// Without a file to resolve against, relative links are left as written
+	if result := renderMarkdown("[guide](guide.md)", ""); !strings.Contains(result, `<a href="guide.md">guide</a>`) {
+		t.Errorf("relative link without base: %q", result)
+	}
+}
+
 func TestRenderMarkdownCodeBlocks(t *testing.T) {
 	input := "```python\nprint('hello')\n```"
 	result := renderMarkdown(input, "")
@@ -459,6 +528,240 @@ func TestRenderFile(t *testing.T) {
 	}
 }
 
+// ===== Directory Listing Tests =====
+
+func writeTestFile(t *testing.T, path, content string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func entryNames(files []FileEntry) []string {
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+func TestListDirectory(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	writeTestFile(t, filepath.Join(dir, "b.md"), "# B", base.Add(2*time.Hour))
+	writeTestFile(t, filepath.Join(dir, "a.txt"), "hello world, longer", base)
+	writeTestFile(t, filepath.Join(dir, "c.go"), "package c", base.Add(time.Hour))
+	writeTestFile(t, filepath.Join(dir, ".hidden"), "x", base)
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "sub", "x.md"), "x", base)
+	writeTestFile(t, filepath.Join(dir, "sub", "y.md"), "y", base)
+	writeTestFile(t, filepath.Join(dir, "sub", ".z.md"), "z", base)
+	if err := os.Symlink(filepath.Join(dir, "missing"), filepath.Join(dir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "sub"), filepath.Join(dir, "linked")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		opts   ListOptions
+		expect []string
+		total  int
+	}{
+		{"Default name sort", ListOptions{Sort: "name"}, []string{"linked", "sub", "a.txt", "b.md", "c.go", "dangling"}, 6},
+		{"Size descending", ListOptions{Sort: "size", Desc: true, Extensions: []string{".md", ".txt", ".go"}}, []string{"sub", "linked", "a.txt", "c.go", "b.md"}, 5},
+		{"Mtime", ListOptions{Sort: "mtime", Extensions: []string{".md", ".txt", ".go"}}, []string{"linked", "sub", "a.txt", "c.go", "b.md"}, 5},
+		{"Extension filter", ListOptions{Sort: "name", Extensions: []string{".md"}}, []string{"linked", "sub", "b.md"}, 3},
+		{"Pagination", ListOptions{Sort: "name", Offset: 2, Limit: 2}, []string{"a.txt", "b.md"}, 6},
+		{"Offset past end", ListOptions{Sort: "name", Offset: 10}, nil, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, total, err := listDirectory(dir, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, want %d", total, tt.total)
+			}
+			if got := strings.Join(entryNames(files), ","); got != strings.Join(tt.expect, ",") {
+				t.Errorf("listDirectory() = %s, want %s", got, strings.Join(tt.expect, ","))
+			}
+		})
+	}
+
+	files, _, err := listDirectory(dir, ListOptions{Sort: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]FileEntry)
+	for _, f := range files {
+		byName[f.Name] = f
+	}
+
+	if sub := byName["sub"]; sub.ChildCount != 2 {
+		t.Errorf("sub.ChildCount = %d, want 2", sub.ChildCount)
+	}
+	if linked := byName["linked"]; !linked.IsSymlink || !linked.IsDir || linked.BrokenLink || linked.ChildCount != 2 {
+		t.Errorf("linked directory symlink not resolved: %+v", linked)
+	}
+	if dangling := byName["dangling"]; !dangling.BrokenLink || dangling.Viewable || dangling.LinkTarget == "" {
+		t.Errorf("dangling symlink not reported as broken: %+v", dangling)
+	}
+	if md := byName["b.md"]; !md.ModTime.Equal(base.Add(2*time.Hour)) || md.Mode != "-rw-r--r--" {
+		t.Errorf("b.md metadata = %v %s", md.ModTime, md.Mode)
+	}
+	if txt := byName["a.txt"]; !strings.HasPrefix(txt.MimeType, "text/plain") {
+		t.Errorf("a.txt MimeType = %q, want text/plain", txt.MimeType)
+	}
+}
+
+func TestParseListOptions(t *testing.T) {
+	opts, err := parseListOptions(url.Values{
+		"sort":   {"size"},
+		"order":  {"desc"},
+		"offset": {"10"},
+		"limit":  {"5"},
+		"ext":    {"md,.GO", "txt"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Sort != "size" || !opts.Desc || opts.Offset != 10 || opts.Limit != 5 {
+		t.Errorf("parseListOptions() = %+v", opts)
+	}
+	if got := strings.Join(opts.Extensions, ","); got != ".md,.go,.txt" {
+		t.Errorf("Extensions = %s, want .md,.go,.txt", got)
+	}
+
+	invalid := []url.Values{
+		{"sort": {"color"}},
+		{"sort": {"type"}},
+		{"order": {"sideways"}},
+		{"limit": {"-1"}},
+		{"offset": {"abc"}},
+	}
+	for _, q := range invalid {
+		if _, err := parseListOptions(q); err == nil {
+			t.Errorf("parseListOptions(%v) should fail", q)
+		}
+	}
+}
+
+// ===== Router Tests =====
+
+func TestRouter(t *testing.T) {
+	dir := writeTree(t, map[string]string{"doc.md": "# Doc\n", "notes.txt": "notes"})
+	big := filepath.Join(dir, "big.md")
+	if err := os.WriteFile(big, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(big, MaxViewableSize+1); err != nil {
+		t.Fatal(err)
+	}
+	doc, missing := filepath.Join(dir, "doc.md"), filepath.Join(dir, "missing.md")
+
+	tests := []struct {
+		method, target, accept string
+		status                 int
+		contentType            string
+	}{
+		{"GET", doc, "", http.StatusOK, "text/html"},
+		{"HEAD", doc, "", http.StatusOK, "text/html"},
+		{"GET", missing, "text/html,*/*;q=0.8", http.StatusNotFound, "text/html"},
+		{"GET", missing, "application/json", http.StatusNotFound, "application/json"},
+		{"GET", dir, "", http.StatusBadRequest, "text/html"},
+		{"POST", doc, "", http.StatusMethodNotAllowed, "text/plain"},
+		{"DELETE", "/files", "", http.StatusMethodNotAllowed, "application/json"},
+		{"GET", "/files?dir=" + url.QueryEscape(missing), "", http.StatusNotFound, "application/json"},
+		{"GET", "/files?dir=" + url.QueryEscape(doc), "", http.StatusBadRequest, "application/json"},
+		{"GET", "/files?dir=" + url.QueryEscape(missing), "text/html", http.StatusNotFound, "text/plain"},
+		{"GET", "/mtime" + doc, "", http.StatusOK, "text/plain"},
+		{"GET", "/mtime" + missing, "", http.StatusNotFound, "application/json"},
+		{"GET", "/preview" + doc, "", http.StatusOK, "text/html"},
+		{"GET", "/preview" + missing, "", http.StatusNotFound, "application/json"},
+		{"GET", "/preview" + big, "", http.StatusRequestEntityTooLarge, "application/json"},
+		{"GET", "/convert?to=json&path=" + url.QueryEscape(filepath.Join(dir, "notes.txt")), "", http.StatusUnsupportedMediaType, "application/json"},
+		{"GET", "/asset?path=" + url.QueryEscape(dir), "", http.StatusBadRequest, "application/json"},
+	}
+	router := newRouter()
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tt.status || !strings.HasPrefix(rec.Header().Get("Content-Type"), tt.contentType) {
+			t.Errorf("%s %s: %d %s, want %d %s", tt.method, tt.target, rec.Code, rec.Header().Get("Content-Type"), tt.status, tt.contentType)
+		}
+		if tt.contentType == "application/json" && tt.status >= 400 {
+			var body map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == "" {
+				t.Errorf("%s %s: error body %s", tt.method, tt.target, rec.Body)
+			}
+		}
+		if tt.status == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "GET, HEAD" {
+			t.Errorf("%s %s: Allow = %q", tt.method, tt.target, rec.Header().Get("Allow"))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest("GET", missing, nil))
+	if !strings.Contains(rec.Body.String(), "File not found") || !strings.Contains(rec.Body.String(), `id="sidebar"`) {
+		t.Error("missing files should get a page with the sidebar")
+	}
+}
+
+func TestRouterUnreadableFile(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads every file")
+	}
+	path := filepath.Join(t.TempDir(), "secret.json")
+	if err := os.WriteFile(path, []byte(`{"secret": true}`), 0); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{path, "/preview" + path, "/convert?to=json&path=" + url.QueryEscape(path)} {
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s: status = %d, want 403", target, rec.Code)
+		}
+	}
+}
+
+func TestRouterCDNTraversal(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	secret := filepath.Join(filepath.Dir(getCacheDir()), "secret.js")
+	if err := os.MkdirAll(filepath.Dir(secret), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, target := range []string{
+		"/cdn/cdn.jsdelivr.net/a%2F..%2F..%2F..%2Fsecret.js",
+		"/cdn/cdn.jsdelivr.net/..%2F..%2Fsecret.js",
+		"/cdn/cdn.jsdelivr.net/a%2F%2Fb.js",
+	} {
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		if rec.Code != http.StatusBadRequest || strings.Contains(rec.Body.String(), "secret") {
+			t.Errorf("%s: status = %d, body %q", target, rec.Code, rec.Body.String())
+		}
+	}
+	if _, _, err := cachedCDN("cdn.jsdelivr.net/a/../../../secret.js"); err == nil {
+		t.Error("cachedCDN should refuse paths leaving the cache")
+	}
+}
+
 // ===== Benchmark Tests =====
 
 func BenchmarkRenderMarkdown(b *testing.B) {
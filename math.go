@@ -0,0 +1,645 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+)
+
+// Greek letters; capitals are upright in TeX
+var texGreek = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+// Symbols written as identifiers
+var texIdentifiers = map[string]string{
+	"infty": "∞", "partial": "∂", "nabla": "∇", "ell": "ℓ", "hbar": "ℏ", "imath": "ı",
+	"jmath": "ȷ", "Re": "ℜ", "Im": "ℑ", "aleph": "ℵ", "emptyset": "∅", "varnothing": "∅",
+	"top": "⊤", "bot": "⊥", "angle": "∠", "triangle": "△", "prime": "′",
+}
+
+// Symbols written as operators
+var texOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "oplus": "⊕", "ominus": "⊖", "otimes": "⊗", "odot": "⊙",
+	"cup": "∪", "cap": "∩", "setminus": "∖", "wedge": "∧", "land": "∧", "vee": "∨", "lor": "∨",
+	"neg": "¬", "lnot": "¬",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "ll": "≪", "gg": "≫",
+	"approx": "≈", "sim": "∼", "simeq": "≃", "cong": "≅", "equiv": "≡", "propto": "∝",
+	"prec": "≺", "succ": "≻", "preceq": "⪯", "succeq": "⪰", "perp": "⊥", "mid": "∣", "parallel": "∥",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "supset": "⊃", "subseteq": "⊆",
+	"supseteq": "⊇", "forall": "∀", "exists": "∃", "nexists": "∄",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←", "leftrightarrow": "↔",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "implies": "⟹", "iff": "⟺",
+	"mapsto": "↦", "uparrow": "↑", "downarrow": "↓", "longrightarrow": "⟶", "longleftarrow": "⟵",
+	"ldots": "…", "dots": "…", "cdots": "⋯", "vdots": "⋮", "ddots": "⋱",
+	"langle": "⟨", "rangle": "⟩", "lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉",
+	"vert": "|", "Vert": "‖", "colon": ":",
+	"{": "{", "}": "}", "|": "‖", "#": "#", "%": "%", "&": "&", "_": "_", "$": "$",
+}
+
+// Large operators; those in texLimits take their scripts above and below in display style
+var texLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+	"bigcup": "⋃", "bigcap": "⋂", "bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+}
+
+var texLimits = map[string]bool{
+	"sum": true, "prod": true, "coprod": true, "bigcup": true, "bigcap": true, "bigoplus": true,
+	"bigotimes": true, "bigvee": true, "bigwedge": true, "lim": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "gcd": true, "limsup": true, "liminf": true,
+}
+
+// Functions written upright
+var texFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true, "arcsin": true,
+	"arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true, "log": true,
+	"ln": true, "lg": true, "exp": true, "lim": true, "max": true, "min": true, "sup": true,
+	"inf": true, "det": true, "gcd": true, "deg": true, "dim": true, "ker": true, "arg": true,
+	"limsup": true, "liminf": true, "Pr": true, "hom": true,
+}
+
+// Spacing commands, in em
+var texSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", "!": "-0.1667em",
+	" ": "0.25em", "quad": "1em", "qquad": "2em",
+}
+
+// Accents and the mark drawn over (or under) their argument
+var texAccents = map[string]struct {
+	mark    string
+	under   bool
+	stretch bool
+}{
+	"hat": {"^", false, false}, "widehat": {"^", false, true}, "bar": {"¯", false, false},
+	"overline": {"‾", false, true}, "underline": {"_", true, true}, "vec": {"→", false, false},
+	"overrightarrow": {"→", false, true}, "tilde": {"˜", false, false}, "widetilde": {"˜", false, true},
+	"dot": {"˙", false, false}, "ddot": {"¨", false, false}, "check": {"ˇ", false, false},
+	"breve": {"˘", false, false}, "acute": {"´", false, false}, "grave": {"`", false, false},
+}
+
+// Environments laid out as tables, with their fences
+var texMatrices = map[string][2]string{
+	"matrix": {"", ""}, "pmatrix": {"(", ")"}, "bmatrix": {"[", "]"}, "Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"}, "cases": {"{", ""}, "array": {"", ""},
+	"aligned": {"", ""}, "align": {"", ""}, "align*": {"", ""}, "gathered": {"", ""},
+	"split": {"", ""},
+}
+
+// First code points of the mathematical alphabets, capitals then small letters;
+// letters of the older Letterlike Symbols block are listed apart
+var texAlphabets = map[string]struct {
+	upper, lower rune
+	holes        map[rune]rune
+}{
+	"mathbf":   {0x1D400, 0x1D41A, nil},
+	"mathbb":   {0x1D538, 0, map[rune]rune{'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'}},
+	"mathcal":  {0x1D49C, 0, map[rune]rune{'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ'}},
+	"mathfrak": {0x1D504, 0x1D51E, map[rune]rune{'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'}},
+}
+
+// texParser turns a TeX math expression into MathML
+type texParser struct {
+	src     []rune
+	pos     int
+	display bool
+}
+
+// texToMathML converts TeX math to a <math> element; macros it does not know
+// are reported as errors so the caller can fall back to client-side rendering
+func texToMathML(tex string, display bool) (string, error) {
+	p := &texParser{src: []rune(tex), display: display}
+	nodes, stop, err := p.parseExpr()
+	if err != nil {
+		return "", err
+	}
+	if stop != "" {
+		return "", fmt.Errorf("unexpected %s", stop)
+	}
+	attr := ""
+	if display {
+		attr = ` display="block"`
+	}
+	return fmt.Sprintf(`<math%s><semantics>%s<annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		attr, mrow(nodes), html.EscapeString(tex)), nil
+}
+
+// renderMathInline renders $...$ as MathML, or as a span for KaTeX when unsupported
+func renderMathInline(tex string) string {
+	if mathml, err := texToMathML(tex, false); err == nil {
+		return `<span class="math-inline">` + mathml + `</span>`
+	}
+	return `<span class="math-inline">$` + html.EscapeString(tex) + `$</span>`
+}
+
+// renderMathBlock renders $$...$$ as MathML, or as a div for KaTeX when unsupported
+func renderMathBlock(tex string) string {
+	if mathml, err := texToMathML(tex, true); err == nil {
+		return `<div class="math-block">` + mathml + `</div>`
+	}
+	return `<div class="math-block">$$` + html.EscapeString(tex) + `$$</div>`
+}
+
+// mrow wraps several nodes in an mrow
+func mrow(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+func mo(op string, attrs string) string {
+	return "<mo" + attrs + ">" + html.EscapeString(op) + "</mo>"
+}
+
+func (p *texParser) skipSpace() {
+	for p.pos < len(p.src) && unicode.IsSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func (p *texParser) peek() rune {
+	if p.pos < len(p.src) {
+		return p.src[p.pos]
+	}
+	return 0
+}
+
+// command reads the name of a control sequence after its backslash
+func (p *texParser) command() string {
+	start := p.pos
+	for p.pos < len(p.src) && unicode.IsLetter(p.src[p.pos]) && p.src[p.pos] < unicode.MaxASCII {
+		p.pos++
+	}
+	if p.pos == start && p.pos < len(p.src) {
+		p.pos++
+	}
+	return string(p.src[start:p.pos])
+}
+
+// rawGroup reads a {...} argument as text
+func (p *texParser) rawGroup() (string, error) {
+	p.skipSpace()
+	if p.peek() != '{' {
+		return "", fmt.Errorf("expected {")
+	}
+	depth, start := 0, p.pos+1
+	for ; p.pos < len(p.src); p.pos++ {
+		switch p.src[p.pos] {
+		case '\\':
+			p.pos++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos++
+				return string(p.src[start : p.pos-1]), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("unbalanced braces")
+}
+
+// argument parses a {...} group or a single token as one node
+func (p *texParser) argument() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", fmt.Errorf("missing argument")
+	}
+	if p.peek() == '{' {
+		p.pos++
+		nodes, stop, err := p.parseExpr()
+		if err != nil {
+			return "", err
+		}
+		if stop != "}" {
+			return "", fmt.Errorf("unbalanced braces")
+		}
+		return mrow(nodes), nil
+	}
+	node, _, err := p.atom()
+	return node, err
+}
+
+// parseExpr parses nodes up to the end of the input or a terminator: }, &,
+// \\, \right, \middle or \end, which it returns
+func (p *texParser) parseExpr() ([]string, string, error) {
+	nodes := []string{}
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nodes, "", nil
+		}
+		switch c := p.peek(); {
+		case c == '}':
+			p.pos++
+			return nodes, "}", nil
+		case c == '&':
+			p.pos++
+			return nodes, "&", nil
+		case c == '\\':
+			save := p.pos
+			p.pos++
+			switch name := p.command(); name {
+			case "\\", "cr":
+				// Optional spacing after a row break, e.g. \\[2pt]
+				if p.peek() == '[' {
+					for p.pos < len(p.src) && p.src[p.pos] != ']' {
+						p.pos++
+					}
+					p.pos++
+				}
+				return nodes, "\\\\", nil
+			case "right", "middle", "end":
+				return nodes, "\\" + name, nil
+			}
+			p.pos = save
+		case c == '^' || c == '_':
+			return nil, "", fmt.Errorf("script without base")
+		}
+
+		base, limits, err := p.atom()
+		if err != nil {
+			return nil, "", err
+		}
+		if base == "" {
+			continue
+		}
+		node, err := p.scripts(base, limits)
+		if err != nil {
+			return nil, "", err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// scripts attaches the primes, subscript and superscript following a base
+func (p *texParser) scripts(base string, limits bool) (string, error) {
+	var sub, sup string
+	primes := ""
+	for {
+		p.skipSpace()
+		switch p.peek() {
+		case '\'':
+			p.pos++
+			primes += "′"
+			continue
+		case '^', '_':
+			c := p.peek()
+			p.pos++
+			arg, err := p.argument()
+			if err != nil {
+				return "", err
+			}
+			if c == '^' {
+				if sup != "" {
+					return "", fmt.Errorf("double superscript")
+				}
+				sup = arg
+			} else {
+				if sub != "" {
+					return "", fmt.Errorf("double subscript")
+				}
+				sub = arg
+			}
+			continue
+		}
+		break
+	}
+	if primes != "" {
+		sup = mrow(append([]string{mo(primes, "")}, nonEmpty(sup)...))
+	}
+
+	under, over, both := "msub", "msup", "msubsup"
+	if limits && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return fmt.Sprintf("<%s>%s%s%s</%s>", both, base, sub, sup, both), nil
+	case sub != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", under, base, sub, under), nil
+	case sup != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", over, base, sup, over), nil
+	}
+	return base, nil
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+// atom parses one token, group or command; limits reports a base taking its
+// scripts above and below in display style
+func (p *texParser) atom() (string, bool, error) {
+	c := p.peek()
+	switch {
+	case c == '{':
+		node, err := p.argument()
+		return node, false, err
+	case c == '\\':
+		p.pos++
+		return p.control(p.command())
+	case c == '~':
+		p.pos++
+		return `<mspace width="0.25em"></mspace>`, false, nil
+	case c >= '0' && c <= '9' || c == '.' && p.pos+1 < len(p.src) && unicode.IsDigit(p.src[p.pos+1]):
+		start := p.pos
+		for p.pos < len(p.src) && (unicode.IsDigit(p.src[p.pos]) || p.src[p.pos] == '.' && p.pos+1 < len(p.src) && unicode.IsDigit(p.src[p.pos+1])) {
+			p.pos++
+		}
+		return "<mn>" + string(p.src[start:p.pos]) + "</mn>", false, nil
+	case unicode.IsLetter(c):
+		p.pos++
+		return "<mi>" + html.EscapeString(string(c)) + "</mi>", false, nil
+	}
+
+	p.pos++
+	switch c {
+	case '-':
+		return mo("−", ""), false, nil
+	case '*':
+		return mo("∗", ""), false, nil
+	case '(', ')', '[', ']', '|':
+		return mo(string(c), ` stretchy="false"`), false, nil
+	case '#', '$', '%':
+		return "", false, fmt.Errorf("unexpected %c", c)
+	}
+	return mo(string(c), ""), false, nil
+}
+
+// delimiter reads the fence after \left, \middle or \right
+func (p *texParser) delimiter() (string, error) {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		return "", fmt.Errorf("missing delimiter")
+	}
+	c := p.src[p.pos]
+	p.pos++
+	switch {
+	case c == '.':
+		return "", nil
+	case c == '\\':
+		name := p.command()
+		if op, ok := texOperators[name]; ok && (strings.ContainsAny(op, "{}|‖⟨⟩⌊⌋⌈⌉")) {
+			return op, nil
+		}
+		return "", fmt.Errorf("unsupported delimiter \\%s", name)
+	case strings.ContainsRune("()[]|/", c):
+		return string(c), nil
+	}
+	return "", fmt.Errorf("unsupported delimiter %c", c)
+}
+
+// control renders a control sequence
+func (p *texParser) control(name string) (string, bool, error) {
+	if s, ok := texGreek[name]; ok {
+		if unicode.IsUpper([]rune(name)[0]) {
+			return `<mi mathvariant="normal">` + s + "</mi>", false, nil
+		}
+		return "<mi>" + s + "</mi>", false, nil
+	}
+	if s, ok := texIdentifiers[name]; ok {
+		return "<mi>" + s + "</mi>", false, nil
+	}
+	if s, ok := texOperators[name]; ok {
+		attrs := ""
+		if strings.ContainsAny(s, "{}|‖⟨⟩⌊⌋⌈⌉") {
+			attrs = ` stretchy="false"`
+		}
+		return mo(s, attrs), false, nil
+	}
+	if s, ok := texLargeOperators[name]; ok {
+		attrs := ` largeop="true"`
+		if texLimits[name] {
+			attrs += ` movablelimits="true"`
+		}
+		return mo(s, attrs), texLimits[name], nil
+	}
+	if texFunctions[name] {
+		return "<mi>" + name + "</mi>", texLimits[name], nil
+	}
+	if width, ok := texSpaces[name]; ok {
+		return `<mspace width="` + width + `"></mspace>`, false, nil
+	}
+	if accent, ok := texAccents[name]; ok {
+		arg, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		stretchy := ` stretchy="false"`
+		if accent.stretch {
+			stretchy = ` stretchy="true"`
+		}
+		if accent.under {
+			return fmt.Sprintf(`<munder accentunder="true">%s%s</munder>`, arg, mo(accent.mark, stretchy)), false, nil
+		}
+		return fmt.Sprintf(`<mover accent="true">%s%s</mover>`, arg, mo(accent.mark, stretchy)), false, nil
+	}
+	if alphabet, ok := texAlphabets[name]; ok {
+		text, err := p.rawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		var out strings.Builder
+		for _, r := range strings.TrimSpace(text) {
+			switch {
+			case alphabet.holes[r] != 0:
+				out.WriteRune(alphabet.holes[r])
+			case r >= 'A' && r <= 'Z':
+				out.WriteRune(alphabet.upper + r - 'A')
+			case r >= 'a' && r <= 'z' && alphabet.lower != 0:
+				out.WriteRune(alphabet.lower + r - 'a')
+			case r >= '0' && r <= '9' && name == "mathbf":
+				out.WriteRune(0x1D7CE + r - '0')
+			case r == ' ':
+			default:
+				return "", false, fmt.Errorf("unsupported character %q in \\%s", r, name)
+			}
+		}
+		return "<mi>" + out.String() + "</mi>", false, nil
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		den, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		return "<mfrac>" + num + den + "</mfrac>", false, nil
+
+	case "binom":
+		n, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		k, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		return "<mrow>" + mo("(", "") + `<mfrac linethickness="0">` + n + k + "</mfrac>" + mo(")", "") + "</mrow>", false, nil
+
+	case "sqrt":
+		p.skipSpace()
+		index := ""
+		if p.peek() == '[' {
+			end := p.pos
+			for end < len(p.src) && p.src[end] != ']' {
+				end++
+			}
+			if end == len(p.src) {
+				return "", false, fmt.Errorf("unbalanced [")
+			}
+			sub := &texParser{src: p.src[p.pos+1 : end], display: p.display}
+			nodes, stop, err := sub.parseExpr()
+			if err != nil || stop != "" {
+				return "", false, fmt.Errorf("invalid root index")
+			}
+			p.pos = end + 1
+			index = mrow(nodes)
+		}
+		arg, err := p.argument()
+		if err != nil {
+			return "", false, err
+		}
+		if index != "" {
+			return "<mroot>" + arg + index + "</mroot>", false, nil
+		}
+		return "<msqrt>" + arg + "</msqrt>", false, nil
+
+	case "text", "textrm", "textit", "textbf", "mbox", "mathrm", "operatorname":
+		text, err := p.rawGroup()
+		if err != nil {
+			return "", false, err
+		}
+		if strings.ContainsAny(text, `\{}$`) {
+			return "", false, fmt.Errorf("unsupported markup in \\%s", name)
+		}
+		switch name {
+		case "operatorname":
+			return "<mi>" + html.EscapeString(text) + "</mi>", false, nil
+		case "mathrm":
+			return `<mi mathvariant="normal">` + html.EscapeString(strings.TrimSpace(text)) + "</mi>", false, nil
+		}
+		return "<mtext>" + html.EscapeString(text) + "</mtext>", false, nil
+
+	case "left":
+		open, err := p.delimiter()
+		if err != nil {
+			return "", false, err
+		}
+		nodes := []string{mo(open, ` fence="true" stretchy="true"`)}
+		for {
+			inner, stop, err := p.parseExpr()
+			if err != nil {
+				return "", false, err
+			}
+			nodes = append(nodes, inner...)
+			d, err := p.delimiter()
+			if err != nil {
+				return "", false, err
+			}
+			switch stop {
+			case "\\middle":
+				nodes = append(nodes, mo(d, ` stretchy="true"`))
+				continue
+			case "\\right":
+				nodes = append(nodes, mo(d, ` fence="true" stretchy="true"`))
+				return "<mrow>" + strings.Join(nodes, "") + "</mrow>", false, nil
+			}
+			return "", false, fmt.Errorf("\\left without \\right")
+		}
+
+	case "begin":
+		return p.environment()
+
+	case "displaystyle", "textstyle", "limits", "nolimits":
+		// Layout hints MathML works out by itself
+		return "", false, nil
+	}
+	return "", false, fmt.Errorf("unsupported macro \\%s", name)
+}
+
+// environment renders \begin{name}...\end{name} as a table
+func (p *texParser) environment() (string, bool, error) {
+	name, err := p.rawGroup()
+	if err != nil {
+		return "", false, err
+	}
+	fences, ok := texMatrices[name]
+	if !ok {
+		return "", false, fmt.Errorf("unsupported environment %s", name)
+	}
+	if name == "array" {
+		// Column specification
+		if _, err := p.rawGroup(); err != nil {
+			return "", false, err
+		}
+	}
+
+	var rows [][]string
+	var row []string
+	for {
+		nodes, stop, err := p.parseExpr()
+		if err != nil {
+			return "", false, err
+		}
+		row = append(row, mrow(nodes))
+		switch stop {
+		case "&":
+			continue
+		case "\\\\":
+			rows = append(rows, row)
+			row = nil
+			continue
+		case "\\end":
+			end, err := p.rawGroup()
+			if err != nil || end != name {
+				return "", false, fmt.Errorf("\\begin{%s} ended by \\end{%s}", name, end)
+			}
+			if len(row) > 1 || row[0] != "<mrow></mrow>" {
+				rows = append(rows, row)
+			}
+		default:
+			return "", false, fmt.Errorf("unterminated environment %s", name)
+		}
+		break
+	}
+
+	attrs := ""
+	switch name {
+	case "cases":
+		attrs = ` columnalign="left left"`
+	case "aligned", "align", "align*", "split":
+		attrs = ` columnalign="right left right left" displaystyle="true"`
+	}
+	var table strings.Builder
+	table.WriteString("<mtable" + attrs + ">")
+	for _, r := range rows {
+		table.WriteString("<mtr>")
+		for _, cell := range r {
+			table.WriteString("<mtd>" + cell + "</mtd>")
+		}
+		table.WriteString("</mtr>")
+	}
+	table.WriteString("</mtable>")
+	if fences[0] == "" && fences[1] == "" {
+		return table.String(), false, nil
+	}
+	return "<mrow>" + mo(fences[0], ` fence="true" stretchy="true"`) + table.String() + mo(fences[1], ` fence="true" stretchy="true"`) + "</mrow>", false, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ===== Math Rendering Tests =====
+
+func TestTexToMathML(t *testing.T) {
+	tests := []struct {
+		tex     string
+		display bool
+		expect  string
+	}{
+		{`x^2 + 1`, false, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mo>+</mo><mn>1</mn></mrow>`},
+		{`a_{ij} - b`, false, `<mrow><msub><mi>a</mi><mrow><mi>i</mi><mi>j</mi></mrow></msub><mo>−</mo><mi>b</mi></mrow>`},
+		{`\frac{1}{2}`, false, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{`\sqrt[3]{x}`, false, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{`\alpha \leq \Omega`, false, `<mrow><mi>α</mi><mo>≤</mo><mi mathvariant="normal">Ω</mi></mrow>`},
+		{`\sum_{i=1}^n i`, true, `<mrow><munderover><mo largeop="true" movablelimits="true">∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover><mi>i</mi></mrow>`},
+		{`\sum_{i=1}^n i`, false, `<msubsup><mo largeop="true" movablelimits="true">∑</mo>`},
+		{`\int_0^\infty`, true, `<msubsup><mo largeop="true">∫</mo><mn>0</mn><mi>∞</mi></msubsup>`},
+		{`f'(x)`, false, `<msup><mi>f</mi><mo>′</mo></msup><mo stretchy="false">(</mo>`},
+		{`\sin x`, false, `<mrow><mi>sin</mi><mi>x</mi></mrow>`},
+		{`\mathbb{R}^n`, false, `<msup><mi>ℝ</mi><mi>n</mi></msup>`},
+		{`\text{if } x < 0`, false, `<mtext>if </mtext><mi>x</mi><mo>&lt;</mo><mn>0</mn>`},
+		{`\hat{x}`, false, `<mover accent="true"><mi>x</mi><mo stretchy="false">^</mo></mover>`},
+		{`\left( \frac{a}{b} \right)`, false, `<mrow><mo fence="true" stretchy="true">(</mo><mfrac><mi>a</mi><mi>b</mi></mfrac><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{`\begin{pmatrix} 1 & 0 \\ 0 & 1 \end{pmatrix}`, true, `<mtable><mtr><mtd><mn>1</mn></mtd><mtd><mn>0</mn></mtd></mtr><mtr><mtd><mn>0</mn></mtd><mtd><mn>1</mn></mtd></mtr></mtable>`},
+		{`|x| = \begin{cases} x & x \geq 0 \\ -x & x < 0 \end{cases}`, true, `<mo fence="true" stretchy="true">{</mo><mtable columnalign="left left">`},
+		{`3.14`, false, `<mn>3.14</mn>`},
+	}
+	for _, tt := range tests {
+		got, err := texToMathML(tt.tex, tt.display)
+		if err != nil {
+			t.Errorf("%s: %v", tt.tex, err)
+			continue
+		}
+		if !strings.Contains(got, tt.expect) {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.tex, got, tt.expect)
+		}
+		if !strings.Contains(got, `<annotation encoding="application/x-tex">`) {
+			t.Errorf("%s: the TeX source should be kept as annotation", tt.tex)
+		}
+	}
+}
+
+func TestTexToMathMLUnsupported(t *testing.T) {
+	for _, tex := range []string{`\foo{x}`, `x^2^3`, `\frac{1}`, `{x`, `\left( x`, `\begin{tikzpicture}\end{tikzpicture}`, `\mathbb{\alpha}`} {
+		if _, err := texToMathML(tex, false); err == nil {
+			t.Errorf("%s should not convert", tex)
+		}
+	}
+}
+
+func TestRenderMarkdownMathML(t *testing.T) {
+	result := renderMarkdown("Euler: $e^{i\\pi} + 1 = 0$ and $\\unknownmacro{x}$ *done*\n\n$$\n\\frac{a*b*c}{2}\n$$\n", "")
+	for _, want := range []string{
+		`<span class="math-inline"><math><semantics><mrow><msup><mi>e</mi>`,
+		`<span class="math-inline">$\unknownmacro{x}$</span>`,
+		`<em>done</em>`,
+		`<div class="math-block"><math display="block">`,
+		`<mi>a</mi><mo>∗</mo><mi>b</mi>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("missing %q in %s", want, result)
+		}
+	}
+}
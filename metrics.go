@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metrics served by /metrics in the Prometheus text format
+var (
+	requestsTotal       = newCounterVec("file_viewer_requests_total", "HTTP requests served, by route, method and status code.", "route", "method", "code")
+	requestDuration     = newHistogramVec("file_viewer_request_duration_seconds", "Time to serve HTTP requests, by route.", latencyBuckets, "route")
+	responseBytes       = newCounterVec("file_viewer_response_bytes_total", "Bytes of response bodies, by route.", "route")
+	rendersTotal        = newCounterVec("file_viewer_renders_total", "Files rendered into pages, by content type.", "type")
+	renderErrors        = newCounterVec("file_viewer_render_errors_total", "Files that could not be read for rendering.")
+	renderDuration      = newHistogramVec("file_viewer_render_duration_seconds", "Time to render files, by content type.", latencyBuckets, "type")
+	renderCacheRequests = newCounterVec("file_viewer_render_cache_total", "Pages and previews served from the render cache (hit) or rendered (miss).", "result")
+	cdnRequests         = newCounterVec("file_viewer_cdn_requests_total", "CDN resources requested: hit (local cache), miss (downloaded) or error.", "result")
+	watcherEvents       = newCounterVec("file_viewer_watcher_events_total", "Events sent to the followers of log files, by event.", "event")
+	startTime           = time.Now()
+)
+
+// Upper bounds of the latency histograms, in seconds
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// metric is a metric family written by /metrics
+type metric interface {
+	write(w io.Writer)
+}
+
+// metricRegistry holds the metrics in the order they were created
+var metricRegistry []metric
+
+// counterVec is a counter with one series per set of label values
+type counterVec struct {
+	name, help string
+	labels     []string
+	mu         sync.Mutex
+	values     map[string]float64 // By label values joined with \xff
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	c := &counterVec{name: name, help: help, labels: labels, values: map[string]float64{}}
+	metricRegistry = append(metricRegistry, c)
+	return c
+}
+
+func (c *counterVec) inc(values ...string) {
+	c.add(1, values...)
+}
+
+func (c *counterVec) add(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	c.mu.Lock()
+	c.values[key] += v
+	c.mu.Unlock()
+}
+
+// value returns the count of a series
+func (c *counterVec) value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(values, "\xff")]
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, labelPairs(c.labels, key, ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec is a histogram with one series per set of label values
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // Per bucket, not cumulative
+	sum    float64
+	count  uint64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	h := &histogramVec{name: name, help: help, labels: labels, buckets: buckets, series: map[string]*histogram{}}
+	metricRegistry = append(metricRegistry, h)
+	return h
+}
+
+func (h *histogramVec) observe(v float64, values ...string) {
+	key := strings.Join(values, "\xff")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogram{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, key, formatFloat(bound)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, labelPairs(h.labels, key, "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, labelPairs(h.labels, key, ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, labelPairs(h.labels, key, ""), s.count)
+	}
+}
+
+// labelPairs formats the labels of a series, with an le label for
+// histogram buckets
+func labelPairs(names []string, key, le string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, v := range strings.Split(key, "\xff") {
+			pairs = append(pairs, names[i]+`="`+escapeLabel(v)+`"`)
+		}
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// handleMetrics serves /metrics
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, m := range metricRegistry {
+		m.write(w)
+	}
+	fmt.Fprintf(w, "# HELP file_viewer_start_time_seconds Start time of the server since the Unix epoch.\n# TYPE file_viewer_start_time_seconds gauge\nfile_viewer_start_time_seconds %d\n", startTime.Unix())
+}
+
+// methodLabel maps a request method to a bounded label: the methods the
+// router serves, other for anything a client may send
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// routeLabel maps a request path to a bounded route label: an API route,
+// /cdn/, /metrics, /healthz, or page for the files themselves
+func routeLabel(p string) string {
+	switch {
+	case apiRoute(p) != "":
+		return apiRoute(p)
+	case strings.HasPrefix(p, "/cdn/"):
+		return "/cdn/"
+	case p == "/metrics" || p == "/healthz":
+		return p
+	}
+	return "page"
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== Logging and Metrics Tests =====
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, "warn", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "n", 1)
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["msg"] != "shown" || entry["n"] != 1.0 {
+		t.Errorf("log = %s (%v)", buf.String(), err)
+	}
+
+	for _, tt := range [][2]string{{"loud", "text"}, {"info", "xml"}} {
+		if _, err := newLogger(&buf, tt[0], tt[1]); err == nil {
+			t.Errorf("level %s, format %s should be refused", tt[0], tt[1])
+		}
+	}
+}
+
+// captureLogs sends the default logger to a buffer of JSON lines
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	saved := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(saved) })
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	return &buf
+}
+
+func TestLogRequests(t *testing.T) {
+	dir := writeTree(t, map[string]string{"doc.md": "# Doc\n"})
+	logs := captureLogs(t, slog.LevelInfo)
+	server := logRequests(newRouter())
+
+	pagesBefore := requestsTotal.value("page", "GET", "200")
+	missingBefore := requestsTotal.value("page", "GET", "404")
+	rendersBefore := rendersTotal.value("markdown")
+	errorsBefore := renderErrors.value()
+
+	for _, target := range []string{filepath.Join(dir, "doc.md") + "?token=s3cret", "/mtime" + filepath.Join(dir, "doc.md"), filepath.Join(dir, "missing.md")} {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+	}
+
+	lines := strings.Split(strings.TrimSpace(logs.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 log lines, live reload polls at debug level only:\n%s", logs)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["msg"] != "request" || entry["status"] != 200.0 || entry["render_type"] != "markdown" || entry["bytes"].(float64) == 0 {
+		t.Errorf("log = %s", lines[0])
+	}
+	if url := entry["url"].(string); strings.Contains(url, "s3cret") || !strings.Contains(url, "token=REDACTED") {
+		t.Errorf("the token should be redacted: %s", url)
+	}
+
+	if requestsTotal.value("page", "GET", "200")-pagesBefore != 1 || requestsTotal.value("page", "GET", "404")-missingBefore != 1 {
+		t.Error("page requests should be counted by status code")
+	}
+	if rendersTotal.value("markdown")-rendersBefore != 1 || renderErrors.value()-errorsBefore != 1 {
+		t.Error("renders and render errors should be counted")
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	c := newCounterVec("test_events_total", "Test events.", "kind")
+	h := newHistogramVec("test_duration_seconds", "Test durations.", []float64{0.1, 1}, "kind")
+	c.inc(`a"b`)
+	c.add(2, "plain")
+	h.observe(0.05, "x")
+	h.observe(0.5, "x")
+	h.observe(3, "x")
+	cdnRequests.inc("hit")
+
+	rec := httptest.NewRecorder()
+	handleMetrics(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE test_events_total counter\n",
+		`test_events_total{kind="a\"b"} 1`,
+		`test_events_total{kind="plain"} 2`,
+		"# TYPE test_duration_seconds histogram\n",
+		`test_duration_seconds_bucket{kind="x",le="0.1"} 1`,
+		`test_duration_seconds_bucket{kind="x",le="1"} 2`,
+		`test_duration_seconds_bucket{kind="x",le="+Inf"} 3`,
+		`test_duration_seconds_sum{kind="x"} 3.55`,
+		`test_duration_seconds_count{kind="x"} 3`,
+		`file_viewer_cdn_requests_total{result="hit"}`,
+		"# TYPE file_viewer_watcher_events_total counter\n",
+		"file_viewer_start_time_seconds ",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q", want)
+		}
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %s", ct)
+	}
+}
+
+func TestRouteLabel(t *testing.T) {
+	for p, want := range map[string]string{
+		"/files":                  "/files",
+		"/mtime/home/me/a.md":     "/mtime/",
+		"/cdn/cdn.jsdelivr.net/x": "/cdn/",
+		"/metrics":                "/metrics",
+		"/home/me/notes.md":       "page",
+		"/":                       "page",
+	} {
+		if got := routeLabel(p); got != want {
+			t.Errorf("routeLabel(%s) = %s, want %s", p, got, want)
+		}
+	}
+}
+
+func TestMethodLabel(t *testing.T) {
+	for method, want := range map[string]string{
+		"GET":      "GET",
+		"HEAD":     "HEAD",
+		"OPTIONS":  "OPTIONS",
+		"POST":     "other",
+		"get":      "other",
+		"XYZZY123": "other",
+	} {
+		if got := methodLabel(method); got != want {
+			t.Errorf("methodLabel(%s) = %s, want %s", method, got, want)
+		}
+	}
+}
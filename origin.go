@@ -0,0 +1,163 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// defaultListen is the address served without a listen setting: loopback
+// only, so other machines cannot read local files
+var defaultListen = "127.0.0.1:" + strconv.Itoa(PORT)
+
+// listenAddr returns the address the server binds
+func (c *Config) listenAddr() string {
+	if c.Listen != "" {
+		return c.Listen
+	}
+	return defaultListen
+}
+
+// serverURL returns the URL printed for a listen address: localhost for
+// loopback and wildcard addresses
+func serverURL(addr string, secure bool) string {
+	scheme := "http://"
+	if secure {
+		scheme = "https://"
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return scheme + addr
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && (ip.IsLoopback() || ip.IsUnspecified()) {
+		host = "localhost"
+	}
+	return scheme + net.JoinHostPort(host, port)
+}
+
+// isLoopbackAddr reports whether a listen address only accepts local
+// connections
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiRoutes are the endpoints returning file data to scripts. Pages are
+// left open to links from anywhere: other sites cannot read them.
+var apiRoutes = []string{
+	"/asset", "/files", "/chunk", "/search", "/query", "/convert", "/export",
+	"/graph", "/links/check", "/jsonl", "/tail", "/mtime/", "/preview/",
+}
+
+// apiRoute returns the API route of a path, "" for other paths
+func apiRoute(p string) string {
+	for _, route := range apiRoutes {
+		if p == route || strings.HasSuffix(route, "/") && strings.HasPrefix(p, route) {
+			return route
+		}
+	}
+	return ""
+}
+
+func isAPIPath(p string) bool {
+	return apiRoute(p) != ""
+}
+
+// allowedHost reports whether a Host header names this server: localhost,
+// an IP address, the host of the listen address or one of allowedHosts.
+// Any other name may be a website rebound to 127.0.0.1.
+func allowedHost(hostport string) bool {
+	host := hostport
+	if h, _, err := net.SplitHostPort(hostport); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(strings.Trim(host, "[]")), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") || net.ParseIP(host) != nil {
+		return true
+	}
+	names := appConfig.AllowedHosts
+	if listenHost, _, err := net.SplitHostPort(appConfig.listenAddr()); err == nil {
+		names = append([]string{listenHost}, names...)
+	}
+	for _, name := range names {
+		if host == strings.TrimSuffix(strings.ToLower(name), ".") {
+			return true
+		}
+	}
+	return false
+}
+
+// corsAllowed reports whether the cors setting lets an origin read the API
+func corsAllowed(origin string) bool {
+	if appConfig.CORS == nil {
+		return false
+	}
+	for _, o := range appConfig.CORS.Origins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameOrigin reports whether an Origin header is the server itself
+func sameOrigin(r *http.Request, origin string) bool {
+	scheme := "http://"
+	if r.TLS != nil {
+		scheme = "https://"
+	}
+	return strings.EqualFold(origin, scheme+r.Host)
+}
+
+// crossOrigin reports whether a request comes from a page of another
+// origin: by its Origin header, or by Sec-Fetch-Site for the requests
+// browsers send without one (images, scripts, navigations)
+func crossOrigin(r *http.Request, origin string) bool {
+	if origin != "" {
+		return !sameOrigin(r, origin)
+	}
+	site := r.Header.Get("Sec-Fetch-Site")
+	return site == "cross-site" || site == "same-site"
+}
+
+// guardRequests refuses requests for an unknown Host and API requests from
+// other origins, unless the cors setting allows them, and answers CORS
+// preflights
+func guardRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHost(r.Host) {
+			writeError(w, r, http.StatusForbidden, "Host not allowed; add it to allowedHosts in the config file")
+			return
+		}
+
+		origin := r.Header.Get("Origin")
+		cors := origin != "" && !sameOrigin(r, origin) && corsAllowed(origin)
+		if cors {
+			h := w.Header()
+			h.Set("Access-Control-Allow-Origin", origin)
+			h.Add("Vary", "Origin")
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				h.Set("Access-Control-Allow-Methods", "GET, HEAD")
+				h.Set("Access-Control-Allow-Headers", "Content-Type")
+				h.Set("Access-Control-Max-Age", "600")
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+		}
+
+		if !cors && isAPIPath(path.Clean(r.URL.Path)) && crossOrigin(r, origin) {
+			writeError(w, r, http.StatusForbidden, "Cross-origin request refused")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
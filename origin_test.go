@@ -0,0 +1,101 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ===== Host and Origin Tests =====
+
+func TestAllowedHost(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{AllowedHosts: []string{"Notes.Example.com"}}
+
+	for host, want := range map[string]bool{
+		"localhost:4120":          true,
+		"LOCALHOST.":              true,
+		"app.localhost:4120":      true,
+		"127.0.0.1:4120":          true,
+		"[::1]:4120":              true,
+		"192.168.1.20:4120":       true,
+		"notes.example.com:4120":  true,
+		"127.0.0.1":               true,
+		"evil.example.com:4120":   false,
+		"localhost.evil.com:4120": false,
+		"":                        false,
+	} {
+		if got := allowedHost(host); got != want {
+			t.Errorf("allowedHost(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	appConfig = &Config{Listen: "devbox:4120"}
+	if !allowedHost("devbox:4120") {
+		t.Error("the host of the listen address should be allowed")
+	}
+}
+
+func TestGuardRequests(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{CORS: &CORSConfig{Origins: []string{"http://localhost:3000/"}}}
+
+	server := guardRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name, method, target, host string
+		headers                    map[string]string
+		status                     int
+		allowOrigin                string
+	}{
+		{"page", "GET", "/tmp/a.md", "localhost:4120", nil, 200, ""},
+		{"rebound host", "GET", "/files?dir=/", "attacker.example:4120", nil, 403, ""},
+		{"rebound page", "GET", "/etc/passwd", "attacker.example:4120", nil, 403, ""},
+		{"same origin", "GET", "/files?dir=/", "localhost:4120", map[string]string{"Origin": "http://localhost:4120", "Sec-Fetch-Site": "same-origin"}, 200, ""},
+		{"curl", "GET", "/files?dir=/", "127.0.0.1:4120", nil, 200, ""},
+		{"typed URL", "GET", "/asset?path=/a.png", "localhost:4120", map[string]string{"Sec-Fetch-Site": "none"}, 200, ""},
+		{"cross-site fetch", "GET", "/files?dir=/", "localhost:4120", map[string]string{"Origin": "https://evil.example"}, 403, ""},
+		{"cross-site image", "GET", "/asset?path=/a.png", "localhost:4120", map[string]string{"Sec-Fetch-Site": "cross-site"}, 403, ""},
+		{"other port", "GET", "/mtime/tmp/a.md", "localhost:4120", map[string]string{"Sec-Fetch-Site": "same-site"}, 403, ""},
+		{"cross-site link to page", "GET", "/tmp/a.md", "localhost:4120", map[string]string{"Sec-Fetch-Site": "cross-site"}, 200, ""},
+		{"sandboxed origin", "GET", "/search?path=/a", "localhost:4120", map[string]string{"Origin": "null"}, 403, ""},
+		{"CORS origin", "GET", "/files?dir=/", "localhost:4120", map[string]string{"Origin": "http://localhost:3000"}, 200, "http://localhost:3000"},
+		{"CORS preflight", "OPTIONS", "/files?dir=/", "localhost:4120", map[string]string{"Origin": "http://localhost:3000", "Access-Control-Request-Method": "GET"}, 204, "http://localhost:3000"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.target, nil)
+		req.Host = tt.host
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.allowOrigin {
+			t.Errorf("%s: Access-Control-Allow-Origin = %q, want %q", tt.name, got, tt.allowOrigin)
+		}
+	}
+}
+
+func TestServerURL(t *testing.T) {
+	for addr, want := range map[string]string{
+		"127.0.0.1:4120":   "http://localhost:4120",
+		"0.0.0.0:8080":     "http://localhost:8080",
+		":4120":            "http://localhost:4120",
+		"192.168.1.2:4120": "http://192.168.1.2:4120",
+		"[::1]:4120":       "http://localhost:4120",
+	} {
+		if got := serverURL(addr, false); got != want {
+			t.Errorf("serverURL(%q) = %s, want %s", addr, got, want)
+		}
+	}
+	if got := serverURL("devbox:4120", true); got != "https://devbox:4120" {
+		t.Errorf("serverURL with TLS = %s", got)
+	}
+	if !isLoopbackAddr(defaultListen) || isLoopbackAddr("0.0.0.0:4120") || isLoopbackAddr(":4120") {
+		t.Error("only loopback addresses are local")
+	}
+}
@@ -0,0 +1,1362 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of nodes returned by /query
+const maxQueryResults = 1000
+
+// queryNode is a value reached by a query and where it lives in the document;
+// computed values (length, keys...) have no path
+type queryNode struct {
+	path    []interface{} // string keys and int indices from the root
+	hasPath bool
+	value   interface{}
+}
+
+func rootNode(doc interface{}) queryNode {
+	return queryNode{path: []interface{}{}, hasPath: true, value: doc}
+}
+
+func valueNode(v interface{}) queryNode {
+	return queryNode{value: v}
+}
+
+// child returns the node for a key or index below n
+func (n queryNode) child(step interface{}, v interface{}) queryNode {
+	c := queryNode{value: v, hasPath: n.hasPath}
+	if n.hasPath {
+		c.path = append(append([]interface{}{}, n.path...), step)
+	}
+	return c
+}
+
+// children returns the direct children of a node, object keys in sorted order
+func (n queryNode) children() []queryNode {
+	var out []queryNode
+	switch v := n.value.(type) {
+	case map[string]interface{}:
+		for _, k := range sortedKeys(v) {
+			out = append(out, n.child(k, v[k]))
+		}
+	case []interface{}:
+		for i, item := range v {
+			out = append(out, n.child(i, item))
+		}
+	}
+	return out
+}
+
+// descendants returns the node and all nodes below it, in document order
+func (n queryNode) descendants() []queryNode {
+	out := []queryNode{n}
+	for _, c := range n.children() {
+		out = append(out, c.descendants()...)
+	}
+	return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// formatJSONPath formats a node path as a normalized JSONPath: $.a['b c'][0]
+func formatJSONPath(path []interface{}) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, step := range path {
+		switch s := step.(type) {
+		case int:
+			sb.WriteString(fmt.Sprintf("[%d]", s))
+		case string:
+			if identifierRe.MatchString(s) {
+				sb.WriteString("." + s)
+			} else {
+				sb.WriteString("['" + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `'`, `\'`) + "']")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// formatJQPath formats a node path as a jq path: .a["b c"][0]
+func formatJQPath(path []interface{}) string {
+	if len(path) == 0 {
+		return "."
+	}
+	var sb strings.Builder
+	for _, step := range path {
+		switch s := step.(type) {
+		case int:
+			if sb.Len() == 0 {
+				sb.WriteString(".")
+			}
+			sb.WriteString(fmt.Sprintf("[%d]", s))
+		case string:
+			if identifierRe.MatchString(s) {
+				sb.WriteString("." + s)
+			} else {
+				if sb.Len() == 0 {
+					sb.WriteString(".")
+				}
+				sb.WriteString("[" + strconv.Quote(s) + "]")
+			}
+		}
+	}
+	return sb.String()
+}
+
+// ===== Expression scanner shared by the JSONPath and jq parsers =====
+
+type queryScanner struct {
+	s   string
+	pos int
+}
+
+func (p *queryScanner) skipSpace() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n' || p.s[p.pos] == '\r') {
+		p.pos++
+	}
+}
+
+func (p *queryScanner) peek(prefix string) bool {
+	p.skipSpace()
+	return strings.HasPrefix(p.s[p.pos:], prefix)
+}
+
+func (p *queryScanner) accept(prefix string) bool {
+	if p.peek(prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+// acceptWord accepts a keyword not followed by an identifier character
+func (p *queryScanner) acceptWord(word string) bool {
+	if !p.peek(word) {
+		return false
+	}
+	end := p.pos + len(word)
+	if end < len(p.s) && isIdentChar(p.s[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *queryScanner) expect(prefix string) error {
+	if !p.accept(prefix) {
+		return p.errorf("expected %q", prefix)
+	}
+	return nil
+}
+
+func (p *queryScanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos+1)
+}
+
+func (p *queryScanner) eof() bool {
+	p.skipSpace()
+	return p.pos >= len(p.s)
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func (p *queryScanner) identifier() string {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.s) && isIdentChar(p.s[p.pos]) && !(p.pos == start && (p.s[p.pos] == '-' || p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// stringLiteral reads a single or double quoted string
+func (p *queryScanner) stringLiteral() (string, bool, error) {
+	p.skipSpace()
+	if p.pos >= len(p.s) || (p.s[p.pos] != '"' && p.s[p.pos] != '\'') {
+		return "", false, nil
+	}
+	quote := p.s[p.pos]
+	var sb strings.Builder
+	for i := p.pos + 1; i < len(p.s); i++ {
+		c := p.s[i]
+		switch {
+		case c == '\\' && i+1 < len(p.s):
+			i++
+			switch p.s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			default:
+				sb.WriteByte(p.s[i])
+			}
+		case c == quote:
+			p.pos = i + 1
+			return sb.String(), true, nil
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", false, p.errorf("unterminated string")
+}
+
+var numberRe = regexp.MustCompile(`^-?\d+(\.\d+)?([eE][+-]?\d+)?`)
+
+func (p *queryScanner) number() (float64, bool) {
+	p.skipSpace()
+	m := numberRe.FindString(p.s[p.pos:])
+	if m == "" {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(m, 64)
+	if err != nil {
+		return 0, false
+	}
+	p.pos += len(m)
+	return n, true
+}
+
+// literal reads a number, string, true, false or null
+func (p *queryScanner) literal() (interface{}, bool, error) {
+	if s, ok, err := p.stringLiteral(); ok || err != nil {
+		return s, ok, err
+	}
+	if n, ok := p.number(); ok {
+		return n, true, nil
+	}
+	for word, v := range map[string]interface{}{"true": true, "false": false, "null": nil} {
+		if p.acceptWord(word) {
+			return v, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// ===== Comparisons =====
+
+func compareValues(op string, a, b interface{}) bool {
+	switch op {
+	case "==":
+		return reflect.DeepEqual(a, b)
+	case "!=":
+		return !reflect.DeepEqual(a, b)
+	}
+	var c int
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return false
+		}
+		c = compareFloat(x, y)
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(x, y)
+	default:
+		return false
+	}
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+var comparisonOps = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+func (p *queryScanner) comparisonOp() string {
+	for _, op := range comparisonOps {
+		if p.accept(op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// ===== JSONPath =====
+
+// jsonPathSegment is one step of a JSONPath: .name, [selectors] or ..[selectors]
+type jsonPathSegment struct {
+	recursive bool
+	selectors []jsonPathSelector
+}
+
+type jsonPathSelector struct {
+	kind   string // name, index, wildcard, slice or filter
+	name   string
+	index  int
+	slice  [3]*int
+	filter jsonPathExpr
+}
+
+// jsonPathExpr is a filter expression evaluated against the current node (@) and the root ($)
+type jsonPathExpr func(current, root queryNode) bool
+
+type jsonPathParser struct {
+	queryScanner
+}
+
+// compileJSONPath parses a JSONPath query (RFC 9535 subset)
+func compileJSONPath(query string) ([]jsonPathSegment, error) {
+	p := &jsonPathParser{queryScanner{s: query}}
+	if !p.accept("$") {
+		return nil, p.errorf("JSONPath must start with $")
+	}
+	segments, err := p.segments()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return segments, nil
+}
+
+func (p *jsonPathParser) segments() ([]jsonPathSegment, error) {
+	var segments []jsonPathSegment
+	for {
+		p.skipSpace()
+		switch {
+		case p.accept(".."):
+			seg := jsonPathSegment{recursive: true}
+			if p.peek("[") {
+				sels, err := p.bracket()
+				if err != nil {
+					return nil, err
+				}
+				seg.selectors = sels
+			} else if p.accept("*") {
+				seg.selectors = []jsonPathSelector{{kind: "wildcard"}}
+			} else if name := p.identifier(); name != "" {
+				seg.selectors = []jsonPathSelector{{kind: "name", name: name}}
+			} else {
+				return nil, p.errorf("expected name after ..")
+			}
+			segments = append(segments, seg)
+		case p.accept("."):
+			if p.accept("*") {
+				segments = append(segments, jsonPathSegment{selectors: []jsonPathSelector{{kind: "wildcard"}}})
+			} else if name := p.identifier(); name != "" {
+				segments = append(segments, jsonPathSegment{selectors: []jsonPathSelector{{kind: "name", name: name}}})
+			} else {
+				return nil, p.errorf("expected name after .")
+			}
+		case p.peek("["):
+			sels, err := p.bracket()
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, jsonPathSegment{selectors: sels})
+		default:
+			return segments, nil
+		}
+	}
+}
+
+// bracket parses [sel, sel...]
+func (p *jsonPathParser) bracket() ([]jsonPathSelector, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	var sels []jsonPathSelector
+	for {
+		sel, err := p.selector()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+		if p.accept("]") {
+			return sels, nil
+		}
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *jsonPathParser) selector() (jsonPathSelector, error) {
+	if p.accept("*") {
+		return jsonPathSelector{kind: "wildcard"}, nil
+	}
+	if p.accept("?") {
+		expr, err := p.orExpr()
+		if err != nil {
+			return jsonPathSelector{}, err
+		}
+		return jsonPathSelector{kind: "filter", filter: expr}, nil
+	}
+	if s, ok, err := p.stringLiteral(); err != nil {
+		return jsonPathSelector{}, err
+	} else if ok {
+		return jsonPathSelector{kind: "name", name: s}, nil
+	}
+
+	// Index or slice
+	var parts [3]*int
+	part := 0
+	for {
+		if n, ok := p.number(); ok {
+			i := int(n)
+			parts[part] = &i
+		}
+		if part < 2 && p.accept(":") {
+			part++
+			continue
+		}
+		break
+	}
+	if part == 0 {
+		if parts[0] == nil {
+			return jsonPathSelector{}, p.errorf("invalid selector")
+		}
+		return jsonPathSelector{kind: "index", index: *parts[0]}, nil
+	}
+	return jsonPathSelector{kind: "slice", slice: parts}, nil
+}
+
+// Filter expressions: ||, &&, !, parentheses, comparisons and existence tests
+
+func (p *jsonPathParser) orExpr() (jsonPathExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c, r queryNode) bool { return l(c, r) || right(c, r) }
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) andExpr() (jsonPathExpr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(c, r queryNode) bool { return l(c, r) && right(c, r) }
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) unaryExpr() (jsonPathExpr, error) {
+	if p.accept("!") {
+		inner, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return func(c, r queryNode) bool { return !inner(c, r) }, nil
+	}
+	if p.accept("(") {
+		inner, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		return inner, p.expect(")")
+	}
+
+	left, leftIsPath, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.comparisonOp()
+	if op == "" {
+		if !leftIsPath {
+			return nil, p.errorf("expected comparison")
+		}
+		return func(c, r queryNode) bool { return len(left(c, r)) > 0 }, nil
+	}
+	right, _, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	return func(c, r queryNode) bool {
+		a, b := left(c, r), right(c, r)
+		// Comparisons only apply to single values
+		if len(a) != 1 || len(b) != 1 {
+			return op == "!=" && len(a) != len(b)
+		}
+		return compareValues(op, a[0], b[0])
+	}, nil
+}
+
+// operand returns a function producing the operand's values, and whether it is a path
+func (p *jsonPathParser) operand() (func(c, r queryNode) []interface{}, bool, error) {
+	for _, start := range []string{"@", "$"} {
+		if p.accept(start) {
+			segments, err := p.segments()
+			if err != nil {
+				return nil, false, err
+			}
+			fromRoot := start == "$"
+			return func(c, r queryNode) []interface{} {
+				from := c
+				if fromRoot {
+					from = r
+				}
+				var values []interface{}
+				for _, n := range evalJSONPath(segments, []queryNode{from}, r) {
+					values = append(values, n.value)
+				}
+				return values
+			}, true, nil
+		}
+	}
+	v, ok, err := p.literal()
+	if err != nil {
+		return nil, false, err
+	}
+	if !ok {
+		return nil, false, p.errorf("expected @, $ or a literal")
+	}
+	return func(c, r queryNode) []interface{} { return []interface{}{v} }, false, nil
+}
+
+// evalJSONPath applies segments to a list of nodes
+func evalJSONPath(segments []jsonPathSegment, nodes []queryNode, root queryNode) []queryNode {
+	for _, seg := range segments {
+		var next []queryNode
+		for _, n := range nodes {
+			candidates := []queryNode{n}
+			if seg.recursive {
+				candidates = n.descendants()
+			}
+			for _, c := range candidates {
+				for _, sel := range seg.selectors {
+					next = append(next, applySelector(sel, c, root)...)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func applySelector(sel jsonPathSelector, n queryNode, root queryNode) []queryNode {
+	switch sel.kind {
+	case "name":
+		if obj, ok := n.value.(map[string]interface{}); ok {
+			if v, ok := obj[sel.name]; ok {
+				return []queryNode{n.child(sel.name, v)}
+			}
+		}
+	case "wildcard":
+		return n.children()
+	case "index":
+		if arr, ok := n.value.([]interface{}); ok {
+			i := sel.index
+			if i < 0 {
+				i += len(arr)
+			}
+			if i >= 0 && i < len(arr) {
+				return []queryNode{n.child(i, arr[i])}
+			}
+		}
+	case "slice":
+		if arr, ok := n.value.([]interface{}); ok {
+			var out []queryNode
+			for _, i := range sliceIndices(len(arr), sel.slice) {
+				out = append(out, n.child(i, arr[i]))
+			}
+			return out
+		}
+	case "filter":
+		var out []queryNode
+		for _, c := range n.children() {
+			if sel.filter(c, root) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// sliceIndices resolves [start:end:step] against an array length, Python style
+func sliceIndices(length int, parts [3]*int) []int {
+	step := 1
+	if parts[2] != nil {
+		step = *parts[2]
+	}
+	if step == 0 {
+		return nil
+	}
+	norm := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += length
+		}
+		return i
+	}
+	var out []int
+	if step > 0 {
+		start, end := max(norm(parts[0], 0), 0), min(norm(parts[1], length), length)
+		for i := start; i < end; i += step {
+			out = append(out, i)
+		}
+	} else {
+		start, end := min(norm(parts[0], length-1), length-1), max(norm(parts[1], -1), -1)
+		if parts[1] == nil {
+			end = -1
+		}
+		for i := start; i > end; i += step {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// ===== jq =====
+
+// jqFilter maps one input node to its outputs
+type jqFilter func(in queryNode) ([]queryNode, error)
+
+type jqParser struct {
+	queryScanner
+}
+
+// compileJQ parses a jq program (subset: paths, .[], .., |, ",", select, map,
+// keys, length, type, not, first, last, has, comparisons, and/or, [...])
+func compileJQ(query string) (jqFilter, error) {
+	p := &jqParser{queryScanner{s: query}}
+	f, err := p.pipe()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.errorf("unexpected %q", p.s[p.pos:])
+	}
+	return f, nil
+}
+
+func (p *jqParser) pipe() (jqFilter, error) {
+	left, err := p.comma()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("|") {
+		right, err := p.comma()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(in queryNode) ([]queryNode, error) {
+			mid, err := l(in)
+			if err != nil {
+				return nil, err
+			}
+			var out []queryNode
+			for _, m := range mid {
+				res, err := right(m)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, res...)
+			}
+			return out, nil
+		}
+	}
+	return left, nil
+}
+
+func (p *jqParser) comma() (jqFilter, error) {
+	left, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept(",") {
+		right, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(in queryNode) ([]queryNode, error) {
+			a, err := l(in)
+			if err != nil {
+				return nil, err
+			}
+			b, err := right(in)
+			return append(a, b...), err
+		}
+	}
+	return left, nil
+}
+
+func (p *jqParser) or() (jqFilter, error) {
+	return p.logical("or", p.and, func(a, b bool) bool { return a || b })
+}
+
+func (p *jqParser) and() (jqFilter, error) {
+	return p.logical("and", p.comparison, func(a, b bool) bool { return a && b })
+}
+
+func (p *jqParser) logical(word string, next func() (jqFilter, error), combine func(a, b bool) bool) (jqFilter, error) {
+	left, err := next()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptWord(word) {
+		right, err := next()
+		if err != nil {
+			return nil, err
+		}
+		left = jqBinary(left, right, func(a, b interface{}) interface{} { return combine(jqTruthy(a), jqTruthy(b)) })
+	}
+	return left, nil
+}
+
+func (p *jqParser) comparison() (jqFilter, error) {
+	left, err := p.postfix()
+	if err != nil {
+		return nil, err
+	}
+	if op := p.comparisonOp(); op != "" {
+		right, err := p.postfix()
+		if err != nil {
+			return nil, err
+		}
+		return jqBinary(left, right, func(a, b interface{}) interface{} { return compareValues(op, a, b) }), nil
+	}
+	return left, nil
+}
+
+// jqBinary combines every output of left with every output of right
+func jqBinary(left, right jqFilter, op func(a, b interface{}) interface{}) jqFilter {
+	return func(in queryNode) ([]queryNode, error) {
+		a, err := left(in)
+		if err != nil {
+			return nil, err
+		}
+		b, err := right(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []queryNode
+		for _, x := range a {
+			for _, y := range b {
+				out = append(out, valueNode(op(x.value, y.value)))
+			}
+		}
+		return out, nil
+	}
+}
+
+func jqTruthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+// postfix parses a primary term followed by .name, [..] and ? suffixes
+func (p *jqParser) postfix() (jqFilter, error) {
+	f, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		var step jqFilter
+		switch {
+		case p.peek(".."):
+			return f, nil
+		case p.accept(".["):
+			p.pos--
+			step, err = p.bracketStep()
+		case p.peek("."):
+			p.accept(".")
+			step, err = p.fieldStep()
+		case p.peek("["):
+			step, err = p.bracketStep()
+		case p.accept("?"):
+			// Errors of the term so far are suppressed
+			try := f
+			f = func(in queryNode) ([]queryNode, error) {
+				out, err := try(in)
+				if err != nil {
+					return nil, nil
+				}
+				return out, nil
+			}
+			continue
+		default:
+			return f, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		f = jqChain(f, step)
+	}
+}
+
+func jqChain(first, second jqFilter) jqFilter {
+	return func(in queryNode) ([]queryNode, error) {
+		mid, err := first(in)
+		if err != nil {
+			return nil, err
+		}
+		var out []queryNode
+		for _, m := range mid {
+			res, err := second(m)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, res...)
+		}
+		return out, nil
+	}
+}
+
+func identity(in queryNode) ([]queryNode, error) {
+	return []queryNode{in}, nil
+}
+
+func (p *jqParser) primary() (jqFilter, error) {
+	switch {
+	case p.accept(".."):
+		return func(in queryNode) ([]queryNode, error) { return in.descendants(), nil }, nil
+	case p.accept("."):
+		if p.peek("[") {
+			return p.bracketStep()
+		}
+		if p.peek("\"") {
+			return p.fieldStep()
+		}
+		p.skipSpace()
+		if p.pos < len(p.s) && isIdentChar(p.s[p.pos]) {
+			return p.fieldStep()
+		}
+		return identity, nil
+	case p.accept("("):
+		f, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		return f, p.expect(")")
+	case p.accept("["):
+		// Array construction
+		if p.accept("]") {
+			return func(in queryNode) ([]queryNode, error) { return []queryNode{valueNode([]interface{}{})}, nil }, nil
+		}
+		inner, err := p.pipe()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(in queryNode) ([]queryNode, error) {
+			res, err := inner(in)
+			if err != nil {
+				return nil, err
+			}
+			arr := make([]interface{}, len(res))
+			for i, r := range res {
+				arr[i] = r.value
+			}
+			return []queryNode{valueNode(arr)}, nil
+		}, nil
+	}
+
+	if v, ok, err := p.literal(); err != nil {
+		return nil, err
+	} else if ok {
+		return func(in queryNode) ([]queryNode, error) { return []queryNode{valueNode(v)}, nil }, nil
+	}
+
+	name := p.identifier()
+	if name == "" {
+		if p.eof() {
+			return nil, p.errorf("unexpected end of query")
+		}
+		return nil, p.errorf("unexpected %q", p.s[p.pos:p.pos+1])
+	}
+	return p.function(name)
+}
+
+// fieldStep parses name or "name" after a dot
+func (p *jqParser) fieldStep() (jqFilter, error) {
+	name, ok, err := p.stringLiteral()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		name = p.identifier()
+		if name == "" {
+			return nil, p.errorf("expected field name")
+		}
+	}
+	return jqField(name), nil
+}
+
+func jqField(name string) jqFilter {
+	return func(in queryNode) ([]queryNode, error) {
+		switch v := in.value.(type) {
+		case map[string]interface{}:
+			return []queryNode{in.child(name, v[name])}, nil
+		case nil:
+			return []queryNode{in.child(name, nil)}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with %q", jqType(in.value), name)
+	}
+}
+
+// bracketStep parses [], [n], ["name"] and [n:m]
+func (p *jqParser) bracketStep() (jqFilter, error) {
+	if err := p.expect("["); err != nil {
+		return nil, err
+	}
+	if p.accept("]") {
+		return func(in queryNode) ([]queryNode, error) {
+			switch in.value.(type) {
+			case map[string]interface{}, []interface{}:
+				return in.children(), nil
+			}
+			return nil, fmt.Errorf("cannot iterate over %s", jqType(in.value))
+		}, nil
+	}
+	if s, ok, err := p.stringLiteral(); err != nil {
+		return nil, err
+	} else if ok {
+		return jqField(s), p.expect("]")
+	}
+
+	var parts [3]*int
+	if n, ok := p.number(); ok {
+		i := int(n)
+		parts[0] = &i
+	}
+	if p.accept(":") {
+		if n, ok := p.number(); ok {
+			i := int(n)
+			parts[1] = &i
+		}
+		if err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		return func(in queryNode) ([]queryNode, error) {
+			arr, ok := in.value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot slice %s", jqType(in.value))
+			}
+			sliced := []interface{}{}
+			for _, i := range sliceIndices(len(arr), parts) {
+				sliced = append(sliced, arr[i])
+			}
+			return []queryNode{valueNode(sliced)}, nil
+		}, nil
+	}
+	if parts[0] == nil {
+		return nil, p.errorf("invalid index")
+	}
+	if err := p.expect("]"); err != nil {
+		return nil, err
+	}
+	index := *parts[0]
+	return func(in queryNode) ([]queryNode, error) {
+		switch v := in.value.(type) {
+		case []interface{}:
+			i := index
+			if i < 0 {
+				i += len(v)
+			}
+			if i < 0 || i >= len(v) {
+				return []queryNode{valueNode(nil)}, nil
+			}
+			return []queryNode{in.child(i, v[i])}, nil
+		case nil:
+			return []queryNode{valueNode(nil)}, nil
+		}
+		return nil, fmt.Errorf("cannot index %s with number", jqType(in.value))
+	}, nil
+}
+
+// function parses a builtin call
+func (p *jqParser) function(name string) (jqFilter, error) {
+	var arg jqFilter
+	if p.accept("(") {
+		var err error
+		if arg, err = p.pipe(); err != nil {
+			return nil, err
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+	needsArg := map[string]bool{"select": true, "map": true, "has": true}
+	if needsArg[name] != (arg != nil) {
+		if arg == nil {
+			return nil, p.errorf("%s needs an argument", name)
+		}
+		return nil, p.errorf("%s takes no argument", name)
+	}
+
+	switch name {
+	case "select":
+		return func(in queryNode) ([]queryNode, error) {
+			res, err := arg(in)
+			if err != nil {
+				return nil, err
+			}
+			var out []queryNode
+			for _, r := range res {
+				if jqTruthy(r.value) {
+					out = append(out, in)
+				}
+			}
+			return out, nil
+		}, nil
+	case "map":
+		return jqMap(arg), nil
+	case "has":
+		return func(in queryNode) ([]queryNode, error) {
+			keys, err := arg(in)
+			if err != nil {
+				return nil, err
+			}
+			var out []queryNode
+			for _, k := range keys {
+				found := false
+				switch v := in.value.(type) {
+				case map[string]interface{}:
+					if s, ok := k.value.(string); ok {
+						_, found = v[s]
+					}
+				case []interface{}:
+					if n, ok := k.value.(float64); ok {
+						found = n >= 0 && int(n) < len(v)
+					}
+				}
+				out = append(out, valueNode(found))
+			}
+			return out, nil
+		}, nil
+	case "keys":
+		return func(in queryNode) ([]queryNode, error) {
+			switch v := in.value.(type) {
+			case map[string]interface{}:
+				keys := []interface{}{}
+				for _, k := range sortedKeys(v) {
+					keys = append(keys, k)
+				}
+				return []queryNode{valueNode(keys)}, nil
+			case []interface{}:
+				keys := []interface{}{}
+				for i := range v {
+					keys = append(keys, float64(i))
+				}
+				return []queryNode{valueNode(keys)}, nil
+			}
+			return nil, fmt.Errorf("%s has no keys", jqType(in.value))
+		}, nil
+	case "length":
+		return func(in queryNode) ([]queryNode, error) {
+			switch v := in.value.(type) {
+			case map[string]interface{}:
+				return []queryNode{valueNode(float64(len(v)))}, nil
+			case []interface{}:
+				return []queryNode{valueNode(float64(len(v)))}, nil
+			case string:
+				return []queryNode{valueNode(float64(len([]rune(v))))}, nil
+			case float64:
+				if v < 0 {
+					v = -v
+				}
+				return []queryNode{valueNode(v)}, nil
+			case nil:
+				return []queryNode{valueNode(float64(0))}, nil
+			}
+			return nil, fmt.Errorf("%s has no length", jqType(in.value))
+		}, nil
+	case "type":
+		return func(in queryNode) ([]queryNode, error) { return []queryNode{valueNode(jqType(in.value))}, nil }, nil
+	case "not":
+		return func(in queryNode) ([]queryNode, error) { return []queryNode{valueNode(!jqTruthy(in.value))}, nil }, nil
+	case "first", "last":
+		return func(in queryNode) ([]queryNode, error) {
+			arr, ok := in.value.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot index %s with number", jqType(in.value))
+			}
+			if len(arr) == 0 {
+				return []queryNode{valueNode(nil)}, nil
+			}
+			i := 0
+			if name == "last" {
+				i = len(arr) - 1
+			}
+			return []queryNode{in.child(i, arr[i])}, nil
+		}, nil
+	case "empty":
+		return func(in queryNode) ([]queryNode, error) { return nil, nil }, nil
+	}
+	return nil, fmt.Errorf("unknown function: %s", name)
+}
+
+// jqMap builds map(f) as [.[] | f]
+func jqMap(f jqFilter) jqFilter {
+	iterate := func(in queryNode) ([]queryNode, error) {
+		switch in.value.(type) {
+		case map[string]interface{}, []interface{}:
+			return in.children(), nil
+		}
+		return nil, fmt.Errorf("cannot iterate over %s", jqType(in.value))
+	}
+	inner := jqChain(iterate, f)
+	return func(in queryNode) ([]queryNode, error) {
+		res, err := inner(in)
+		if err != nil {
+			return nil, err
+		}
+		arr := make([]interface{}, len(res))
+		for i, r := range res {
+			arr[i] = r.value
+		}
+		return []queryNode{valueNode(arr)}, nil
+	}
+}
+
+func jqType(v interface{}) string {
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "boolean"
+	}
+	return "null"
+}
+
+// ===== Endpoint =====
+
+// queryResult is one node returned by /query
+type queryResult struct {
+	Path  string      `json:"path,omitempty"`
+	Value interface{} `json:"value"`
+	HTML  string      `json:"html"`
+}
+
+// queryLanguage picks jsonpath for queries starting with $, jq otherwise
+func queryLanguage(query, lang string) string {
+	if lang == "jsonpath" || lang == "jq" {
+		return lang
+	}
+	if strings.HasPrefix(strings.TrimSpace(query), "$") {
+		return "jsonpath"
+	}
+	return "jq"
+}
+
+// runQuery evaluates a JSONPath or jq query against a parsed document
+func runQuery(doc interface{}, query, lang string) ([]queryResult, error) {
+	root := rootNode(doc)
+	var nodes []queryNode
+	switch lang {
+	case "jsonpath":
+		segments, err := compileJSONPath(query)
+		if err != nil {
+			return nil, err
+		}
+		nodes = evalJSONPath(segments, []queryNode{root}, root)
+	case "jq":
+		f, err := compileJQ(query)
+		if err != nil {
+			return nil, err
+		}
+		if nodes, err = f(root); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown query language: %s", lang)
+	}
+
+	results := make([]queryResult, 0, len(nodes))
+	for _, n := range nodes {
+		r := queryResult{Value: n.value}
+		if n.hasPath {
+			if lang == "jq" {
+				r.Path = formatJQPath(n.path)
+			} else {
+				r.Path = formatJSONPath(n.path)
+			}
+		}
+		results = append(results, r)
+	}
+	return results, nil
+}
+
+// loadStructured reads and parses a JSON, YAML or TOML file
+func loadStructured(path string) (interface{}, string, error) {
+	format := structuredFormat(path)
+	if format == "" {
+		return nil, "", fmt.Errorf("not a JSON, YAML or TOML file: %s", path)
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, format, err
+	}
+	doc, err := parseStructured(string(content), format)
+	return doc, format, err
+}
+
+// handleQuery serves /query?path=&q=&lang= against JSON, YAML and TOML files
+func handleQuery(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	path, query := q.Get("path"), q.Get("q")
+	if path == "" || strings.TrimSpace(query) == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path or q parameter")
+		return
+	}
+	if structuredFormat(path) == "" {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Not a JSON, YAML or TOML file")
+		return
+	}
+	if checkFile(w, r, path, MaxViewableSize) == nil {
+		return
+	}
+	doc, format, err := loadStructured(path)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "Cannot parse "+format+": "+err.Error())
+		return
+	}
+
+	lang := queryLanguage(query, q.Get("lang"))
+	results, err := runQuery(doc, query, lang)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	truncated := len(results) > maxQueryResults
+	if truncated {
+		results = results[:maxQueryResults]
+	}
+	for i := range results {
+		results[i].HTML = renderJSONTree(results[i].Value)
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"path":      path,
+		"query":     query,
+		"lang":      lang,
+		"results":   results,
+		"count":     len(results),
+		"truncated": truncated,
+	})
+}
+
+// renderQueryBar renders the JSONPath / jq query bar shown above JSON, YAML and TOML documents
+func renderQueryBar() string {
+	return withNonce(`<div class="query-bar">
+    <select id="query-lang" title="Query language">
+        <option value="">Auto</option>
+        <option value="jsonpath">JSONPath</option>
+        <option value="jq">jq</option>
+    </select>
+    <input type="text" id="query-input" placeholder="$.items[?(@.enabled)].name  or  .items[] | select(.enabled) | .name" onkeydown="if (event.key === 'Enter') runQuery()" />
+    <button onclick="runQuery()">Query</button>
+    <button onclick="clearQuery()" title="Clear results">✕</button>
+</div>
+<div id="query-results" class="query-results"></div>
+<script>
+async function runQuery() {
+    const q = document.getElementById('query-input').value;
+    const out = document.getElementById('query-results');
+    if (!q.trim()) { clearQuery(); return; }
+    const params = new URLSearchParams({ path: decodeURIComponent(location.pathname), q: q, lang: document.getElementById('query-lang').value });
+    const res = await fetch('/query?' + params);
+    const data = await res.json();
+    out.innerHTML = '';
+    out.style.display = 'block';
+    const header = document.createElement('div');
+    header.className = 'query-summary';
+    if (!res.ok) {
+        header.classList.add('query-error');
+        header.textContent = data.error;
+        out.appendChild(header);
+        return;
+    }
+    header.textContent = data.count + ' result' + (data.count === 1 ? '' : 's') + (data.truncated ? ' (truncated)' : '') + ' · ' + data.lang;
+    out.appendChild(header);
+    data.results.forEach(r => {
+        const item = document.createElement('div');
+        item.className = 'query-result';
+        if (r.path) {
+            const path = document.createElement('div');
+            path.className = 'query-result-path';
+            const code = document.createElement('code');
+            code.textContent = r.path;
+            const copy = document.createElement('button');
+            copy.textContent = '📋';
+            copy.title = 'Copy path';
+            copy.onclick = () => navigator.clipboard.writeText(r.path);
+            path.appendChild(code);
+            path.appendChild(copy);
+            item.appendChild(path);
+        }
+        const tree = document.createElement('div');
+        tree.className = 'json-tree';
+        tree.innerHTML = '<ul><li>' + r.html + '</li></ul>';
+        item.appendChild(tree);
+        out.appendChild(item);
+    });
+}
+function clearQuery() {
+    const out = document.getElementById('query-results');
+    out.innerHTML = '';
+    out.style.display = 'none';
+}
+</script>
+`)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ===== Query Tests =====
+
+const queryTestDoc = `{
+  "store": {
+    "book": [
+      {"title": "Sayings", "price": 8.95, "tags": ["quotes"]},
+      {"title": "Sword", "price": 12.99, "isbn": "0-553"},
+      {"title": "Moby Dick", "price": 8.99, "isbn": "0-395"}
+    ],
+    "bicycle": {"color": "red", "price": 19.95},
+    "my key": true
+  }
+}`
+
+func mustParseJSON(t *testing.T, content string) interface{} {
+	t.Helper()
+	doc, err := parseStructured(content, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// summarize renders results as "path=value" pairs for compact expectations
+func summarize(results []queryResult) string {
+	s := ""
+	for i, r := range results {
+		if i > 0 {
+			s += " "
+		}
+		b, _ := json.Marshal(r.Value)
+		if r.Path != "" {
+			s += r.Path + "="
+		}
+		s += string(b)
+	}
+	return s
+}
+
+func TestJSONPath(t *testing.T) {
+	doc := mustParseJSON(t, queryTestDoc)
+
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{"$.store.book[0].title", `$.store.book[0].title="Sayings"`},
+		{"$.store.book[-1].title", `$.store.book[2].title="Moby Dick"`},
+		{"$['store']['my key']", `$.store['my key']=true`},
+		{"$.store.book[*].price", `$.store.book[0].price=8.95 $.store.book[1].price=12.99 $.store.book[2].price=8.99`},
+		{"$.store.book[0:2].title", `$.store.book[0].title="Sayings" $.store.book[1].title="Sword"`},
+		{"$.store.book[::-2].title", `$.store.book[2].title="Moby Dick" $.store.book[0].title="Sayings"`},
+		{"$.store.book[0,2].price", `$.store.book[0].price=8.95 $.store.book[2].price=8.99`},
+		{"$..color", `$.store.bicycle.color="red"`},
+		{"$.store.book[?(@.price < 9)].title", `$.store.book[0].title="Sayings" $.store.book[2].title="Moby Dick"`},
+		{"$.store.book[?@.isbn && @.price > 10].title", `$.store.book[1].title="Sword"`},
+		{"$.store.book[?(!@.isbn)].title", `$.store.book[0].title="Sayings"`},
+		{`$.store.book[?(@.title == "Sword" || @.tags[0] == 'quotes')].price`, `$.store.book[0].price=8.95 $.store.book[1].price=12.99`},
+		{"$.store.book[?(@.price > $.store.bicycle.price)]", ``},
+		{"$.missing", ``},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := runQuery(doc, tt.query, "jsonpath")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := summarize(results); got != tt.expect {
+				t.Errorf("got  %s\nwant %s", got, tt.expect)
+			}
+		})
+	}
+
+	for _, bad := range []string{"store", "$.", "$[", "$[?(@.a ==)]", "$['unterminated"} {
+		if _, err := runQuery(doc, bad, "jsonpath"); err == nil {
+			t.Errorf("%q should be rejected", bad)
+		}
+	}
+}
+
+func TestJQ(t *testing.T) {
+	doc := mustParseJSON(t, queryTestDoc)
+
+	tests := []struct {
+		query  string
+		expect string
+	}{
+		{".", ""},
+		{".store.bicycle.color", `.store.bicycle.color="red"`},
+		{`.store["my key"]`, `.store["my key"]=true`},
+		{".store.book[1].title", `.store.book[1].title="Sword"`},
+		{".store.book[] | select(.price < 9) | .title", `.store.book[0].title="Sayings" .store.book[2].title="Moby Dick"`},
+		{".store.book | map(.price)", `[8.95,12.99,8.99]`},
+		{".store.book | length", `3`},
+		{".store.bicycle | keys", `["color","price"]`},
+		{".store.book[] | select(has(\"isbn\") and .price > 10) | .isbn", `.store.book[1].isbn="0-553"`},
+		{".store.bicycle.color, .store.bicycle.price", `.store.bicycle.color="red" .store.bicycle.price=19.95`},
+		{".store.book[0:1] | .[0].title", `"Sayings"`},
+		{"[.store.book[].title] | first", `"Sayings"`},
+		{".store.book | last | .title", `.store.book[2].title="Moby Dick"`},
+		{".. | .color? | select(. != null)", `.store.bicycle.color="red"`},
+		{".store | type", `"object"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			results, err := runQuery(doc, tt.query, "jq")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := summarize(results)
+			if tt.query == "." {
+				if len(results) != 1 || results[0].Path != "." {
+					t.Errorf("identity = %s", got)
+				}
+				return
+			}
+			if got != tt.expect {
+				t.Errorf("got  %s\nwant %s", got, tt.expect)
+			}
+		})
+	}
+
+	for _, bad := range []string{".store |", "select", ".store.book[] | bogus", ".store.book.title"} {
+		if _, err := runQuery(doc, bad, "jq"); err == nil {
+			t.Errorf("%q should fail", bad)
+		}
+	}
+}
+
+func TestParseStructured(t *testing.T) {
+	tests := []struct {
+		format  string
+		content string
+		expect  string
+	}{
+		{"yaml", "name: app\nport: 8080\ntags: [a, b]\nwhen: 2024-01-02T03:04:05Z\n", `{"name":"app","port":8080,"tags":["a","b"],"when":"2024-01-02T03:04:05Z"}`},
+		{"yaml", "a: 1\n---\na: 2\n", `[{"a":1},{"a":2}]`},
+		{"yaml", "1: one\nnan: .nan\n", `{"1":"one","nan":"NaN"}`},
+		{"toml", "title = \"x\"\n[server]\nport = 80\n[[users]]\nname = \"a\"\n", `{"server":{"port":80},"title":"x","users":[{"name":"a"}]}`},
+		{"toml", "day = 2024-01-02\n", `{"day":"2024-01-02"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.expect, func(t *testing.T) {
+			doc, err := parseStructured(tt.content, tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.Marshal(doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != tt.expect {
+				t.Errorf("got %s, want %s", b, tt.expect)
+			}
+		})
+	}
+}
+
+func TestHandleQuery(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("services:\n  - name: web\n    port: 80\n  - name: db\n    port: 5432\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query  string
+		status int
+		count  int
+	}{
+		{"$.services[?(@.port > 100)].name", http.StatusOK, 1},
+		{".services[].name", http.StatusOK, 2},
+		{"$.services[", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handleQuery(rec, httptest.NewRequest("GET", "/query?path="+url.QueryEscape(path)+"&q="+url.QueryEscape(tt.query), nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var resp struct {
+				Count   int           `json:"count"`
+				Results []queryResult `json:"results"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Count != tt.count {
+				t.Errorf("count = %d, want %d", resp.Count, tt.count)
+			}
+			if resp.Count > 0 && resp.Results[0].HTML == "" {
+				t.Error("Results should include rendered HTML")
+			}
+		})
+	}
+
+	for name, wantStatus := range map[string]int{"notes.txt": http.StatusUnsupportedMediaType, "missing.json": http.StatusNotFound} {
+		rec := httptest.NewRecorder()
+		handleQuery(rec, httptest.NewRequest("GET", fmt.Sprintf("/query?path=%s&q=.", url.QueryEscape(filepath.Join(dir, name))), nil))
+		if rec.Code != wantStatus {
+			t.Errorf("%s: status = %d, want %d", name, rec.Code, wantStatus)
+		}
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"html"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	xhtml "golang.org/x/net/html"
+)
+
+// Elements kept by sanitizeHTML; others are dropped, their text kept
+var sanitizeElements = map[string]bool{
+	"a": true, "abbr": true, "audio": true, "b": true, "bdi": true, "bdo": true, "blockquote": true,
+	"br": true, "caption": true, "center": true, "cite": true, "code": true, "col": true,
+	"colgroup": true, "dd": true, "del": true, "details": true, "dfn": true, "div": true, "dl": true,
+	"dt": true, "em": true, "figcaption": true, "figure": true, "font": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "i": true, "img": true, "ins": true,
+	"kbd": true, "li": true, "mark": true, "ol": true, "p": true, "picture": true, "pre": true,
+	"q": true, "rp": true, "rt": true, "ruby": true, "s": true, "samp": true, "small": true,
+	"source": true, "span": true, "strike": true, "strong": true, "sub": true, "summary": true,
+	"sup": true, "table": true, "tbody": true, "td": true, "tfoot": true, "th": true, "thead": true,
+	"time": true, "tr": true, "tt": true, "u": true, "ul": true, "var": true, "video": true, "wbr": true,
+}
+
+// Elements dropped with their content
+var sanitizeDropContent = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "iframe": true,
+	"object": true, "applet": true, "textarea": true, "select": true, "title": true, "head": true,
+	"xmp": true, "noembed": true, "noframes": true, "plaintext": true, "frameset": true,
+	"svg": true, "math": true,
+}
+
+// Attributes kept on every allowed element
+var sanitizeGlobalAttrs = map[string]bool{
+	"id": true, "class": true, "title": true, "lang": true, "dir": true, "align": true,
+	"valign": true, "width": true, "height": true, "role": true, "style": true,
+}
+
+// Attributes kept on some elements
+var sanitizeElementAttrs = map[string]map[string]bool{
+	"a":          {"href": true, "name": true, "target": true},
+	"img":        {"src": true, "alt": true, "loading": true},
+	"source":     {"src": true, "type": true, "media": true},
+	"video":      {"src": true, "poster": true, "controls": true, "loop": true, "muted": true, "playsinline": true},
+	"audio":      {"src": true, "controls": true, "loop": true, "muted": true},
+	"ol":         {"start": true, "type": true, "reversed": true},
+	"li":         {"value": true},
+	"td":         {"colspan": true, "rowspan": true},
+	"th":         {"colspan": true, "rowspan": true, "scope": true},
+	"col":        {"span": true},
+	"colgroup":   {"span": true},
+	"table":      {"border": true, "cellpadding": true, "cellspacing": true},
+	"details":    {"open": true},
+	"time":       {"datetime": true},
+	"blockquote": {"cite": true},
+	"q":          {"cite": true},
+	"del":        {"cite": true, "datetime": true},
+	"ins":        {"cite": true, "datetime": true},
+	"font":       {"color": true, "size": true, "face": true},
+}
+
+var (
+	sanitizeURLAttrs  = map[string]bool{"href": true, "src": true, "cite": true, "poster": true}
+	sanitizeDataImgRe = regexp.MustCompile(`^data:image/(png|gif|jpeg|webp);`)
+	sanitizeStyleRe   = regexp.MustCompile(`(?i)url\s*\(|expression\s*\(|@import|javascript:|behavior\s*:|\\`)
+	sanitizeSpaceRe   = regexp.MustCompile(`[\x00-\x20]+`)
+)
+
+// safeURL reports whether a URL attribute may be kept: relative URLs and
+// fragments, http(s), mailto: and tel:, and data: images for src
+func safeURL(attr, value string) bool {
+	v := strings.ToLower(sanitizeSpaceRe.ReplaceAllString(value, ""))
+	if !checkSchemeRe.MatchString(v) {
+		return true
+	}
+	for _, scheme := range []string{"http:", "https:", "mailto:", "tel:"} {
+		if strings.HasPrefix(v, scheme) {
+			return true
+		}
+	}
+	return attr == "src" && sanitizeDataImgRe.MatchString(v)
+}
+
+// sanitizeHTML keeps the allowed elements and attributes of an HTML fragment:
+// no scripts, styles sheets, frames, forms or event handlers, and only safe
+// URLs. Text is kept as written, with < escaped so dropped tags cannot
+// rebuild new ones. Unclosed tags are left for the browser to close.
+func sanitizeHTML(src string) string {
+	var sb strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(src))
+	dropping, depth := "", 0
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			return sb.String()
+		}
+		raw := string(z.Raw())
+		name, hasAttr := z.TagName()
+		tag := string(name)
+
+		if dropping != "" {
+			switch {
+			case tt == xhtml.StartTagToken && tag == dropping:
+				depth++
+			case tt == xhtml.EndTagToken && tag == dropping:
+				if depth--; depth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.TextToken:
+			sb.WriteString(strings.ReplaceAll(raw, "<", "&lt;"))
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if sanitizeDropContent[tag] {
+				if tt == xhtml.StartTagToken {
+					dropping, depth = tag, 1
+				}
+				continue
+			}
+			if !sanitizeElements[tag] {
+				continue
+			}
+			sb.WriteString("<" + tag)
+			target := false
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attr, value := string(key), string(val)
+				if !sanitizeGlobalAttrs[attr] && !sanitizeElementAttrs[tag][attr] && !strings.HasPrefix(attr, "aria-") {
+					continue
+				}
+				if sanitizeURLAttrs[attr] && !safeURL(attr, value) {
+					continue
+				}
+				if attr == "style" && sanitizeStyleRe.MatchString(value) {
+					continue
+				}
+				target = target || attr == "target"
+				sb.WriteString(" " + attr + `="` + html.EscapeString(value) + `"`)
+			}
+			if target {
+				sb.WriteString(` rel="noopener noreferrer"`)
+			}
+			if tt == xhtml.SelfClosingTagToken {
+				sb.WriteString(" /")
+			}
+			sb.WriteString(">")
+		case xhtml.EndTagToken:
+			if sanitizeElements[tag] {
+				sb.WriteString("</" + tag + ">")
+			}
+		}
+		// Comments and doctypes are dropped
+	}
+}
+
+// Elements of rendered SVG removed with their content
+var svgDropElements = map[string]bool{"script": true, "iframe": true, "object": true, "embed": true}
+
+// svgAttrRe matches one attribute of a raw tag, with its double-quoted,
+// single-quoted or unquoted value
+var svgAttrRe = regexp.MustCompile(`\s([^\s"'=<>/]+)(?:\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+)))?`)
+
+// sanitizeSVG removes scripts, event handlers and unsafe link targets from
+// the SVG of a diagram tool, whose input labels and URL attributes come from
+// the document. The rest is kept as written: SVG attributes are case
+// sensitive, unlike the HTML sanitizeHTML rebuilds.
+func sanitizeSVG(svg string) string {
+	var sb strings.Builder
+	z := xhtml.NewTokenizer(strings.NewReader(svg))
+	dropping, depth := "", 0
+	for {
+		tt := z.Next()
+		if tt == xhtml.ErrorToken {
+			return sb.String()
+		}
+		raw := string(z.Raw())
+		name, hasAttr := z.TagName()
+		tag := string(name)
+
+		if dropping != "" {
+			switch {
+			case tt == xhtml.StartTagToken && tag == dropping:
+				depth++
+			case tt == xhtml.EndTagToken && tag == dropping:
+				if depth--; depth == 0 {
+					dropping = ""
+				}
+			}
+			continue
+		}
+
+		switch tt {
+		case xhtml.StartTagToken, xhtml.SelfClosingTagToken:
+			if svgDropElements[tag] || animatesLink(z, hasAttr) {
+				if tt == xhtml.StartTagToken {
+					dropping, depth = tag, 1
+				}
+				continue
+			}
+			sb.WriteString(svgAttrRe.ReplaceAllStringFunc(raw, func(m string) string {
+				parts := svgAttrRe.FindStringSubmatch(m)
+				attr := strings.ToLower(parts[1])
+				value := html.UnescapeString(parts[2] + parts[3] + parts[4])
+				if strings.HasPrefix(attr, "on") || isLinkAttr(attr) && !safeURL("href", value) {
+					return ""
+				}
+				return m
+			}))
+		case xhtml.EndTagToken:
+			if !svgDropElements[tag] {
+				sb.WriteString(raw)
+			}
+		default:
+			sb.WriteString(raw)
+		}
+	}
+}
+
+// isLinkAttr reports whether an attribute holds a URL a click or a load follows
+func isLinkAttr(attr string) bool {
+	return attr == "href" || strings.HasSuffix(attr, ":href") || attr == "src" || attr == "action" || attr == "formaction"
+}
+
+// animatesLink reports whether the tag being tokenized animates a link
+// attribute, such as <set attributeName="href" to="javascript:...">
+func animatesLink(z *xhtml.Tokenizer, hasAttr bool) bool {
+	for hasAttr {
+		var key, val []byte
+		key, val, hasAttr = z.TagAttr()
+		if string(key) == "attributename" && isLinkAttr(strings.ToLower(string(val))) {
+			return true
+		}
+	}
+	return false
+}
+
+// isTrustedPath reports whether a file or directory is below one of the
+// trustedRoots of the config, whose HTML is rendered as it is
+func isTrustedPath(p string) bool {
+	if p == "" {
+		return false
+	}
+	p = filepath.Clean(p)
+	for _, root := range appConfig.TrustedRoots {
+		root = filepath.Clean(expandHome(root))
+		if p == root || strings.HasPrefix(p, root+string(filepath.Separator)) || root == string(filepath.Separator) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy of untrusted HTML documents: styles and remote or inline images,
+// nothing else
+const sandboxCSP = "default-src 'none'; style-src 'unsafe-inline'; img-src data: https:; font-src data: https:; media-src https:"
+
+var htmlHeadRe = regexp.MustCompile(`(?i)<head(\s[^>]*)?>`)
+
+// renderHTMLFile renders an .html file: as it is under a trusted root,
+// otherwise in a sandboxed frame where scripts cannot run
+func renderHTMLFile(filePath, content string) string {
+	if isTrustedPath(filePath) {
+		return content
+	}
+	meta := `<meta http-equiv="Content-Security-Policy" content="` + sandboxCSP + `">`
+	if loc := htmlHeadRe.FindStringIndex(content); loc != nil {
+		content = content[:loc[1]] + meta + content[loc[1]:]
+	} else {
+		content = meta + content
+	}
+	return `<div class="html-sandbox-note">🔒 Sandboxed: scripts, forms and local resources are disabled. Add its folder to <code>trustedRoots</code> in the config file to render it as it is.</div>
+<iframe class="html-sandbox" sandbox="allow-popups allow-popups-to-escape-sandbox" referrerpolicy="no-referrer" srcdoc="` + html.EscapeString(content) + `"></iframe>`
+}
+
+// assetNeedsSandbox reports whether an /asset response could run scripts
+// when opened directly: HTML, SVG and XML documents
+func assetNeedsSandbox(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return strings.HasPrefix(ct, "text/html") || strings.Contains(ct, "xml") || strings.Contains(ct, "svg")
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ===== HTML Sanitiser Tests =====
+
+func TestSanitizeHTML(t *testing.T) {
+	tests := []struct {
+		input, expect string
+	}{
+		{`<p align="center"><img src="logo.png" width="100" alt="Logo"></p>`, `<p align="center"><img src="logo.png" width="100" alt="Logo"></p>`},
+		{`<script>fetch('/asset?path=/etc/passwd')</script>after`, `after`},
+		{`<style>body { display: none }</style>`, ``},
+		{`<img src=x onerror="alert(1)">`, `<img src="x">`},
+		{`<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href=" jAvA&#x09;script:alert(1)">x</a>`, `<a>x</a>`},
+		{`<a href="https://example.com" target="_blank">x</a>`, `<a href="https://example.com" target="_blank" rel="noopener noreferrer">x</a>`},
+		{`<a href="#section" onclick="x()">y</a>`, `<a href="#section">y</a>`},
+		{`<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA">`},
+		{`<img src="data:text/html,<script>alert(1)</script>">`, `<img>`},
+		{`<iframe src="https://evil"><p>inside</p></iframe>kept`, `kept`},
+		{`<svg onload="alert(1)"><svg><text>x</text></svg></svg>ok`, `ok`},
+		{`<form action="/x"><input name="q"><button>Go</button></form>`, `Go`},
+		{`<div style="color: red">a</div><div style="background: url(http://x)">b</div>`, `<div style="color: red">a</div><div>b</div>`},
+		{`<<b>script>alert(1)<</b>/script>`, `&lt;<b>script>alert(1)&lt;</b>/script>`},
+		{`<<x>script>alert(1)<</x>/script>`, `&lt;script>alert(1)&lt;/script>`},
+		{`a < b &amp; c <!-- comment --> d`, `a &lt; b &amp; c  d`},
+		{`<details open><summary>More</summary>Text</details>`, `<details open=""><summary>More</summary>Text</details>`},
+		{`<br/><hr />`, `<br /><hr />`},
+		{`<span aria-label="x" data-x="y">t</span>`, `<span aria-label="x">t</span>`},
+	}
+	for _, tt := range tests {
+		if got := sanitizeHTML(tt.input); got != tt.expect {
+			t.Errorf("sanitizeHTML(%q)\ngot  %q\nwant %q", tt.input, got, tt.expect)
+		}
+	}
+}
+
+func TestSanitizeSVG(t *testing.T) {
+	tests := []struct {
+		input, expect string
+	}{
+		{`<svg viewBox="0 0 10 10"><path d="M 0 0 L 1 1"/></svg>`, `<svg viewBox="0 0 10 10"><path d="M 0 0 L 1 1"/></svg>`},
+		{`<svg><a xlink:href="javascript:alert(1)" xlink:title="a"><text>a</text></a></svg>`, `<svg><a xlink:title="a"><text>a</text></a></svg>`},
+		{`<svg><a href="https://example.com"><text>b</text></a></svg>`, `<svg><a href="https://example.com"><text>b</text></a></svg>`},
+		{`<svg><a href="data:text/html,x">c</a></svg>`, `<svg><a>c</a></svg>`},
+		{`<svg onload="alert(1)"><g onClick='x()' id="g"/></svg>`, `<svg><g id="g"/></svg>`},
+		{`<svg><script>alert(1)</script><text>d</text></svg>`, `<svg><text>d</text></svg>`},
+		{`<svg><a href="#"><set attributeName="href" to="javascript:alert(1)"/>e</a></svg>`, `<svg><a href="#">e</a></svg>`},
+		{`<svg><foreignObject><div><img src=x onerror=alert(1)>f</div></foreignObject></svg>`, `<svg><foreignObject><div><img src=x>f</div></foreignObject></svg>`},
+		{`<svg><style>.a { fill: red }</style></svg>`, `<svg><style>.a { fill: red }</style></svg>`},
+	}
+	for _, tt := range tests {
+		if got := sanitizeSVG(tt.input); got != tt.expect {
+			t.Errorf("sanitizeSVG(%q)\ngot  %q\nwant %q", tt.input, got, tt.expect)
+		}
+	}
+}
+
+func TestRenderMarkdownSanitized(t *testing.T) {
+	dir := t.TempDir()
+	input := "# Title <img src=x onerror=alert(1)>\n\n## A\n\n## B\n\n" +
+		"<div align=\"center\" onclick=\"steal()\">\n\n<script>\nfetch('/asset?path=/etc/passwd')\n</script>\n\n" +
+		"Inline <b onmouseover=\"x()\">bold</b> and `<script>` code, [x](javascript:alert(1)) ![i](x\" onerror=\"alert(1))\n\n" +
+		"Note[^a\"b]\n\n[^a\"b]: Footnote\n"
+
+	result := renderMarkdown(input, dir)
+	for _, unwanted := range []string{`onerror=alert`, `onerror="alert`, `onclick="steal`, `onmouseover="x`, "fetch(", "<script", `javascript:`, `id="fn-a"b"`} {
+		if strings.Contains(result, unwanted) {
+			t.Errorf("%q should be removed:\n%s", unwanted, result)
+		}
+	}
+	for _, want := range []string{`<div align="center">`, `<b>bold</b>`, `<code>&lt;script&gt;</code>`, `<img src="x">`, `<a>x</a>`, `<a href="#fn-a&#34;b"`} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in:\n%s", want, result)
+		}
+	}
+
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{TrustedRoots: []string{dir}}
+	if result := renderMarkdown(input, dir); !strings.Contains(result, "<script>\n") || !strings.Contains(result, `onclick="steal()"`) {
+		t.Errorf("trusted roots should render raw HTML:\n%s", result)
+	}
+	if result := renderMarkdown(input, t.TempDir()); strings.Contains(result, "<script") {
+		t.Error("files outside trusted roots are sanitised")
+	}
+}
+
+func TestCodeFenceLanguage(t *testing.T) {
+	input := "```x\" onmouseover=\"alert(1)\nhi\n```\n\n```go title=\"main.go\"\nfunc main() {}\n```\n"
+	result := renderMarkdown(input, "")
+	exported := highlightCode(result)
+	for _, out := range []string{result, exported} {
+		if strings.Contains(out, "onmouseover") {
+			t.Errorf("the info string should not reach the attributes:\n%s", out)
+		}
+	}
+	if !strings.Contains(result, `<code id="code-0">hi`) || !strings.Contains(result, `class="language-go"`) {
+		t.Errorf("fence languages:\n%s", result)
+	}
+	if got := renderCode("x", `a"b`); !strings.Contains(got, `class="language-a&#34;b"`) {
+		t.Errorf("renderCode() = %s", got)
+	}
+}
+
+func TestRenderHTMLFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "page.html")
+	page := `<html><head><title>Page</title></head><body><script>alert("x")</script></body></html>`
+	if err := os.WriteFile(path, []byte(page), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	content, class := renderFile(path)
+	if class != "html" {
+		t.Errorf("class = %s", class)
+	}
+	for _, want := range []string{
+		`<iframe class="html-sandbox" sandbox="allow-popups allow-popups-to-escape-sandbox"`,
+		`srcdoc="&lt;html&gt;&lt;head&gt;&lt;meta http-equiv=&#34;Content-Security-Policy&#34; content=&#34;default-src &#39;none&#39;`,
+		`&lt;script&gt;alert(&#34;x&#34;)`,
+	} {
+		if !strings.Contains(content, want) {
+			t.Errorf("expected %q in:\n%s", want, content)
+		}
+	}
+
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{TrustedRoots: []string{dir}}
+	if content, _ := renderFile(path); content != page {
+		t.Errorf("trusted HTML should be returned as it is, got %s", content)
+	}
+}
+
+func TestAssetSandbox(t *testing.T) {
+	dir := writeTree(t, map[string]string{"page.html": "<script>alert(1)</script>", "logo.svg": "<svg></svg>", "logo.png": string(testPNG)})
+	for name, sandboxed := range map[string]bool{"page.html": true, "logo.svg": true, "logo.png": false} {
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/asset?path="+url.QueryEscape(filepath.Join(dir, name)), nil))
+		csp := rec.Header().Get("Content-Security-Policy")
+		if got := strings.HasPrefix(csp, "sandbox;"); got != sandboxed {
+			t.Errorf("%s: Content-Security-Policy = %q", name, csp)
+		}
+	}
+}
@@ -0,0 +1,1001 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Maximum size of a remote schema
+const maxSchemaSize = 5 * 1024 * 1024
+
+// Meta-schema URIs: a document declaring one of them is itself a schema
+var metaSchemas = map[string]bool{
+	"https://json-schema.org/draft/2020-12/schema": true,
+	"https://json-schema.org/draft/2019-09/schema": true,
+	"http://json-schema.org/draft-07/schema":       true,
+	"http://json-schema.org/draft-06/schema":       true,
+	"http://json-schema.org/draft-04/schema":       true,
+}
+
+// schemaError is one validation failure
+type schemaError struct {
+	Pointer string `json:"pointer"` // JSON pointer to the offending value, "" for the root
+	Keyword string `json:"keyword"` // schema location, e.g. /properties/port/type
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"` // source line, for YAML documents
+}
+
+// schemaReport is the outcome of validating a document against its schema
+type schemaReport struct {
+	Schema    string        // where the schema comes from
+	Source    string        // $schema, sidecar or config
+	Errors    []schemaError // empty when the document is valid
+	LoadError string        // the schema could not be loaded
+}
+
+// ===== Discovery =====
+
+// findSchema looks for the schema of a document: its $schema property, a
+// sidecar <name>.schema.json, then the globs of the configuration
+func findSchema(filePath string, doc interface{}) (string, string) {
+	if obj, ok := doc.(map[string]interface{}); ok {
+		if s, ok := obj["$schema"].(string); ok && s != "" && !metaSchemas[strings.TrimSuffix(s, "#")] {
+			return resolveSchemaLocation(s, filepath.Dir(filePath)), "$schema"
+		}
+	}
+
+	base := strings.TrimSuffix(filePath, filepath.Ext(filePath))
+	if !strings.HasSuffix(base, ".schema") {
+		sidecar := base + ".schema.json"
+		if _, err := os.Stat(sidecar); err == nil {
+			return sidecar, "sidecar"
+		}
+	}
+
+	// Sorted for a deterministic choice when several globs match
+	globs := make([]string, 0, len(appConfig.Schemas))
+	for glob := range appConfig.Schemas {
+		globs = append(globs, glob)
+	}
+	sort.Strings(globs)
+	for _, glob := range globs {
+		if matchGlob(glob, filePath) {
+			return resolveSchemaLocation(appConfig.Schemas[glob], getConfigDir()), "config"
+		}
+	}
+	return "", ""
+}
+
+// resolveSchemaLocation turns a relative schema path into an absolute one
+func resolveSchemaLocation(location, dir string) string {
+	if strings.Contains(location, "://") || filepath.IsAbs(location) {
+		return location
+	}
+	return filepath.Join(dir, location)
+}
+
+// validateDocument finds the schema of a parsed document and validates it;
+// it returns nil when the document has no schema
+func validateDocument(filePath string, doc interface{}) *schemaReport {
+	location, source := findSchema(filePath, doc)
+	if location == "" {
+		return nil
+	}
+	report := &schemaReport{Schema: location, Source: source}
+
+	loader := newSchemaLoader()
+	uri := locationURI(location)
+	schema, err := loader.load(uri)
+	if err != nil {
+		report.LoadError = err.Error()
+		return report
+	}
+	report.Errors = loader.validate(doc, schema, uri)
+	return report
+}
+
+// locationURI converts a file path to a file:// URI, leaving URLs untouched
+func locationURI(location string) string {
+	if strings.Contains(location, "://") {
+		return location
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(location)}).String()
+}
+
+// ===== Loading =====
+
+// Failed schema downloads are answered from the cache for this long
+const schemaRetryDelay = 5 * time.Minute
+
+// Remote schemas fetched during this run, by URI
+var (
+	remoteSchemaCache   = make(map[string]*remoteSchema)
+	remoteSchemaCacheMu sync.Mutex
+)
+
+// schemaClient downloads remote schemas. Any file viewed can name a $schema
+// or $ref URL, so it only connects to public addresses.
+var schemaClient = &http.Client{Timeout: httpClient.Timeout, Transport: publicTransport(httpClient.Timeout)}
+
+// remoteSchema is a schema download, shared by the validations waiting for it
+type remoteSchema struct {
+	ready chan struct{} // Closed once doc or err is set
+	doc   interface{}
+	err   error
+	retry time.Time // When a failed download may be tried again
+}
+
+// stale reports whether a finished download failed long enough ago to be
+// tried again
+func (rs *remoteSchema) stale() bool {
+	select {
+	case <-rs.ready:
+		return rs.err != nil && time.Now().After(rs.retry)
+	default:
+		return false
+	}
+}
+
+// schemaLoader loads schema documents and indexes their $id and $anchor
+type schemaLoader struct {
+	docs      map[string]interface{} // by URI without fragment
+	resources map[string]interface{} // by $id / URI#anchor
+	regexps   map[string]*regexp.Regexp
+}
+
+func newSchemaLoader() *schemaLoader {
+	return &schemaLoader{
+		docs:      make(map[string]interface{}),
+		resources: make(map[string]interface{}),
+		regexps:   make(map[string]*regexp.Regexp),
+	}
+}
+
+// load returns the schema document at uri (file:// or http(s)://)
+func (l *schemaLoader) load(uri string) (interface{}, error) {
+	uri = strings.TrimSuffix(uri, "#")
+	if doc, ok := l.docs[uri]; ok {
+		return doc, nil
+	}
+	if doc, ok := l.resources[uri]; ok {
+		return doc, nil
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	switch u.Scheme {
+	case "file":
+		data, err := os.ReadFile(u.Path)
+		if err != nil {
+			return nil, err
+		}
+		format := "json"
+		if ext := strings.ToLower(filepath.Ext(u.Path)); ext == ".yaml" || ext == ".yml" {
+			format = "yaml"
+		}
+		if doc, err = parseStructured(string(data), format); err != nil {
+			return nil, fmt.Errorf("%s: %w", u.Path, err)
+		}
+	case "http", "https":
+		if doc, err = fetchRemoteSchema(uri); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported schema location: %s", uri)
+	}
+
+	l.docs[uri] = doc
+	l.index(doc, uri)
+	return doc, nil
+}
+
+// fetchRemoteSchema downloads a schema, caching it for the lifetime of the
+// process, and failures for schemaRetryDelay so that an unreachable host
+// does not slow down every view. The download runs outside the lock: one
+// slow host only delays the validations that need its schemas.
+func fetchRemoteSchema(uri string) (interface{}, error) {
+	remoteSchemaCacheMu.Lock()
+	if rs, ok := remoteSchemaCache[uri]; ok && !rs.stale() {
+		remoteSchemaCacheMu.Unlock()
+		<-rs.ready
+		return rs.doc, rs.err
+	}
+	rs := &remoteSchema{ready: make(chan struct{})}
+	remoteSchemaCache[uri] = rs
+	remoteSchemaCacheMu.Unlock()
+
+	rs.doc, rs.err = downloadSchema(uri)
+	rs.retry = time.Now().Add(schemaRetryDelay)
+	close(rs.ready)
+	return rs.doc, rs.err
+}
+
+// downloadSchema fetches and parses a remote schema
+func downloadSchema(uri string) (interface{}, error) {
+	resp, err := schemaClient.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: HTTP %d", uri, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSchemaSize))
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseStructured(string(data), "json")
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", uri, err)
+	}
+	return doc, nil
+}
+
+// index registers the embedded resources ($id) and anchors of a schema document
+func (l *schemaLoader) index(schema interface{}, base string) {
+	switch s := schema.(type) {
+	case map[string]interface{}:
+		if id, ok := s["$id"].(string); ok {
+			base = resolveURI(base, id)
+			l.resources[strings.TrimSuffix(base, "#")] = s
+		}
+		for _, key := range []string{"$anchor", "$dynamicAnchor"} {
+			if anchor, ok := s[key].(string); ok {
+				l.resources[stripFragment(base)+"#"+anchor] = s
+			}
+		}
+		for key, v := range s {
+			// enum and const hold data, not schemas
+			if key != "enum" && key != "const" {
+				l.index(v, base)
+			}
+		}
+	case []interface{}:
+		for _, v := range s {
+			l.index(v, base)
+		}
+	}
+}
+
+func resolveURI(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+func stripFragment(uri string) string {
+	if i := strings.Index(uri, "#"); i >= 0 {
+		return uri[:i]
+	}
+	return uri
+}
+
+// resolveRef returns the schema a $ref points to and its base URI
+func (l *schemaLoader) resolveRef(ref, base string) (interface{}, string, error) {
+	target := resolveURI(base, ref)
+	docURI, fragment := stripFragment(target), ""
+	if i := strings.Index(target, "#"); i >= 0 {
+		fragment = target[i+1:]
+	}
+	if metaSchemas[docURI] {
+		return true, docURI, nil
+	}
+
+	if fragment != "" && !strings.HasPrefix(fragment, "/") {
+		if s, ok := l.resources[docURI+"#"+fragment]; ok {
+			return s, docURI, nil
+		}
+		if _, err := l.load(docURI); err != nil {
+			return nil, "", err
+		}
+		if s, ok := l.resources[docURI+"#"+fragment]; ok {
+			return s, docURI, nil
+		}
+		return nil, "", fmt.Errorf("anchor not found: %s", target)
+	}
+
+	doc, err := l.load(docURI)
+	if err != nil {
+		return nil, "", err
+	}
+	if fragment == "" {
+		return doc, docURI, nil
+	}
+	unescaped, err := url.PathUnescape(fragment)
+	if err != nil {
+		return nil, "", err
+	}
+	s, ok := jsonPointerGet(doc, unescaped)
+	if !ok {
+		return nil, "", fmt.Errorf("$ref not found: %s", target)
+	}
+	return s, docURI, nil
+}
+
+// resolveDynamic returns the schema a $dynamicRef points to: when its
+// static target declares the $dynamicAnchor it names, the outermost
+// resource of the dynamic scope with that $dynamicAnchor wins
+func (l *schemaLoader) resolveDynamic(ref string, target interface{}, targetBase string, scope []string) (interface{}, string) {
+	_, anchor, ok := strings.Cut(ref, "#")
+	if !ok || anchor == "" || strings.HasPrefix(anchor, "/") || !hasDynamicAnchor(target, anchor) {
+		return target, targetBase
+	}
+	for _, base := range scope {
+		if s, ok := l.resources[stripFragment(base)+"#"+anchor]; ok && hasDynamicAnchor(s, anchor) {
+			return s, stripFragment(base)
+		}
+	}
+	return target, targetBase
+}
+
+func hasDynamicAnchor(schema interface{}, anchor string) bool {
+	s, ok := schema.(map[string]interface{})
+	return ok && s["$dynamicAnchor"] == anchor
+}
+
+// jsonPointerGet follows a JSON pointer (RFC 6901) through a document
+func jsonPointerGet(doc interface{}, pointer string) (interface{}, bool) {
+	if pointer == "" {
+		return doc, true
+	}
+	for _, token := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			next, ok := v[token]
+			if !ok {
+				return nil, false
+			}
+			doc = next
+		case []interface{}:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			doc = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// pointerToken escapes a key for use in a JSON pointer
+func pointerToken(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+// ===== Validation (JSON Schema draft 2020-12) =====
+
+// evaluated records which properties and items a schema evaluated, for
+// unevaluatedProperties and unevaluatedItems
+type evaluated struct {
+	props    map[string]bool
+	items    int          // items [0, items) were evaluated
+	matched  map[int]bool // items matched by contains
+	allItems bool
+}
+
+func (e *evaluated) merge(o evaluated) {
+	for k := range o.props {
+		if e.props == nil {
+			e.props = make(map[string]bool)
+		}
+		e.props[k] = true
+	}
+	for i := range o.matched {
+		if e.matched == nil {
+			e.matched = make(map[int]bool)
+		}
+		e.matched[i] = true
+	}
+	e.items = max(e.items, o.items)
+	e.allItems = e.allItems || o.allItems
+}
+
+func (e *evaluated) markProp(k string) {
+	if e.props == nil {
+		e.props = make(map[string]bool)
+	}
+	e.props[k] = true
+}
+
+// validate checks a document against a schema loaded from uri
+func (l *schemaLoader) validate(doc, schema interface{}, uri string) []schemaError {
+	if _, ok := l.docs[uri]; !ok {
+		l.docs[uri] = schema
+		l.index(schema, uri)
+	}
+	errs, _ := l.check(doc, schema, uri, "", "", nil, 0)
+	return errs
+}
+
+// check validates inst (at pointer ptr) against schema (at keyword path kw).
+// scope lists the base URIs of the schema resources entered so far,
+// outermost first, where $dynamicRef looks for its anchor.
+func (l *schemaLoader) check(inst, schema interface{}, base, ptr, kw string, scope []string, depth int) ([]schemaError, evaluated) {
+	var ev evaluated
+	if depth > 64 {
+		return []schemaError{{Pointer: ptr, Keyword: kw, Message: "schema recursion too deep"}}, ev
+	}
+	fail := func(keyword, format string, args ...interface{}) schemaError {
+		return schemaError{Pointer: ptr, Keyword: kw + "/" + keyword, Message: fmt.Sprintf(format, args...)}
+	}
+
+	var s map[string]interface{}
+	switch v := schema.(type) {
+	case bool:
+		if !v {
+			return []schemaError{{Pointer: ptr, Keyword: kw, Message: "no value is allowed here"}}, ev
+		}
+		return nil, ev
+	case map[string]interface{}:
+		s = v
+	default:
+		return nil, ev
+	}
+	if id, ok := s["$id"].(string); ok {
+		base = resolveURI(base, id)
+	}
+	if len(scope) == 0 || scope[len(scope)-1] != base {
+		scope = append(scope[:len(scope):len(scope)], base)
+	}
+
+	var errs []schemaError
+	sub := func(inst, schema interface{}, ptr, kw string) ([]schemaError, evaluated) {
+		return l.check(inst, schema, base, ptr, kw, scope, depth+1)
+	}
+
+	// References
+	for _, key := range []string{"$ref", "$dynamicRef"} {
+		ref, ok := s[key].(string)
+		if !ok {
+			continue
+		}
+		target, targetBase, err := l.resolveRef(ref, base)
+		if err != nil {
+			errs = append(errs, fail(key, "%v", err))
+			continue
+		}
+		if key == "$dynamicRef" {
+			target, targetBase = l.resolveDynamic(ref, target, targetBase, scope)
+		}
+		e, refEv := l.check(inst, target, targetBase, ptr, kw+"/"+key, scope, depth+1)
+		errs = append(errs, e...)
+		ev.merge(refEv)
+	}
+
+	// Any instance type
+	if t, ok := s["type"]; ok {
+		if !matchesType(inst, t) {
+			errs = append(errs, fail("type", "expected %s, got %s", describeTypes(t), jsonType(inst)))
+		}
+	}
+	if enum, ok := s["enum"].([]interface{}); ok {
+		found := false
+		for _, v := range enum {
+			if reflect.DeepEqual(inst, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, fail("enum", "must be one of %s", mustJSON(enum)))
+		}
+	}
+	if c, ok := s["const"]; ok && !reflect.DeepEqual(inst, c) {
+		errs = append(errs, fail("const", "must be %s", mustJSON(c)))
+	}
+
+	// Numbers
+	if n, ok := inst.(float64); ok {
+		if m, ok := s["multipleOf"].(float64); ok && m > 0 {
+			// n/m is inexact in binary: 0.3/0.1 is 2.9999999999999996
+			if q := n / m; math.Abs(q-math.Round(q)) > 1e-9*max(1, math.Abs(q)) {
+				errs = append(errs, fail("multipleOf", "must be a multiple of %v", m))
+			}
+		}
+		if m, ok := s["maximum"].(float64); ok && n > m {
+			errs = append(errs, fail("maximum", "must be <= %v", m))
+		}
+		if m, ok := s["exclusiveMaximum"].(float64); ok && n >= m {
+			errs = append(errs, fail("exclusiveMaximum", "must be < %v", m))
+		}
+		if m, ok := s["minimum"].(float64); ok && n < m {
+			errs = append(errs, fail("minimum", "must be >= %v", m))
+		}
+		if m, ok := s["exclusiveMinimum"].(float64); ok && n <= m {
+			errs = append(errs, fail("exclusiveMinimum", "must be > %v", m))
+		}
+	}
+
+	// Strings
+	if str, ok := inst.(string); ok {
+		length := utf8.RuneCountInString(str)
+		if m, ok := s["maxLength"].(float64); ok && length > int(m) {
+			errs = append(errs, fail("maxLength", "must be at most %v characters", m))
+		}
+		if m, ok := s["minLength"].(float64); ok && length < int(m) {
+			errs = append(errs, fail("minLength", "must be at least %v characters", m))
+		}
+		if p, ok := s["pattern"].(string); ok {
+			if re, err := l.regexp(p); err != nil {
+				errs = append(errs, fail("pattern", "invalid pattern %q in schema", p))
+			} else if !re.MatchString(str) {
+				errs = append(errs, fail("pattern", "must match pattern %q", p))
+			}
+		}
+		if f, ok := s["format"].(string); ok {
+			if msg := checkFormat(f, str); msg != "" {
+				errs = append(errs, fail("format", "%s", msg))
+			}
+		}
+	}
+
+	// Arrays
+	if arr, ok := inst.([]interface{}); ok {
+		if m, ok := s["maxItems"].(float64); ok && len(arr) > int(m) {
+			errs = append(errs, fail("maxItems", "must have at most %v items", m))
+		}
+		if m, ok := s["minItems"].(float64); ok && len(arr) < int(m) {
+			errs = append(errs, fail("minItems", "must have at least %v items", m))
+		}
+		if u, ok := s["uniqueItems"].(bool); ok && u {
+			for i := range arr {
+				for j := i + 1; j < len(arr); j++ {
+					if reflect.DeepEqual(arr[i], arr[j]) {
+						errs = append(errs, fail("uniqueItems", "items %d and %d are equal", i, j))
+					}
+				}
+			}
+		}
+		prefix := 0
+		if items, ok := s["prefixItems"].([]interface{}); ok {
+			for i, item := range items {
+				if i >= len(arr) {
+					break
+				}
+				e, _ := sub(arr[i], item, ptr+"/"+strconv.Itoa(i), fmt.Sprintf("%s/prefixItems/%d", kw, i))
+				errs = append(errs, e...)
+				prefix = i + 1
+			}
+			ev.items = max(ev.items, prefix)
+		}
+		if items, ok := s["items"]; ok {
+			for i := prefix; i < len(arr); i++ {
+				e, _ := sub(arr[i], items, ptr+"/"+strconv.Itoa(i), kw+"/items")
+				errs = append(errs, e...)
+			}
+			ev.allItems = true
+		}
+		if contains, ok := s["contains"]; ok {
+			count := 0
+			for i, item := range arr {
+				if e, _ := sub(item, contains, ptr+"/"+strconv.Itoa(i), kw+"/contains"); len(e) == 0 {
+					count++
+					if ev.matched == nil {
+						ev.matched = make(map[int]bool)
+					}
+					ev.matched[i] = true
+				}
+			}
+			minContains := 1
+			if m, ok := s["minContains"].(float64); ok {
+				minContains = int(m)
+			}
+			if count < minContains {
+				errs = append(errs, fail("contains", "must contain at least %d matching item(s), found %d", minContains, count))
+			}
+			if m, ok := s["maxContains"].(float64); ok && count > int(m) {
+				errs = append(errs, fail("maxContains", "must contain at most %v matching item(s), found %d", m, count))
+			}
+		}
+	}
+
+	// Objects
+	if obj, ok := inst.(map[string]interface{}); ok {
+		if m, ok := s["maxProperties"].(float64); ok && len(obj) > int(m) {
+			errs = append(errs, fail("maxProperties", "must have at most %v properties", m))
+		}
+		if m, ok := s["minProperties"].(float64); ok && len(obj) < int(m) {
+			errs = append(errs, fail("minProperties", "must have at least %v properties", m))
+		}
+		if required, ok := s["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, present := obj[name]; !present {
+						errs = append(errs, fail("required", "missing required property %q", name))
+					}
+				}
+			}
+		}
+		if deps, ok := s["dependentRequired"].(map[string]interface{}); ok {
+			for prop, req := range deps {
+				if _, present := obj[prop]; !present {
+					continue
+				}
+				list, _ := req.([]interface{})
+				for _, r := range list {
+					if name, ok := r.(string); ok {
+						if _, present := obj[name]; !present {
+							errs = append(errs, fail("dependentRequired", "property %q requires %q", prop, name))
+						}
+					}
+				}
+			}
+		}
+
+		keys := sortedKeys(obj)
+		props, _ := s["properties"].(map[string]interface{})
+		patternProps, _ := s["patternProperties"].(map[string]interface{})
+		for _, k := range keys {
+			matched := false
+			if ps, ok := props[k]; ok {
+				matched = true
+				e, _ := sub(obj[k], ps, ptr+"/"+pointerToken(k), kw+"/properties/"+pointerToken(k))
+				errs = append(errs, e...)
+			}
+			for pattern, ps := range patternProps {
+				re, err := l.regexp(pattern)
+				if err != nil || !re.MatchString(k) {
+					continue
+				}
+				matched = true
+				e, _ := sub(obj[k], ps, ptr+"/"+pointerToken(k), kw+"/patternProperties/"+pointerToken(pattern))
+				errs = append(errs, e...)
+			}
+			if matched {
+				ev.markProp(k)
+				continue
+			}
+			if additional, ok := s["additionalProperties"]; ok {
+				if additional == false {
+					errs = append(errs, schemaError{Pointer: ptr + "/" + pointerToken(k), Keyword: kw + "/additionalProperties", Message: fmt.Sprintf("property %q is not allowed", k)})
+				} else {
+					e, _ := sub(obj[k], additional, ptr+"/"+pointerToken(k), kw+"/additionalProperties")
+					errs = append(errs, e...)
+				}
+				ev.markProp(k)
+			}
+		}
+		if names, ok := s["propertyNames"]; ok {
+			for _, k := range keys {
+				if e, _ := sub(k, names, ptr+"/"+pointerToken(k), kw+"/propertyNames"); len(e) > 0 {
+					errs = append(errs, schemaError{Pointer: ptr + "/" + pointerToken(k), Keyword: kw + "/propertyNames", Message: fmt.Sprintf("invalid property name %q: %s", k, e[0].Message)})
+				}
+			}
+		}
+		if deps, ok := s["dependentSchemas"].(map[string]interface{}); ok {
+			for prop, ds := range deps {
+				if _, present := obj[prop]; present {
+					e, depEv := sub(inst, ds, ptr, kw+"/dependentSchemas/"+pointerToken(prop))
+					errs = append(errs, e...)
+					ev.merge(depEv)
+				}
+			}
+		}
+	}
+
+	// Combinators
+	if all, ok := s["allOf"].([]interface{}); ok {
+		for i, as := range all {
+			e, allEv := sub(inst, as, ptr, fmt.Sprintf("%s/allOf/%d", kw, i))
+			errs = append(errs, e...)
+			ev.merge(allEv)
+		}
+	}
+	if anyOf, ok := s["anyOf"].([]interface{}); ok {
+		valid := false
+		for i, as := range anyOf {
+			if e, anyEv := sub(inst, as, ptr, fmt.Sprintf("%s/anyOf/%d", kw, i)); len(e) == 0 {
+				valid = true
+				ev.merge(anyEv)
+			}
+		}
+		if !valid {
+			errs = append(errs, fail("anyOf", "must match at least one of the allowed schemas"))
+		}
+	}
+	if oneOf, ok := s["oneOf"].([]interface{}); ok {
+		matches := 0
+		var firstErrs []schemaError
+		for i, branch := range oneOf {
+			e, oneEv := sub(inst, branch, ptr, fmt.Sprintf("%s/oneOf/%d", kw, i))
+			if len(e) == 0 {
+				matches++
+				ev.merge(oneEv)
+			} else if firstErrs == nil {
+				firstErrs = e
+			}
+		}
+		switch {
+		case matches == 0 && len(oneOf) == 1:
+			errs = append(errs, firstErrs...)
+		case matches == 0:
+			errs = append(errs, fail("oneOf", "must match exactly one of the allowed schemas, matches none"))
+		case matches > 1:
+			errs = append(errs, fail("oneOf", "must match exactly one of the allowed schemas, matches %d", matches))
+		}
+	}
+	if not, ok := s["not"]; ok {
+		if e, _ := sub(inst, not, ptr, kw+"/not"); len(e) == 0 {
+			errs = append(errs, fail("not", "must not match the schema"))
+		}
+	}
+	if cond, ok := s["if"]; ok {
+		e, ifEv := sub(inst, cond, ptr, kw+"/if")
+		branch := "else"
+		if len(e) == 0 {
+			branch = "then"
+			ev.merge(ifEv)
+		}
+		if bs, ok := s[branch]; ok {
+			be, branchEv := sub(inst, bs, ptr, kw+"/"+branch)
+			errs = append(errs, be...)
+			ev.merge(branchEv)
+		}
+	}
+
+	// Unevaluated locations, after every other keyword
+	if obj, ok := inst.(map[string]interface{}); ok {
+		if unevaluated, ok := s["unevaluatedProperties"]; ok {
+			for _, k := range sortedKeys(obj) {
+				if ev.props[k] {
+					continue
+				}
+				if unevaluated == false {
+					errs = append(errs, schemaError{Pointer: ptr + "/" + pointerToken(k), Keyword: kw + "/unevaluatedProperties", Message: fmt.Sprintf("property %q is not allowed", k)})
+				} else {
+					e, _ := sub(obj[k], unevaluated, ptr+"/"+pointerToken(k), kw+"/unevaluatedProperties")
+					errs = append(errs, e...)
+				}
+				ev.markProp(k)
+			}
+		}
+	}
+	if arr, ok := inst.([]interface{}); ok {
+		if unevaluated, ok := s["unevaluatedItems"]; ok && !ev.allItems {
+			for i := ev.items; i < len(arr); i++ {
+				if ev.matched[i] {
+					continue
+				}
+				e, _ := sub(arr[i], unevaluated, ptr+"/"+strconv.Itoa(i), kw+"/unevaluatedItems")
+				errs = append(errs, e...)
+			}
+			ev.allItems = true
+		}
+	}
+
+	return errs, ev
+}
+
+func (l *schemaLoader) regexp(pattern string) (*regexp.Regexp, error) {
+	if re, ok := l.regexps[pattern]; ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	l.regexps[pattern] = re
+	return re, nil
+}
+
+// jsonType returns the JSON Schema type of a value
+func jsonType(v interface{}) string {
+	switch n := v.(type) {
+	case float64:
+		if n == float64(int64(n)) {
+			return "integer"
+		}
+		return "number"
+	}
+	return jqType(v)
+}
+
+func matchesType(v interface{}, t interface{}) bool {
+	switch tt := t.(type) {
+	case string:
+		actual := jsonType(v)
+		return actual == tt || (tt == "number" && actual == "integer")
+	case []interface{}:
+		for _, item := range tt {
+			if matchesType(v, item) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func describeTypes(t interface{}) string {
+	if list, ok := t.([]interface{}); ok {
+		names := make([]string, len(list))
+		for i, item := range list {
+			names[i] = fmt.Sprint(item)
+		}
+		return strings.Join(names, " or ")
+	}
+	return fmt.Sprint(t)
+}
+
+var (
+	uuidRe     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hostnameRe = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+)
+
+// checkFormat validates the common string formats; unknown formats are annotations only
+func checkFormat(format, s string) string {
+	valid := true
+	switch format {
+	case "date-time":
+		_, err := time.Parse(time.RFC3339Nano, s)
+		valid = err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", s)
+		valid = err == nil
+	case "time":
+		_, err := time.Parse("15:04:05Z07:00", s)
+		if err != nil {
+			_, err = time.Parse("15:04:05.999999999Z07:00", s)
+		}
+		valid = err == nil
+	case "email":
+		addr, err := mail.ParseAddress(s)
+		valid = err == nil && addr.Address == s
+	case "ipv4":
+		ip := net.ParseIP(s)
+		valid = ip != nil && ip.To4() != nil && !strings.Contains(s, ":")
+	case "ipv6":
+		ip := net.ParseIP(s)
+		valid = ip != nil && strings.Contains(s, ":")
+	case "uri":
+		u, err := url.Parse(s)
+		valid = err == nil && u.Scheme != ""
+	case "uuid":
+		valid = uuidRe.MatchString(s)
+	case "hostname":
+		valid = len(s) <= 253 && hostnameRe.MatchString(s)
+	default:
+		return ""
+	}
+	if valid {
+		return ""
+	}
+	return fmt.Sprintf("must be a valid %s", format)
+}
+
+// ===== YAML source lines =====
+
+// yamlPointerLines maps the JSON pointers of a YAML document to their line numbers
+func yamlPointerLines(content string) map[string]int {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return nil
+	}
+	lines := make(map[string]int)
+	var walk func(n *yaml.Node, ptr string)
+	walk = func(n *yaml.Node, ptr string) {
+		if n.Kind == yaml.AliasNode && n.Alias != nil {
+			n = n.Alias
+		}
+		lines[ptr] = n.Line
+		switch n.Kind {
+		case yaml.DocumentNode:
+			if len(n.Content) > 0 {
+				walk(n.Content[0], ptr)
+			}
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key := ptr + "/" + pointerToken(n.Content[i].Value)
+				walk(n.Content[i+1], key)
+				// Point at the key rather than the value
+				lines[key] = n.Content[i].Line
+			}
+		case yaml.SequenceNode:
+			for i, item := range n.Content {
+				walk(item, ptr+"/"+strconv.Itoa(i))
+			}
+		}
+	}
+	walk(&root, "")
+	return lines
+}
+
+// ===== Rendering =====
+
+// schemaErrorsByPointer groups error messages by the pointer they apply to
+func schemaErrorsByPointer(report *schemaReport) map[string][]string {
+	if report == nil {
+		return nil
+	}
+	byPointer := make(map[string][]string)
+	for _, e := range report.Errors {
+		byPointer[e.Pointer] = append(byPointer[e.Pointer], e.Message)
+	}
+	return byPointer
+}
+
+// renderSchemaSummary renders the validation summary panel shown above a document
+func renderSchemaSummary(report *schemaReport) string {
+	if report == nil {
+		return ""
+	}
+	var sb strings.Builder
+	schema := html.EscapeString(report.Schema)
+	switch {
+	case report.LoadError != "":
+		sb.WriteString(fmt.Sprintf(`<div class="schema-summary schema-unavailable"><strong>⚠️ Schema unavailable</strong> <code>%s</code> (%s): %s</div>`,
+			schema, report.Source, html.EscapeString(report.LoadError)))
+	case len(report.Errors) == 0:
+		sb.WriteString(fmt.Sprintf(`<div class="schema-summary schema-valid"><strong>✓ Valid</strong> against <code>%s</code> (%s)</div>`, schema, report.Source))
+	default:
+		plural := "s"
+		if len(report.Errors) == 1 {
+			plural = ""
+		}
+		sb.WriteString(fmt.Sprintf(`<details class="schema-summary schema-invalid" open><summary><strong>✗ %d validation error%s</strong> against <code>%s</code> (%s)</summary><ul>`,
+			len(report.Errors), plural, schema, report.Source))
+		for _, e := range report.Errors {
+			location := e.Pointer
+			if location == "" {
+				location = "/"
+			}
+			if e.Line > 0 {
+				location = fmt.Sprintf("line %d · %s", e.Line, location)
+			}
+			sb.WriteString(fmt.Sprintf(`<li><a href="#" class="schema-pointer" data-pointer="%s" data-line="%d" onclick="revealSchemaError(this); return false;">%s</a> %s <span class="schema-keyword">%s</span></li>`,
+				html.EscapeString(e.Pointer), e.Line, html.EscapeString(location), html.EscapeString(e.Message), html.EscapeString(e.Keyword)))
+		}
+		sb.WriteString(withNonce(`</ul></details>
+<script>
+function revealSchemaError(link) {
+    const node = Array.from(document.querySelectorAll('.json-tree li[data-pointer]')).find(li => li.dataset.pointer === link.dataset.pointer);
+    if (node) {
+        let parent = node;
+        while (parent) {
+            parent.classList.remove('json-collapsed');
+            const toggle = parent.querySelector(':scope > .json-toggle');
+            if (toggle) toggle.textContent = '▼';
+            parent = parent.parentElement ? parent.parentElement.closest('li') : null;
+        }
+        node.scrollIntoView({ block: 'center' });
+        node.classList.add('schema-flash');
+        setTimeout(() => node.classList.remove('schema-flash'), 1500);
+        return;
+    }
+    const line = parseInt(link.dataset.line, 10);
+    const row = line && document.querySelectorAll('.line-numbers-rows > span')[line - 1];
+    if (row) row.scrollIntoView({ block: 'center' });
+}
+</script>`))
+	}
+	return sb.String()
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ===== Schema Validation Tests =====
+
+// validateJSON validates a JSON document against a JSON schema held in memory
+func validateJSON(t *testing.T, schema, doc string) []schemaError {
+	t.Helper()
+	s, err := parseStructured(schema, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := parseStructured(doc, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newSchemaLoader().validate(d, s, "file:///schemas/test.json")
+}
+
+func TestSchemaKeywords(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema string
+		doc    string
+		errors []string // "pointer: message" of each expected error
+	}{
+		{"type", `{"type": "string"}`, `1`, []string{": expected string, got integer"}},
+		{"integer is a number", `{"type": "number"}`, `3`, nil},
+		{"type list", `{"type": ["string", "null"]}`, `null`, nil},
+		{"enum", `{"enum": ["a", "b"]}`, `"c"`, []string{`: must be one of ["a","b"]`}},
+		{"const", `{"const": {"a": 1}}`, `{"a": 1}`, nil},
+		{"bounds", `{"minimum": 1, "exclusiveMaximum": 10, "multipleOf": 2}`, `10`, []string{": must be < 10"}},
+		{"decimal multipleOf", `{"multipleOf": 0.1}`, `0.3`, nil},
+		{"decimal multipleOf mismatch", `{"multipleOf": 0.1}`, `0.35`, []string{": must be a multiple of 0.1"}},
+		{"large multipleOf quotient", `{"multipleOf": 0.5}`, `1e300`, nil},
+		{"string", `{"minLength": 2, "pattern": "^[a-z]+$"}`, `"A"`, []string{": must be at least 2 characters", `: must match pattern "^[a-z]+$"`}},
+		{"format", `{"format": "date"}`, `"2024-13-01"`, []string{": must be a valid date"}},
+		{"unknown format", `{"format": "color"}`, `"nope"`, nil},
+		{"required and properties", `{"required": ["name"], "properties": {"port": {"type": "integer"}}}`, `{"port": "80"}`,
+			[]string{`: missing required property "name"`, "/port: expected integer, got string"}},
+		{"additionalProperties", `{"properties": {"a": {}}, "additionalProperties": false}`, `{"a": 1, "b/c": 2}`, []string{`/b~1c: property "b/c" is not allowed`}},
+		{"patternProperties", `{"patternProperties": {"^x-": {"type": "string"}}, "additionalProperties": false}`, `{"x-a": 1}`, []string{"/x-a: expected string, got integer"}},
+		{"dependentRequired", `{"dependentRequired": {"tls": ["cert"]}}`, `{"tls": true}`, []string{`: property "tls" requires "cert"`}},
+		{"prefixItems and items", `{"prefixItems": [{"type": "string"}], "items": {"type": "number"}}`, `["a", 1, "b"]`, []string{"/2: expected number, got string"}},
+		{"contains", `{"contains": {"const": 1}, "maxContains": 1}`, `[1, 1]`, []string{": must contain at most 1 matching item(s), found 2"}},
+		{"uniqueItems", `{"uniqueItems": true}`, `[1, 2, 1]`, []string{": items 0 and 2 are equal"}},
+		{"anyOf", `{"anyOf": [{"type": "string"}, {"type": "boolean"}]}`, `1`, []string{": must match at least one of the allowed schemas"}},
+		{"oneOf", `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, `1`, []string{": must match exactly one of the allowed schemas, matches 2"}},
+		{"not", `{"not": {"type": "null"}}`, `null`, []string{": must not match the schema"}},
+		{"if then else", `{"if": {"properties": {"kind": {"const": "tcp"}}}, "then": {"required": ["port"]}, "else": {"required": ["path"]}}`, `{"kind": "tcp"}`, []string{`: missing required property "port"`}},
+		{"$ref and $defs", `{"$defs": {"port": {"type": "integer", "maximum": 65535}}, "properties": {"port": {"$ref": "#/$defs/port"}}}`, `{"port": 70000}`, []string{"/port: must be <= 65535"}},
+		{"$anchor", `{"$defs": {"n": {"$anchor": "name", "type": "string"}}, "items": {"$ref": "#name"}}`, `["a", 2]`, []string{"/1: expected string, got integer"}},
+		{"recursive $ref", `{"properties": {"children": {"items": {"$ref": "#"}}, "id": {"type": "integer"}}}`, `{"children": [{"children": [{"id": "x"}]}]}`, []string{"/children/0/children/0/id: expected integer, got string"}},
+		{"unevaluatedProperties", `{"allOf": [{"properties": {"a": {}}}], "unevaluatedProperties": false}`, `{"a": 1, "b": 2}`, []string{`/b: property "b" is not allowed`}},
+		{"unevaluatedItems", `{"prefixItems": [{}], "unevaluatedItems": false}`, `[1, 2]`, []string{"/1: no value is allowed here"}},
+		{"unevaluatedItems after contains", `{"contains": {"type": "string"}, "unevaluatedItems": {"type": "number"}}`, `["a", 1, true]`, []string{"/2: expected number, got boolean"}},
+		{"$dynamicRef", `{"$id": "https://example.com/root", "$ref": "list", "$defs": {
+			"strings": {"$dynamicAnchor": "items", "type": "string"},
+			"list": {"$id": "list", "items": {"$dynamicRef": "#items"}, "$defs": {"any": {"$dynamicAnchor": "items"}}}}}`,
+			`["a", 2]`, []string{"/1: expected string, got integer"}},
+		{"false schema", `{"properties": {"legacy": false}}`, `{"legacy": 1}`, []string{"/legacy: no value is allowed here"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := validateJSON(t, tt.schema, tt.doc)
+			var got []string
+			for _, e := range errs {
+				got = append(got, e.Pointer+": "+e.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.errors, "\n") {
+				t.Errorf("errors:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.errors, "\n"))
+			}
+		})
+	}
+}
+
+func TestFetchRemoteSchema(t *testing.T) {
+	release := make(chan struct{})
+	slowStarted := make(chan struct{}, 2)
+	var slowHits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow.json" {
+			slowHits.Add(1)
+			slowStarted <- struct{}{}
+			<-release
+		}
+		w.Write([]byte(`{"type": "string"}`))
+	}))
+	defer server.Close()
+	saved := schemaClient
+	defer func() { schemaClient = saved }()
+	schemaClient = server.Client()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := fetchRemoteSchema(server.URL + "/slow.json"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	<-slowStarted
+
+	// Another host's schema does not wait for the slow download
+	done := make(chan error)
+	go func() {
+		_, err := fetchRemoteSchema(server.URL + "/fast.json")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fetch blocked by a slow download")
+	}
+
+	close(release)
+	wg.Wait()
+	if n := slowHits.Load(); n != 1 {
+		t.Errorf("slow schema downloaded %d times, want 1", n)
+	}
+}
+
+func TestFetchRemoteSchemaFailures(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	// Files cannot make the server reach its own network
+	if _, err := fetchRemoteSchema(server.URL + "/local.json"); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("loopback schema: %v", err)
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("loopback server reached %d times", n)
+	}
+
+	saved := schemaClient
+	defer func() { schemaClient = saved }()
+	schemaClient = server.Client()
+	uri := server.URL + "/down.json"
+	for i := 0; i < 3; i++ {
+		if _, err := fetchRemoteSchema(uri); err == nil {
+			t.Fatal("a failed download should be an error")
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Errorf("failed schema downloaded %d times, want 1", n)
+	}
+	remoteSchemaCacheMu.Lock()
+	remoteSchemaCache[uri].retry = time.Now().Add(-time.Second)
+	remoteSchemaCacheMu.Unlock()
+	fetchRemoteSchema(uri)
+	if n := hits.Load(); n != 2 {
+		t.Errorf("after the retry delay: downloaded %d times, want 2", n)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"*.json", "/a/b/package.json", true},
+		{"package.json", "/a/package.json", true},
+		{"**/.github/workflows/*.yml", "/repo/.github/workflows/ci.yml", true},
+		{"**/.github/workflows/*.yml", "/repo/.github/workflows/sub/ci.yml", false},
+		{"config/*.yaml", "/srv/app/config/db.yaml", true},
+		{"/etc/**/*.conf.json", "/etc/a/b/x.conf.json", true},
+		{"/etc/*.json", "/srv/etc/x.json", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.path); got != tt.match {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+}
+
+func TestSchemaDiscovery(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		writeFiles(t, dir, map[string]string{name: content})
+		return filepath.Join(dir, name)
+	}
+	write("schemas/service.json", `{"type": "object", "required": ["name"], "properties": {"port": {"$ref": "defs.json#/port"}}}`)
+	write("schemas/defs.json", `{"port": {"type": "integer"}}`)
+
+	oldConfig := appConfig
+	defer func() { appConfig = oldConfig }()
+	appConfig = &Config{Schemas: map[string]string{"services/*.yaml": filepath.Join(dir, "schemas/service.json")}}
+
+	t.Run("$schema", func(t *testing.T) {
+		path := write("a.json", `{"$schema": "schemas/service.json", "port": "x"}`)
+		content, _ := renderFile(path)
+		for _, want := range []string{`2 validation errors`, `missing required property &#34;name&#34;`, `data-pointer="/port" class="schema-node-invalid"`} {
+			if !strings.Contains(content, want) {
+				t.Errorf("missing %q", want)
+			}
+		}
+	})
+
+	t.Run("sidecar", func(t *testing.T) {
+		path := write("b.json", `{"name": "ok"}`)
+		write("b.schema.json", `{"required": ["name"]}`)
+		content, _ := renderFile(path)
+		if !strings.Contains(content, "✓ Valid") || !strings.Contains(content, "(sidecar)") {
+			t.Error("Should validate against the sidecar schema")
+		}
+	})
+
+	t.Run("config glob on YAML", func(t *testing.T) {
+		path := write("services/web.yaml", "name: web\nport: eighty\n")
+		content, _ := renderFile(path)
+		if !strings.Contains(content, "line 2 · /port") || !strings.Contains(content, "(config)") {
+			t.Errorf("Should report the YAML line of the error: %s", content[:min(len(content), 600)])
+		}
+	})
+
+	t.Run("missing schema", func(t *testing.T) {
+		path := write("c.json", `{"$schema": "nowhere.json"}`)
+		content, _ := renderFile(path)
+		if !strings.Contains(content, "Schema unavailable") {
+			t.Error("Should report an unavailable schema")
+		}
+	})
+
+	t.Run("no schema", func(t *testing.T) {
+		path := write("d.json", `{"$schema": "https://json-schema.org/draft/2020-12/schema"}`)
+		content, _ := renderFile(path)
+		if strings.Contains(content, "schema-summary") || strings.Contains(content, "data-pointer") {
+			t.Error("Schemas themselves and files without schema are not validated")
+		}
+	})
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+)
+
+// Inline event handlers of the viewer's pages. A nonce cannot cover
+// attributes, so the page policy allows exactly these by hash; the tests
+// check the list against the sources.
+var inlineHandlers = []string{
+	"clearQuery()",
+	"closeLightbox()",
+	"collapseAll()",
+	"copyCode(this)",
+	"copyTOML()",
+	"copyYAML()",
+	"downloadAs('json', true)",
+	"downloadAs(this.dataset.to, false)",
+	"expandAll()",
+	"exportDocument('html')",
+	"exportDocument('pdf')",
+	"filterCSV(this.value)",
+	"filterJSONL()",
+	"filterLog()",
+	"if (event.key === 'Enter') runQuery()",
+	"if(event.key==='Enter')largeFileGoto(this.value)",
+	"if(event.key==='Enter')largeFileSearch()",
+	"jumpToJSONLError(); return false;",
+	"largeFileGoto(document.getElementById('lf-goto').value)",
+	"largeFileSearch()",
+	"loadMoreJSONL()",
+	"nextMatch()",
+	"openLightbox(this.src, this.alt)",
+	"openLinkGraph()",
+	"prevMatch()",
+	"printDocument()",
+	"revealSchemaError(this); return false;",
+	"runQuery()",
+	"searchJson(this.value)",
+	"setJSONLView('list')",
+	"setJSONLView('table')",
+	"setTheme(this.value)",
+	"siteSearch(this.value)",
+	"textSearch(this.value, 'searchable-content')",
+	"this.parentElement.classList.toggle('json-collapsed');this.textContent=this.textContent==='▼'?'▶':'▼'",
+	"toggleFollow()",
+	"toggleSidebar()",
+}
+
+var inlineHandlerHashes = func() string {
+	hashes := make([]string, len(inlineHandlers))
+	for i, h := range inlineHandlers {
+		sum := sha256.Sum256([]byte(h))
+		hashes[i] = "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+	}
+	return strings.Join(hashes, " ")
+}()
+
+// nonceMarker stands for the nonce in the viewer's own script tags until
+// the response is written. It is random so that rendered content cannot
+// forge it, and as long as a nonce so that Content-Length stays right.
+var nonceMarker = newNonce()
+
+// newNonce returns 128 random bits in base64
+func newNonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// withNonce marks the <script> tags of a template as the viewer's own.
+// Call it on templates before content is put in them.
+func withNonce(tmpl string) string {
+	return strings.ReplaceAll(tmpl, "<script>", `<script nonce="`+nonceMarker+`">`)
+}
+
+// stripNonce removes the nonce markers of a page written to disk or stdout
+func stripNonce(page string) string {
+	return strings.ReplaceAll(page, ` nonce="`+nonceMarker+`"`, "")
+}
+
+// pageCSP is the policy of every response: scripts from the viewer itself,
+// remote images and media as Markdown can show them, no plugins or framing
+func pageCSP(nonce string) string {
+	return "default-src 'self'; " +
+		"script-src 'self' 'nonce-" + nonce + "' 'unsafe-hashes' " + inlineHandlerHashes + "; " +
+		"style-src 'self' 'unsafe-inline'; " +
+		"img-src * data: blob:; media-src * data: blob:; font-src 'self' data:; connect-src 'self'; " +
+		"object-src 'none'; base-uri 'none'; form-action 'self'; frame-ancestors 'none'"
+}
+
+// Policy of files under trustedRoots, whose own scripts and handlers run
+const trustedPageCSP = "frame-ancestors 'none'; base-uri 'self'"
+
+// Policy of exported HTML documents: inline KaTeX in an opaque origin
+const exportCSP = "sandbox allow-scripts allow-popups allow-modals; default-src 'none'; script-src 'unsafe-inline'; " +
+	"style-src 'unsafe-inline'; img-src * data:; font-src data:; frame-ancestors 'none'"
+
+// securityHeaders sets the security headers of every response and gives
+// each one a fresh script nonce. Handlers may replace the policy.
+func securityHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce := newNonce()
+		h := w.Header()
+		h.Set("Content-Security-Policy", pageCSP(nonce))
+		h.Set("X-Content-Type-Options", "nosniff")
+		// URLs hold local paths
+		h.Set("Referrer-Policy", "no-referrer")
+		h.Set("X-Frame-Options", "DENY")
+		h.Set("Cross-Origin-Opener-Policy", "same-origin")
+		next.ServeHTTP(&nonceWriter{ResponseWriter: w, nonce: []byte(nonce)}, r)
+	})
+}
+
+// nonceWriter puts the nonce of the response in place of nonceMarker
+type nonceWriter struct {
+	http.ResponseWriter
+	nonce []byte
+}
+
+// WriteHeader leaves the policy out of 304 responses: browsers would pair
+// its nonce with the cached page, written with another one
+func (w *nonceWriter) WriteHeader(status int) {
+	if status == http.StatusNotModified {
+		w.Header().Del("Content-Security-Policy")
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *nonceWriter) Write(p []byte) (int, error) {
+	marker := []byte(nonceMarker)
+	if bytes.Contains(p, marker) {
+		p = bytes.ReplaceAll(p, marker, w.nonce)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush keeps /tail streaming through the middleware
+func (w *nonceWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *nonceWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
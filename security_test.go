@@ -0,0 +1,144 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// ===== Security Header Tests =====
+
+var cspNonceRe = regexp.MustCompile(`'nonce-([^']+)'`)
+
+func TestSecurityHeaders(t *testing.T) {
+	dir := writeTree(t, map[string]string{
+		"doc.md":   "# Doc\n\n<script>alert(1)</script>\n",
+		"logo.svg": "<svg></svg>",
+		"logo.png": string(testPNG),
+	})
+	server := securityHeaders(newRouter())
+	get := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		server.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	var nonces []string
+	for i := 0; i < 2; i++ {
+		rec := get(filepath.Join(dir, "doc.md"))
+		h := rec.Header()
+		for name, want := range map[string]string{
+			"X-Content-Type-Options": "nosniff",
+			"Referrer-Policy":        "no-referrer",
+			"X-Frame-Options":        "DENY",
+		} {
+			if got := h.Get(name); got != want {
+				t.Errorf("%s = %q, want %q", name, got, want)
+			}
+		}
+		csp := h.Get("Content-Security-Policy")
+		for _, want := range []string{"frame-ancestors 'none'", "object-src 'none'", "'unsafe-hashes' 'sha256-"} {
+			if !strings.Contains(csp, want) {
+				t.Errorf("Content-Security-Policy %q lacks %q", csp, want)
+			}
+		}
+		m := cspNonceRe.FindStringSubmatch(csp)
+		if m == nil {
+			t.Fatalf("no nonce in %q", csp)
+		}
+		body := rec.Body.String()
+		if !strings.Contains(body, `<script nonce="`+m[1]+`">`) {
+			t.Error("the page scripts should carry the nonce of the response")
+		}
+		if strings.Contains(body, nonceMarker) || strings.Contains(body, "<script>") {
+			t.Error("every inline script of the page should have the nonce")
+		}
+		nonces = append(nonces, m[1])
+	}
+	if nonces[0] == nonces[1] {
+		t.Error("each response should get a fresh nonce")
+	}
+
+	rec := get("/asset?path=" + url.QueryEscape(filepath.Join(dir, "logo.svg")))
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename=logo.svg` {
+		t.Errorf("SVG Content-Disposition = %q", got)
+	}
+	if csp := rec.Header().Get("Content-Security-Policy"); !strings.HasPrefix(csp, "sandbox;") {
+		t.Errorf("SVG Content-Security-Policy = %q", csp)
+	}
+	rec = get("/asset?path=" + url.QueryEscape(filepath.Join(dir, "logo.png")))
+	if got := rec.Header().Get("Content-Disposition"); got != "" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("PNG Content-Disposition = %q", got)
+	}
+
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{TrustedRoots: []string{dir}}
+	if csp := get(filepath.Join(dir, "doc.md")).Header().Get("Content-Security-Policy"); csp != trustedPageCSP {
+		t.Errorf("trusted page Content-Security-Policy = %q", csp)
+	}
+	if got := get("/asset?path=" + url.QueryEscape(filepath.Join(dir, "logo.svg"))).Header().Get("Content-Disposition"); got != "" {
+		t.Errorf("trusted SVG Content-Disposition = %q", got)
+	}
+}
+
+func TestCDNHosts(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	// Only the hosts of the templates are proxied, even when cached
+	other := filepath.Join(getCacheDir(), "evil.example", "x.js")
+	if err := os.MkdirAll(filepath.Dir(other), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(other, []byte("alert(1)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/cdn/evil.example/x.js", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("unknown host: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestStripNonce(t *testing.T) {
+	page := stripNonce(buildHTML("Doc", "/doc.md", renderText("text"), "text"))
+	if strings.Contains(page, "nonce=") || !strings.Contains(page, "<script>") {
+		t.Error("pages written out should have plain script tags")
+	}
+}
+
+// TestInlineHandlersListed keeps inlineHandlers in step with the handlers
+// written in the sources
+func TestInlineHandlersListed(t *testing.T) {
+	listed := map[string]bool{}
+	for _, h := range inlineHandlers {
+		listed[h] = true
+	}
+	attrRe := regexp.MustCompile(`\bon[a-z]+="([^"]*)"`)
+	files, _ := filepath.Glob("*.go")
+	used := map[string]bool{}
+	for _, file := range files {
+		if strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range attrRe.FindAllStringSubmatch(string(src), -1) {
+			used[m[1]] = true
+			if !listed[m[1]] {
+				t.Errorf("%s: handler %q is missing from inlineHandlers", file, m[1])
+			}
+		}
+	}
+	for h := range listed {
+		if !used[h] {
+			t.Errorf("inlineHandlers lists %q, which is no longer used", h)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Server timeouts. Writes get enough time for PDF exports; /tail streams
+// lift their write deadline.
+const (
+	readHeaderTimeout = 10 * time.Second
+	writeTimeout      = 2 * time.Minute
+	idleTimeout       = 2 * time.Minute
+	shutdownTimeout   = 10 * time.Second
+)
+
+type drainKey struct{}
+
+// newServer returns the HTTP server of a handler, with timeouts and a drain
+// channel closed on shutdown for the streams to end
+func newServer(addr string, h http.Handler) *http.Server {
+	drain := make(chan struct{})
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           h,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		BaseContext: func(net.Listener) context.Context {
+			return context.WithValue(context.Background(), drainKey{}, drain)
+		},
+	}
+	srv.RegisterOnShutdown(func() { close(drain) })
+	return srv
+}
+
+// draining returns a channel closed when the server of a request shuts
+// down; nil, never ready, outside newServer
+func draining(r *http.Request) <-chan struct{} {
+	drain, _ := r.Context().Value(drainKey{}).(chan struct{})
+	return drain
+}
+
+// serve serves ln, and the plain HTTP servers of others on their own
+// address, until ctx is done or one of them fails, then shuts them all down:
+// no new connections, streams ended, in-flight requests given
+// shutdownTimeout to finish
+func serve(ctx context.Context, srv *http.Server, ln net.Listener, secure bool, others ...*http.Server) error {
+	errc := make(chan error, 1+len(others))
+	go func() {
+		if secure {
+			errc <- srv.ServeTLS(ln, "", "")
+		} else {
+			errc <- srv.Serve(ln)
+		}
+	}()
+	for _, other := range others {
+		go func() {
+			if err := other.ListenAndServe(); err != http.ErrServerClosed {
+				errc <- fmt.Errorf("%s: %w", other.Addr, err)
+			}
+		}()
+	}
+	var err error
+	select {
+	case err = <-errc:
+		if len(others) == 0 {
+			return err
+		}
+	case <-ctx.Done():
+		slog.Info("shutting down", "timeout", shutdownTimeout)
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	for _, s := range append([]*http.Server{srv}, others...) {
+		if shutdownErr := s.Shutdown(shutdownCtx); shutdownErr != nil {
+			s.Close()
+			if err == nil {
+				err = fmt.Errorf("shutdown: %w", shutdownErr)
+			}
+		}
+	}
+	return err
+}
+
+// listenFDsStart is the first file descriptor passed by systemd
+const listenFDsStart = 3
+
+// activationListener returns the socket passed by systemd socket
+// activation, nil when the server was started otherwise
+func activationListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, nil
+	}
+	// Not for the children of the server
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		return nil, fmt.Errorf("socket activation passed %d sockets, want 1", n)
+	}
+	return fileListener(os.NewFile(listenFDsStart, "systemd socket"))
+}
+
+// fileListener returns the listener of a socket file, which it closes
+func fileListener(f *os.File) (net.Listener, error) {
+	defer f.Close()
+	ln, err := net.FileListener(f)
+	if err != nil {
+		return nil, fmt.Errorf("socket activation: %w", err)
+	}
+	return ln, nil
+}
+
+// handleHealth serves /healthz for service managers and load balancers
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status": "ok",
+		"uptime": int64(time.Since(startTime).Seconds()),
+	})
+}
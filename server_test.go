@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ===== Server Tests =====
+
+func TestServeShutdown(t *testing.T) {
+	logs := captureLogs(t, slog.LevelInfo)
+	logPath := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(logPath, []byte("started\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.Write([]byte("done"))
+	})
+	mux.HandleFunc("/tail", handleTail)
+
+	srv := newServer("", mux)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, ln, false) }()
+	base := "http://" + ln.Addr().String()
+
+	client := &http.Client{Timeout: 10 * time.Second, Transport: &http.Transport{DisableKeepAlives: true}}
+	stream, err := client.Get(base + "/tail?path=" + url.QueryEscape(logPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Body.Close()
+	slow := make(chan string, 1)
+	go func() {
+		resp, err := client.Get(base + "/slow")
+		if err != nil {
+			slow <- err.Error()
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		slow <- string(body)
+	}()
+	<-started
+
+	cancel()
+	// The stream ends on shutdown, the in-flight request still completes
+	if _, err := io.ReadAll(stream.Body); err != nil {
+		t.Errorf("stream: %v", err)
+	}
+	close(release)
+	if got := <-slow; got != "done" {
+		t.Errorf("in-flight request = %q, want done", got)
+	}
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve() = %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("serve() did not return")
+	}
+	if _, err := client.Get(base + "/slow"); err == nil {
+		t.Error("new connections should be refused after shutdown")
+	}
+	if !strings.Contains(logs.String(), "shutting down") {
+		t.Errorf("logs = %s", logs)
+	}
+
+	if srv.ReadHeaderTimeout == 0 || srv.WriteTimeout == 0 || srv.IdleTimeout == 0 {
+		t.Error("the server should have timeouts")
+	}
+}
+
+func TestServeOthers(t *testing.T) {
+	captureLogs(t, slog.LevelInfo)
+	freeAddr := func() string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		return ln.Addr().String()
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer("", http.NotFoundHandler())
+	redirect := newServer(freeAddr(), redirectToHTTPS("localhost:4443"))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	served := make(chan error, 1)
+	go func() { served <- serve(ctx, srv, ln, false, redirect) }()
+
+	client := &http.Client{
+		Timeout:       10 * time.Second,
+		Transport:     &http.Transport{DisableKeepAlives: true},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://" + redirect.Addr + "/a.md"); err == nil {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMovedPermanently {
+		t.Errorf("redirect status = %d", resp.StatusCode)
+	}
+
+	// Both servers stop together
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Errorf("serve() = %v", err)
+		}
+	case <-time.After(shutdownTimeout):
+		t.Fatal("serve() did not return")
+	}
+	if _, err := client.Get("http://" + redirect.Addr + "/a.md"); err == nil {
+		t.Error("the redirect server should be shut down")
+	}
+
+	// A server that cannot listen stops the others
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	if ln, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	srv = newServer("", http.NotFoundHandler())
+	err = serve(context.Background(), srv, ln, false, newServer(busy.Addr().String(), redirectToHTTPS("localhost:4443")))
+	if err == nil || !strings.Contains(err.Error(), busy.Addr().String()) {
+		t.Errorf("serve() with a busy address = %v", err)
+	}
+	if _, err := client.Get("http://" + ln.Addr().String()); err == nil {
+		t.Error("the main server should be shut down")
+	}
+}
+
+func TestActivationListener(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if ln, err := activationListener(); ln != nil || err != nil {
+		t.Errorf("sockets of another process: %v, %v", ln, err)
+	}
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "2")
+	if _, err := activationListener(); err == nil {
+		t.Error("several sockets should be refused")
+	}
+	if os.Getenv("LISTEN_PID") != "" || os.Getenv("LISTEN_FDS") != "" {
+		t.Error("the activation variables should be cleared")
+	}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tcp.Close()
+	f, err := tcp.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := fileListener(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	if ln.Addr().String() != tcp.Addr().String() {
+		t.Errorf("listener on %s, want %s", ln.Addr(), tcp.Addr())
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{Auth: &AuthConfig{Mode: "token", Token: "s3cret"}}
+	auth, err := newAuthenticator(appConfig.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	auth.middleware(newRouter()).ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"status":"ok"`) {
+		t.Errorf("healthz without credentials: %d %s", rec.Code, rec.Body)
+	}
+}
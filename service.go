@@ -0,0 +1,149 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Names of the systemd units and of the launchd agent
+const (
+	serviceName  = "file-viewer"
+	launchdLabel = "local.file-viewer"
+)
+
+// serviceFile is a file written by install-service
+type serviceFile struct {
+	path, content string
+}
+
+// serviceFiles returns the files starting the server at login for an OS,
+// and the commands enabling them. socket uses systemd socket activation:
+// the server starts on the first connection to listen.
+func serviceFiles(goos, home, exe, listen string, args []string, socket bool) ([]serviceFile, []string, error) {
+	args = append([]string{exe, "--listen", listen}, args...)
+	switch goos {
+	case "linux":
+		dir := filepath.Join(home, ".config", "systemd", "user")
+		quoted := make([]string, len(args))
+		for i, a := range args {
+			quoted[i] = systemdQuote(a)
+		}
+		unit := "[Unit]\nDescription=File Viewer\n"
+		if socket {
+			unit += "Requires=" + serviceName + ".socket\n"
+		}
+		unit += "\n[Service]\nExecStart=" + strings.Join(quoted, " ") + "\nRestart=on-failure\n"
+		if !socket {
+			unit += "\n[Install]\nWantedBy=default.target\n"
+		}
+		files := []serviceFile{{filepath.Join(dir, serviceName+".service"), unit}}
+		enable := serviceName + ".service"
+		if socket {
+			files = append(files, serviceFile{filepath.Join(dir, serviceName+".socket"),
+				"[Unit]\nDescription=File Viewer socket\n\n[Socket]\nListenStream=" + listen + "\n\n[Install]\nWantedBy=sockets.target\n"})
+			enable = serviceName + ".socket"
+		}
+		return files, []string{"systemctl --user daemon-reload", "systemctl --user enable --now " + enable}, nil
+
+	case "darwin":
+		if socket {
+			return nil, nil, fmt.Errorf("socket activation needs systemd")
+		}
+		path := filepath.Join(home, "Library", "LaunchAgents", launchdLabel+".plist")
+		var sb strings.Builder
+		sb.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>
+	<string>` + launchdLabel + `</string>
+	<key>ProgramArguments</key>
+	<array>
+`)
+		for _, a := range args {
+			sb.WriteString("\t\t<string>" + html.EscapeString(a) + "</string>\n")
+		}
+		sb.WriteString(`	</array>
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<dict>
+		<key>SuccessfulExit</key>
+		<false/>
+	</dict>
+	<key>StandardErrorPath</key>
+	<string>` + html.EscapeString(filepath.Join(home, "Library", "Logs", serviceName+".log")) + `</string>
+</dict>
+</plist>
+`)
+		return []serviceFile{{path, sb.String()}}, []string{fmt.Sprintf("launchctl bootstrap gui/%d %s", os.Getuid(), path)}, nil
+	}
+	return nil, nil, fmt.Errorf("no service manager supported on %s; use systemd (Linux) or launchd (macOS)", goos)
+}
+
+// systemdQuote quotes an ExecStart argument: specifiers and variables are
+// escaped, arguments with spaces or quotes double-quoted
+func systemdQuote(s string) string {
+	s = strings.NewReplacer("%", "%%", "$", "$$").Replace(s)
+	if !strings.ContainsAny(s, " \t\"'\\;") {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// runInstallService writes a systemd user unit or a launchd agent running
+// the server with the arguments left after the flags
+func runInstallService(args []string) int {
+	flags := flag.NewFlagSet("install-service", flag.ContinueOnError)
+	listen := flags.String("listen", appConfig.listenAddr(), "address of the service")
+	socket := flags.Bool("socket", false, "systemd socket activation: start the server on the first connection")
+	printOnly := flags.Bool("print", false, "print the files instead of writing them")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	files, commands, err := serviceFiles(runtime.GOOS, home, exe, *listen, flags.Args(), *socket)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	for _, f := range files {
+		if *printOnly {
+			fmt.Printf("# %s\n%s\n", f.path, f.content)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if err := os.WriteFile(f.path, []byte(f.content), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Wrote %s\n", f.path)
+	}
+	fmt.Println("Start it now and at every login with:")
+	for _, c := range commands {
+		fmt.Println("  " + c)
+	}
+	return 0
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// ===== Service Tests =====
+
+func TestServiceFiles(t *testing.T) {
+	files, commands, err := serviceFiles("linux", "/home/me", "/opt/file viewer/file-viewer", "127.0.0.1:4120", []string{"--auth", "token"}, false)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("linux: %d files, %v", len(files), err)
+	}
+	unit := files[0]
+	if unit.path != "/home/me/.config/systemd/user/file-viewer.service" {
+		t.Errorf("unit path = %s", unit.path)
+	}
+	for _, want := range []string{
+		`ExecStart="/opt/file viewer/file-viewer" --listen 127.0.0.1:4120 --auth token` + "\n",
+		"WantedBy=default.target",
+	} {
+		if !strings.Contains(unit.content, want) {
+			t.Errorf("unit lacks %q:\n%s", want, unit.content)
+		}
+	}
+	if commands[len(commands)-1] != "systemctl --user enable --now file-viewer.service" {
+		t.Errorf("commands = %v", commands)
+	}
+
+	files, commands, err = serviceFiles("linux", "/home/me", "/usr/bin/file-viewer", "127.0.0.1:4120", nil, true)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("linux socket: %d files, %v", len(files), err)
+	}
+	if !strings.Contains(files[0].content, "Requires=file-viewer.socket") || strings.Contains(files[0].content, "[Install]") {
+		t.Errorf("socket-activated unit:\n%s", files[0].content)
+	}
+	if files[1].path != "/home/me/.config/systemd/user/file-viewer.socket" || !strings.Contains(files[1].content, "ListenStream=127.0.0.1:4120\n") {
+		t.Errorf("socket unit %s:\n%s", files[1].path, files[1].content)
+	}
+	if commands[len(commands)-1] != "systemctl --user enable --now file-viewer.socket" {
+		t.Errorf("commands = %v", commands)
+	}
+
+	files, _, err = serviceFiles("darwin", "/Users/me", "/usr/local/bin/file-viewer", "127.0.0.1:4120", []string{"--log-format", "a&b"}, false)
+	if err != nil || len(files) != 1 {
+		t.Fatalf("darwin: %d files, %v", len(files), err)
+	}
+	if files[0].path != "/Users/me/Library/LaunchAgents/local.file-viewer.plist" {
+		t.Errorf("plist path = %s", files[0].path)
+	}
+	for _, want := range []string{"<string>/usr/local/bin/file-viewer</string>", "<string>a&amp;b</string>", "<key>RunAtLoad</key>"} {
+		if !strings.Contains(files[0].content, want) {
+			t.Errorf("plist lacks %q", want)
+		}
+	}
+	if _, _, err := serviceFiles("darwin", "/Users/me", "/usr/local/bin/file-viewer", "127.0.0.1:4120", nil, true); err == nil {
+		t.Error("socket activation needs systemd")
+	}
+	if _, _, err := serviceFiles("windows", `C:\Users\me`, `C:\file-viewer.exe`, "127.0.0.1:4120", nil, false); err == nil {
+		t.Error("windows has no supported service manager")
+	}
+}
+
+func TestSystemdQuote(t *testing.T) {
+	for in, want := range map[string]string{
+		"/usr/bin/file-viewer": "/usr/bin/file-viewer",
+		"/opt/my app/fv":       `"/opt/my app/fv"`,
+		"100%":                 "100%%",
+		"$HOME":                "$$HOME",
+		`say "hi"`:             `"say \"hi\""`,
+	} {
+		if got := systemdQuote(in); got != want {
+			t.Errorf("systemdQuote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
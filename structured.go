@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// structuredFormat returns json, yaml or toml for files holding a structured
+// document, or "" for anything else
+func structuredFormat(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// parseStructured parses a JSON, YAML or TOML document into the values
+// encoding/json produces: map[string]interface{}, []interface{}, string,
+// float64, bool and nil. A YAML stream with several documents becomes an array.
+func parseStructured(content, format string) (interface{}, error) {
+	switch format {
+	case "json":
+		var v interface{}
+		if err := json.Unmarshal([]byte(content), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+
+	case "yaml":
+		dec := yaml.NewDecoder(strings.NewReader(content))
+		var docs []interface{}
+		for {
+			var v interface{}
+			err := dec.Decode(&v)
+			if err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+				return nil, err
+			}
+			docs = append(docs, normalizeValue(v))
+		}
+		switch len(docs) {
+		case 0:
+			return nil, nil
+		case 1:
+			return docs[0], nil
+		}
+		return docs, nil
+
+	case "toml":
+		var v map[string]interface{}
+		if _, err := toml.Decode(content, &v); err != nil {
+			return nil, err
+		}
+		return normalizeValue(v), nil
+	}
+	return nil, fmt.Errorf("unsupported format: %s", format)
+}
+
+// normalizeValue converts YAML and TOML decoder output to JSON-compatible values
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case nil, string, bool:
+		return val
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = normalizeValue(item)
+		}
+		return out
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = normalizeValue(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	case []map[string]interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	case float64:
+		// JSON has no NaN or Infinity
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			return strconv.FormatFloat(val, 'g', -1, 64)
+		}
+		return val
+	case float32:
+		return normalizeValue(float64(val))
+	case int:
+		return float64(val)
+	case int64:
+		return float64(val)
+	case uint64:
+		return float64(val)
+	case time.Time:
+		// TOML local dates and times carry a marker zone
+		switch val.Location().String() {
+		case "date-local":
+			return val.Format("2006-01-02")
+		case "time-local":
+			return val.Format("15:04:05.999999999")
+		case "datetime-local":
+			return val.Format("2006-01-02T15:04:05.999999999")
+		}
+		return val.Format(time.RFC3339Nano)
+	case fmt.Stringer:
+		return val.String()
+	}
+
+	// Other slices and integer types
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		out := make([]interface{}, rv.Len())
+		for i := range out {
+			out[i] = normalizeValue(rv.Index(i).Interface())
+		}
+		return out
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return float64(rv.Uint())
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// ===== TLS Tests =====
+
+func TestEnsureLocalCert(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tls")
+	certFile, keyFile, caFile, err := ensureLocalCert(dir, []string{"localhost", "127.0.0.1", "devbox"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(keyFile); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v", info.Mode(), err)
+	}
+
+	caPEM, _ := os.ReadFile(caFile)
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caPEM) {
+		t.Fatal("ca.pem holds no certificate")
+	}
+	leaf, _, err := loadKeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"localhost", "127.0.0.1", "devbox"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	// Kept while it covers the hosts, renewed with the same CA otherwise
+	before, _ := os.ReadFile(certFile)
+	if _, _, _, err := ensureLocalCert(dir, []string{"localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.ReadFile(certFile); string(after) != string(before) {
+		t.Error("a valid certificate should be kept")
+	}
+	if _, _, _, err := ensureLocalCert(dir, []string{"localhost", "192.168.1.20"}); err != nil {
+		t.Fatal(err)
+	}
+	leaf, _, _ = loadKeyPair(certFile, keyFile)
+	if _, err := leaf.Verify(x509.VerifyOptions{DNSName: "192.168.1.20", Roots: roots}); err != nil {
+		t.Errorf("renewed certificate: %v", err)
+	}
+	if again, _ := os.ReadFile(caFile); string(again) != string(caPEM) {
+		t.Error("the CA should be kept")
+	}
+}
+
+func TestServeTLS(t *testing.T) {
+	certFile, keyFile, caFile, err := ensureLocalCert(t.TempDir(), []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})}
+	if err := configureTLS(srv, certFile, keyFile); err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.ServeTLS(ln, "", "")
+	defer srv.Close()
+
+	caPEM, _ := os.ReadFile(caFile)
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(caPEM)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}, ForceAttemptHTTP2: true}}
+	resp, err := client.Get("https://" + ln.Addr().String() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2", resp.Proto)
+	}
+
+	if err := configureTLS(&http.Server{}, certFile, filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("a missing key should be reported")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	for _, tt := range []struct {
+		listen, host, target, location string
+	}{
+		{"0.0.0.0:4120", "localhost:8080", "/tmp/a.md?line=2", "https://localhost:4120/tmp/a.md?line=2"},
+		{":443", "192.168.1.20", "/", "https://192.168.1.20/"},
+		{":4120", "[::1]:80", "/x", "https://[::1]:4120/x"},
+	} {
+		req := httptest.NewRequest("GET", tt.target, nil)
+		req.Host = tt.host
+		rec := httptest.NewRecorder()
+		redirectToHTTPS(tt.listen).ServeHTTP(rec, req)
+		if rec.Code != http.StatusMovedPermanently || rec.Header().Get("Location") != tt.location {
+			t.Errorf("%s%s: %d %s, want %s", tt.host, tt.target, rec.Code, rec.Header().Get("Location"), tt.location)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Host = "rebound.example"
+	rec := httptest.NewRecorder()
+	redirectToHTTPS(":4120").ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("unknown host: status = %d", rec.Code)
+	}
+}
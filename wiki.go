@@ -0,0 +1,707 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"html"
+	"io/fs"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	vaultTTL        = 10 * time.Second // Vault indexes are rebuilt after this
+	maxVaultEntries = 20000            // Files and directories walked per vault
+	backlinkContext = 160              // Characters of the linking line shown
+)
+
+// Directories marking the root of a vault: Obsidian's settings, or a repository
+var vaultMarkers = []string{".obsidian", ".git"}
+
+var (
+	// Code spans are matched first so links inside them are left as they are
+	wikiLinkRe = regexp.MustCompile("`[^`]+`|(!?)\\[\\[([^\\[\\]|#\\n]*)(#[^\\[\\]|\\n]*)?(?:\\|([^\\[\\]\\n]*))?\\]\\]")
+	mdLinkRe   = regexp.MustCompile(`\[[^\]]*\]\(<?([^)\s>]+)>?(?:\s+"[^"]*")?\)`)
+	fenceRe    = regexp.MustCompile("^\\s*(```|~~~)")
+)
+
+// vaultLink is a link from one Markdown file of a vault to another file
+type vaultLink struct {
+	Source  string `json:"source"`
+	Target  string `json:"target"` // Resolved path, or the link text when broken
+	Line    int    `json:"line"`
+	Context string `json:"context,omitempty"`
+	Broken  bool   `json:"broken,omitempty"`
+}
+
+// vault indexes the files below a root for wiki-link resolution and backlinks
+type vault struct {
+	root      string
+	built     time.Time
+	names     map[string][]string // Lower-case file name -> paths
+	notes     []string            // Markdown files, sorted
+	links     []vaultLink
+	truncated bool
+	modTimes  map[string]int64  // Markdown file -> modification time
+	linkSums  map[string]uint64 // File -> hash of its links and backlinks
+	gens      map[string]uint64 // File -> generation, moved when its sum changes
+}
+
+var (
+	vaultsMu    sync.Mutex
+	vaults      = map[string]*vault{}
+	vaultBuilds = map[string]chan struct{}{} // Closed when the index of a root is built
+)
+
+// findVaultRoot returns the vault holding dir: the deepest configured vault,
+// else the nearest parent with a vault marker, else dir itself
+func findVaultRoot(dir string) string {
+	dir = filepath.Clean(dir)
+	best := ""
+	for _, root := range appConfig.Vaults {
+		root = filepath.Clean(expandHome(root))
+		if (dir == root || strings.HasPrefix(dir, root+string(filepath.Separator))) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best != "" {
+		return best
+	}
+	for d := dir; ; d = filepath.Dir(d) {
+		for _, marker := range vaultMarkers {
+			if info, err := os.Stat(filepath.Join(d, marker)); err == nil && info.IsDir() {
+				return d
+			}
+		}
+		if filepath.Dir(d) == d {
+			return dir
+		}
+	}
+}
+
+// expandHome replaces a leading ~ with the home directory
+func expandHome(p string) string {
+	if p == "~" || strings.HasPrefix(p, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, p[1:])
+		}
+	}
+	return p
+}
+
+// getVault returns the index of a vault root, built again once it is stale.
+// Roots are indexed outside the lock, once at a time: requests arriving
+// meanwhile get the stale index, or wait when there is none yet.
+func getVault(root string) *vault {
+	vaultsMu.Lock()
+	v, ok := vaults[root]
+	if ok && time.Since(v.built) < vaultTTL {
+		vaultsMu.Unlock()
+		return v
+	}
+	if done, building := vaultBuilds[root]; building {
+		vaultsMu.Unlock()
+		if ok {
+			return v
+		}
+		<-done
+		vaultsMu.Lock()
+		defer vaultsMu.Unlock()
+		return vaults[root]
+	}
+	done := make(chan struct{})
+	vaultBuilds[root] = done
+	vaultsMu.Unlock()
+
+	prev := v
+	v = indexVault(root)
+	v.carryGenerations(prev)
+	vaultsMu.Lock()
+	vaults[root] = v
+	delete(vaultBuilds, root)
+	vaultsMu.Unlock()
+	close(done)
+	return v
+}
+
+// lastVault returns the latest index of a root without waiting for a walk:
+// nil when there is none yet. Missing and stale indexes are built in the
+// background.
+func lastVault(root string) *vault {
+	vaultsMu.Lock()
+	v, ok := vaults[root]
+	_, building := vaultBuilds[root]
+	stale := !ok || time.Since(v.built) >= vaultTTL
+	vaultsMu.Unlock()
+	if stale && !building {
+		go getVault(root)
+	}
+	return v
+}
+
+// indexVault walks a root, skipping hidden directories, and reads the links
+// of every Markdown file
+func indexVault(root string) *vault {
+	v := &vault{root: root, built: time.Now(), names: map[string][]string{}, modTimes: map[string]int64{}}
+	entries := 0
+	filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entries++; entries > maxVaultEntries {
+			v.truncated = true
+			return filepath.SkipAll
+		}
+		if p != root && (strings.HasPrefix(d.Name(), ".") || d.Name() == "node_modules") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || !d.Type().IsRegular() {
+			return nil
+		}
+		name := strings.ToLower(d.Name())
+		v.names[name] = append(v.names[name], p)
+		if isMarkdownFile(p) {
+			v.notes = append(v.notes, p)
+			if info, err := d.Info(); err == nil {
+				v.modTimes[p] = info.ModTime().UnixNano()
+			}
+		}
+		return nil
+	})
+	sort.Strings(v.notes)
+	for _, note := range v.notes {
+		v.links = append(v.links, v.readLinks(note)...)
+	}
+	v.sumLinks()
+	return v
+}
+
+// sumLinks hashes, for each file, the links it makes and those of the notes
+// linking to it, with their modification time for the titles shown
+func (v *vault) sumLinks() {
+	sums := map[string]hash.Hash64{}
+	add := func(p string, l vaultLink) {
+		if sums[p] == nil {
+			sums[p] = fnv.New64a()
+		}
+		fmt.Fprintf(sums[p], "%s\x00%s\x00%d\x00%t\x00%d\x00%s\n", l.Source, l.Target, l.Line, l.Broken, v.modTimes[l.Source], l.Context)
+	}
+	for _, l := range v.links {
+		add(l.Source, l)
+		if !l.Broken {
+			add(l.Target, l)
+		}
+	}
+	v.linkSums = make(map[string]uint64, len(sums))
+	for p, h := range sums {
+		v.linkSums[p] = h.Sum64()
+	}
+}
+
+// carryGenerations takes the generations of the previous index of the root
+// and moves those of the files whose links or backlinks changed since
+func (v *vault) carryGenerations(prev *vault) {
+	v.gens = map[string]uint64{}
+	if prev == nil {
+		return
+	}
+	maps.Copy(v.gens, prev.gens)
+	for p, sum := range v.linkSums {
+		if prev.linkSums[p] != sum {
+			v.gens[p]++
+		}
+	}
+	for p := range prev.linkSums {
+		if _, ok := v.linkSums[p]; !ok {
+			v.gens[p]++
+		}
+	}
+}
+
+// resolve finds the file a wiki-link target names: by file name, .md added
+// when it has no extension, and by path suffix when it has a folder; the
+// file closest to fromDir wins
+func (v *vault) resolve(target, fromDir string) (string, bool) {
+	target = strings.Trim(filepath.ToSlash(strings.TrimSpace(target)), "/")
+	if target == "" {
+		return "", false
+	}
+	lower := strings.ToLower(target)
+	keys := []string{lower}
+	if !isMarkdownFile(lower) {
+		keys = append([]string{lower + ".md", lower + ".markdown"}, keys...)
+	}
+	for _, key := range keys {
+		var matches []string
+		for _, p := range v.names[strings.ToLower(pathBase(key))] {
+			rel := strings.ToLower(filepath.ToSlash(p))
+			if !strings.Contains(key, "/") || strings.HasSuffix(rel, "/"+key) {
+				matches = append(matches, p)
+			}
+		}
+		if len(matches) > 0 {
+			sort.Slice(matches, func(i, j int) bool {
+				di, dj := linkDistance(fromDir, matches[i]), linkDistance(fromDir, matches[j])
+				if di != dj {
+					return di < dj
+				}
+				return matches[i] < matches[j]
+			})
+			return matches[0], true
+		}
+	}
+	return "", false
+}
+
+// pathBase is path.Base for targets written with forward slashes
+func pathBase(p string) string {
+	if i := strings.LastIndex(p, "/"); i >= 0 {
+		return p[i+1:]
+	}
+	return p
+}
+
+// linkDistance counts the directories between fromDir and a file
+func linkDistance(fromDir, p string) int {
+	rel, err := filepath.Rel(fromDir, filepath.Dir(p))
+	if err != nil {
+		return 1 << 20
+	}
+	if rel == "." {
+		return 0
+	}
+	return len(strings.Split(rel, string(filepath.Separator)))
+}
+
+// readLinks returns the wiki-links and relative Markdown links of a note,
+// outside code blocks
+func (v *vault) readLinks(note string) []vaultLink {
+	f, err := os.Open(note)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var links []vaultLink
+	dir := filepath.Dir(note)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	inFence := false
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if fenceRe.MatchString(line) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		context := strings.TrimSpace(line)
+		if r := []rune(context); len(r) > backlinkContext {
+			context = string(r[:backlinkContext]) + "…"
+		}
+		add := func(target string, resolved string, ok bool) {
+			link := vaultLink{Source: note, Target: resolved, Line: n, Context: context}
+			if !ok {
+				link.Target, link.Broken = target, true
+			}
+			if link.Target != note {
+				links = append(links, link)
+			}
+		}
+		for _, m := range wikiLinkRe.FindAllStringSubmatch(line, -1) {
+			if strings.HasPrefix(m[0], "`") || strings.TrimSpace(m[2]) == "" {
+				continue
+			}
+			resolved, ok := v.resolve(m[2], dir)
+			add(strings.TrimSpace(m[2]), resolved, ok)
+		}
+		for _, m := range mdLinkRe.FindAllStringSubmatch(line, -1) {
+			target := strings.SplitN(strings.SplitN(m[1], "#", 2)[0], "?", 2)[0]
+			if target == "" || strings.Contains(target, ":") || !isMarkdownFile(target) {
+				continue
+			}
+			if unescaped, err := url.PathUnescape(target); err == nil {
+				target = unescaped
+			}
+			p := target
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			_, err := os.Stat(p)
+			add(target, filepath.Clean(p), err == nil)
+		}
+	}
+	return links
+}
+
+// renderWikiLink renders [[target#heading|alias]], or ![[image]] as an image;
+// targets not found in the vault are marked broken
+func renderWikiLink(embed bool, target, heading, alias, baseDir string) string {
+	target, heading, alias = strings.TrimSpace(target), strings.TrimSpace(strings.TrimPrefix(heading, "#")), strings.TrimSpace(alias)
+	label := alias
+	if label == "" {
+		label = target
+		if heading != "" {
+			label = strings.TrimSpace(target + " › " + heading)
+			if target == "" {
+				label = heading
+			}
+		}
+	}
+	fragment := ""
+	if strings.HasPrefix(heading, "^") {
+		// Block references keep their id
+		fragment = "#" + url.PathEscape(heading)
+	} else if heading != "" {
+		fragment = "#" + slugify(heading)
+	}
+	if target == "" {
+		return fmt.Sprintf(`<a href="%s" class="wiki-link">%s</a>`, html.EscapeString(fragment), html.EscapeString(label))
+	}
+
+	resolved, ok := "", false
+	if baseDir != "" {
+		resolved, ok = getVault(findVaultRoot(baseDir)).resolve(target, baseDir)
+	}
+	if !ok {
+		return fmt.Sprintf(`<span class="wiki-link wiki-link-broken" title="%s">%s</span>`,
+			html.EscapeString("No file named “"+target+"” in this vault"), html.EscapeString(label))
+	}
+	if embed && isImageFile(resolved) {
+		return fmt.Sprintf(`<img src="/asset?path=%s" alt="%s" class="lightbox-img" onclick="openLightbox(this.src, this.alt)" style="max-width:100%%; cursor: zoom-in;">`,
+			html.EscapeString(url.QueryEscape(resolved)), html.EscapeString(alias))
+	}
+	href := (&url.URL{Path: filepath.ToSlash(resolved)}).EscapedPath() + fragment
+	return fmt.Sprintf(`<a href="%s" class="wiki-link">%s</a>`, html.EscapeString(href), html.EscapeString(label))
+}
+
+// isImageFile reports whether a path is an image shown inline by embeds
+func isImageFile(p string) bool {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".svg", ".webp", ".bmp", ".avif":
+		return true
+	}
+	return false
+}
+
+// noteTitle returns the front matter title of a note, or its name without extension
+func noteTitle(p string) string {
+	name := filepath.Base(p)
+	return pageTitle(p, strings.TrimSuffix(name, filepath.Ext(name)))
+}
+
+// renderBacklinks renders the panel below a note: the notes linking to it and
+// its own links that lead nowhere
+func renderBacklinks(filePath string) string {
+	filePath = filepath.Clean(filePath)
+	v := getVault(findVaultRoot(filepath.Dir(filePath)))
+	var backlinks, broken []vaultLink
+	for _, l := range v.links {
+		if l.Target == filePath && !l.Broken {
+			// A line linking twice is listed once
+			if n := len(backlinks); n == 0 || backlinks[n-1].Source != l.Source || backlinks[n-1].Line != l.Line {
+				backlinks = append(backlinks, l)
+			}
+		}
+		if l.Source == filePath && l.Broken {
+			broken = append(broken, l)
+		}
+	}
+	if len(backlinks) == 0 && len(broken) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("<section class=\"backlinks\">\n")
+	if len(backlinks) > 0 {
+		sb.WriteString(fmt.Sprintf("<h4>🔗 Linked from (%d)</h4>\n<ul>\n", len(backlinks)))
+		for _, l := range backlinks {
+			href := (&url.URL{Path: filepath.ToSlash(l.Source)}).EscapedPath()
+			sb.WriteString(fmt.Sprintf(`<li><a href="%s">%s</a> <small>line %d</small><div class="backlink-context">%s</div></li>`+"\n",
+				html.EscapeString(href), html.EscapeString(noteTitle(l.Source)), l.Line, html.EscapeString(l.Context)))
+		}
+		sb.WriteString("</ul>\n")
+	}
+	if len(broken) > 0 {
+		sb.WriteString(fmt.Sprintf("<h4>⚠ Unresolved links (%d)</h4>\n<ul class=\"backlinks-broken\">\n", len(broken)))
+		for _, l := range broken {
+			sb.WriteString(fmt.Sprintf("<li><code>%s</code> <small>line %d</small></li>\n", html.EscapeString(l.Target), l.Line))
+		}
+		sb.WriteString("</ul>\n")
+	}
+	sb.WriteString("</section>\n")
+	return sb.String()
+}
+
+// graphNode is a file of the link graph; missing nodes stand for broken targets
+type graphNode struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Links     int    `json:"links"`
+	Backlinks int    `json:"backlinks"`
+	Missing   bool   `json:"missing,omitempty"`
+}
+
+type graphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// linkGraph is the /graph response
+type linkGraph struct {
+	Root      string      `json:"root"`
+	Nodes     []graphNode `json:"nodes"`
+	Links     []graphEdge `json:"links"`
+	Broken    []vaultLink `json:"broken"`
+	Truncated bool        `json:"truncated,omitempty"`
+}
+
+// graph returns the notes of the vault and the links between them; a link
+// repeated in a note is one edge
+func (v *vault) graph() linkGraph {
+	g := linkGraph{Root: v.root, Nodes: []graphNode{}, Links: []graphEdge{}, Broken: []vaultLink{}, Truncated: v.truncated}
+	index := map[string]int{}
+	node := func(id, title string, missing bool) int {
+		if i, ok := index[id]; ok {
+			return i
+		}
+		index[id] = len(g.Nodes)
+		g.Nodes = append(g.Nodes, graphNode{ID: id, Title: title, Missing: missing})
+		return index[id]
+	}
+	for _, note := range v.notes {
+		node(note, noteTitle(note), false)
+	}
+
+	seen := map[graphEdge]bool{}
+	for _, l := range v.links {
+		target := l.Target
+		if l.Broken {
+			g.Broken = append(g.Broken, l)
+			target = "missing:" + l.Target
+			node(target, l.Target, true)
+		} else if _, ok := index[target]; !ok {
+			// Attachments are not part of the graph
+			continue
+		}
+		edge := graphEdge{Source: l.Source, Target: target}
+		if seen[edge] {
+			continue
+		}
+		seen[edge] = true
+		g.Links = append(g.Links, edge)
+		g.Nodes[index[l.Source]].Links++
+		g.Nodes[index[target]].Backlinks++
+	}
+	return g
+}
+
+// handleGraph serves the link graph of the vault holding path as JSON, or
+// with format=html as an interactive page
+func handleGraph(w http.ResponseWriter, r *http.Request) {
+	p := r.URL.Query().Get("path")
+	if p == "" {
+		writeError(w, r, http.StatusBadRequest, "Missing path parameter")
+		return
+	}
+	p = filepath.Clean(p)
+	info, err := os.Stat(p)
+	if err != nil {
+		writeFileError(w, r, err)
+		return
+	}
+	dir := p
+	if !info.IsDir() {
+		dir = filepath.Dir(p)
+	}
+	root := findVaultRoot(dir)
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+		writeJSON(w, http.StatusOK, getVault(root).graph())
+	case "html":
+		content := fmt.Sprintf(`<div id="link-graph" class="link-graph" data-root="%s" data-current="%s"><canvas></canvas><div class="link-graph-info"></div></div>%s`,
+			html.EscapeString(root), html.EscapeString(p), withNonce(graphScript))
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(buildHTML("Link graph · "+filepath.Base(root), root, content, "graph")))
+	default:
+		writeError(w, r, http.StatusBadRequest, "Unsupported format: "+format)
+	}
+}
+
+// Force-directed layout of /graph drawn on a canvas: drag nodes, hover for
+// names, click to open, the current note highlighted, missing notes hollow
+const graphScript = `<script>
+(async function() {
+    const box = document.getElementById('link-graph');
+    const canvas = box.querySelector('canvas');
+    const info = box.querySelector('.link-graph-info');
+    const ctx = canvas.getContext('2d');
+    const res = await fetch('/graph?path=' + encodeURIComponent(box.dataset.root));
+    const data = await res.json();
+    if (!res.ok) { info.textContent = data.error; return; }
+    info.textContent = data.nodes.filter(n => !n.missing).length + ' notes · ' + data.links.length + ' links · ' +
+        data.broken.length + ' broken' + (data.truncated ? ' · vault truncated' : '');
+
+    const byId = {};
+    data.nodes.forEach((n, i) => {
+        const a = 2 * Math.PI * i / data.nodes.length;
+        n.x = Math.cos(a) * 200 + Math.random(); n.y = Math.sin(a) * 200 + Math.random();
+        n.vx = 0; n.vy = 0; n.i = i; byId[n.id] = n;
+    });
+    // The layout stops once nodes move less than settled pixels per tick,
+    // or after maxTicks; above exactLimit nodes, repulsion uses a grid
+    const settled = 0.05, maxTicks = 1000, exactLimit = 400, cellSize = 120;
+    const edges = data.links.map(l => ({ s: byId[l.source], t: byId[l.target] })).filter(e => e.s && e.t);
+    const css = getComputedStyle(document.body);
+    let scale = 1, panX = 0, panY = 0, hover = null, drag = null, moved = false;
+
+    function resize() {
+        canvas.width = box.clientWidth * devicePixelRatio;
+        canvas.height = box.clientHeight * devicePixelRatio;
+    }
+    window.addEventListener('resize', () => { resize(); redraw(); });
+    resize();
+
+    function repel(a, b) {
+        let dx = a.x - b.x, dy = a.y - b.y;
+        const d2 = Math.max(dx * dx + dy * dy, 25);
+        const f = 800 / d2;
+        dx *= f / Math.sqrt(d2); dy *= f / Math.sqrt(d2);
+        a.vx += dx; a.vy += dy; b.vx -= dx; b.vy -= dy;
+    }
+
+    // Moves the nodes one tick and returns their mean movement. Large vaults
+    // only repel the nodes of neighbouring grid cells, far ones barely push.
+    function step() {
+        const nodes = data.nodes;
+        if (nodes.length <= exactLimit) {
+            for (let i = 0; i < nodes.length; i++) {
+                for (let j = i + 1; j < nodes.length; j++) repel(nodes[i], nodes[j]);
+            }
+        } else {
+            const grid = new Map(), key = (x, y) => x + ',' + y;
+            nodes.forEach(n => {
+                n.cx = Math.floor(n.x / cellSize); n.cy = Math.floor(n.y / cellSize);
+                const k = key(n.cx, n.cy);
+                if (!grid.has(k)) grid.set(k, []);
+                grid.get(k).push(n);
+            });
+            nodes.forEach(a => {
+                for (let dx = -1; dx <= 1; dx++) {
+                    for (let dy = -1; dy <= 1; dy++) {
+                        (grid.get(key(a.cx + dx, a.cy + dy)) || []).forEach(b => { if (a.i < b.i) repel(a, b); });
+                    }
+                }
+            });
+        }
+        edges.forEach(e => {
+            const dx = e.t.x - e.s.x, dy = e.t.y - e.s.y;
+            e.s.vx += dx * 0.01; e.s.vy += dy * 0.01; e.t.vx -= dx * 0.01; e.t.vy -= dy * 0.01;
+        });
+        let movement = 0;
+        nodes.forEach(n => {
+            n.vx -= n.x * 0.002; n.vy -= n.y * 0.002;
+            if (n !== drag) { n.x += n.vx; n.y += n.vy; movement += Math.abs(n.vx) + Math.abs(n.vy); }
+            n.vx *= 0.6; n.vy *= 0.6;
+        });
+        return movement / Math.max(nodes.length, 1);
+    }
+
+    function toScreen(n) {
+        return [canvas.width / 2 + (n.x * scale + panX) * devicePixelRatio, canvas.height / 2 + (n.y * scale + panY) * devicePixelRatio];
+    }
+    function radius(n) { return (4 + Math.sqrt(n.backlinks + n.links) * 2) * devicePixelRatio; }
+
+    function draw() {
+        ctx.clearRect(0, 0, canvas.width, canvas.height);
+        const text = css.getPropertyValue('--text-primary') || '#333';
+        const accent = css.getPropertyValue('--link-color') || '#0366d6';
+        ctx.lineWidth = devicePixelRatio;
+        edges.forEach(e => {
+            const near = hover && (e.s === hover || e.t === hover);
+            ctx.strokeStyle = near ? accent : 'rgba(128,128,128,0.35)';
+            const [x1, y1] = toScreen(e.s), [x2, y2] = toScreen(e.t);
+            ctx.beginPath(); ctx.moveTo(x1, y1); ctx.lineTo(x2, y2); ctx.stroke();
+        });
+        data.nodes.forEach(n => {
+            const [x, y] = toScreen(n);
+            ctx.beginPath(); ctx.arc(x, y, radius(n), 0, 2 * Math.PI);
+            if (n.missing) {
+                ctx.strokeStyle = '#d73a49'; ctx.stroke();
+            } else {
+                ctx.fillStyle = n.id === box.dataset.current ? '#e36209' : (n === hover ? accent : 'rgba(128,128,128,0.8)');
+                ctx.fill();
+            }
+            if (n === hover || scale > 1.5 || n.id === box.dataset.current) {
+                ctx.fillStyle = text;
+                ctx.font = (12 * devicePixelRatio) + 'px sans-serif';
+                ctx.fillText(n.title, x + radius(n) + 3, y + 4);
+            }
+        });
+    }
+
+    function nodeAt(ev) {
+        const rect = canvas.getBoundingClientRect();
+        const mx = (ev.clientX - rect.left) * devicePixelRatio, my = (ev.clientY - rect.top) * devicePixelRatio;
+        return data.nodes.find(n => { const [x, y] = toScreen(n); return Math.hypot(x - mx, y - my) <= radius(n) + 3; }) || null;
+    }
+    canvas.addEventListener('mousemove', ev => {
+        if (drag) {
+            moved = true;
+            if (drag === 'pan') { panX += ev.movementX; panY += ev.movementY; redraw(); }
+            else { drag.x += ev.movementX / scale; drag.y += ev.movementY / scale; wake(); }
+            return;
+        }
+        const was = hover;
+        hover = nodeAt(ev);
+        if (hover !== was) redraw();
+        canvas.style.cursor = hover ? 'pointer' : 'grab';
+        canvas.title = hover ? hover.id.replace(/^missing:/, 'Missing: ') : '';
+    });
+    canvas.addEventListener('mousedown', ev => { drag = nodeAt(ev) || 'pan'; moved = false; });
+    window.addEventListener('mouseup', () => {
+        if (drag && drag !== 'pan' && !moved && !drag.missing) location.href = drag.id.split('/').map(encodeURIComponent).join('/');
+        if (drag && drag !== 'pan') wake();
+        drag = null;
+    });
+    canvas.addEventListener('wheel', ev => {
+        ev.preventDefault();
+        scale = Math.min(4, Math.max(0.2, scale * (ev.deltaY < 0 ? 1.1 : 0.9)));
+        redraw();
+    }, { passive: false });
+
+    let ticks = 0, running = false, pending = false;
+    function frame() {
+        const movement = step();
+        draw();
+        if (++ticks < maxTicks && (movement > settled || (drag && drag !== 'pan'))) requestAnimationFrame(frame);
+        else running = false;
+    }
+    // wake restarts the layout, redraw only paints it again
+    function wake() {
+        ticks = 0;
+        if (!running) { running = true; requestAnimationFrame(frame); }
+    }
+    function redraw() {
+        if (running || pending) return;
+        pending = true;
+        requestAnimationFrame(() => { pending = false; draw(); });
+    }
+    wake();
+})();
+</script>`
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// ===== Wiki-link Tests =====
+
+// writeVault creates a vault with an .obsidian marker from name -> content
+func writeVault(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := writeTree(t, files)
+	if err := os.Mkdir(filepath.Join(root, ".obsidian"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestFindVaultRoot(t *testing.T) {
+	root := writeVault(t, map[string]string{"a/b/note.md": ""})
+	if got := findVaultRoot(filepath.Join(root, "a", "b")); got != root {
+		t.Errorf("marker: got %s, want %s", got, root)
+	}
+
+	plain := t.TempDir()
+	if got := findVaultRoot(plain); got != plain {
+		t.Errorf("without marker: got %s, want %s", got, plain)
+	}
+
+	saved := appConfig
+	defer func() { appConfig = saved }()
+	appConfig = &Config{Vaults: []string{filepath.Join(root, "a")}}
+	if got := findVaultRoot(filepath.Join(root, "a", "b")); got != filepath.Join(root, "a") {
+		t.Errorf("configured: got %s", got)
+	}
+}
+
+func TestVaultResolve(t *testing.T) {
+	root := writeVault(t, map[string]string{
+		"Page Name.md":             "",
+		"projects/plan.md":         "",
+		"archive/plan.md":          "",
+		"img/diagram.png":          "",
+		"projects/Readme.markdown": "",
+	})
+	v := indexVault(root)
+	tests := []struct {
+		target, fromDir, want string
+	}{
+		{"Page Name", root, "Page Name.md"},
+		{"page name", root, "Page Name.md"},
+		{"Page Name.md", root, "Page Name.md"},
+		{"plan", filepath.Join(root, "projects"), "projects/plan.md"},
+		{"plan", filepath.Join(root, "archive"), "archive/plan.md"},
+		{"archive/plan", filepath.Join(root, "projects"), "archive/plan.md"},
+		{"diagram.png", root, "img/diagram.png"},
+		{"readme", root, "projects/Readme.markdown"},
+		{"missing", root, ""},
+		{"other/plan", root, ""},
+	}
+	for _, tt := range tests {
+		got, ok := v.resolve(tt.target, tt.fromDir)
+		if tt.want == "" {
+			if ok {
+				t.Errorf("%s: resolved to %s, want broken", tt.target, got)
+			}
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("%s from %s: got %s, want %s", tt.target, tt.fromDir, got, want)
+		}
+	}
+}
+
+func TestGetVaultConcurrent(t *testing.T) {
+	root := writeVault(t, map[string]string{"a.md": "[[b]]", "b.md": "text"})
+	got := make([]*vault, 8)
+	var wg sync.WaitGroup
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i] = getVault(root)
+		}()
+	}
+	wg.Wait()
+	for i, v := range got {
+		if v != got[0] || len(v.notes) != 2 {
+			t.Errorf("getVault() #%d = %p with %d notes, want the one index %p", i, v, len(v.notes), got[0])
+		}
+	}
+}
+
+func TestRenderMarkdownWikiLinks(t *testing.T) {
+	root := writeVault(t, map[string]string{
+		"Page Name.md":   "# Page\n",
+		"my_notes__x.md": "",
+		"pic.png":        string(testPNG),
+	})
+	result := renderMarkdown("See [[Page Name]], [[Page Name#Some Heading|the heading]], [[my_notes__x]], [[#Local]], [[Nowhere]], ![[pic.png]] and `[[code]]`.", root)
+	for _, want := range []string{
+		`<a href="` + filepath.ToSlash(root) + `/Page%20Name.md" class="wiki-link">Page Name</a>`,
+		`Page%20Name.md#some-heading" class="wiki-link">the heading</a>`,
+		`my_notes__x.md" class="wiki-link">my_notes__x</a>`,
+		`<a href="#local" class="wiki-link">Local</a>`,
+		`<span class="wiki-link wiki-link-broken" title="No file named “Nowhere” in this vault">Nowhere</span>`,
+		`<img src="/asset?path=` + url.QueryEscape(filepath.Join(root, "pic.png")) + `"`,
+		`<code>[[code]]</code>`,
+	} {
+		if !strings.Contains(result, want) {
+			t.Errorf("expected %q in:\n%s", want, result)
+		}
+	}
+}
+
+func TestBacklinksAndGraph(t *testing.T) {
+	root := writeVault(t, map[string]string{
+		"index.md":    "# Index\n\nStart with [[alpha]] and [beta](sub/beta.md).\n\n```\n[[not a link]]\n```\n",
+		"alpha.md":    "---\ntitle: Alpha Note\n---\nBack to [[index]], see [[ghost]] and [[alpha]].\n",
+		"sub/beta.md": "Links to [[alpha|A]] twice: [[alpha]].\n",
+	})
+	alpha := filepath.Join(root, "alpha.md")
+
+	panel := renderBacklinks(alpha)
+	for _, want := range []string{
+		`🔗 Linked from (2)`,
+		`<a href="` + filepath.ToSlash(filepath.Join(root, "index.md")) + `">index</a> <small>line 3</small>`,
+		`<div class="backlink-context">Start with [[alpha]] and [beta](sub/beta.md).</div>`,
+		`⚠ Unresolved links (1)`,
+		`<code>ghost</code> <small>line 4</small>`,
+	} {
+		if !strings.Contains(panel, want) {
+			t.Errorf("expected %q in:\n%s", want, panel)
+		}
+	}
+	if renderBacklinks(filepath.Join(root, "sub", "beta.md")) == "" {
+		t.Error("beta is linked from the index")
+	}
+
+	rec := httptest.NewRecorder()
+	handleGraph(rec, httptest.NewRequest("GET", "/graph?path="+url.QueryEscape(alpha), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var g linkGraph
+	if err := json.Unmarshal(rec.Body.Bytes(), &g); err != nil {
+		t.Fatal(err)
+	}
+	if g.Root != root {
+		t.Errorf("root = %s", g.Root)
+	}
+	nodes := map[string]graphNode{}
+	for _, n := range g.Nodes {
+		nodes[n.ID] = n
+	}
+	if n := nodes[alpha]; n.Title != "Alpha Note" || n.Backlinks != 2 || n.Links != 2 {
+		t.Errorf("alpha node = %+v", n)
+	}
+	if n, ok := nodes["missing:ghost"]; !ok || !n.Missing {
+		t.Errorf("broken target should be a missing node: %+v", g.Nodes)
+	}
+	if len(g.Links) != 5 {
+		t.Errorf("links = %+v, want 5 distinct edges", g.Links)
+	}
+	if len(g.Broken) != 1 || g.Broken[0].Target != "ghost" || g.Broken[0].Source != alpha {
+		t.Errorf("broken = %+v", g.Broken)
+	}
+
+	rec = httptest.NewRecorder()
+	handleGraph(rec, httptest.NewRequest("GET", "/graph?format=html&path="+url.QueryEscape(alpha), nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `<div id="link-graph"`) {
+		t.Errorf("HTML view status = %d", rec.Code)
+	}
+
+	for query, status := range map[string]int{
+		"":                       http.StatusBadRequest,
+		"path=/nonexistent/a.md": http.StatusNotFound,
+		"path=" + url.QueryEscape(alpha) + "&format=svg": http.StatusBadRequest,
+	} {
+		rec := httptest.NewRecorder()
+		handleGraph(rec, httptest.NewRequest("GET", "/graph?"+query, nil))
+		if rec.Code != status {
+			t.Errorf("%s: status = %d, want %d", query, rec.Code, status)
+		}
+	}
+}